@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"inHouseAd/internal/config"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/cache"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/lib/role"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a subcommand of the binary, run instead of the server with the same config.
+type command func(cfg *config.Config, args []string) error
+
+var commands = map[string]command{
+	"migrate":  runMigrate,
+	"user":     runUser,
+	"category": runCategory,
+	"good":     runGood,
+	"import":   runImport,
+	"seed":     runSeed,
+}
+
+// adminUid is the actor of the changes made by the admin commands: they are not made by a user.
+const adminUid = 0
+
+const (
+	userUsage     = "usage: user create -email <email> [-password <password>] [-role user|admin] | user passwd -email <email> [-password <password>]"
+	categoryUsage = "usage: category list | category create -name <name> | category delete -id <id> [-version <version>]"
+	goodUsage     = "usage: good list -category <id> | good create -name <name> -category <id> [-attributes <json>] | good delete -id <id>"
+)
+
+// userAdmin manages accounts for the admin commands; sign-up only creates users with role.User.
+type userAdmin interface {
+	CreateUser(ctx context.Context, email string, passwordHashed []byte, role string) (int, error)
+	SetPassword(ctx context.Context, email string, passwordHashed []byte) error
+}
+
+// openStorage opens the storage for an admin command and migrates it the way the server does.
+// The memory storage is refused: whatever a command wrote would be gone when it exits.
+func openStorage(cfg *config.Config, log *slog.Logger) (Storage, error) {
+	if cfg.Storage == "memory" {
+		return nil, errors.New("memory storage does not outlive a command, use postgres or sqlite")
+	}
+
+	storage, err := setupStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setupSchema(log, cfg, storage); err != nil {
+		storage.Close()
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// openLists opens the list cache of the servers for a command, so that its writes drop their
+// cached lists. Only a Redis cache is shared with the servers: with the memory one the lists
+// of each server go stale until the TTL, or until postgres notifies the change.
+func openLists(cfg *config.Config, log *slog.Logger, storage Storage) (*cache.Lists, func(), error) {
+	if cfg.Cache.Store != "redis" {
+		return cache.NewLists(log, nil, cfg.Cache.Store, storage, cache.Options{}), func() {}, nil
+	}
+
+	listCache, err := setupCache(cfg.Cache)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closeCache := func() {
+		if err := listCache.Close(); err != nil {
+			log.Error("failed to close cache", sl.Err(err))
+		}
+	}
+
+	return cache.NewLists(log, listCache, cfg.Cache.Store, storage, cache.Options{}), closeCache, nil
+}
+
+// commandLogger keeps the logs of a command on stderr, away from its table or JSON output.
+func commandLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+}
+
+// newFlags makes the flag set of a subcommand with the -o output flag every one of them takes.
+func newFlags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	output := fs.String("o", "table", "output format: table or json")
+	return fs, output
+}
+
+// write prints v as indented JSON or, for the table format, whatever table writes.
+func write(format string, v any, table func(w io.Writer)) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format %q, want table or json", format)
+}
+
+// readPassword returns the -password flag or, when it is empty, the first line of stdin,
+// which keeps the password out of the shell history.
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	password = strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password is required: pass -password or write it to stdin")
+	}
+
+	return password, nil
+}
+
+type userResponse struct {
+	Id    int    `json:"id,omitempty"`
+	Email string `json:"email"`
+	Role  string `json:"role,omitempty"`
+}
+
+// runUser runs the user command: create a user with a role, or reset a password.
+func runUser(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+
+	fs, output := newFlags("user " + args[0])
+	email := fs.String("email", "", "email of the user")
+	password := fs.String("password", "", "password, read from stdin when empty")
+	userRole := fs.String("role", role.User, "role of the new user: user or admin")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if args[0] != "create" && args[0] != "passwd" {
+		return errors.New(userUsage)
+	}
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+	if !role.Valid(*userRole) {
+		return fmt.Errorf("unknown role %q, want user or admin", *userRole)
+	}
+
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	passwordHashed, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	storage, err := openStorage(cfg, commandLogger())
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	ctx := context.Background()
+
+	response := userResponse{Email: *email}
+
+	if args[0] == "create" {
+		response.Id, err = storage.CreateUser(ctx, *email, passwordHashed, *userRole)
+		if err != nil {
+			return err
+		}
+		response.Role = *userRole
+
+		return write(*output, response, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tEMAIL\tROLE")
+			fmt.Fprintf(w, "%d\t%s\t%s\n", response.Id, response.Email, response.Role)
+		})
+	}
+
+	if err := storage.SetPassword(ctx, *email, passwordHashed); err != nil {
+		return fmt.Errorf("user %s: %w", *email, err)
+	}
+
+	return write(*output, response, func(w io.Writer) {
+		fmt.Fprintf(w, "password of %s updated\n", response.Email)
+	})
+}
+
+// runCategory runs the category command: list, create or delete.
+func runCategory(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(categoryUsage)
+	}
+
+	fs, output := newFlags("category " + args[0])
+	name := fs.String("name", "", "name of the new category")
+	id := fs.Int("id", 0, "id of the category")
+	version := fs.Int("version", 0, "version the category must have, the current one when 0")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	log := commandLogger()
+
+	storage, err := openStorage(cfg, log)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	lists, closeLists, err := openLists(cfg, log, storage)
+	if err != nil {
+		return err
+	}
+	defer closeLists()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "list":
+		categories, err := storage.GetCategoryList(ctx)
+		if err != nil {
+			return err
+		}
+
+		return write(*output, categories, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tPARENT\tNAME\tVERSION")
+			for _, c := range categories {
+				parent := "-"
+				if c.ParentId != nil {
+					parent = strconv.Itoa(*c.ParentId)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%d\n", c.CategoryId, parent, c.CategoryName, c.Version)
+			}
+		})
+	case "create":
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+
+		categoryId, err := storage.Create(ctx, *name, adminUid)
+		if err != nil {
+			return err
+		}
+		lists.InvalidateCategories(ctx)
+
+		response := entity.CategoryCreateResponse{CategoryId: categoryId, CategoryName: *name}
+
+		return write(*output, response, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tNAME")
+			fmt.Fprintf(w, "%d\t%s\n", response.CategoryId, response.CategoryName)
+		})
+	case "delete":
+		if *id == 0 {
+			return errors.New("-id is required")
+		}
+
+		if *version == 0 {
+			categories, err := storage.GetCategoryList(ctx)
+			if err != nil {
+				return err
+			}
+			for _, c := range categories {
+				if c.CategoryId == *id {
+					*version = c.Version
+				}
+			}
+		}
+
+		if err := storage.DeleteCategory(ctx, *id, *version); err != nil {
+			return fmt.Errorf("category %d: %w", *id, err)
+		}
+		// Deleting a category hides its goods too.
+		lists.InvalidateCategories(ctx)
+		lists.InvalidateGoods(ctx)
+
+		response := entity.CategoryDeleteResponse{CategoryId: *id, Deleted: true}
+
+		return write(*output, response, func(w io.Writer) {
+			fmt.Fprintf(w, "category %d moved to the trash\n", response.CategoryId)
+		})
+	}
+
+	return errors.New(categoryUsage)
+}
+
+// runGood runs the good command: list the goods of a category, create or delete one.
+func runGood(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(goodUsage)
+	}
+
+	fs, output := newFlags("good " + args[0])
+	name := fs.String("name", "", "name of the new good")
+	categoryId := fs.Int("category", 0, "id of the category")
+	attributes := fs.String("attributes", "", "attribute values of the new good as a JSON object")
+	id := fs.Int("id", 0, "id of the good")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	log := commandLogger()
+
+	storage, err := openStorage(cfg, log)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	lists, closeLists, err := openLists(cfg, log, storage)
+	if err != nil {
+		return err
+	}
+	defer closeLists()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "list":
+		if *categoryId == 0 {
+			return errors.New("-category is required")
+		}
+
+		goods, err := storage.GetGoodList(ctx, *categoryId, nil, false)
+		if err != nil {
+			return err
+		}
+
+		return write(*output, goods, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tNAME\tSKU\tPRICE\tSTOCK\tVERSION")
+			for _, g := range goods {
+				sku, price := "-", "-"
+				if g.Sku != "" {
+					sku = g.Sku
+				}
+				if g.Price != nil {
+					price = strconv.FormatFloat(*g.Price, 'f', 2, 64)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\n", g.GoodId, g.GoodName, sku, price, g.Stock, g.Version)
+			}
+		})
+	case "create":
+		if *name == "" || *categoryId == 0 {
+			return errors.New("-name and -category are required")
+		}
+
+		var values map[string]any
+		if *attributes != "" {
+			if err := json.Unmarshal([]byte(*attributes), &values); err != nil {
+				return fmt.Errorf("-attributes: %w", err)
+			}
+		}
+
+		goodId, categoryName, err := storage.AddGood(ctx, *name, *categoryId, values, adminUid)
+		if err != nil {
+			return err
+		}
+		lists.InvalidateGoods(ctx)
+
+		response := entity.GoodAddResponse{
+			GoodId:         goodId,
+			GoodCategoryId: *categoryId,
+			GoodName:       *name,
+			CategoryName:   categoryName,
+		}
+
+		return write(*output, response, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tNAME\tCATEGORY")
+			fmt.Fprintf(w, "%d\t%s\t%s\n", response.GoodId, response.GoodName, response.CategoryName)
+		})
+	case "delete":
+		if *id == 0 {
+			return errors.New("-id is required")
+		}
+
+		good, err := storage.GetGood(ctx, *id)
+		if err != nil {
+			return fmt.Errorf("good %d: %w", *id, err)
+		}
+
+		if err := storage.DeleteGood(ctx, *id, good.Version, adminUid); err != nil {
+			return fmt.Errorf("good %d: %w", *id, err)
+		}
+		lists.InvalidateGoods(ctx)
+
+		response := entity.GoodDeleteResponse{GoodId: *id, Deleted: true}
+
+		return write(*output, response, func(w io.Writer) {
+			fmt.Fprintf(w, "good %d moved to the trash\n", response.GoodId)
+		})
+	}
+
+	return errors.New(goodUsage)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/config"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/goodsource"
+	"inHouseAd/internal/lib/importer"
+	"inHouseAd/internal/lib/leader"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/lib/tabular"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+const importUsage = "usage: import file -path <file> [-mode transactional|resumable] [-dry-run] [-create-categories] [-mapping <json>] | import source -name <source>"
+
+// runImport runs the import command: a CSV or XLSX file through the importer, or one fetch
+// of a configured good source. Both run in the foreground and print how they went.
+func runImport(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(importUsage)
+	}
+
+	fs, output := newFlags("import " + args[0])
+	path := fs.String("path", "", "CSV or XLSX file to import")
+	mode := fs.String("mode", importer.ModeTransactional, "transactional or resumable")
+	dryRun := fs.Bool("dry-run", false, "check the rows without storing them")
+	createCategories := fs.Bool("create-categories", false, "create the categories the file names")
+	mapping := fs.String("mapping", "", "JSON object from field to column header")
+	name := fs.String("name", "", "name of the good source")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "file":
+		if *path == "" {
+			return errors.New("-path is required")
+		}
+
+		job := entity.ImportJob{
+			Uid:              adminUid,
+			Format:           tabular.FormatByName(*path),
+			Mode:             *mode,
+			DryRun:           *dryRun,
+			CreateCategories: *createCategories,
+		}
+		if job.Format != tabular.FormatCSV && job.Format != tabular.FormatXLSX {
+			return tabular.ErrUnsupportedFormat
+		}
+		if job.Mode != importer.ModeTransactional && job.Mode != importer.ModeResumable {
+			return errors.New("-mode must be transactional or resumable")
+		}
+		if *mapping != "" {
+			if err := json.Unmarshal([]byte(*mapping), &job.Mapping); err != nil {
+				return errors.New("-mapping must be a JSON object of strings")
+			}
+		}
+
+		job, err := importFile(cfg, *path, job)
+		if err != nil {
+			return err
+		}
+
+		return write(*output, job, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tSTATUS\tROWS\tSUCCEEDED\tFAILED\tERROR")
+			fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%s\n", job.ImportId, job.Status, job.TotalRows, job.Succeeded, job.Failed, job.Error)
+			for _, e := range job.Errors {
+				fmt.Fprintf(w, "\trow %d: %s\n", e.Row, e.Message)
+			}
+		})
+	case "source":
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+
+		run, err := importSource(cfg, *name)
+		if err != nil {
+			return err
+		}
+
+		return write(*output, run, func(w io.Writer) {
+			fmt.Fprintln(w, "RUN\tSOURCE\tSTATUS\tFETCHED\tADDED\tREJECTED\tERROR")
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%d\t%s\n", run.RunId, run.Source, run.Status, run.Fetched, run.Added, run.Rejected, run.Error)
+		})
+	}
+
+	return errors.New(importUsage)
+}
+
+// importFile stores the file where the importer reads it from, creates the job and runs it.
+func importFile(cfg *config.Config, path string, job entity.ImportJob) (entity.ImportJob, error) {
+	log := commandLogger()
+
+	storage, err := openStorage(cfg, log)
+	if err != nil {
+		return entity.ImportJob{}, err
+	}
+	defer storage.Close()
+
+	fileStore, err := setupFileStore(cfg.Files)
+	if err != nil {
+		return entity.ImportJob{}, err
+	}
+
+	lists, closeLists, err := openLists(cfg, log, storage)
+	if err != nil {
+		return entity.ImportJob{}, err
+	}
+	defer closeLists()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return entity.ImportJob{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return entity.ImportJob{}, err
+	}
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return entity.ImportJob{}, err
+	}
+	job.BlobKey = "imports/" + hex.EncodeToString(name) + "." + job.Format
+
+	ctx := context.Background()
+
+	if err := fileStore.Put(ctx, job.BlobKey, f, info.Size(), mime.TypeByExtension(filepath.Ext(path))); err != nil {
+		return entity.ImportJob{}, err
+	}
+
+	job.ImportId, err = storage.CreateImportJob(ctx, job)
+	if err != nil {
+		if err := fileStore.Delete(ctx, job.BlobKey); err != nil {
+			log.Error("failed to delete import file", sl.Err(err))
+		}
+		return entity.ImportJob{}, err
+	}
+
+	elector := leader.New(log, storage, leader.Holder(), cfg.Leader.LeaseTTL)
+	importer.New(ctx, log, storage, fileStore, elector, lists, 1, cfg.Import.BatchSize).Run(ctx, job.ImportId)
+
+	return storage.GetImportJob(ctx, job.ImportId)
+}
+
+// importSource fetches a configured good source once, as a manual run, and returns the run.
+func importSource(cfg *config.Config, name string) (entity.FetchRun, error) {
+	jobs, err := setupGoodSources(cfg.Fetch, cfg.Dedup, cfg.Sources)
+	if err != nil {
+		return entity.FetchRun{}, err
+	}
+
+	var job *goodsource.Job
+	for i := range jobs {
+		if jobs[i].Source.Name() == name {
+			job = &jobs[i]
+		}
+	}
+	if job == nil {
+		return entity.FetchRun{}, fmt.Errorf("source %s is not configured", name)
+	}
+
+	log := commandLogger()
+
+	storage, err := openStorage(cfg, log)
+	if err != nil {
+		return entity.FetchRun{}, err
+	}
+	defer storage.Close()
+
+	lists, closeLists, err := openLists(cfg, log, storage)
+	if err != nil {
+		return entity.FetchRun{}, err
+	}
+	defer closeLists()
+
+	ctx := context.Background()
+
+	// RunOnce does not go through the elector, it runs here whichever replica holds the lease.
+	scheduler := goodsource.NewScheduler(log, storage, nil, lists, []goodsource.Job{*job}, fetchOptions(cfg.Fetch))
+	scheduler.RunOnce(ctx, *job, goodsource.TriggerManual)
+
+	runs, err := storage.GetLastFetchRuns(ctx)
+	if err != nil {
+		return entity.FetchRun{}, err
+	}
+
+	run, ok := runs[name]
+	if !ok {
+		return entity.FetchRun{}, fmt.Errorf("source %s: the run was not recorded", name)
+	}
+
+	return run, nil
+}
+
+// fetchOptions are the goodsource.Options of the fetch config.
+func fetchOptions(cfg config.Fetch) goodsource.Options {
+	return goodsource.Options{
+		MaxRetries:       cfg.MaxRetries,
+		BaseDelay:        cfg.BaseDelay,
+		MaxDelay:         cfg.MaxDelay,
+		BreakerThreshold: cfg.BreakerThreshold,
+		BreakerCooldown:  cfg.BreakerCooldown,
+		PollInterval:     cfg.PollInterval,
+	}
+}
@@ -1,20 +1,57 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/cors"
 	"inHouseAd/internal/config"
+	"inHouseAd/internal/entity"
 	"inHouseAd/internal/http-server/handlers/auth/signin"
 	"inHouseAd/internal/http-server/handlers/auth/signup"
+	"inHouseAd/internal/http-server/handlers/goodsservice/attribute"
+	"inHouseAd/internal/http-server/handlers/goodsservice/cachestats"
 	"inHouseAd/internal/http-server/handlers/goodsservice/category"
+	"inHouseAd/internal/http-server/handlers/goodsservice/changes"
+	"inHouseAd/internal/http-server/handlers/goodsservice/exchange"
+	"inHouseAd/internal/http-server/handlers/goodsservice/exportjob"
+	"inHouseAd/internal/http-server/handlers/goodsservice/feed"
 	"inHouseAd/internal/http-server/handlers/goodsservice/good"
+	"inHouseAd/internal/http-server/handlers/goodsservice/image"
+	"inHouseAd/internal/http-server/handlers/goodsservice/importjob"
+	"inHouseAd/internal/http-server/handlers/goodsservice/pool"
+	"inHouseAd/internal/http-server/handlers/goodsservice/source"
+	"inHouseAd/internal/http-server/handlers/goodsservice/trash"
+	"inHouseAd/internal/http-server/middleware/idempotency"
 	"inHouseAd/internal/http-server/middleware/logger"
-	"inHouseAd/internal/lib/goodgetter"
+	"inHouseAd/internal/http-server/middleware/readprimary"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/blobstore/local"
+	"inHouseAd/internal/lib/blobstore/s3"
+	"inHouseAd/internal/lib/cache"
+	"inHouseAd/internal/lib/cache/lru"
+	"inHouseAd/internal/lib/cache/redis"
+	changebus "inHouseAd/internal/lib/changes"
+	"inHouseAd/internal/lib/commerceml"
+	"inHouseAd/internal/lib/cron"
+	"inHouseAd/internal/lib/exporter"
+	feedgen "inHouseAd/internal/lib/feed"
+	"inHouseAd/internal/lib/goodsource"
+	"inHouseAd/internal/lib/importer"
+	"inHouseAd/internal/lib/leader"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/lib/trashpurger"
+	"inHouseAd/internal/storage/memory"
 	"inHouseAd/internal/storage/postgres"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -26,36 +63,159 @@ const (
 func main() {
 	cfg := config.MustLoad("config/config.yaml")
 
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(cfg, os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	log := SetupLogger(cfg.Env)
 
 	log.Info("App started", slog.String("env", cfg.Env))
 	log.Debug("Debugging started")
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	jwtSecret := cfg.Auth.JwtSecret
 
-	storage, err := postgres.New(
-		cfg.Postgres.Host,
-		cfg.Postgres.Port,
-		cfg.Postgres.User,
-		cfg.Postgres.Password,
-		cfg.Postgres.DBName,
-	)
+	storage, err := setupStorage(cfg)
 	if err != nil {
-		log.Error("failed to init storage: ", err)
+		log.Error("failed to init storage", sl.Err(err))
+		os.Exit(1)
+	}
+
+	if err := setupSchema(log, cfg, storage); err != nil {
+		log.Error("failed to check schema", sl.Err(err))
 		os.Exit(1)
 	}
 
 	log.Info("storage successfully initialized")
 
-	go periodicGoodFetch(log, cfg.API.Url, storage)
+	blobStore, err := setupBlobStore(cfg.Media)
+	if err != nil {
+		log.Error("failed to init blob store", sl.Err(err))
+		os.Exit(1)
+	}
+
+	fileStore, err := setupFileStore(cfg.Files)
+	if err != nil {
+		log.Error("failed to init file store", sl.Err(err))
+		os.Exit(1)
+	}
+
+	sourceJobs, err := setupGoodSources(cfg.Fetch, cfg.Dedup, cfg.Sources)
+	if err != nil {
+		log.Error("failed to init good sources", sl.Err(err))
+		os.Exit(1)
+	}
+	elector := leader.New(log, storage, leader.Holder(), cfg.Leader.LeaseTTL)
+
+	listCache, err := setupCache(cfg.Cache)
+	if err != nil {
+		log.Error("failed to init cache", sl.Err(err))
+		os.Exit(1)
+	}
+	lists := cache.NewLists(log, listCache, cfg.Cache.Store, storage, cache.Options{
+		CategoryTTL: cfg.Cache.CategoryTTL,
+		GoodTTL:     cfg.Cache.GoodTTL,
+		Bypass:      postgres.UsesPrimary,
+	})
+
+	scheduler := goodsource.NewScheduler(log, storage, elector, lists, sourceJobs, fetchOptions(cfg.Fetch))
+
+	var background sync.WaitGroup
+	background.Add(3)
+	go func() {
+		defer background.Done()
+		scheduler.Run(ctx)
+	}()
+	go func() {
+		defer background.Done()
+		elector.Run(ctx, "trash-purge", func(ctx context.Context) {
+			periodicTrashPurge(ctx, log, cfg.Trash, storage, blobStore)
+		})
+	}()
+	go func() {
+		defer background.Done()
+		elector.Run(ctx, "idempotency-purge", func(ctx context.Context) {
+			periodicIdempotencyPurge(ctx, log, cfg.Idempotency.PurgeInterval, storage)
+		})
+	}()
+
+	importRunner := importer.New(ctx, log, storage, fileStore, elector, lists, cfg.Import.Workers, cfg.Import.BatchSize)
+	exportRunner := exporter.New(ctx, log, storage, fileStore, elector, cfg.Export.Workers)
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		elector.Run(ctx, "job-resume", func(ctx context.Context) {
+			periodicJobResume(ctx, cfg.Leader.LeaseTTL, importRunner, exportRunner)
+		})
+	}()
+
+	feedCache := feedgen.NewCache(log, storage, blobStore, fileStore, feedgen.Options{
+		ShopName: cfg.Feed.ShopName,
+		Company:  cfg.Feed.Company,
+		ShopURL:  cfg.Feed.ShopURL,
+		GoodURL:  cfg.Feed.GoodURL,
+		Currency: cfg.Feed.Currency,
+	}, cfg.Feed.MaxAge)
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		elector.Run(ctx, "feed-refresh", func(ctx context.Context) {
+			periodicFeedRefresh(ctx, cfg.Feed.CheckInterval, feedCache)
+		})
+	}()
+	go func() {
+		defer background.Done()
+		periodicFeedLoad(ctx, cfg.Feed.CheckInterval, feedCache)
+	}()
+
+	// Every replica checks the replicas it reads from itself.
+	pg, isPostgres := storage.(*postgres.Storage)
+	if isPostgres && len(cfg.Postgres.Replicas) != 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			periodicReplicaCheck(ctx, log, cfg.Postgres.ReplicaCheckInterval, pg)
+		}()
+	}
+
+	exchanger := commerceml.NewExchange(log, storage, lists, cfg.Exchange.Dir, cfg.Exchange.PriceType)
+
+	// The database notifies every catalog change, whoever made it; only postgres can.
+	var bus *changebus.Bus
+	if isPostgres {
+		bus = changebus.NewBus(log, cfg.Changes.Buffer)
+		listener := changebus.NewListener(log, pg, postgres.ChangesChannel, bus, cfg.Changes.ReconnectDelay, cfg.Changes.MaxReconnectDelay)
+
+		events, unsubscribe := bus.Subscribe("cache")
+		context.AfterFunc(ctx, unsubscribe)
+
+		background.Add(2)
+		go func() {
+			defer background.Done()
+			listener.Run(ctx)
+		}()
+		go func() {
+			defer background.Done()
+			lists.Follow(context.Background(), events)
+		}()
+	}
 
 	router := chi.NewRouter()
 
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "PATCH", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", idempotency.Header},
+		ExposedHeaders:   []string{"Link", "ETag", idempotency.ReplayedHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -66,17 +226,70 @@ func main() {
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
 	router.Use(corsHandler.Handler)
+	if isPostgres && len(cfg.Postgres.Replicas) != 0 {
+		router.Use(readprimary.New(log, cfg.Postgres.ReplicaMaxLag))
+	}
+	router.Use(idempotency.New(log, storage, jwtSecret, idempotency.Options{
+		TTL:         cfg.Idempotency.TTL,
+		Wait:        cfg.Idempotency.Wait,
+		LockTimeout: cfg.Idempotency.LockTimeout,
+		MaxBodySize: cfg.Idempotency.MaxBodySize,
+	}))
 
 	router.Post("/user/signup", signup.CreateUser(log, storage))
 	router.Post("/user/signin", signin.LoginUser(log, storage, jwtSecret))
-	router.Post("/category/create", category.Create(log, storage, jwtSecret))
-	router.Patch("/category/update", category.EditCategory(log, storage, jwtSecret))
-	router.Delete("/category/delete/{id}", category.DeleteCategory(log, storage, jwtSecret))
-	router.Post("/good/create/{categoryId}", good.Create(log, storage, jwtSecret))
-	router.Patch("/good/update", good.UpdateGood(log, storage, jwtSecret))
-	router.Delete("/good/delete/{id}", good.DeleteGood(log, storage, jwtSecret))
-	router.Get("/category/list", category.GetCategoryList(log, storage))
-	router.Get("/good/list/{categoryId}", good.GetGoodList(log, storage))
+	router.Post("/category/create", category.Create(log, storage, lists, jwtSecret))
+	router.Patch("/category/update", category.EditCategory(log, storage, lists, jwtSecret, cfg.RequireIfMatch))
+	router.Delete("/category/delete/{id}", category.DeleteCategory(log, storage, lists, jwtSecret, cfg.RequireIfMatch))
+	router.Post("/good/create/{categoryId}", good.Create(log, storage, lists, jwtSecret))
+	router.Patch("/good/update", good.UpdateGood(log, storage, lists, jwtSecret, cfg.RequireIfMatch))
+	router.Delete("/good/delete/{id}", good.DeleteGood(log, storage, lists, jwtSecret, cfg.RequireIfMatch))
+	router.Get("/category/list", category.GetCategoryList(log, lists))
+	router.Get("/good/list/{categoryId}", good.GetGoodList(log, lists, blobStore))
+	router.Get("/good/{id}", good.GetGood(log, storage, blobStore))
+	router.Get("/good/duplicates", good.GetDuplicates(log, storage, cfg.Dedup.Threshold, jwtSecret))
+	router.Get("/good/{id}/history", good.GetHistory(log, storage, jwtSecret))
+	router.Post("/good/{id}/revert/{rev}", good.Revert(log, storage, lists, jwtSecret))
+	router.Put("/good/attributes/{id}", good.SetAttributes(log, storage, lists, jwtSecret, cfg.RequireIfMatch))
+	router.Post("/good/variants/generate/{id}", good.GenerateVariants(log, storage, lists, jwtSecret))
+	router.Get("/good/variants/{id}", good.GetVariantList(log, storage))
+	router.Patch("/good/offer/update", good.UpdateOffer(log, storage, lists, jwtSecret, cfg.RequireIfMatch))
+	router.Post("/good/images/upload/{id}", image.Upload(log, storage, lists, blobStore, cfg.Media.MaxSize, cfg.Media.MaxPixels, cfg.Media.ThumbnailSizes, jwtSecret))
+	router.Get("/good/images/{id}", image.GetImageList(log, storage, blobStore))
+	router.Put("/good/images/order/{id}", image.Reorder(log, storage, lists, blobStore, jwtSecret))
+	router.Patch("/image/primary/{id}", image.SetPrimary(log, storage, lists, blobStore, jwtSecret))
+	router.Delete("/image/delete/{id}", image.DeleteImage(log, storage, lists, blobStore, jwtSecret))
+	router.Get("/trash", trash.GetTrash(log, storage, jwtSecret))
+	router.Post("/import/upload", importjob.Upload(log, storage, importRunner, fileStore, cfg.Import.MaxSize, jwtSecret))
+	router.Get("/import/{id}", importjob.GetImport(log, storage, jwtSecret))
+	router.Get("/export", exportjob.Export(log, storage, cfg.Export.StreamTimeout, jwtSecret))
+	router.Post("/export/job", exportjob.Create(log, storage, exportRunner, jwtSecret))
+	router.Get("/export/job/{id}", exportjob.GetExport(log, storage, jwtSecret))
+	router.Get("/export/job/{id}/file", exportjob.Download(log, storage, fileStore, jwtSecret))
+	router.Get("/feed/{format}", feed.GetFeed(log, feedCache))
+	router.HandleFunc("/exchange/1c", exchange.Exchange(log, storage, exchanger, cfg.Exchange.FileLimit, cfg.Exchange.Timeout, jwtSecret))
+	router.Get("/feed/{format}/report", feed.GetReport(log, feedCache, jwtSecret))
+	router.Get("/source/runs", source.GetRuns(log, storage, jwtSecret))
+	router.Get("/source/states", source.GetStates(log, scheduler, jwtSecret))
+	router.Get("/source/jobs", source.GetJobs(log, scheduler, jwtSecret))
+	router.Post("/source/jobs/{name}/pause", source.Pause(log, scheduler, jwtSecret))
+	router.Post("/source/jobs/{name}/resume", source.Resume(log, scheduler, jwtSecret))
+	router.Post("/source/jobs/{name}/run", source.Run(log, scheduler, jwtSecret))
+	router.Post("/good/restore/{id}", trash.RestoreGood(log, storage, lists, jwtSecret))
+	router.Post("/category/restore/{id}", trash.RestoreCategory(log, storage, lists, jwtSecret))
+	router.Get("/cache/stats", cachestats.GetStats(log, lists, jwtSecret))
+	if isPostgres {
+		router.Get("/storage/pool", pool.GetStats(log, pg, jwtSecret))
+		router.Get("/storage/replicas", pool.GetReplicas(log, pg, jwtSecret))
+		router.Get("/changes", changes.Stream(log, bus, ctx.Done(), jwtSecret))
+	}
+
+	if store, ok := blobStore.(*local.Store); ok {
+		router.Handle(cfg.Media.Local.BaseURL+"/"+image.KeyPrefix+"*", http.StripPrefix(cfg.Media.Local.BaseURL+"/", http.FileServer(fileOnlyFS{http.Dir(store.Dir())})))
+	}
+	router.Post("/attribute/create/{categoryId}", attribute.Create(log, storage, lists, jwtSecret))
+	router.Delete("/attribute/delete/{id}", attribute.DeleteAttribute(log, storage, lists, jwtSecret))
+	router.Get("/attribute/list/{categoryId}", attribute.GetAttributeList(log, storage))
 
 	log.Info("starting server", slog.String("address", cfg.Address))
 
@@ -88,11 +301,34 @@ func main() {
 		IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Error("failed to start server")
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start server", sl.Err(err))
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+
+	log.Info("shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPServer.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to shut down server", sl.Err(err))
+	}
+
+	background.Wait()
+	importRunner.Wait()
+	exportRunner.Wait()
+
+	if listCache != nil {
+		listCache.Close()
 	}
+	storage.Close()
 
-	log.Error("server stopped")
+	log.Info("server stopped")
 }
 
 func SetupLogger(env string) *slog.Logger {
@@ -113,14 +349,371 @@ func SetupLogger(env string) *slog.Logger {
 	return log
 }
 
-func periodicGoodFetch(log *slog.Logger, apiURL string, adderGood good.AdderGood) {
-	ticker := time.NewTicker(1 * time.Minute)
+// Storage is everything the handlers and background jobs need from a storage backend.
+type Storage interface {
+	signup.Registration
+	signin.Authorization
+	category.CreatorCategory
+	category.EditorCategory
+	category.DeleterCategory
+	category.ListCategory
+	good.AdderGood
+	good.UpdaterGood
+	good.DeleterGood
+	good.ListGood
+	good.GetterGood
+	good.AttributeSetterGood
+	good.GeneratorVariant
+	good.ListVariant
+	good.HistoryGood
+	good.ReverterGood
+	good.UpdaterOffer
+	good.DuplicatesGood
+	attribute.CreatorAttribute
+	attribute.ListAttribute
+	attribute.DeleterAttribute
+	image.AdderImage
+	image.ListImage
+	image.DeleterImage
+	image.ReordererImage
+	image.PrimarySetterImage
+	trash.ListTrash
+	trash.RestorerGood
+	trash.RestorerCategory
+	trashpurger.Purger
+	importjob.CreatorImport
+	importjob.GetterImport
+	importer.Storage
+	exportjob.CreatorExport
+	exportjob.GetterExport
+	exporter.Storage
+	feedgen.CacheSource
+	commerceml.Storage
+	goodsource.Storage
+	source.GetterRuns
+	leader.Storage
+	idempotency.Store
+	idempotencyPurger
+	userAdmin
+	Close()
+}
+
+// setupStorage opens the configured backend. The sqlite backend keeps the catalog in one file
+// and, like the memory one, serves a single replica. The memory backend keeps nothing across
+// restarts; it is meant for development and tests.
+func setupStorage(cfg *config.Config) (Storage, error) {
+	switch cfg.Storage {
+	case "postgres":
+		return postgres.New(
+			cfg.Postgres.Host,
+			cfg.Postgres.Port,
+			cfg.Postgres.User,
+			cfg.Postgres.Password,
+			cfg.Postgres.DBName,
+			postgres.Pool{
+				SSLMode:            cfg.Postgres.SSLMode,
+				SSLRootCert:        cfg.Postgres.SSLRootCert,
+				MaxConns:           cfg.Postgres.MaxConns,
+				MinConns:           cfg.Postgres.MinConns,
+				MaxConnLifetime:    cfg.Postgres.MaxConnLifetime,
+				MaxConnIdleTime:    cfg.Postgres.MaxConnIdleTime,
+				HealthCheckPeriod:  cfg.Postgres.HealthCheckPeriod,
+				StatementCache:     cfg.Postgres.StatementCache,
+				StatementCacheSize: cfg.Postgres.StatementCacheSize,
+			},
+			postgres.Replicas{
+				DSNs:   cfg.Postgres.Replicas,
+				MaxLag: cfg.Postgres.ReplicaMaxLag,
+			},
+			postgres.Timeouts{
+				Default: cfg.Postgres.QueryTimeout,
+				Methods: cfg.Postgres.QueryTimeouts,
+			},
+		)
+	case "sqlite":
+		return setupSqlite(cfg.Sqlite)
+	case "memory":
+		return memory.New(), nil
+	}
+
+	return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+}
+
+func setupBlobStore(cfg config.Media) (blobstore.BlobStore, error) {
+	switch cfg.Store {
+	case "local":
+		return local.New(cfg.Local.Dir, cfg.Local.BaseURL)
+	case "s3":
+		return s3.New(cfg.S3.Endpoint, cfg.S3.Region, cfg.S3.Bucket, cfg.S3.AccessKey, cfg.S3.SecretKey, cfg.S3.BaseURL)
+	}
+
+	return nil, fmt.Errorf("unknown media store %q", cfg.Store)
+}
+
+// setupFileStore opens the private store of import uploads and export files.
+func setupFileStore(cfg config.Files) (blobstore.BlobStore, error) {
+	switch cfg.Store {
+	case "local":
+		return local.New(cfg.Local.Dir, "")
+	case "s3":
+		return s3.New(cfg.S3.Endpoint, cfg.S3.Region, cfg.S3.Bucket, cfg.S3.AccessKey, cfg.S3.SecretKey, "")
+	}
+
+	return nil, fmt.Errorf("unknown file store %q", cfg.Store)
+}
+
+// fileOnlyFS serves the files of the media directory but not its listings.
+type fileOnlyFS struct {
+	fs http.FileSystem
+}
+
+func (f fileOnlyFS) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+
+	return file, nil
+}
+
+// setupCache opens the configured list cache, nil when caching is off.
+func setupCache(cfg config.Cache) (cache.Cache, error) {
+	switch cfg.Store {
+	case "memory":
+		return lru.New(cfg.Size), nil
+	case "redis":
+		return redis.New(redis.Options{
+			Address:  cfg.Redis.Address,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+			Prefix:   cfg.Redis.Prefix,
+			Timeout:  cfg.Redis.Timeout,
+			PoolSize: cfg.Redis.PoolSize,
+		})
+	case "off":
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown cache store %q", cfg.Store)
+}
+
+func setupGoodSources(fetch config.Fetch, dedup config.Dedup, cfgs []config.Source) ([]goodsource.Job, error) {
+	dialer := &net.Dialer{Timeout: fetch.ConnectTimeout}
+	client := &http.Client{
+		Timeout: fetch.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   fetch.ConnectTimeout,
+			ResponseHeaderTimeout: fetch.Timeout,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+
+	names := make(map[string]bool, len(cfgs))
+
+	jobs := make([]goodsource.Job, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("source %s: duplicate name", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		var (
+			source goodsource.GoodSource
+			err    error
+		)
+
+		switch cfg.Type {
+		case "json":
+			source, err = goodsource.NewJSON(cfg.Name, client, cfg.Method, cfg.URL, cfg.Items, cfg.Fields)
+		case "csv":
+			source, err = goodsource.NewCSV(cfg.Name, client, cfg.URL, cfg.Mapping)
+		case "file":
+			source, err = goodsource.NewFile(cfg.Name, cfg.Path, cfg.Items, cfg.Fields, cfg.Mapping)
+		default:
+			err = fmt.Errorf("source %s: unknown type %q", cfg.Name, cfg.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var schedule cron.Schedule
+		switch {
+		case cfg.Schedule != "":
+			if schedule, err = cron.Parse(cfg.Schedule); err != nil {
+				return nil, fmt.Errorf("source %s: %w", cfg.Name, err)
+			}
+		case cfg.Interval > 0:
+			schedule = cron.Every(cfg.Interval)
+		default:
+			return nil, fmt.Errorf("source %s: schedule or a positive interval is required", cfg.Name)
+		}
+
+		jobs = append(jobs, goodsource.Job{
+			Source:     source,
+			CategoryId: cfg.CategoryId,
+			Schedule:   schedule,
+			BatchSize:  cfg.BatchSize,
+			Normalization: goodsource.Normalization{
+				Trim:     !dedup.NoTrim,
+				CaseFold: !dedup.NoCaseFold,
+			},
+		})
+	}
+
+	return jobs, nil
+}
+
+func periodicTrashPurge(ctx context.Context, log *slog.Logger, cfg config.Trash, purger trashpurger.Purger, store blobstore.BlobStore) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	retention := time.Duration(cfg.RetentionDays) * 24 * time.Hour
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			trashpurger.PurgeTrash(ctx, log, purger, store, retention)
+		}
+	}
+}
+
+type idempotencyPurger interface {
+	PurgeIdempotencyKeys(ctx context.Context) (int, error)
+}
+
+func periodicIdempotencyPurge(ctx context.Context, log *slog.Logger, interval time.Duration, purger idempotencyPurger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := purger.PurgeIdempotencyKeys(ctx)
+			if err != nil {
+				log.Error("failed to purge idempotency keys", sl.Err(err))
+				continue
+			}
+			log.Info("expired idempotency keys purged", slog.Int("keys", n))
+		}
+	}
+}
+
+type jobResumer interface {
+	Resume(ctx context.Context)
+}
+
+// periodicJobResume picks up the import and export jobs left unfinished right away, then every
+// interval: a job whose replica died is claimed again once its lease expires.
+func periodicJobResume(ctx context.Context, interval time.Duration, resumers ...jobResumer) {
+	resume := func() {
+		for _, r := range resumers {
+			r.Resume(ctx)
+		}
+	}
+
+	resume()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resume()
+		}
+	}
+}
+
+// periodicFeedRefresh generates the feeds right away, then keeps them in step with the catalog.
+func periodicFeedRefresh(ctx context.Context, interval time.Duration, cache *feedgen.Cache) {
+	cache.Refresh(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cache.Refresh(ctx)
+		}
+	}
+}
+
+// periodicFeedLoad picks up the feeds generated by the replica holding the feed-refresh lease
+// right away, then every interval.
+func periodicFeedLoad(ctx context.Context, interval time.Duration, cache *feedgen.Cache) {
+	cache.Load(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cache.Load(ctx)
+		}
+	}
+}
+
+type replicaChecker interface {
+	CheckReplicas(ctx context.Context) []entity.ReplicaState
+}
+
+// periodicReplicaCheck checks the replicas right away, then every interval; each check is
+// bounded by the interval so that a hung replica does not hold up the next one.
+func periodicReplicaCheck(ctx context.Context, log *slog.Logger, interval time.Duration, checker replicaChecker) {
+	healthy := make(map[string]bool)
+
+	check := func() {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		defer cancel()
+
+		for _, state := range checker.CheckReplicas(checkCtx) {
+			was, seen := healthy[state.Host]
+			if !seen || was != state.Healthy {
+				if state.Healthy {
+					log.Info("replica in rotation", slog.String("host", state.Host), slog.Int64("lag_ms", state.LagMs))
+				} else {
+					log.Warn("replica out of rotation", slog.String("host", state.Host), slog.String("reason", state.Error))
+				}
+			}
+			healthy[state.Host] = state.Healthy
+		}
+	}
+
+	check()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-ticker.C:
-			goodgetter.GetGoodFromAPI(log, apiURL, adderGood)
+			check()
 		}
 	}
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"inHouseAd/internal/config"
+	"inHouseAd/internal/lib/migrate"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// migratable storages keep their schema in goose migrations; the memory storage has none.
+type migratable interface {
+	Migrator() (*migrate.Migrator, error)
+}
+
+const migrateUsage = "usage: migrate up | down | status | redo | to <version>"
+
+// setupSchema applies the pending migrations when auto-migration is on, and fails when the
+// schema is still behind the migrations built into the binary.
+func setupSchema(log *slog.Logger, cfg *config.Config, storage Storage) error {
+	s, ok := storage.(migratable)
+	if !ok {
+		return nil
+	}
+
+	m, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+
+	if !cfg.DisableAutoMigrate {
+		if err := m.Up(); err != nil {
+			return err
+		}
+	}
+
+	if err := m.Check(); err != nil {
+		if errors.Is(err, migrate.ErrBehind) {
+			log.Error("run the migrate up command or clear disable_auto_migrate")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// runMigrate runs the migrate command: up, down, status, redo or to <version>.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	storage, err := setupStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	s, ok := storage.(migratable)
+	if !ok {
+		return fmt.Errorf("%s storage has no migrations", cfg.Storage)
+	}
+
+	m, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up()
+	case "down":
+		return m.Down()
+	case "redo":
+		return m.Redo()
+	case "to":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return m.To(version)
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, appliedAt, s.Name)
+		}
+		return w.Flush()
+	}
+
+	return errors.New(migrateUsage)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/config"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"io"
+)
+
+type demoGood struct {
+	name  string
+	sku   string
+	price float64
+	stock int
+}
+
+// demoCatalog is what the seed command stores: a few categories of goods with offers, and
+// one category whose good comes in size and color variants.
+var demoCatalog = []struct {
+	category string
+	goods    []demoGood
+}{
+	{"Phones", []demoGood{
+		{"Pixel 8", "PHONE-PIXEL8", 699, 12},
+		{"iPhone 15", "PHONE-IPHONE15", 799, 8},
+		{"Galaxy S24", "PHONE-S24", 749, 0},
+	}},
+	{"Laptops", []demoGood{
+		{"ThinkPad X1 Carbon", "LAPTOP-X1", 1499, 4},
+		{"MacBook Air 13", "LAPTOP-AIR13", 1099, 6},
+	}},
+	{"Headphones", []demoGood{
+		{"WH-1000XM5", "AUDIO-XM5", 399, 15},
+	}},
+}
+
+const (
+	demoVariantCategory = "T-shirts"
+	demoVariantGood     = "Basic tee"
+)
+
+var demoVariantAxes = []entity.VariantAxis{
+	{Name: "size", Values: []string{"S", "M", "L"}},
+	{Name: "color", Values: []string{"black", "white"}},
+}
+
+type seedResponse struct {
+	Categories int `json:"categories"`
+	Goods      int `json:"goods"`
+	Variants   int `json:"variants"`
+}
+
+// runSeed runs the seed command: it adds the demo data to the catalog. A catalog that already
+// has one of the demo categories is left alone unless -force is given, so running it twice
+// does not double the data.
+func runSeed(cfg *config.Config, args []string) error {
+	fs, output := newFlags("seed")
+	force := fs.Bool("force", false, "seed even when the demo categories already exist")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	log := commandLogger()
+
+	storage, err := openStorage(cfg, log)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	lists, closeLists, err := openLists(cfg, log, storage)
+	if err != nil {
+		return err
+	}
+	defer closeLists()
+
+	ctx := context.Background()
+
+	categories, err := storage.GetCategoryList(ctx)
+	if err != nil {
+		return err
+	}
+	if !*force {
+		demo := map[string]bool{demoVariantCategory: true}
+		for _, c := range demoCatalog {
+			demo[c.category] = true
+		}
+		for _, c := range categories {
+			if demo[c.CategoryName] {
+				return fmt.Errorf("category %s already exists, pass -force to seed anyway", c.CategoryName)
+			}
+		}
+	}
+
+	var response seedResponse
+
+	// Even a seed that failed half way may have stored some of the catalog.
+	defer func() {
+		lists.InvalidateCategories(ctx)
+		lists.InvalidateGoods(ctx)
+	}()
+
+	for _, c := range demoCatalog {
+		categoryId, err := storage.Create(ctx, c.category, adminUid)
+		if err != nil {
+			return fmt.Errorf("category %s: %w", c.category, err)
+		}
+		response.Categories++
+
+		for _, g := range c.goods {
+			goodId, _, err := storage.AddGood(ctx, g.name, categoryId, nil, adminUid)
+			if err != nil {
+				return fmt.Errorf("good %s: %w", g.name, err)
+			}
+			// A good is created at version 1.
+			if _, err := storage.UpdateOffer(ctx, goodId, &g.sku, &g.price, &g.stock, 1, adminUid); err != nil {
+				return fmt.Errorf("good %s: %w", g.name, err)
+			}
+			response.Goods++
+		}
+	}
+
+	categoryId, err := storage.Create(ctx, demoVariantCategory, adminUid)
+	if err != nil {
+		return fmt.Errorf("category %s: %w", demoVariantCategory, err)
+	}
+	response.Categories++
+
+	for _, axis := range demoVariantAxes {
+		a := entity.CategoryAttribute{Name: axis.Name, Type: attr.TypeEnum, EnumValues: axis.Values}
+		if _, err := storage.CreateAttribute(ctx, categoryId, a); err != nil {
+			return fmt.Errorf("attribute %s: %w", axis.Name, err)
+		}
+	}
+
+	parentId, _, err := storage.AddGood(ctx, demoVariantGood, categoryId, nil, adminUid)
+	if err != nil {
+		return fmt.Errorf("good %s: %w", demoVariantGood, err)
+	}
+	response.Goods++
+
+	price := 19.0
+	variants, _, err := storage.GenerateVariants(ctx, parentId, demoVariantAxes, "TEE", &price, 20, adminUid)
+	if err != nil {
+		return fmt.Errorf("variants of %s: %w", demoVariantGood, err)
+	}
+	response.Variants = len(variants)
+
+	return write(*output, response, func(w io.Writer) {
+		fmt.Fprintln(w, "CATEGORIES\tGOODS\tVARIANTS")
+		fmt.Fprintf(w, "%d\t%d\t%d\n", response.Categories, response.Goods, response.Variants)
+	})
+}
@@ -0,0 +1,19 @@
+//go:build cgo
+
+package main
+
+import (
+	"inHouseAd/internal/config"
+	"inHouseAd/internal/storage/sqlite"
+)
+
+func setupSqlite(cfg config.Sqlite) (Storage, error) {
+	return sqlite.New(
+		cfg.Path,
+		cfg.BusyTimeout,
+		sqlite.Timeouts{
+			Default: cfg.QueryTimeout,
+			Methods: cfg.QueryTimeouts,
+		},
+	)
+}
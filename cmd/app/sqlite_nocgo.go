@@ -0,0 +1,13 @@
+//go:build !cgo
+
+package main
+
+import (
+	"errors"
+	"inHouseAd/internal/config"
+)
+
+// The SQLite driver is written in C; binaries built with CGO_ENABLED=0 go without it.
+func setupSqlite(cfg config.Sqlite) (Storage, error) {
+	return nil, errors.New("sqlite storage requires a build with cgo")
+}
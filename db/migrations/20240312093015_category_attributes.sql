@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS category_attribute (
+    id SERIAL PRIMARY KEY,
+    category_id INT NOT NULL,
+    name VARCHAR NOT NULL,
+    attr_type VARCHAR NOT NULL,
+    unit VARCHAR NOT NULL DEFAULT '',
+    enum_values JSONB NOT NULL DEFAULT '[]',
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (category_id, name),
+    FOREIGN KEY (category_id) REFERENCES category (id) ON DELETE CASCADE
+);
+
+ALTER TABLE good ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX good_attributes_idx ON good USING GIN (attributes jsonb_path_ops);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS good_attributes_idx;
+ALTER TABLE good DROP COLUMN IF EXISTS attributes;
+DROP TABLE IF EXISTS category_attribute;
+-- +goose StatementEnd
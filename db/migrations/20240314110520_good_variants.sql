@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE good
+    ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES good (id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS variant_axes JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS sku VARCHAR,
+    ADD COLUMN IF NOT EXISTS price NUMERIC(12, 2),
+    ADD COLUMN IF NOT EXISTS stock INT NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX good_sku_idx ON good (sku);
+CREATE INDEX good_parent_id_idx ON good (parent_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS good_parent_id_idx;
+DROP INDEX IF EXISTS good_sku_idx;
+ALTER TABLE good
+    DROP COLUMN IF EXISTS stock,
+    DROP COLUMN IF EXISTS price,
+    DROP COLUMN IF EXISTS sku,
+    DROP COLUMN IF EXISTS variant_axes,
+    DROP COLUMN IF EXISTS parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS good_image (
+    id SERIAL PRIMARY KEY,
+    good_id INT NOT NULL,
+    blob_key VARCHAR NOT NULL,
+    thumbnails JSONB NOT NULL DEFAULT '{}',
+    content_type VARCHAR NOT NULL,
+    size BIGINT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (good_id) REFERENCES good (id) ON DELETE CASCADE
+);
+
+CREATE INDEX good_image_good_id_idx ON good_image (good_id, position);
+CREATE UNIQUE INDEX good_image_primary_idx ON good_image (good_id) WHERE is_primary;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS good_image;
+-- +goose StatementEnd
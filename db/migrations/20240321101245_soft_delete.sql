@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE good ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE category ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX good_deleted_at_idx ON good (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX category_deleted_at_idx ON category (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS category_deleted_at_idx;
+DROP INDEX IF EXISTS good_deleted_at_idx;
+ALTER TABLE category DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE good DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS good_revision (
+    id SERIAL PRIMARY KEY,
+    good_id INT NOT NULL,
+    rev INT NOT NULL,
+    action VARCHAR NOT NULL,
+    snapshot JSONB NOT NULL,
+    actor_uid INT,
+    source_rev INT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (good_id, rev),
+    FOREIGN KEY (good_id) REFERENCES good (id) ON DELETE CASCADE
+);
+
+CREATE FUNCTION good_revision_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'good revisions are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER good_revision_no_update
+    BEFORE UPDATE ON good_revision
+    FOR EACH ROW EXECUTE FUNCTION good_revision_immutable();
+
+-- Goods created before history existed start from a baseline revision of their current state.
+INSERT INTO good_revision (good_id, rev, action, snapshot)
+SELECT g.id, 1, 'baseline', jsonb_build_object(
+    'good_name', g.good_name,
+    'parent_id', g.parent_id,
+    'sku', COALESCE(g.sku, ''),
+    'price', g.price,
+    'stock', g.stock,
+    'attributes', g.attributes,
+    'category_ids', COALESCE((SELECT jsonb_agg(category_id ORDER BY category_id) FROM good_category WHERE good_id = g.id), '[]'),
+    'deleted', g.deleted_at IS NOT NULL
+)
+FROM good AS g;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS good_revision_no_update ON good_revision;
+DROP FUNCTION IF EXISTS good_revision_immutable();
+DROP TABLE IF EXISTS good_revision;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE good ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE category ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE FUNCTION bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER good_bump_version
+    BEFORE UPDATE ON good
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+
+CREATE TRIGGER category_bump_version
+    BEFORE UPDATE ON category
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS category_bump_version ON category;
+DROP TRIGGER IF EXISTS good_bump_version ON good;
+DROP FUNCTION IF EXISTS bump_version();
+ALTER TABLE category DROP COLUMN IF EXISTS version;
+ALTER TABLE good DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS import_job (
+    id SERIAL PRIMARY KEY,
+    uid INT NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    format VARCHAR NOT NULL,
+    mode VARCHAR NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    create_categories BOOLEAN NOT NULL DEFAULT FALSE,
+    mapping JSONB NOT NULL DEFAULT '{}',
+    blob_key VARCHAR NOT NULL,
+    total_rows INT NOT NULL DEFAULT 0,
+    processed_rows INT NOT NULL DEFAULT 0,
+    succeeded INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    errors JSONB NOT NULL DEFAULT '[]',
+    error VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX import_job_status_idx ON import_job (status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS import_job;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS export_job (
+    id SERIAL PRIMARY KEY,
+    uid INT NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    format VARCHAR NOT NULL,
+    query JSONB NOT NULL DEFAULT '{}',
+    blob_key VARCHAR NOT NULL DEFAULT '',
+    row_count INT NOT NULL DEFAULT 0,
+    error VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX export_job_status_idx ON export_job (status);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS export_job;
+-- +goose StatementEnd
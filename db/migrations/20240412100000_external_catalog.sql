@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE category
+    ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES category (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS source VARCHAR,
+    ADD COLUMN IF NOT EXISTS external_id VARCHAR,
+    ADD CONSTRAINT category_source_external_id_key UNIQUE (source, external_id);
+
+ALTER TABLE good
+    ADD COLUMN IF NOT EXISTS source VARCHAR,
+    ADD COLUMN IF NOT EXISTS external_id VARCHAR,
+    ADD CONSTRAINT good_source_external_id_key UNIQUE (source, external_id);
+
+CREATE INDEX category_parent_id_idx ON category (parent_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS category_parent_id_idx;
+
+ALTER TABLE good
+    DROP CONSTRAINT IF EXISTS good_source_external_id_key,
+    DROP COLUMN IF EXISTS external_id,
+    DROP COLUMN IF EXISTS source;
+
+ALTER TABLE category
+    DROP CONSTRAINT IF EXISTS category_source_external_id_key,
+    DROP COLUMN IF EXISTS external_id,
+    DROP COLUMN IF EXISTS source,
+    DROP COLUMN IF EXISTS parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS fetch_run (
+    id SERIAL PRIMARY KEY,
+    source VARCHAR NOT NULL,
+    status VARCHAR NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    fetched INT NOT NULL DEFAULT 0,
+    added INT NOT NULL DEFAULT 0,
+    rejected INT NOT NULL DEFAULT 0,
+    error VARCHAR NOT NULL DEFAULT '',
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX fetch_run_source_idx ON fetch_run (source, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS fetch_run;
+-- +goose StatementEnd
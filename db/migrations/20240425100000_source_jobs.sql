@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS source_job (
+    source VARCHAR PRIMARY KEY,
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    run_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE fetch_run ADD COLUMN IF NOT EXISTS trigger VARCHAR NOT NULL DEFAULT 'schedule';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE fetch_run DROP COLUMN IF EXISTS trigger;
+
+DROP TABLE IF EXISTS source_job;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Accounts sharing an email cannot be merged here: revisions and jobs point at their ids.
+-- The migration fails with the list of duplicates instead, to be resolved by hand.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(format('%s (ids %s)', email, ids), ', ')
+    INTO duplicates
+    FROM (
+        SELECT email, string_agg(id::TEXT, ', ' ORDER BY id) AS ids
+        FROM users
+        GROUP BY email
+        HAVING count(*) > 1
+    ) d;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'users share an email: %', duplicates
+            USING HINT = 'Merge or delete the duplicate accounts, then run the migration again.';
+    END IF;
+END
+$$;
+
+DROP INDEX IF EXISTS users_email_idx;
+
+CREATE UNIQUE INDEX users_email_key ON users (email);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_email_key;
+
+CREATE INDEX users_email_idx ON users (email);
+-- +goose StatementEnd
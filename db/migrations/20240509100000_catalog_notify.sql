@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE FUNCTION notify_catalog_change() RETURNS trigger AS $$
+DECLARE
+    r RECORD;
+    payload JSON;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        r := OLD;
+    ELSE
+        r := NEW;
+    END IF;
+
+    IF TG_TABLE_NAME = 'good_category' THEN
+        payload := json_build_object('table', TG_TABLE_NAME, 'op', TG_OP, 'good_id', r.good_id, 'category_id', r.category_id);
+    ELSE
+        payload := json_build_object('table', TG_TABLE_NAME, 'op', TG_OP, 'id', r.id);
+    END IF;
+
+    PERFORM pg_notify('catalog_changes', payload::text);
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER good_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON good
+    FOR EACH ROW EXECUTE FUNCTION notify_catalog_change();
+
+CREATE TRIGGER category_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON category
+    FOR EACH ROW EXECUTE FUNCTION notify_catalog_change();
+
+CREATE TRIGGER good_category_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON good_category
+    FOR EACH ROW EXECUTE FUNCTION notify_catalog_change();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS good_category_notify_change ON good_category;
+DROP TRIGGER IF EXISTS category_notify_change ON category;
+DROP TRIGGER IF EXISTS good_notify_change ON good;
+DROP FUNCTION IF EXISTS notify_catalog_change();
+-- +goose StatementEnd
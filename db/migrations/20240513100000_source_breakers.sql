@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE source_job ADD COLUMN IF NOT EXISTS breaker_failures INT NOT NULL DEFAULT 0;
+ALTER TABLE source_job ADD COLUMN IF NOT EXISTS breaker_open_until TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE source_job DROP COLUMN IF EXISTS breaker_open_until;
+ALTER TABLE source_job DROP COLUMN IF EXISTS breaker_failures;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+// Package migrations embeds the SQL migrations into the binary, so that it migrates the same
+// schema whatever directory it is started from.
+package migrations
+
+import "embed"
+
+// Postgres holds the migrations of the PostgreSQL storage.
+//
+//go:embed *.sql
+var Postgres embed.FS
+
+// Sqlite holds the migrations of the SQLite storage, under sqlite/.
+//
+//go:embed sqlite/*.sql
+var Sqlite embed.FS
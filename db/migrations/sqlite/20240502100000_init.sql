@@ -0,0 +1,217 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email VARCHAR NOT NULL UNIQUE,
+    password_hashed VARCHAR NOT NULL,
+    created_at DATE NOT NULL DEFAULT CURRENT_DATE
+);
+
+CREATE TABLE IF NOT EXISTS category (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category_name VARCHAR NOT NULL,
+    parent_id INT REFERENCES category (id) ON DELETE SET NULL,
+    source VARCHAR,
+    external_id VARCHAR,
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMP,
+    UNIQUE (source, external_id)
+);
+
+INSERT INTO category (category_name)
+VALUES ('No category');
+
+CREATE INDEX category_parent_id_idx ON category (parent_id);
+CREATE INDEX category_deleted_at_idx ON category (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS good (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    good_name VARCHAR NOT NULL,
+    attributes JSON NOT NULL DEFAULT '{}',
+    parent_id INT REFERENCES good (id) ON DELETE CASCADE,
+    variant_axes JSON NOT NULL DEFAULT '[]',
+    sku VARCHAR UNIQUE,
+    price REAL,
+    stock INT NOT NULL DEFAULT 0,
+    source VARCHAR,
+    external_id VARCHAR,
+    version INT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMP,
+    UNIQUE (source, external_id)
+);
+
+CREATE INDEX good_parent_id_idx ON good (parent_id);
+CREATE INDEX good_deleted_at_idx ON good (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS good_category (
+    good_id INT NOT NULL,
+    category_id INT NOT NULL,
+    PRIMARY KEY (good_id, category_id),
+    FOREIGN KEY (good_id) REFERENCES good (id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES category (id) ON DELETE CASCADE
+);
+
+CREATE INDEX good_category_category_id_idx ON good_category (category_id);
+
+CREATE TABLE IF NOT EXISTS category_attribute (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category_id INT NOT NULL,
+    name VARCHAR NOT NULL,
+    attr_type VARCHAR NOT NULL,
+    unit VARCHAR NOT NULL DEFAULT '',
+    enum_values JSON NOT NULL DEFAULT '[]',
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    UNIQUE (category_id, name),
+    FOREIGN KEY (category_id) REFERENCES category (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS good_image (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    good_id INT NOT NULL,
+    blob_key VARCHAR NOT NULL,
+    thumbnails JSON NOT NULL DEFAULT '{}',
+    content_type VARCHAR NOT NULL,
+    size BIGINT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    FOREIGN KEY (good_id) REFERENCES good (id) ON DELETE CASCADE
+);
+
+CREATE INDEX good_image_good_id_idx ON good_image (good_id, position);
+CREATE UNIQUE INDEX good_image_primary_idx ON good_image (good_id) WHERE is_primary;
+
+CREATE TABLE IF NOT EXISTS good_revision (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    good_id INT NOT NULL,
+    rev INT NOT NULL,
+    action VARCHAR NOT NULL,
+    snapshot JSON NOT NULL,
+    actor_uid INT,
+    source_rev INT,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    UNIQUE (good_id, rev),
+    FOREIGN KEY (good_id) REFERENCES good (id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER good_revision_no_update
+BEFORE UPDATE ON good_revision
+BEGIN
+    SELECT RAISE(ABORT, 'good revisions are immutable');
+END;
+
+-- SQLite triggers cannot assign to NEW, so the version is bumped by a second update that
+-- does not fire the trigger again (recursive triggers are off).
+CREATE TRIGGER good_bump_version
+AFTER UPDATE ON good
+BEGIN
+    UPDATE good SET version = OLD.version + 1 WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER category_bump_version
+AFTER UPDATE ON category
+BEGIN
+    UPDATE category SET version = OLD.version + 1 WHERE id = NEW.id;
+END;
+
+CREATE TABLE IF NOT EXISTS idempotency_key (
+    uid INT NOT NULL,
+    idem_key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR NOT NULL,
+    status_code INT,
+    headers JSON,
+    body BLOB,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (uid, idem_key)
+);
+
+CREATE INDEX idempotency_key_expires_at_idx ON idempotency_key (expires_at);
+
+CREATE TABLE IF NOT EXISTS import_job (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    uid INT NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    format VARCHAR NOT NULL,
+    mode VARCHAR NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    create_categories BOOLEAN NOT NULL DEFAULT FALSE,
+    mapping JSON NOT NULL DEFAULT '{}',
+    blob_key VARCHAR NOT NULL,
+    total_rows INT NOT NULL DEFAULT 0,
+    processed_rows INT NOT NULL DEFAULT 0,
+    succeeded INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    errors JSON NOT NULL DEFAULT '[]',
+    error VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX import_job_status_idx ON import_job (status);
+
+CREATE TABLE IF NOT EXISTS export_job (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    uid INT NOT NULL,
+    status VARCHAR NOT NULL DEFAULT 'pending',
+    format VARCHAR NOT NULL,
+    query JSON NOT NULL DEFAULT '{}',
+    blob_key VARCHAR NOT NULL DEFAULT '',
+    row_count INT NOT NULL DEFAULT 0,
+    error VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX export_job_status_idx ON export_job (status);
+
+CREATE TABLE IF NOT EXISTS fetch_run (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source VARCHAR NOT NULL,
+    "trigger" VARCHAR NOT NULL DEFAULT 'schedule',
+    status VARCHAR NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    fetched INT NOT NULL DEFAULT 0,
+    added INT NOT NULL DEFAULT 0,
+    rejected INT NOT NULL DEFAULT 0,
+    error VARCHAR NOT NULL DEFAULT '',
+    started_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX fetch_run_source_idx ON fetch_run (source, id);
+
+CREATE TABLE IF NOT EXISTS job_lease (
+    name VARCHAR PRIMARY KEY,
+    holder VARCHAR NOT NULL,
+    acquired_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS source_job (
+    source VARCHAR PRIMARY KEY,
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    run_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS source_job;
+DROP TABLE IF EXISTS job_lease;
+DROP TABLE IF EXISTS fetch_run;
+DROP TABLE IF EXISTS export_job;
+DROP TABLE IF EXISTS import_job;
+DROP TABLE IF EXISTS idempotency_key;
+DROP TABLE IF EXISTS good_revision;
+DROP TABLE IF EXISTS good_image;
+DROP TABLE IF EXISTS category_attribute;
+DROP TABLE IF EXISTS good_category;
+DROP TABLE IF EXISTS good;
+DROP TABLE IF EXISTS category;
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE source_job ADD COLUMN breaker_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE source_job ADD COLUMN breaker_open_until TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE source_job DROP COLUMN breaker_open_until;
+ALTER TABLE source_job DROP COLUMN breaker_failures;
+-- +goose StatementEnd
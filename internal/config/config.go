@@ -7,17 +7,41 @@ import (
 )
 
 type Config struct {
-	Env        string `yaml:"env" env-default:"local"`
-	HTTPServer `yaml:"http_server"`
-	Postgres   `yaml:"postgres"`
-	Auth       `yaml:"app"`
-	API        `yaml:"api"`
+	Env string `yaml:"env" env-default:"local"`
+	// Storage is the backend: postgres, sqlite for single-node deployments, or memory
+	// for development and tests.
+	Storage string `yaml:"storage" env-default:"postgres"`
+	// DisableAutoMigrate stops the app from applying pending migrations on startup; it then
+	// refuses to start until the schema is migrated with the migrate command. The flag is
+	// negative because a false in the file does not override a true env-default.
+	DisableAutoMigrate bool `yaml:"disable_auto_migrate"`
+	HTTPServer         `yaml:"http_server"`
+	Postgres           `yaml:"postgres"`
+	Sqlite             `yaml:"sqlite"`
+	Auth               `yaml:"app"`
+	Media              `yaml:"media"`
+	Files              `yaml:"files"`
+	Trash              `yaml:"trash"`
+	Concurrency        `yaml:"concurrency"`
+	Idempotency        `yaml:"idempotency"`
+	Import             `yaml:"import"`
+	Export             `yaml:"export"`
+	Feed               `yaml:"feed"`
+	Exchange           `yaml:"exchange"`
+	Leader             `yaml:"leader"`
+	Fetch              `yaml:"fetch"`
+	Dedup              `yaml:"dedup"`
+	Cache              `yaml:"cache"`
+	Changes            `yaml:"changes"`
+	Sources            []Source `yaml:"sources"`
 }
 
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8080"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// ShutdownTimeout is how long requests in flight are waited for on SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
 }
 type Postgres struct {
 	Host     string `yaml:"host" env-default:"localhost"`
@@ -25,14 +49,211 @@ type Postgres struct {
 	User     string `yaml:"user" env-default:"postgres"`
 	Password string `yaml:"password" env-default:"postgres"`
 	DBName   string `yaml:"db_name" env-default:"postgres"`
+	// SSLMode takes the libpq values; the verify modes check the server against SSLRootCert.
+	SSLMode     string `yaml:"ssl_mode" env-default:"disable"`
+	SSLRootCert string `yaml:"ssl_root_cert"`
+	// MinConns are kept open even when idle; every connection is checked each HealthCheckPeriod.
+	MaxConns          int32         `yaml:"max_conns" env-default:"10"`
+	MinConns          int32         `yaml:"min_conns" env-default:"2"`
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime" env-default:"1h"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time" env-default:"30m"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period" env-default:"1m"`
+	// StatementCache is prepare, describe (for PgBouncer in transaction mode) or off.
+	StatementCache     string `yaml:"statement_cache" env-default:"prepare"`
+	StatementCacheSize int    `yaml:"statement_cache_size" env-default:"512"`
+	// Replicas are DSNs of read replicas for the list queries. A replica is read from while its
+	// lag, checked every ReplicaCheckInterval, stays within ReplicaMaxLag.
+	Replicas             []string      `yaml:"replicas"`
+	ReplicaMaxLag        time.Duration `yaml:"replica_max_lag" env-default:"5s"`
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval" env-default:"5s"`
+	// QueryTimeout bounds every storage call, QueryTimeouts overrides it for single
+	// storage methods by name, e.g. GetGoodList. Zero means no limit, so it has no env-default:
+	// cleanenv would replace a zero in the file with it.
+	QueryTimeout  time.Duration            `yaml:"query_timeout"`
+	QueryTimeouts map[string]time.Duration `yaml:"query_timeouts"`
+}
+
+type Sqlite struct {
+	Path string `yaml:"path" env-default:"storage/catalog.db"`
+	// BusyTimeout is how long a write waits for another one to finish before it fails.
+	BusyTimeout time.Duration `yaml:"busy_timeout" env-default:"5s"`
+	// QueryTimeout and QueryTimeouts work as in Postgres.
+	QueryTimeout  time.Duration            `yaml:"query_timeout"`
+	QueryTimeouts map[string]time.Duration `yaml:"query_timeouts"`
 }
 
 type Auth struct {
 	JwtSecret string `yaml:"jwt_secret" env-default:"secret"`
 }
 
-type API struct {
-	Url string `yaml:"url" env-default:"https://randomall.ru/api/gens/1818"`
+type Media struct {
+	Store          string `yaml:"store" env-default:"local"`
+	MaxSize        int64  `yaml:"max_size" env-default:"10485760"`
+	MaxPixels      int64  `yaml:"max_pixels" env-default:"40000000"`
+	ThumbnailSizes []int  `yaml:"thumbnail_sizes" env-default:"160,480"`
+	Local          struct {
+		Dir     string `yaml:"dir" env-default:"media"`
+		BaseURL string `yaml:"base_url" env-default:"/media"`
+	} `yaml:"local"`
+	S3 struct {
+		Endpoint  string `yaml:"endpoint"`
+		Region    string `yaml:"region" env-default:"us-east-1"`
+		Bucket    string `yaml:"bucket"`
+		AccessKey string `yaml:"access_key"`
+		SecretKey string `yaml:"secret_key"`
+		BaseURL   string `yaml:"base_url"`
+	} `yaml:"s3"`
+}
+
+// Files is the private blob store of import uploads and export results. Unlike Media it is never
+// served as is: export files are downloaded through the API by the user who requested them.
+type Files struct {
+	Store string `yaml:"store" env-default:"local"`
+	Local struct {
+		Dir string `yaml:"dir" env-default:"files"`
+	} `yaml:"local"`
+	S3 struct {
+		Endpoint  string `yaml:"endpoint"`
+		Region    string `yaml:"region" env-default:"us-east-1"`
+		Bucket    string `yaml:"bucket"`
+		AccessKey string `yaml:"access_key"`
+		SecretKey string `yaml:"secret_key"`
+	} `yaml:"s3"`
+}
+
+type Trash struct {
+	RetentionDays int           `yaml:"retention_days" env-default:"30"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// Concurrency controls optimistic locking: when RequireIfMatch is off, updates without
+// an If-Match header are applied unconditionally. It is off until clients send the header.
+type Concurrency struct {
+	RequireIfMatch bool `yaml:"require_if_match" env-default:"false"`
+}
+
+// Idempotency.MaxBodySize is the largest body of a request with an Idempotency-Key; it is held
+// in memory to be hashed.
+type Idempotency struct {
+	TTL           time.Duration `yaml:"ttl" env-default:"24h"`
+	Wait          time.Duration `yaml:"wait" env-default:"5s"`
+	LockTimeout   time.Duration `yaml:"lock_timeout" env-default:"1m"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+	MaxBodySize   int64         `yaml:"max_body_size" env-default:"1048576"`
+}
+
+type Import struct {
+	MaxSize   int64 `yaml:"max_size" env-default:"52428800"`
+	Workers   int   `yaml:"workers" env-default:"2"`
+	BatchSize int   `yaml:"batch_size" env-default:"100"`
+}
+
+// Export.StreamTimeout replaces the server write timeout for GET /export.
+type Export struct {
+	Workers       int           `yaml:"workers" env-default:"2"`
+	StreamTimeout time.Duration `yaml:"stream_timeout" env-default:"10m"`
+}
+
+// Feed describes the shop for the marketplace feeds. GoodURL is the storefront page of a good
+// with "{id}" in place of its id. Feeds are checked for catalog changes every CheckInterval
+// and regenerated at least every MaxAge.
+type Feed struct {
+	ShopName      string        `yaml:"shop_name" env-default:"inHouseAd"`
+	Company       string        `yaml:"company" env-default:"inHouseAd"`
+	ShopURL       string        `yaml:"shop_url" env-default:"http://localhost:8080"`
+	GoodURL       string        `yaml:"good_url" env-default:"http://localhost:8080/good/{id}"`
+	Currency      string        `yaml:"currency" env-default:"RUB"`
+	CheckInterval time.Duration `yaml:"check_interval" env-default:"1m"`
+	MaxAge        time.Duration `yaml:"max_age" env-default:"1h"`
+}
+
+// Exchange configures the 1C exchange. PriceType is the name of the 1C price type to import,
+// empty takes the first price of every offer.
+type Exchange struct {
+	Dir       string        `yaml:"dir" env-default:"exchange"`
+	FileLimit int64         `yaml:"file_limit" env-default:"104857600"`
+	Timeout   time.Duration `yaml:"timeout" env-default:"5m"`
+	PriceType string        `yaml:"price_type"`
+}
+
+// Leader controls how replicas share background jobs: a replica that stops renewing its lease
+// on a job loses it to another one after LeaseTTL.
+type Leader struct {
+	LeaseTTL time.Duration `yaml:"lease_ttl" env-default:"15s"`
+}
+
+// Fetch controls how good sources are requested. A failed fetch is retried MaxRetries times
+// with exponential backoff from BaseDelay up to MaxDelay; after BreakerThreshold failed runs
+// in a row a source is skipped for BreakerCooldown. MaxRetries and BreakerThreshold may be zero
+// (no retries, no breaker) and have no env-default for that reason.
+type Fetch struct {
+	Timeout          time.Duration `yaml:"timeout" env-default:"30s"`
+	ConnectTimeout   time.Duration `yaml:"connect_timeout" env-default:"5s"`
+	MaxRetries       int           `yaml:"max_retries"`
+	BaseDelay        time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay         time.Duration `yaml:"max_delay" env-default:"30s"`
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" env-default:"5m"`
+	// PollInterval is how often pause and run requests from the admin API are checked.
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"5s"`
+}
+
+// Dedup decides when goods are duplicates. Goods of a source without an external id are matched
+// by their name and sku ignoring surrounding and repeated spaces and letter case, unless NoTrim
+// or NoCaseFold is set; the flags are negative like DisableAutoMigrate. Threshold is the default
+// name similarity of the near-duplicate report.
+type Dedup struct {
+	NoTrim     bool    `yaml:"no_trim"`
+	NoCaseFold bool    `yaml:"no_case_fold"`
+	Threshold  float64 `yaml:"threshold" env-default:"0.6"`
+}
+
+// Cache keeps the category and good lists. Store is memory (an LRU of Size lists in every
+// replica), redis (one cache for all the replicas) or off. A list is kept for the TTL of its
+// query at most; changes made through the category and good endpoints drop it at once.
+type Cache struct {
+	Store       string        `yaml:"store" env-default:"memory"`
+	Size        int           `yaml:"size" env-default:"1000"`
+	CategoryTTL time.Duration `yaml:"category_ttl" env-default:"5m"`
+	GoodTTL     time.Duration `yaml:"good_ttl" env-default:"1m"`
+	Redis       struct {
+		Address  string        `yaml:"address" env-default:"localhost:6379"`
+		Password string        `yaml:"password"`
+		DB       int           `yaml:"db"`
+		Prefix   string        `yaml:"prefix" env-default:"inhousead:"`
+		Timeout  time.Duration `yaml:"timeout" env-default:"500ms"`
+		PoolSize int           `yaml:"pool_size" env-default:"10"`
+	} `yaml:"redis"`
+}
+
+// Changes controls the bus of catalog changes the database notifies (postgres only). Buffer is
+// how many changes a subscriber may lag behind before it is told to resync; a lost connection is
+// reopened after ReconnectDelay, doubled on every failure up to MaxReconnectDelay.
+type Changes struct {
+	Buffer            int           `yaml:"buffer" env-default:"256"`
+	ReconnectDelay    time.Duration `yaml:"reconnect_delay" env-default:"1s"`
+	MaxReconnectDelay time.Duration `yaml:"max_reconnect_delay" env-default:"30s"`
+}
+
+// Source is a background good source, its goods are matched across fetches by the "external_id"
+// field when mapped. Type is "json" (an API, URL and Method, with Items and
+// Fields as JSONPaths), "csv" (a table at URL, Mapping from fields to column headers) or "file"
+// (Path to a file or a directory of .json, .csv and .xlsx files, mapped with Items and Fields or
+// Mapping). Fetched goods go to CategoryId on every Schedule time (a cron expression), or every
+// Interval when Schedule is empty, BatchSize per transaction.
+type Source struct {
+	Name       string            `yaml:"name"`
+	Type       string            `yaml:"type"`
+	URL        string            `yaml:"url"`
+	Method     string            `yaml:"method"`
+	Path       string            `yaml:"path"`
+	Items      string            `yaml:"items"`
+	Fields     map[string]string `yaml:"fields"`
+	Mapping    map[string]string `yaml:"mapping"`
+	CategoryId int               `yaml:"category_id"`
+	Schedule   string            `yaml:"schedule"`
+	Interval   time.Duration     `yaml:"interval"`
+	BatchSize  int               `yaml:"batch_size"`
 }
 
 func MustLoad(configPath string) *Config {
@@ -1,5 +1,9 @@
 package entity
 
+import (
+	"time"
+)
+
 type UserRegisterRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -43,8 +47,9 @@ type CategoryDeleteResponse struct {
 }
 
 type GoodAddRequest struct {
-	GoodName   string `json:"good_name"`
-	CategoryId int    `json:"category_id"`
+	GoodName   string         `json:"good_name"`
+	CategoryId int            `json:"category_id"`
+	Attributes map[string]any `json:"attributes,omitempty"`
 }
 
 type GoodAddResponse struct {
@@ -74,9 +79,468 @@ type GoodDeleteResponse struct {
 type CategoryList struct {
 	CategoryId   int    `json:"category_id"`
 	CategoryName string `json:"category_name"`
+	ParentId     *int   `json:"parent_id,omitempty"`
+	Version      int    `json:"version"`
 }
 
 type GoodList struct {
-	GoodId   int    `json:"good_id"`
-	GoodName string `json:"good_name"`
+	GoodId       int            `json:"good_id"`
+	GoodName     string         `json:"good_name"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	ParentId     *int           `json:"parent_id,omitempty"`
+	Sku          string         `json:"sku,omitempty"`
+	Price        *float64       `json:"price,omitempty"`
+	Stock        int            `json:"stock"`
+	VariantCount int            `json:"variant_count,omitempty"`
+	Image        *GoodImage     `json:"image,omitempty"`
+	Version      int            `json:"version"`
+}
+
+type CategoryAttribute struct {
+	AttributeId int      `json:"attribute_id"`
+	CategoryId  int      `json:"category_id"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Unit        string   `json:"unit,omitempty"`
+	EnumValues  []string `json:"enum_values,omitempty"`
+	Required    bool     `json:"required"`
+}
+
+type AttributeCreateRequest struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Unit       string   `json:"unit,omitempty"`
+	EnumValues []string `json:"enum_values,omitempty"`
+	Required   bool     `json:"required"`
+}
+
+type AttributeDeleteResponse struct {
+	AttributeId int  `json:"attribute_id"`
+	Deleted     bool `json:"deleted"`
+}
+
+type GoodAttributesRequest struct {
+	Attributes map[string]any `json:"attributes"`
+}
+
+type GoodAttributesResponse struct {
+	GoodId     int            `json:"good_id"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+type VariantAxis struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type GoodVariant struct {
+	GoodId     int            `json:"good_id"`
+	ParentId   *int           `json:"parent_id,omitempty"`
+	GoodName   string         `json:"good_name"`
+	Sku        string         `json:"sku,omitempty"`
+	Price      *float64       `json:"price,omitempty"`
+	Stock      int            `json:"stock"`
+	Attributes map[string]any `json:"attributes"`
+	Version    int            `json:"version"`
+}
+
+type VariantsGenerateRequest struct {
+	Axes      []VariantAxis `json:"axes"`
+	SkuPrefix string        `json:"sku_prefix,omitempty"`
+	Price     *float64      `json:"price,omitempty"`
+	Stock     int           `json:"stock"`
+}
+
+type VariantsGenerateResponse struct {
+	ParentId int           `json:"parent_id"`
+	Created  []GoodVariant `json:"created"`
+	Skipped  int           `json:"skipped"`
+}
+
+type GoodOfferUpdateRequest struct {
+	GoodId int      `json:"good_id"`
+	Sku    *string  `json:"sku,omitempty"`
+	Price  *float64 `json:"price,omitempty"`
+	Stock  *int     `json:"stock,omitempty"`
+}
+
+type GoodImage struct {
+	ImageId       int               `json:"image_id"`
+	GoodId        int               `json:"good_id"`
+	Key           string            `json:"-"`
+	ThumbnailKeys map[string]string `json:"-"`
+	ContentType   string            `json:"content_type"`
+	Size          int64             `json:"size"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	Position      int               `json:"position"`
+	Primary       bool              `json:"primary"`
+	Url           string            `json:"url"`
+	Thumbnails    map[string]string `json:"thumbnails"`
+}
+
+type ImageReorderRequest struct {
+	ImageIds []int `json:"image_ids"`
+}
+
+type ImageDeleteResponse struct {
+	ImageId int  `json:"image_id"`
+	Deleted bool `json:"deleted"`
+}
+
+type GoodDetail struct {
+	GoodId     int            `json:"good_id"`
+	GoodName   string         `json:"good_name"`
+	ParentId   *int           `json:"parent_id,omitempty"`
+	Sku        string         `json:"sku,omitempty"`
+	Price      *float64       `json:"price,omitempty"`
+	Stock      int            `json:"stock"`
+	Attributes map[string]any `json:"attributes"`
+	Categories []CategoryList `json:"categories"`
+	Images     []GoodImage    `json:"images"`
+	Version    int            `json:"version"`
+}
+
+type TrashGood struct {
+	GoodId    int       `json:"good_id"`
+	GoodName  string    `json:"good_name"`
+	ParentId  *int      `json:"parent_id,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type TrashCategory struct {
+	CategoryId   int       `json:"category_id"`
+	CategoryName string    `json:"category_name"`
+	DeletedAt    time.Time `json:"deleted_at"`
+}
+
+type Trash struct {
+	Goods      []TrashGood     `json:"goods"`
+	Categories []TrashCategory `json:"categories"`
+}
+
+type GoodRestoreResponse struct {
+	GoodId   int  `json:"good_id"`
+	Restored bool `json:"restored"`
+}
+
+type CategoryRestoreResponse struct {
+	CategoryId int  `json:"category_id"`
+	Restored   bool `json:"restored"`
+}
+
+type PurgeResult struct {
+	Goods      int
+	Categories int
+	BlobKeys   []string
+}
+
+type GoodSnapshot struct {
+	GoodName    string         `json:"good_name"`
+	ParentId    *int           `json:"parent_id,omitempty"`
+	Sku         string         `json:"sku,omitempty"`
+	Price       *float64       `json:"price,omitempty"`
+	Stock       int            `json:"stock"`
+	Attributes  map[string]any `json:"attributes"`
+	CategoryIds []int          `json:"category_ids"`
+	Deleted     bool           `json:"deleted"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type GoodRevision struct {
+	Rev       int           `json:"rev"`
+	Action    string        `json:"action"`
+	ActorUid  *int          `json:"actor_uid,omitempty"`
+	SourceRev *int          `json:"source_rev,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	Snapshot  GoodSnapshot  `json:"snapshot"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+type GoodRevertResponse struct {
+	GoodId int          `json:"good_id"`
+	Rev    int          `json:"rev"`
+	Good   GoodSnapshot `json:"good"`
+}
+
+type IdempotentResponse struct {
+	StatusCode int
+	Header     map[string][]string
+	Body       []byte
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type ImportJob struct {
+	ImportId         int               `json:"import_id"`
+	Uid              int               `json:"-"`
+	Status           string            `json:"status"`
+	Format           string            `json:"format"`
+	Mode             string            `json:"mode"`
+	DryRun           bool              `json:"dry_run"`
+	CreateCategories bool              `json:"create_categories"`
+	Mapping          map[string]string `json:"mapping,omitempty"`
+	BlobKey          string            `json:"-"`
+	TotalRows        int               `json:"total_rows"`
+	ProcessedRows    int               `json:"processed_rows"`
+	Succeeded        int               `json:"succeeded"`
+	Failed           int               `json:"failed"`
+	Errors           []ImportRowError  `json:"errors"`
+	Error            string            `json:"error,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+	StartedAt        *time.Time        `json:"started_at,omitempty"`
+	FinishedAt       *time.Time        `json:"finished_at,omitempty"`
+}
+
+// ImportRow is a mapped line of an import file. Attribute values are still raw text:
+// they are typed against the schemas of the row's categories when it is stored.
+// Err is set when the line could not be mapped, such rows are only reported.
+type ImportRow struct {
+	Row        int
+	GoodName   string
+	Categories []string
+	Sku        string
+	Price      *float64
+	Stock      int
+	Attributes map[string]string
+	Err        string
+}
+
+type ImportBatchResult struct {
+	Succeeded int
+	Errors    []ImportRowError
+}
+
+type ImportCreateResponse struct {
+	ImportId int    `json:"import_id"`
+	Status   string `json:"status"`
+}
+
+type ExportGood struct {
+	GoodId     int            `json:"good_id"`
+	GoodName   string         `json:"good_name"`
+	ParentId   *int           `json:"parent_id,omitempty"`
+	Categories []string       `json:"categories"`
+	Sku        string         `json:"sku,omitempty"`
+	Price      *float64       `json:"price,omitempty"`
+	Stock      int            `json:"stock"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// ExportQuery selects the goods of an export with the same parameters as the good list.
+// CategoryId 0 exports the whole catalog; filters need a category.
+type ExportQuery struct {
+	CategoryId       int      `json:"category_id,omitempty"`
+	Filters          []string `json:"filters,omitempty"`
+	CollapseVariants bool     `json:"collapse_variants,omitempty"`
+}
+
+type ExportJob struct {
+	ExportId   int         `json:"export_id"`
+	Uid        int         `json:"-"`
+	Status     string      `json:"status"`
+	Format     string      `json:"format"`
+	Query      ExportQuery `json:"query"`
+	BlobKey    string      `json:"-"`
+	Url        string      `json:"url,omitempty"`
+	Rows       int         `json:"rows"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+type ExportCreateResponse struct {
+	ExportId int    `json:"export_id"`
+	Status   string `json:"status"`
+}
+
+// FeedGood is a good as the marketplace feeds see it: only its primary image and the ids of its
+// live categories. HasVariants marks parents, which are represented by their variants.
+type FeedGood struct {
+	GoodId      int
+	GoodName    string
+	ParentId    *int
+	Sku         string
+	Price       *float64
+	Stock       int
+	Attributes  map[string]any
+	CategoryIds []int
+	ImageKey    string
+	HasVariants bool
+}
+
+type FeedGoodErrors struct {
+	GoodId   int      `json:"good_id"`
+	GoodName string   `json:"good_name"`
+	Errors   []string `json:"errors"`
+}
+
+type FeedReport struct {
+	Format      string           `json:"format"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Offers      int              `json:"offers"`
+	Skipped     int              `json:"skipped"`
+	Goods       []FeedGoodErrors `json:"goods"`
+}
+
+// ExternalCategory is a category kept in step with an external system, which identifies it
+// (and its parent, empty for a root) by its own ids.
+type ExternalCategory struct {
+	ExternalId       string
+	ParentExternalId string
+	Name             string
+}
+
+// ExternalGood is a good kept in step with an external system. Attribute values are raw text,
+// typed against the category schemas when stored; values without a schema are dropped.
+type ExternalGood struct {
+	ExternalId          string
+	ParentExternalId    string
+	Name                string
+	Sku                 string
+	CategoryExternalIds []string
+	Attributes          map[string]string
+	Deleted             bool
+}
+
+// ExternalOffer updates the price and stock of a good. Offers of an unknown good with a known
+// parent create a variant of the parent, named Name and with Attributes as its axes.
+type ExternalOffer struct {
+	ExternalId       string
+	ParentExternalId string
+	Name             string
+	Sku              string
+	Price            *float64
+	Stock            *int
+	Attributes       map[string]string
+}
+
+// SourceGood is a good fetched from an external source. Position is its place in the fetched
+// document, for logs. ExternalId is the source's key for the good, or a hash of its normalized
+// content when the source has none; fetching the same key again updates the good.
+// Attribute values are raw text, typed by the target category's schemas. Price and Stock are nil
+// when the source does not provide them. Err is set when the good could not be mapped, such
+// goods are only reported.
+type SourceGood struct {
+	Position   int
+	ExternalId string
+	GoodName   string
+	Sku        string
+	Price      *float64
+	Stock      *int
+	Attributes map[string]string
+	Err        string
+}
+
+// NearDuplicate is a pair of live goods with similar names, Similarity from 0 to 1.
+type NearDuplicate struct {
+	GoodId        int     `json:"good_id"`
+	GoodName      string  `json:"good_name"`
+	DuplicateId   int     `json:"duplicate_id"`
+	DuplicateName string  `json:"duplicate_name"`
+	Similarity    float64 `json:"similarity"`
+}
+
+// FetchRun is one fetch of a good source. Trigger is "schedule" or "manual".
+type FetchRun struct {
+	RunId      int        `json:"run_id"`
+	Source     string     `json:"source"`
+	Trigger    string     `json:"trigger"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	Fetched    int        `json:"fetched"`
+	Added      int        `json:"added"`
+	Rejected   int        `json:"rejected"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs *int64     `json:"duration_ms,omitempty"`
+}
+
+// SourceState is the circuit breaker of a good source: open sources are not fetched until OpenUntil.
+type SourceState struct {
+	Source    string     `json:"source"`
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+}
+
+// SourceJobControl is what an admin changed about a source job: paused jobs skip their schedule,
+// RunRequested asks the replica running the job to fetch now. Failures and OpenUntil are its
+// circuit breaker as saved by that replica.
+type SourceJobControl struct {
+	Paused       bool
+	RunRequested bool
+	Failures     int
+	OpenUntil    *time.Time
+}
+
+// SourceJob is a scheduled good source. NextRun is empty while the job is paused.
+type SourceJob struct {
+	Source       string     `json:"source"`
+	Schedule     string     `json:"schedule"`
+	Paused       bool       `json:"paused"`
+	RunRequested bool       `json:"run_requested"`
+	LastRun      *FetchRun  `json:"last_run,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+}
+
+// PoolStats is a snapshot of the database connection pool. A growing EmptyAcquireCount or
+// AcquireDurationMs means requests wait for connections and MaxConns may be too low.
+type PoolStats struct {
+	TotalConns              int32 `json:"total_conns"`
+	IdleConns               int32 `json:"idle_conns"`
+	AcquiredConns           int32 `json:"acquired_conns"`
+	ConstructingConns       int32 `json:"constructing_conns"`
+	MaxConns                int32 `json:"max_conns"`
+	AcquireCount            int64 `json:"acquire_count"`
+	EmptyAcquireCount       int64 `json:"empty_acquire_count"`
+	CanceledAcquireCount    int64 `json:"canceled_acquire_count"`
+	AcquireDurationMs       int64 `json:"acquire_duration_ms"`
+	NewConnsCount           int64 `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64 `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64 `json:"max_idle_destroy_count"`
+}
+
+// ReplicaState is a read replica as of its last check. Unhealthy replicas are not read from.
+type ReplicaState struct {
+	Host      string    `json:"host"`
+	Healthy   bool      `json:"healthy"`
+	LagMs     int64     `json:"lag_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// CacheStats counts the lookups of the list cache since the replica started. A lookup that
+// failed in the cache counts as a miss too, Errors tells them apart.
+type CacheStats struct {
+	Store   string            `json:"store"`
+	Queries []CacheQueryStats `json:"queries"`
+}
+
+type CacheQueryStats struct {
+	Query    string  `json:"query"`
+	TTLMs    int64   `json:"ttl_ms"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Errors   int64   `json:"errors"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// Change is a catalog row changed in the database, as its trigger notified it. Id is the good
+// or the category; a good_category row carries GoodId and CategoryId instead.
+type Change struct {
+	Table      string `json:"table"`
+	Op         string `json:"op"`
+	Id         int    `json:"id,omitempty"`
+	GoodId     int    `json:"good_id,omitempty"`
+	CategoryId int    `json:"category_id,omitempty"`
 }
@@ -1,6 +1,7 @@
 package signin
 
 import (
+	"context"
 	"errors"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
@@ -8,6 +9,7 @@ import (
 	"inHouseAd/internal/entity"
 	"inHouseAd/internal/lib/accesstoken"
 	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/logger/sl"
 	"io"
 	"log/slog"
 	"net/http"
@@ -17,7 +19,7 @@ import (
 var ErrInvalidEmail = errors.New("invalid email")
 
 type Authorization interface {
-	Authorizate(email string) ([]byte, int, error)
+	Authorizate(ctx context.Context, email string) ([]byte, int, error)
 }
 
 func LoginUser(log *slog.Logger, authorization Authorization, secret string) http.HandlerFunc {
@@ -42,7 +44,7 @@ func LoginUser(log *slog.Logger, authorization Authorization, secret string) htt
 			return
 		}
 		if err != nil {
-			log.Error("failed to decode request body: ", err)
+			log.Error("failed to decode request body", sl.Err(err))
 
 			w.WriteHeader(http.StatusBadRequest)
 			render.JSON(w, r, resp.Error("failed to decode request"))
@@ -52,17 +54,24 @@ func LoginUser(log *slog.Logger, authorization Authorization, secret string) htt
 
 		log.Info("request body decoded", slog.Any("request", req))
 
-		passwordHashed, id, err := authorization.Authorizate(req.Email)
+		passwordHashed, id, err := authorization.Authorizate(r.Context(), req.Email)
 		if err != nil {
 			if errors.Is(err, ErrInvalidEmail) {
-				log.Error("incorrect email: ", err)
+				log.Error("incorrect email", sl.Err(err))
 
 				w.WriteHeader(http.StatusBadRequest)
 				render.JSON(w, r, resp.Error("incorrect credentials"))
 
 				return
 			}
-			log.Error("failed to get password: ", err)
+			if r.Context().Err() != nil {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get password", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -71,7 +80,7 @@ func LoginUser(log *slog.Logger, authorization Authorization, secret string) htt
 		}
 
 		if err := bcrypt.CompareHashAndPassword(passwordHashed, []byte(req.Password)); err != nil {
-			log.Error("invalid password: ", err)
+			log.Error("invalid password", sl.Err(err))
 
 			w.WriteHeader(http.StatusBadRequest)
 			render.JSON(w, r, resp.Error("invalid credential"))
@@ -1,12 +1,14 @@
 package signup
 
 import (
+	"context"
 	"errors"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"golang.org/x/crypto/bcrypt"
 	"inHouseAd/internal/entity"
 	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/logger/sl"
 	"io"
 	"log/slog"
 	"net/http"
@@ -15,7 +17,7 @@ import (
 var ErrEmailTaken = errors.New("email already taken")
 
 type Registration interface {
-	Register(email string, passwordHashed []byte) (int, error)
+	Register(ctx context.Context, email string, passwordHashed []byte) (int, error)
 }
 
 func CreateUser(log *slog.Logger, registration Registration) http.HandlerFunc {
@@ -40,7 +42,7 @@ func CreateUser(log *slog.Logger, registration Registration) http.HandlerFunc {
 			return
 		}
 		if err != nil {
-			log.Error("failed to decode request body: ", err)
+			log.Error("failed to decode request body", sl.Err(err))
 
 			w.WriteHeader(http.StatusBadRequest)
 			render.JSON(w, r, resp.Error("failed to decode request"))
@@ -52,7 +54,7 @@ func CreateUser(log *slog.Logger, registration Registration) http.HandlerFunc {
 
 		passwordHashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
-			log.Error("failed to generate password hash: ", err)
+			log.Error("failed to generate password hash", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -60,15 +62,21 @@ func CreateUser(log *slog.Logger, registration Registration) http.HandlerFunc {
 			return
 		}
 
-		id, err := registration.Register(req.Email, passwordHashed)
+		id, err := registration.Register(r.Context(), req.Email, passwordHashed)
 		if err != nil {
 			if errors.Is(err, ErrEmailTaken) {
-				log.Error("email already taken: ", err)
+				log.Error("email already taken", sl.Err(err))
 				render.JSON(w, r, resp.Error("email already taken"))
 				return
 			}
+			if r.Context().Err() != nil {
+				log.Warn("request canceled", sl.Err(err))
 
-			log.Error("failed to create user: ", err)
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to create user", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -0,0 +1,282 @@
+package attribute
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	resp "inHouseAd/internal/lib/api/response"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/storage/postgres"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type CreatorAttribute interface {
+	CreateAttribute(ctx context.Context, categoryId int, a entity.CategoryAttribute) (int, error)
+}
+
+type ListAttribute interface {
+	GetAttributeList(ctx context.Context, categoryId int) ([]entity.CategoryAttribute, error)
+}
+
+type DeleterAttribute interface {
+	DeleteAttribute(ctx context.Context, id int) error
+}
+
+// InvalidatorAttribute drops the cached good lists an attribute change makes stale: filters are
+// typed by the attributes of the category, see cache.Lists.
+type InvalidatorAttribute interface {
+	InvalidateGoods(ctx context.Context)
+}
+
+func Create(log *slog.Logger, creatorAttribute CreatorAttribute, invalidatorAttribute InvalidatorAttribute, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.attribute.Create"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req entity.AttributeCreateRequest
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		categoryId := chi.URLParam(r, "categoryId")
+		if categoryId == "" {
+			log.Info("category id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("category id parameter is required"))
+			return
+		}
+
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("empty request"))
+
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		_, err = uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		categoryIdInt, err := strconv.Atoi(categoryId)
+		if err != nil {
+			http.Error(w, "invalid category ID", http.StatusBadRequest)
+			return
+		}
+
+		response := entity.CategoryAttribute{
+			CategoryId: categoryIdInt,
+			Name:       req.Name,
+			Type:       req.Type,
+			Unit:       req.Unit,
+			EnumValues: req.EnumValues,
+			Required:   req.Required,
+		}
+
+		if err := attr.ValidateSchema(response); err != nil {
+			log.Info("invalid attribute schema", sl.Err(err))
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+
+			return
+		}
+
+		response.AttributeId, err = creatorAttribute.CreateAttribute(r.Context(), categoryIdInt, response)
+		if err != nil {
+			if errors.Is(err, postgres.ErrAttributeExists) {
+				log.Info("attribute already exists", sl.Err(err))
+
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Error("attribute already exists"))
+
+				return
+			}
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				render.JSON(w, r, resp.Error("category not found"))
+
+				return
+			}
+			if errors.Is(err, attr.ErrInvalidValue) {
+				log.Info("goods of the category do not satisfy the attribute", sl.Err(err))
+
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to create attribute", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		invalidatorAttribute.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("attribute created")
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, response)
+	}
+}
+
+func GetAttributeList(log *slog.Logger, listAttribute ListAttribute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.attribute.GetAttributeList"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		categoryId := chi.URLParam(r, "categoryId")
+		if categoryId == "" {
+			log.Info("category id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("category id parameter is required"))
+			return
+		}
+
+		categoryIdInt, err := strconv.Atoi(categoryId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		response, err := listAttribute.GetAttributeList(r.Context(), categoryIdInt)
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get attribute list", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("attribute list geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func DeleteAttribute(log *slog.Logger, deleterAttribute DeleterAttribute, invalidatorAttribute InvalidatorAttribute, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.attribute.DeleteAttribute"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var response entity.AttributeDeleteResponse
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		attributeId := chi.URLParam(r, "id")
+		if attributeId == "" {
+			log.Info("attribute id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("attribute id parameter is required"))
+			return
+		}
+
+		_, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		attributeIdInt, err := strconv.Atoi(attributeId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		err = deleterAttribute.DeleteAttribute(r.Context(), attributeIdInt)
+		if err != nil {
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to delete attribute", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		response.AttributeId = attributeIdInt
+		response.Deleted = true
+
+		invalidatorAttribute.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("attribute deleted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
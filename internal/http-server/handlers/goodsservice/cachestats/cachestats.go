@@ -0,0 +1,45 @@
+package cachestats
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+)
+
+type GetterStats interface {
+	Stats() entity.CacheStats
+}
+
+// GetStats reports the hits and misses of the list cache on this replica.
+func GetStats(log *slog.Logger, getterStats GetterStats, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.cachestats.GetStats"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		log.Info("cache stats geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, getterStats.Stats())
+	}
+}
@@ -1,6 +1,7 @@
 package category
 
 import (
+	"context"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -8,6 +9,8 @@ import (
 	"inHouseAd/internal/entity"
 	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
 	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/etag"
+	"inHouseAd/internal/lib/logger/sl"
 	"inHouseAd/internal/storage/postgres"
 	"io"
 	"log/slog"
@@ -16,22 +19,28 @@ import (
 )
 
 type CreatorCategory interface {
-	Create(name string, uid int) (int, error)
+	Create(ctx context.Context, name string, uid int) (int, error)
 }
 
 type EditorCategory interface {
-	EditCategory(id int, newName string) (int, error)
+	EditCategory(ctx context.Context, id int, newName string, version int) (int, error)
 }
 
 type DeleterCategory interface {
-	DeleteCategory(id int) error
+	DeleteCategory(ctx context.Context, id, version int) error
+}
+
+// InvalidatorCategory drops the cached lists a change makes stale, see cache.Lists.
+type InvalidatorCategory interface {
+	InvalidateCategories(ctx context.Context)
+	InvalidateGoods(ctx context.Context)
 }
 
 type ListCategory interface {
-	GetCategoryList() ([]entity.CategoryList, error)
+	GetCategoryList(ctx context.Context) ([]entity.CategoryList, error)
 }
 
-func Create(log *slog.Logger, creatorCategory CreatorCategory, secret string) http.HandlerFunc {
+func Create(log *slog.Logger, creatorCategory CreatorCategory, invalidatorCategory InvalidatorCategory, secret string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goodsservice.category.Create"
 
@@ -60,7 +69,7 @@ func Create(log *slog.Logger, creatorCategory CreatorCategory, secret string) ht
 			return
 		}
 		if err != nil {
-			log.Error("failed to decode request body: ", err)
+			log.Error("failed to decode request body", sl.Err(err))
 
 			w.WriteHeader(http.StatusBadRequest)
 			render.JSON(w, r, resp.Error("failed to decode request"))
@@ -72,14 +81,21 @@ func Create(log *slog.Logger, creatorCategory CreatorCategory, secret string) ht
 
 		uid, err := uidextractor.ValidateToken(authHeader, secret)
 		if err != nil {
-			log.Error("user unauthorized: ", err)
+			log.Error("user unauthorized", sl.Err(err))
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		response.CategoryId, err = creatorCategory.Create(req.CategoryName, uid)
+		response.CategoryId, err = creatorCategory.Create(r.Context(), req.CategoryName, uid)
 		if err != nil {
-			log.Error("failed to create category: ", err)
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to create category", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -89,6 +105,8 @@ func Create(log *slog.Logger, creatorCategory CreatorCategory, secret string) ht
 
 		response.CategoryName = req.CategoryName
 
+		invalidatorCategory.InvalidateCategories(context.WithoutCancel(r.Context()))
+
 		log.Info("category created")
 
 		w.WriteHeader(http.StatusCreated)
@@ -96,7 +114,7 @@ func Create(log *slog.Logger, creatorCategory CreatorCategory, secret string) ht
 	}
 }
 
-func EditCategory(log *slog.Logger, editorCategory EditorCategory, secret string) http.HandlerFunc {
+func EditCategory(log *slog.Logger, editorCategory EditorCategory, invalidatorCategory InvalidatorCategory, secret string, requireIfMatch bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goodsservice.category.EditCategory"
 
@@ -125,7 +143,7 @@ func EditCategory(log *slog.Logger, editorCategory EditorCategory, secret string
 			return
 		}
 		if err != nil {
-			log.Error("failed to decode request body: ", err)
+			log.Error("failed to decode request body", sl.Err(err))
 
 			w.WriteHeader(http.StatusBadRequest)
 			render.JSON(w, r, resp.Error("failed to decode request"))
@@ -137,14 +155,42 @@ func EditCategory(log *slog.Logger, editorCategory EditorCategory, secret string
 
 		_, err = uidextractor.ValidateToken(authHeader, secret)
 		if err != nil {
-			log.Error("user unauthorized: ", err)
+			log.Error("user unauthorized", sl.Err(err))
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		response.CategoryId, err = editorCategory.EditCategory(req.CategoryId, req.NewName)
+		match, err := etag.IfMatch(r, requireIfMatch)
 		if err != nil {
-			log.Error("failed to edit category: ", err)
+			log.Info("precondition failed", sl.Err(err))
+			etag.WritePreconditionError(w, err)
+			return
+		}
+
+		err = match.Try(postgres.ErrVersionMismatch, func(version int) (err error) {
+			response.CategoryId, err = editorCategory.EditCategory(r.Context(), req.CategoryId, req.NewName, version)
+			return err
+		})
+		if err != nil {
+			if err == postgres.ErrVersionMismatch {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to edit category", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -154,6 +200,8 @@ func EditCategory(log *slog.Logger, editorCategory EditorCategory, secret string
 
 		response.NewName = req.NewName
 
+		invalidatorCategory.InvalidateCategories(context.WithoutCancel(r.Context()))
+
 		log.Info("category edited")
 
 		w.WriteHeader(http.StatusOK)
@@ -161,7 +209,7 @@ func EditCategory(log *slog.Logger, editorCategory EditorCategory, secret string
 	}
 }
 
-func DeleteCategory(log *slog.Logger, deleterCategory DeleterCategory, secret string) http.HandlerFunc {
+func DeleteCategory(log *slog.Logger, deleterCategory DeleterCategory, invalidatorCategory InvalidatorCategory, secret string, requireIfMatch bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goodsservice.category.DeleteCategory"
 
@@ -189,25 +237,47 @@ func DeleteCategory(log *slog.Logger, deleterCategory DeleterCategory, secret st
 
 		_, err := uidextractor.ValidateToken(authHeader, secret)
 		if err != nil {
-			log.Error("user unauthorized: ", err)
+			log.Error("user unauthorized", sl.Err(err))
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
+		match, err := etag.IfMatch(r, requireIfMatch)
+		if err != nil {
+			log.Info("precondition failed", sl.Err(err))
+			etag.WritePreconditionError(w, err)
+			return
+		}
+
 		CategoryIdInt, err := strconv.Atoi(categoryId)
 		if err != nil {
 			http.Error(w, "invalid ID", http.StatusBadRequest)
 			return
 		}
 
-		err = deleterCategory.DeleteCategory(CategoryIdInt)
+		err = match.Try(postgres.ErrVersionMismatch, func(version int) error {
+			return deleterCategory.DeleteCategory(r.Context(), CategoryIdInt, version)
+		})
 		if err != nil {
+			if err == postgres.ErrVersionMismatch {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
 			if err == postgres.ErrNotFound {
 				w.WriteHeader(http.StatusNotFound)
 
 				return
 			}
-			log.Error("failed to delete category: ", err)
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to delete category", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -218,6 +288,9 @@ func DeleteCategory(log *slog.Logger, deleterCategory DeleterCategory, secret st
 		response.CategoryId = CategoryIdInt
 		response.Deleted = true
 
+		invalidatorCategory.InvalidateCategories(context.WithoutCancel(r.Context()))
+		invalidatorCategory.InvalidateGoods(context.WithoutCancel(r.Context()))
+
 		log.Info("category deleted")
 
 		w.WriteHeader(http.StatusOK)
@@ -236,14 +309,21 @@ func GetCategoryList(log *slog.Logger, listCategory ListCategory) http.HandlerFu
 
 		var response []entity.CategoryList
 
-		response, err := listCategory.GetCategoryList()
+		response, err := listCategory.GetCategoryList(r.Context())
 		if err != nil {
 			if err == postgres.ErrNotFound {
 				w.WriteHeader(http.StatusNotFound)
 
 				return
 			}
-			log.Error("failed to get category list: ", err)
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get category list", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -253,6 +333,19 @@ func GetCategoryList(log *slog.Logger, listCategory ListCategory) http.HandlerFu
 
 		log.Info("category list geted")
 
+		tag, err := etag.Hash(response)
+		if err != nil {
+			log.Error("failed to compute etag", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+		if etag.NotModified(w, r, tag) {
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
 		render.JSON(w, r, response)
 	}
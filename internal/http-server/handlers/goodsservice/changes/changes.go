@@ -0,0 +1,105 @@
+package changes
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	changebus "inHouseAd/internal/lib/changes"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// heartbeat is how often an idle stream gets a comment, so that proxies keep it open.
+const heartbeat = 15 * time.Second
+
+type Subscriber interface {
+	Subscribe(name string) (<-chan entity.Change, func())
+}
+
+// Stream sends the catalog changes as server-sent events, each a "change" event with the change
+// as JSON, until the client goes away or stop is closed. A "resync" event means changes were
+// missed and the client should reload what it shows.
+func Stream(log *slog.Logger, subscriber Subscriber, stop <-chan struct{}, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.changes.Stream"
+
+		reqId := middleware.GetReqID(r.Context())
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", reqId),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			log.Warn("failed to lift write deadline", sl.Err(err))
+		}
+
+		events, unsubscribe := subscriber.Subscribe("stream:" + reqId)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			log.Error("failed to flush stream", sl.Err(err))
+			return
+		}
+
+		log.Info("change stream opened")
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			var err error
+
+			select {
+			case <-r.Context().Done():
+				log.Info("change stream closed by client")
+				return
+			case <-stop:
+				log.Info("change stream closed on shutdown")
+				return
+			case <-ticker.C:
+				_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			case c := <-events:
+				event := "change"
+				if c.Op == changebus.OpResync {
+					event = "resync"
+				}
+
+				var data []byte
+				if data, err = json.Marshal(c); err == nil {
+					_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+				}
+			}
+
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				log.Warn("change stream broken", sl.Err(err))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"golang.org/x/crypto/bcrypt"
+	"inHouseAd/internal/http-server/handlers/auth/signin"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	"inHouseAd/internal/lib/accesstoken"
+	"inHouseAd/internal/lib/commerceml"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/storage/postgres"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// cookieName is the session cookie 1C sends back after checkauth.
+const cookieName = "exchange_token"
+
+type Exchanger interface {
+	Init(uid int) error
+	Save(uid int, filename string, r io.Reader) error
+	Import(uid int, filename string) commerceml.Result
+}
+
+// Exchange implements the catalog part of the 1C exchange protocol. 1C authenticates with
+// checkauth (basic auth with the user's email and password), then calls init, uploads the files
+// with file and imports them one by one with import, repeating the call while it answers progress.
+// Answers are plain text lines, as 1C expects. Uploads may take up to timeout, the server
+// read timeout is too short for big files.
+func Exchange(log *slog.Logger, authorization signin.Authorization, exchanger Exchanger, fileLimit int64, timeout time.Duration, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.exchange.Exchange"
+
+		mode := r.URL.Query().Get("mode")
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("mode", mode),
+		)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		if t := r.URL.Query().Get("type"); t != "catalog" {
+			log.Info("unsupported exchange type", slog.String("type", t))
+			reply(w, http.StatusOK, commerceml.StatusFailure, "only catalog exchange is supported")
+			return
+		}
+
+		if mode == "checkauth" {
+			email, password, ok := r.BasicAuth()
+			if !ok {
+				log.Error("user unauthorized: basic auth is missing")
+				reply(w, http.StatusUnauthorized, commerceml.StatusFailure, "basic auth is required")
+				return
+			}
+
+			passwordHashed, uid, err := authorization.Authorizate(r.Context(), email)
+			if err != nil {
+				if errors.Is(err, signin.ErrInvalidEmail) {
+					log.Error("incorrect email", sl.Err(err))
+					reply(w, http.StatusUnauthorized, commerceml.StatusFailure, "incorrect credentials")
+					return
+				}
+				if postgres.Interrupted(err) {
+					log.Warn("request canceled", sl.Err(err))
+					reply(w, http.StatusServiceUnavailable, commerceml.StatusFailure, "request canceled")
+					return
+				}
+				log.Error("failed to get password", sl.Err(err))
+				reply(w, http.StatusInternalServerError, commerceml.StatusFailure, "internal error")
+				return
+			}
+
+			if err := bcrypt.CompareHashAndPassword(passwordHashed, []byte(password)); err != nil {
+				log.Error("invalid password", sl.Err(err))
+				reply(w, http.StatusUnauthorized, commerceml.StatusFailure, "incorrect credentials")
+				return
+			}
+
+			token, err := accesstoken.Generate(secret, uid, time.Hour*24)
+			if err != nil {
+				log.Error("failed to generate token", sl.Err(err))
+				reply(w, http.StatusInternalServerError, commerceml.StatusFailure, "internal error")
+				return
+			}
+
+			log.Info("exchange session started", slog.Int("uid", uid))
+
+			reply(w, http.StatusOK, commerceml.StatusSuccess, cookieName, token)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if cookie, err := r.Cookie(cookieName); err == nil {
+			authHeader = "Bearer " + cookie.Value
+		}
+		if authHeader == "" {
+			log.Error("user unauthorized: session cookie is missing")
+			reply(w, http.StatusUnauthorized, commerceml.StatusFailure, "call checkauth first")
+			return
+		}
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			reply(w, http.StatusUnauthorized, commerceml.StatusFailure, err.Error())
+			return
+		}
+
+		filename := r.URL.Query().Get("filename")
+
+		switch mode {
+		case "init":
+			if err := exchanger.Init(uid); err != nil {
+				log.Error("failed to init exchange", sl.Err(err))
+				reply(w, http.StatusInternalServerError, commerceml.StatusFailure, "internal error")
+				return
+			}
+
+			reply(w, http.StatusOK, "zip=no", fmt.Sprintf("file_limit=%d", fileLimit))
+
+		case "file":
+			// The server's write deadline counts from the start of the request too, so the answer
+			// to a long upload would be cut off without extending it as well.
+			rc := http.NewResponseController(w)
+			if err := rc.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+				log.Warn("failed to extend read deadline", sl.Err(err))
+			}
+			if err := rc.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+				log.Warn("failed to extend write deadline", sl.Err(err))
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, fileLimit)
+
+			if err := exchanger.Save(uid, filename, r.Body); err != nil {
+				if errors.Is(err, commerceml.ErrInvalidFilename) {
+					reply(w, http.StatusBadRequest, commerceml.StatusFailure, err.Error())
+					return
+				}
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					reply(w, http.StatusRequestEntityTooLarge, commerceml.StatusFailure, fmt.Sprintf("file exceeds %d bytes", fileLimit))
+					return
+				}
+				log.Error("failed to save exchange file", sl.Err(err))
+				reply(w, http.StatusInternalServerError, commerceml.StatusFailure, "internal error")
+				return
+			}
+
+			log.Info("exchange file saved", slog.String("filename", filename))
+
+			reply(w, http.StatusOK, commerceml.StatusSuccess)
+
+		case "import":
+			result := exchanger.Import(uid, filename)
+
+			log.Info("exchange import polled", slog.String("filename", filename), slog.String("status", result.Status))
+
+			reply(w, http.StatusOK, result.Status, result.Message)
+
+		case "complete", "deactivate":
+			reply(w, http.StatusOK, commerceml.StatusSuccess)
+
+		default:
+			reply(w, http.StatusOK, commerceml.StatusFailure, fmt.Sprintf("unknown mode %q", mode))
+		}
+	}
+}
+
+func reply(w http.ResponseWriter, status int, lines ...string) {
+	w.WriteHeader(status)
+	for _, line := range lines {
+		io.WriteString(w, line+"\n")
+	}
+}
@@ -0,0 +1,354 @@
+package exportjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	resp "inHouseAd/internal/lib/api/response"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/exporter"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/storage/postgres"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type CreatorExport interface {
+	CreateExportJob(ctx context.Context, job entity.ExportJob) (int, error)
+}
+
+type GetterExport interface {
+	GetExportJob(ctx context.Context, id int) (entity.ExportJob, error)
+}
+
+type Enqueuer interface {
+	Enqueue(id int)
+}
+
+// Export streams the goods in the requested format. The query parameters are those of the good
+// list (category_id, filter, collapse_variants) plus format; without category_id the whole catalog
+// is exported. The write deadline is extended to timeout, the server one is too short for big catalogs.
+func Export(log *slog.Logger, source exporter.Source, timeout time.Duration, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.exportjob.Export"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		format, query, err := parseQuery(r)
+		if err != nil {
+			log.Info("invalid export query", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		export, err := exporter.Prepare(r.Context(), source, query)
+		if err != nil {
+			if errors.Is(err, attr.ErrInvalidFilter) {
+				log.Info("invalid filter", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to prepare export", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			log.Warn("failed to extend write deadline", sl.Err(err))
+		}
+
+		w.Header().Set("Content-Type", exporter.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="goods.%s"`, format))
+		w.WriteHeader(http.StatusOK)
+
+		// The status is already sent, a failure can only cut the download short.
+		rows, err := export.WriteTo(r.Context(), format, w)
+		if err != nil {
+			if r.Context().Err() != nil {
+				log.Warn("export canceled", slog.Int("rows", rows), sl.Err(err))
+				return
+			}
+			log.Error("export interrupted", slog.Int("rows", rows), sl.Err(err))
+			return
+		}
+
+		log.Info("goods exported", slog.Int("rows", rows))
+	}
+}
+
+// Create queues an export job with the same query parameters as Export.
+// The file is stored in the blob store and linked from the job once it is done.
+func Create(log *slog.Logger, creatorExport CreatorExport, enqueuer Enqueuer, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.exportjob.Create"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		format, query, err := parseQuery(r)
+		if err != nil {
+			log.Info("invalid export query", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		if _, err := attr.ParseFilters(query.Filters); err != nil {
+			log.Info("invalid filter", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		id, err := creatorExport.CreateExportJob(r.Context(), entity.ExportJob{Uid: uid, Format: format, Query: query})
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to create export job", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		enqueuer.Enqueue(id)
+
+		log.Info("export queued", slog.Int("export_id", id))
+
+		w.WriteHeader(http.StatusAccepted)
+		render.JSON(w, r, entity.ExportCreateResponse{ExportId: id, Status: exporter.StatusPending})
+	}
+}
+
+type GetterBlob interface {
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// GetExport reports an export job; once it is completed, url is where its file is downloaded.
+func GetExport(log *slog.Logger, getterExport GetterExport, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.exportjob.GetExport"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		job, ok := ownExport(log, getterExport, secret, w, r)
+		if !ok {
+			return
+		}
+
+		if job.BlobKey != "" {
+			job.Url = fmt.Sprintf("/export/job/%d/file", job.ExportId)
+		}
+
+		log.Info("export job geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, job)
+	}
+}
+
+// Download sends the file of a completed export job. Export files are kept in the private blob
+// store, so they are only ever served to the user who requested them.
+func Download(log *slog.Logger, getterExport GetterExport, getterBlob GetterBlob, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.exportjob.Download"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		job, ok := ownExport(log, getterExport, secret, w, r)
+		if !ok {
+			return
+		}
+
+		if job.BlobKey == "" {
+			w.WriteHeader(http.StatusConflict)
+			render.JSON(w, r, resp.Error("export is not completed"))
+			return
+		}
+
+		file, err := getterBlob.Get(r.Context(), job.BlobKey)
+		if err != nil {
+			if errors.Is(err, blobstore.ErrNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			log.Error("failed to open export file", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", exporter.ContentType(job.Format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="goods-%d.%s"`, job.ExportId, job.Format))
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := io.Copy(w, file); err != nil {
+			log.Warn("export download interrupted", sl.Err(err))
+			return
+		}
+
+		log.Info("export file downloaded", slog.Int("export_id", job.ExportId))
+	}
+}
+
+// ownExport loads the export job of the id URL parameter and checks that it belongs to the caller,
+// writing the error response when it does not.
+func ownExport(log *slog.Logger, getterExport GetterExport, secret string, w http.ResponseWriter, r *http.Request) (entity.ExportJob, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		log.Error("user unauthorized: authorization header is missing")
+		http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+		return entity.ExportJob{}, false
+	}
+
+	exportId := chi.URLParam(r, "id")
+	if exportId == "" {
+		log.Info("export id is empty")
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, resp.Error("export id parameter is required"))
+		return entity.ExportJob{}, false
+	}
+
+	uid, err := uidextractor.ValidateToken(authHeader, secret)
+	if err != nil {
+		log.Error("user unauthorized", sl.Err(err))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return entity.ExportJob{}, false
+	}
+
+	exportIdInt, err := strconv.Atoi(exportId)
+	if err != nil {
+		http.Error(w, "invalid ID", http.StatusBadRequest)
+		return entity.ExportJob{}, false
+	}
+
+	job, err := getterExport.GetExportJob(r.Context(), exportIdInt)
+	if err != nil {
+		if err == postgres.ErrNotFound {
+			w.WriteHeader(http.StatusNotFound)
+
+			return entity.ExportJob{}, false
+		}
+		if postgres.Interrupted(err) {
+			log.Warn("request canceled", sl.Err(err))
+
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return entity.ExportJob{}, false
+		}
+		log.Error("failed to get export job", sl.Err(err))
+
+		w.WriteHeader(http.StatusInternalServerError)
+		render.JSON(w, r, resp.Error("internal error"))
+
+		return entity.ExportJob{}, false
+	}
+
+	// Jobs are private to the user who requested them.
+	if job.Uid != uid {
+		w.WriteHeader(http.StatusNotFound)
+		return entity.ExportJob{}, false
+	}
+
+	return job, true
+}
+
+func parseQuery(r *http.Request) (string, entity.ExportQuery, error) {
+	values := r.URL.Query()
+
+	format := values.Get("format")
+	if format == "" {
+		format = exporter.FormatCSV
+	}
+	if format != exporter.FormatCSV && format != exporter.FormatJSONL && format != exporter.FormatXLSX {
+		return "", entity.ExportQuery{}, exporter.ErrUnsupportedFormat
+	}
+
+	query := entity.ExportQuery{Filters: values["filter"]}
+
+	if raw := values.Get("category_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return "", entity.ExportQuery{}, errors.New("invalid category_id")
+		}
+		query.CategoryId = id
+	}
+
+	if raw := values.Get("collapse_variants"); raw != "" {
+		collapse, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", entity.ExportQuery{}, errors.New("invalid collapse_variants")
+		}
+		query.CollapseVariants = collapse
+	}
+
+	return format, query, nil
+}
@@ -0,0 +1,102 @@
+package feed
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/etag"
+	feedgen "inHouseAd/internal/lib/feed"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+)
+
+type GetterFeed interface {
+	Get(format string) (feedgen.Feed, bool)
+}
+
+// GetFeed serves a cached marketplace feed. It is public: marketplaces fetch it without a token.
+func GetFeed(log *slog.Logger, getterFeed GetterFeed) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.feed.GetFeed"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		f, ok := lookup(w, r, log, getterFeed)
+		if !ok {
+			return
+		}
+
+		if etag.NotModified(w, r, f.ETag) {
+			return
+		}
+
+		log.Info("feed geted")
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Last-Modified", f.Report.GeneratedAt.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		w.Write(f.Body)
+	}
+}
+
+// GetReport lists the goods left out of the feed with the reasons.
+func GetReport(log *slog.Logger, getterFeed GetterFeed, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.feed.GetReport"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		f, ok := lookup(w, r, log, getterFeed)
+		if !ok {
+			return
+		}
+
+		log.Info("feed report geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, f.Report)
+	}
+}
+
+func lookup(w http.ResponseWriter, r *http.Request, log *slog.Logger, getterFeed GetterFeed) (feedgen.Feed, bool) {
+	format := chi.URLParam(r, "format")
+	if format != feedgen.FormatYML && format != feedgen.FormatGoogle {
+		log.Info("unknown feed format", slog.String("format", format))
+		w.WriteHeader(http.StatusNotFound)
+		render.JSON(w, r, resp.Error(feedgen.ErrUnknownFormat.Error()))
+		return feedgen.Feed{}, false
+	}
+
+	f, ok := getterFeed.Get(format)
+	if !ok {
+		log.Info("feed is not generated yet", slog.String("format", format))
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		render.JSON(w, r, resp.Error("feed is being generated"))
+		return feedgen.Feed{}, false
+	}
+
+	return f, true
+}
@@ -1,6 +1,7 @@
 package good
 
 import (
+	"context"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -8,30 +9,73 @@ import (
 	"inHouseAd/internal/entity"
 	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
 	resp "inHouseAd/internal/lib/api/response"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/etag"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/lib/variant"
 	"inHouseAd/internal/storage/postgres"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
 )
 
 type AdderGood interface {
-	AddGood(goodName string, categoryId int) (int, string, error)
+	AddGood(ctx context.Context, goodName string, categoryId int, attributes map[string]any, actorUid int) (int, string, error)
 }
 
 type UpdaterGood interface {
-	UpdateGood(goodId, categoryIdToAdd int, goodName string) (int, []string, string, error)
+	UpdateGood(ctx context.Context, goodId, categoryIdToAdd int, goodName string, version, actorUid int) (int, []string, string, error)
 }
 
 type DeleterGood interface {
-	DeleteGood(id int) error
+	DeleteGood(ctx context.Context, id, version, actorUid int) error
+}
+
+// InvalidatorGood drops the cached good lists a change makes stale, see cache.Lists.
+type InvalidatorGood interface {
+	InvalidateGoods(ctx context.Context)
 }
 
 type ListGood interface {
-	GetGoodList(categoryId int) ([]entity.GoodList, error)
+	GetGoodList(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]entity.GoodList, error)
+}
+
+type GetterGood interface {
+	GetGood(ctx context.Context, id int) (entity.GoodDetail, error)
+}
+
+type AttributeSetterGood interface {
+	SetGoodAttributes(ctx context.Context, goodId int, values map[string]any, version, actorUid int) (map[string]any, error)
+}
+
+type GeneratorVariant interface {
+	GenerateVariants(ctx context.Context, parentId int, axes []entity.VariantAxis, skuPrefix string, price *float64, stock, actorUid int) ([]entity.GoodVariant, int, error)
+}
+
+type ListVariant interface {
+	GetVariantList(ctx context.Context, parentId int) ([]entity.GoodVariant, error)
+}
+
+type HistoryGood interface {
+	GetGoodHistory(ctx context.Context, goodId int) ([]entity.GoodRevision, error)
+}
+
+type ReverterGood interface {
+	RevertGood(ctx context.Context, goodId, rev, actorUid int) (entity.GoodRevertResponse, error)
+}
+
+type UpdaterOffer interface {
+	UpdateOffer(ctx context.Context, goodId int, sku *string, price *float64, stock *int, version, actorUid int) (entity.GoodVariant, error)
 }
 
-func Create(log *slog.Logger, adderGood AdderGood, secret string) http.HandlerFunc {
+type DuplicatesGood interface {
+	GetNearDuplicates(ctx context.Context, threshold float64, limit int) ([]entity.NearDuplicate, error)
+}
+
+func Create(log *slog.Logger, adderGood AdderGood, invalidatorGood InvalidatorGood, secret string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goodsservice.good.Create"
 
@@ -68,7 +112,7 @@ func Create(log *slog.Logger, adderGood AdderGood, secret string) http.HandlerFu
 			return
 		}
 		if err != nil {
-			log.Error("failed to decode request body: ", err)
+			log.Error("failed to decode request body", sl.Err(err))
 
 			w.WriteHeader(http.StatusBadRequest)
 			render.JSON(w, r, resp.Error("failed to decode request"))
@@ -78,9 +122,9 @@ func Create(log *slog.Logger, adderGood AdderGood, secret string) http.HandlerFu
 
 		log.Info("request body decoded", slog.Any("request", req))
 
-		_, err = uidextractor.ValidateToken(authHeader, secret)
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
 		if err != nil {
-			log.Error("user unauthorized: ", err)
+			log.Error("user unauthorized", sl.Err(err))
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
@@ -91,9 +135,30 @@ func Create(log *slog.Logger, adderGood AdderGood, secret string) http.HandlerFu
 			return
 		}
 
-		response.GoodId, response.CategoryName, err = adderGood.AddGood(req.GoodName, categoryIdInt)
+		response.GoodId, response.CategoryName, err = adderGood.AddGood(r.Context(), req.GoodName, categoryIdInt, req.Attributes, uid)
 		if err != nil {
-			log.Error("failed to create category: ", err)
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				render.JSON(w, r, resp.Error("category not found"))
+
+				return
+			}
+			if errors.Is(err, attr.ErrInvalidValue) {
+				log.Info("invalid attribute values", sl.Err(err))
+
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to create category", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -104,6 +169,8 @@ func Create(log *slog.Logger, adderGood AdderGood, secret string) http.HandlerFu
 		response.GoodName = req.GoodName
 		response.GoodCategoryId = categoryIdInt
 
+		invalidatorGood.InvalidateGoods(context.WithoutCancel(r.Context()))
+
 		log.Info("category created")
 
 		w.WriteHeader(http.StatusCreated)
@@ -111,7 +178,7 @@ func Create(log *slog.Logger, adderGood AdderGood, secret string) http.HandlerFu
 	}
 }
 
-func UpdateGood(log *slog.Logger, updaterGood UpdaterGood, secret string) http.HandlerFunc {
+func UpdateGood(log *slog.Logger, updaterGood UpdaterGood, invalidatorGood InvalidatorGood, secret string, requireIfMatch bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goodsservice.good.UpdateGood"
 
@@ -139,7 +206,7 @@ func UpdateGood(log *slog.Logger, updaterGood UpdaterGood, secret string) http.H
 			return
 		}
 		if err != nil {
-			log.Error("failed to decode request body: ", err)
+			log.Error("failed to decode request body", sl.Err(err))
 
 			w.WriteHeader(http.StatusBadRequest)
 			render.JSON(w, r, resp.Error("failed to decode request"))
@@ -149,16 +216,57 @@ func UpdateGood(log *slog.Logger, updaterGood UpdaterGood, secret string) http.H
 
 		log.Info("request body decoded", slog.Any("request", req))
 
-		_, err = uidextractor.ValidateToken(authHeader, secret)
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
 		if err != nil {
-			log.Error("user unauthorized: ", err)
+			log.Error("user unauthorized", sl.Err(err))
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		goodId, categoryNames, goodName, err := updaterGood.UpdateGood(req.GoodId, req.AddedCategoryId, req.GoodActualName)
+		match, err := etag.IfMatch(r, requireIfMatch)
 		if err != nil {
-			log.Error("failed to update good: ", err)
+			log.Info("precondition failed", sl.Err(err))
+			etag.WritePreconditionError(w, err)
+			return
+		}
+
+		var (
+			goodId        int
+			categoryNames []string
+			goodName      string
+		)
+		err = match.Try(postgres.ErrVersionMismatch, func(version int) (err error) {
+			goodId, categoryNames, goodName, err = updaterGood.UpdateGood(r.Context(), req.GoodId, req.AddedCategoryId, req.GoodActualName, version, uid)
+			return err
+		})
+		if err != nil {
+			if err == postgres.ErrVersionMismatch {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if errors.Is(err, attr.ErrInvalidValue) {
+				log.Info("invalid attribute values", sl.Err(err))
+
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to update good", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -172,6 +280,8 @@ func UpdateGood(log *slog.Logger, updaterGood UpdaterGood, secret string) http.H
 			GoodName:     goodName,
 		}
 
+		invalidatorGood.InvalidateGoods(context.WithoutCancel(r.Context()))
+
 		log.Info("good updated")
 
 		w.WriteHeader(http.StatusOK)
@@ -179,7 +289,7 @@ func UpdateGood(log *slog.Logger, updaterGood UpdaterGood, secret string) http.H
 	}
 }
 
-func DeleteGood(log *slog.Logger, deleterGood DeleterGood, secret string) http.HandlerFunc {
+func DeleteGood(log *slog.Logger, deleterGood DeleterGood, invalidatorGood InvalidatorGood, secret string, requireIfMatch bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goodsservice.good.DeleteGood"
 
@@ -205,27 +315,49 @@ func DeleteGood(log *slog.Logger, deleterGood DeleterGood, secret string) http.H
 			return
 		}
 
-		_, err := uidextractor.ValidateToken(authHeader, secret)
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
 		if err != nil {
-			log.Error("user unauthorized: ", err)
+			log.Error("user unauthorized", sl.Err(err))
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
+		match, err := etag.IfMatch(r, requireIfMatch)
+		if err != nil {
+			log.Info("precondition failed", sl.Err(err))
+			etag.WritePreconditionError(w, err)
+			return
+		}
+
 		GoodIdInt, err := strconv.Atoi(goodId)
 		if err != nil {
 			http.Error(w, "invalid ID", http.StatusBadRequest)
 			return
 		}
 
-		err = deleterGood.DeleteGood(GoodIdInt)
+		err = match.Try(postgres.ErrVersionMismatch, func(version int) error {
+			return deleterGood.DeleteGood(r.Context(), GoodIdInt, version, uid)
+		})
 		if err != nil {
+			if err == postgres.ErrVersionMismatch {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
 			if err == postgres.ErrNotFound {
 				w.WriteHeader(http.StatusNotFound)
 
 				return
 			}
-			log.Error("failed to delete good: ", err)
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to delete good", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -236,6 +368,8 @@ func DeleteGood(log *slog.Logger, deleterGood DeleterGood, secret string) http.H
 		response.GoodId = GoodIdInt
 		response.Deleted = true
 
+		invalidatorGood.InvalidateGoods(context.WithoutCancel(r.Context()))
+
 		log.Info("good deleted")
 
 		w.WriteHeader(http.StatusOK)
@@ -243,7 +377,7 @@ func DeleteGood(log *slog.Logger, deleterGood DeleterGood, secret string) http.H
 	}
 }
 
-func GetGoodList(log *slog.Logger, listGood ListGood) http.HandlerFunc {
+func GetGoodList(log *slog.Logger, listGood ListGood, urler blobstore.URLer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.goodsservice.good.GetGoodList"
 
@@ -268,14 +402,44 @@ func GetGoodList(log *slog.Logger, listGood ListGood) http.HandlerFunc {
 			return
 		}
 
-		response, err = listGood.GetGoodList(categoryIdInt)
+		filters, err := attr.ParseFilters(r.URL.Query()["filter"])
+		if err != nil {
+			log.Info("invalid filter", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		var collapseVariants bool
+		if raw := r.URL.Query().Get("collapse_variants"); raw != "" {
+			collapseVariants, err = strconv.ParseBool(raw)
+			if err != nil {
+				http.Error(w, "invalid collapse_variants", http.StatusBadRequest)
+				return
+			}
+		}
+
+		response, err = listGood.GetGoodList(r.Context(), categoryIdInt, filters, collapseVariants)
 		if err != nil {
+			if errors.Is(err, attr.ErrInvalidFilter) {
+				log.Info("invalid filter", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+				return
+			}
 			if err == postgres.ErrNotFound {
 				w.WriteHeader(http.StatusNotFound)
 
 				return
 			}
-			log.Error("failed to get good list: ", err)
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get good list", sl.Err(err))
 
 			w.WriteHeader(http.StatusInternalServerError)
 			render.JSON(w, r, resp.Error("internal error"))
@@ -283,8 +447,705 @@ func GetGoodList(log *slog.Logger, listGood ListGood) http.HandlerFunc {
 			return
 		}
 
+		for i := range response {
+			blobstore.ResolveImage(urler, response[i].Image)
+		}
+
 		log.Info("good list geted ")
 
+		tag, err := etag.Hash(response)
+		if err != nil {
+			log.Error("failed to compute etag", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+		if etag.NotModified(w, r, tag) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func SetAttributes(log *slog.Logger, attributeSetterGood AttributeSetterGood, invalidatorGood InvalidatorGood, secret string, requireIfMatch bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.good.SetAttributes"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req entity.GoodAttributesRequest
+		var response entity.GoodAttributesResponse
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("empty request"))
+
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		match, err := etag.IfMatch(r, requireIfMatch)
+		if err != nil {
+			log.Info("precondition failed", sl.Err(err))
+			etag.WritePreconditionError(w, err)
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		err = match.Try(postgres.ErrVersionMismatch, func(version int) (err error) {
+			response.Attributes, err = attributeSetterGood.SetGoodAttributes(r.Context(), goodIdInt, req.Attributes, version, uid)
+			return err
+		})
+		if err != nil {
+			if err == postgres.ErrVersionMismatch {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if errors.Is(err, attr.ErrInvalidValue) {
+				log.Info("invalid attribute values", sl.Err(err))
+
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to set good attributes", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		response.GoodId = goodIdInt
+
+		invalidatorGood.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("good attributes updated")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func GenerateVariants(log *slog.Logger, generatorVariant GeneratorVariant, invalidatorGood InvalidatorGood, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.good.GenerateVariants"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req entity.VariantsGenerateRequest
+		var response entity.VariantsGenerateResponse
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("empty request"))
+
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := variant.ValidateAxes(req.Axes); err != nil {
+			log.Info("invalid variant axes", sl.Err(err))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		if req.Stock < 0 || (req.Price != nil && *req.Price < 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("price and stock must not be negative"))
+			return
+		}
+
+		response.Created, response.Skipped, err = generatorVariant.GenerateVariants(r.Context(), goodIdInt, req.Axes, req.SkuPrefix, req.Price, req.Stock, uid)
+		if err != nil {
+			switch {
+			case err == postgres.ErrNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				return
+			case errors.Is(err, attr.ErrInvalidValue), err == postgres.ErrNotParent, err == postgres.ErrAxesMismatch:
+				log.Info("variants rejected", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+				return
+			case err == postgres.ErrSkuTaken:
+				log.Info("variants rejected", sl.Err(err))
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Error(err.Error()))
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to generate variants", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		response.ParentId = goodIdInt
+
+		invalidatorGood.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("variants generated", slog.Int("created", len(response.Created)), slog.Int("skipped", response.Skipped))
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, response)
+	}
+}
+
+func GetVariantList(log *slog.Logger, listVariant ListVariant) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.good.GetVariantList"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		response, err := listVariant.GetVariantList(r.Context(), goodIdInt)
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get variant list", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("variant list geted")
+
+		tag, err := etag.Hash(response)
+		if err != nil {
+			log.Error("failed to compute etag", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+		if etag.NotModified(w, r, tag) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func UpdateOffer(log *slog.Logger, updaterOffer UpdaterOffer, invalidatorGood InvalidatorGood, secret string, requireIfMatch bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.good.UpdateOffer"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req entity.GoodOfferUpdateRequest
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("empty request"))
+
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		match, err := etag.IfMatch(r, requireIfMatch)
+		if err != nil {
+			log.Info("precondition failed", sl.Err(err))
+			etag.WritePreconditionError(w, err)
+			return
+		}
+
+		if (req.Stock != nil && *req.Stock < 0) || (req.Price != nil && *req.Price < 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("price and stock must not be negative"))
+			return
+		}
+
+		var response entity.GoodVariant
+		err = match.Try(postgres.ErrVersionMismatch, func(version int) (err error) {
+			response, err = updaterOffer.UpdateOffer(r.Context(), req.GoodId, req.Sku, req.Price, req.Stock, version, uid)
+			return err
+		})
+		if err != nil {
+			if err == postgres.ErrVersionMismatch {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if err == postgres.ErrSkuTaken {
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to update offer", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		invalidatorGood.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("offer updated")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func GetGood(log *slog.Logger, getterGood GetterGood, urler blobstore.URLer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.good.GetGood"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		response, err := getterGood.GetGood(r.Context(), goodIdInt)
+		if err != nil {
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get good", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		for i := range response.Images {
+			blobstore.ResolveImage(urler, &response.Images[i])
+		}
+
+		log.Info("good geted")
+
+		tag, err := etag.Derived(response.Version, response)
+		if err != nil {
+			log.Error("failed to compute etag", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+		if etag.NotModified(w, r, tag) {
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func GetHistory(log *slog.Logger, historyGood HistoryGood, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.good.GetHistory"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		_, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		response, err := historyGood.GetGoodHistory(r.Context(), goodIdInt)
+		if err != nil {
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get good history", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("good history geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func Revert(log *slog.Logger, reverterGood ReverterGood, invalidatorGood InvalidatorGood, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.good.Revert"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		goodId := chi.URLParam(r, "id")
+		rev := chi.URLParam(r, "rev")
+		if goodId == "" || rev == "" {
+			log.Info("good id or revision is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id and revision parameters are required"))
+			return
+		}
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		revInt, err := strconv.Atoi(rev)
+		if err != nil {
+			http.Error(w, "invalid revision", http.StatusBadRequest)
+			return
+		}
+
+		response, err := reverterGood.RevertGood(r.Context(), goodIdInt, revInt, uid)
+		if err != nil {
+			switch err {
+			case postgres.ErrNotFound:
+				w.WriteHeader(http.StatusNotFound)
+			case postgres.ErrRevertDeleted:
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+			case postgres.ErrSkuTaken, postgres.ErrParentDeleted:
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Error(err.Error()))
+			default:
+				if postgres.Interrupted(err) {
+					log.Warn("request canceled", sl.Err(err))
+
+					w.WriteHeader(http.StatusServiceUnavailable)
+
+					return
+				}
+				log.Error("failed to revert good", sl.Err(err))
+
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("internal error"))
+			}
+
+			return
+		}
+
+		invalidatorGood.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("good reverted", slog.Int("rev", revInt))
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+// GetDuplicates lists pairs of goods with similar names across the catalog, for merging by hand.
+func GetDuplicates(log *slog.Logger, duplicatesGood DuplicatesGood, defaultThreshold float64, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.good.GetDuplicates"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		_, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		threshold := defaultThreshold
+		if raw := r.URL.Query().Get("threshold"); raw != "" {
+			threshold, err = strconv.ParseFloat(raw, 64)
+			if err != nil || math.IsNaN(threshold) || threshold <= 0 || threshold > 1 {
+				http.Error(w, "invalid threshold", http.StatusBadRequest)
+				return
+			}
+		}
+
+		limit := 100
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > 1000 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		response, err := duplicatesGood.GetNearDuplicates(r.Context(), threshold, limit)
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get near duplicates", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("near duplicates geted")
+
 		w.WriteHeader(http.StatusOK)
 		render.JSON(w, r, response)
 	}
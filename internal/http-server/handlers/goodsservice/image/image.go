@@ -0,0 +1,585 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/lib/thumbnail"
+	"inHouseAd/internal/storage/postgres"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// KeyPrefix starts the blob keys of the images and their thumbnails, the only keys of the media
+// store served publicly.
+const KeyPrefix = "goods/"
+
+const (
+	// formField is the multipart field carrying the uploaded files; several files may be sent at once.
+	formField = "image"
+	maxFiles  = 10
+)
+
+var errDecode = errors.New("failed to decode image")
+
+// InvalidatorImage drops the cached good lists, which show the primary image, see cache.Lists.
+type InvalidatorImage interface {
+	InvalidateGoods(ctx context.Context)
+}
+
+type AdderImage interface {
+	AddGoodImage(ctx context.Context, img entity.GoodImage) (entity.GoodImage, error)
+}
+
+type ListImage interface {
+	GetGoodImages(ctx context.Context, goodId int) ([]entity.GoodImage, error)
+}
+
+type DeleterImage interface {
+	DeleteGoodImage(ctx context.Context, imageId int) (entity.GoodImage, error)
+}
+
+type ReordererImage interface {
+	ReorderGoodImages(ctx context.Context, goodId int, imageIds []int) ([]entity.GoodImage, error)
+}
+
+type PrimarySetterImage interface {
+	SetPrimaryImage(ctx context.Context, imageId int) (entity.GoodImage, error)
+}
+
+func Upload(log *slog.Logger, adderImage AdderImage, invalidatorImage InvalidatorImage, store blobstore.BlobStore, maxSize, maxPixels int64, thumbnailSizes []int, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.image.Upload"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		_, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		// Leave some room for the multipart envelope on top of the image itself.
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize*int64(maxFiles)+1<<20)
+
+		if err := r.ParseMultipartForm(maxSize); err != nil {
+			log.Info("failed to parse multipart form", sl.Err(err))
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to parse multipart form"))
+
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		files := r.MultipartForm.File[formField]
+		if len(files) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(fmt.Sprintf("multipart field %q is required", formField)))
+			return
+		}
+		if len(files) > maxFiles {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(fmt.Sprintf("at most %d images per request", maxFiles)))
+			return
+		}
+
+		response := make([]entity.GoodImage, 0, len(files))
+
+		for _, fh := range files {
+			if fh.Size > maxSize {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				render.JSON(w, r, resp.Error(fmt.Sprintf("%s exceeds %d bytes", fh.Filename, maxSize)))
+				return
+			}
+
+			data, err := readFile(fh)
+			if err != nil {
+				log.Error("failed to read uploaded file", sl.Err(err))
+
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("failed to read uploaded file"))
+
+				return
+			}
+
+			img, err := saveBlobs(r, store, goodIdInt, data, maxPixels, thumbnailSizes)
+			if err != nil {
+				if errors.Is(err, thumbnail.ErrTooManyPixels) {
+					log.Info("image too large", slog.String("file", fh.Filename), sl.Err(err))
+
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					render.JSON(w, r, resp.Error(fmt.Sprintf("%s: %s", fh.Filename, err)))
+
+					return
+				}
+				if errors.Is(err, thumbnail.ErrUnsupportedType) || errors.Is(err, errDecode) {
+					log.Info("invalid image", slog.String("file", fh.Filename), sl.Err(err))
+
+					w.WriteHeader(http.StatusUnsupportedMediaType)
+					render.JSON(w, r, resp.Error(fmt.Sprintf("%s: %s", fh.Filename, err)))
+
+					return
+				}
+				removeBlobs(r, log, store, img)
+				log.Error("failed to store image", sl.Err(err))
+
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("internal error"))
+
+				return
+			}
+
+			stored, err := adderImage.AddGoodImage(r.Context(), img)
+			if err != nil {
+				removeBlobs(r, log, store, img)
+
+				if err == postgres.ErrNotFound {
+					w.WriteHeader(http.StatusNotFound)
+
+					return
+				}
+				if postgres.Interrupted(err) {
+					log.Warn("request canceled", sl.Err(err))
+
+					w.WriteHeader(http.StatusServiceUnavailable)
+
+					return
+				}
+				log.Error("failed to add image", sl.Err(err))
+
+				w.WriteHeader(http.StatusInternalServerError)
+				render.JSON(w, r, resp.Error("internal error"))
+
+				return
+			}
+
+			blobstore.ResolveImage(store, &stored)
+			response = append(response, stored)
+		}
+
+		invalidatorImage.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("images uploaded", slog.Int("count", len(response)))
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, response)
+	}
+}
+
+func GetImageList(log *slog.Logger, listImage ListImage, urler blobstore.URLer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.image.GetImageList"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		response, err := listImage.GetGoodImages(r.Context(), goodIdInt)
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get image list", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		for i := range response {
+			blobstore.ResolveImage(urler, &response[i])
+		}
+
+		log.Info("image list geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func DeleteImage(log *slog.Logger, deleterImage DeleterImage, invalidatorImage InvalidatorImage, store blobstore.BlobStore, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.image.DeleteImage"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var response entity.ImageDeleteResponse
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		imageId := chi.URLParam(r, "id")
+		if imageId == "" {
+			log.Info("image id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("image id parameter is required"))
+			return
+		}
+
+		_, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		imageIdInt, err := strconv.Atoi(imageId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		img, err := deleterImage.DeleteGoodImage(r.Context(), imageIdInt)
+		if err != nil {
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to delete image", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		removeBlobs(r, log, store, img)
+
+		response.ImageId = imageIdInt
+		response.Deleted = true
+
+		invalidatorImage.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("image deleted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func Reorder(log *slog.Logger, reordererImage ReordererImage, invalidatorImage InvalidatorImage, urler blobstore.URLer, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.image.Reorder"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var req entity.ImageReorderRequest
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		err := render.DecodeJSON(r.Body, &req)
+		if errors.Is(err, io.EOF) {
+			log.Error("request body is empty")
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("empty request"))
+
+			return
+		}
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to decode request"))
+
+			return
+		}
+
+		log.Info("request body decoded", slog.Any("request", req))
+
+		_, err = uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		response, err := reordererImage.ReorderGoodImages(r.Context(), goodIdInt, req.ImageIds)
+		if err != nil {
+			if err == postgres.ErrInvalidOrder {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to reorder images", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		for i := range response {
+			blobstore.ResolveImage(urler, &response[i])
+		}
+
+		invalidatorImage.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("images reordered")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func SetPrimary(log *slog.Logger, primarySetterImage PrimarySetterImage, invalidatorImage InvalidatorImage, urler blobstore.URLer, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.image.SetPrimary"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		imageId := chi.URLParam(r, "id")
+		if imageId == "" {
+			log.Info("image id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("image id parameter is required"))
+			return
+		}
+
+		_, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		imageIdInt, err := strconv.Atoi(imageId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		response, err := primarySetterImage.SetPrimaryImage(r.Context(), imageIdInt)
+		if err != nil {
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to set primary image", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		blobstore.ResolveImage(urler, &response)
+
+		invalidatorImage.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("primary image set")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func readFile(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// saveBlobs validates the image, renders its thumbnails and puts everything into the blob store.
+func saveBlobs(r *http.Request, store blobstore.BlobStore, goodId int, data []byte, maxPixels int64, thumbnailSizes []int) (entity.GoodImage, error) {
+	contentType, err := thumbnail.DetectType(data)
+	if err != nil {
+		return entity.GoodImage{}, err
+	}
+
+	decoded, err := thumbnail.Decode(data, maxPixels)
+	if errors.Is(err, thumbnail.ErrTooManyPixels) {
+		return entity.GoodImage{}, err
+	}
+	if err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%w: %s", errDecode, err)
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return entity.GoodImage{}, err
+	}
+
+	prefix := fmt.Sprintf("%s%d/%s", KeyPrefix, goodId, name)
+
+	img := entity.GoodImage{
+		GoodId:        goodId,
+		Key:           prefix + thumbnail.Extension(contentType),
+		ThumbnailKeys: make(map[string]string, len(thumbnailSizes)),
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		Width:         decoded.Bounds().Dx(),
+		Height:        decoded.Bounds().Dy(),
+	}
+
+	if err := store.Put(r.Context(), img.Key, bytes.NewReader(data), img.Size, contentType); err != nil {
+		return entity.GoodImage{}, err
+	}
+
+	for _, size := range thumbnailSizes {
+		thumb, thumbType, err := thumbnail.Encode(thumbnail.Resize(decoded, size), contentType)
+		if err != nil {
+			return img, err
+		}
+
+		key := fmt.Sprintf("%s_%d%s", prefix, size, thumbnail.Extension(thumbType))
+		if err := store.Put(r.Context(), key, bytes.NewReader(thumb), int64(len(thumb)), thumbType); err != nil {
+			return img, err
+		}
+
+		img.ThumbnailKeys[strconv.Itoa(size)] = key
+	}
+
+	return img, nil
+}
+
+func removeBlobs(r *http.Request, log *slog.Logger, store blobstore.BlobStore, img entity.GoodImage) {
+	keys := []string{img.Key}
+	for _, key := range img.ThumbnailKeys {
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := store.Delete(r.Context(), key); err != nil {
+			log.Error("failed to delete blob", slog.String("key", key), sl.Err(err))
+		}
+	}
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,268 @@
+package importjob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/importer"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/lib/tabular"
+	"inHouseAd/internal/storage/postgres"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// formField is the multipart field carrying the CSV or XLSX file.
+const formField = "file"
+
+type CreatorImport interface {
+	CreateImportJob(ctx context.Context, job entity.ImportJob) (int, error)
+}
+
+type GetterImport interface {
+	GetImportJob(ctx context.Context, id int) (entity.ImportJob, error)
+}
+
+type Enqueuer interface {
+	Enqueue(id int)
+}
+
+// Upload stores the file and queues an import job. Options come as multipart fields:
+// mode (transactional or resumable), dry_run, create_categories, format and mapping (a JSON object
+// from field to column header).
+func Upload(log *slog.Logger, creatorImport CreatorImport, enqueuer Enqueuer, store blobstore.BlobStore, maxSize int64, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.importjob.Upload"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			log.Info("failed to parse multipart form", sl.Err(err))
+
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("failed to parse multipart form"))
+
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, fh, err := r.FormFile(formField)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(fmt.Sprintf("multipart field %q is required", formField)))
+			return
+		}
+		defer file.Close()
+
+		if fh.Size > maxSize {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			render.JSON(w, r, resp.Error(fmt.Sprintf("%s exceeds %d bytes", fh.Filename, maxSize)))
+			return
+		}
+
+		job := entity.ImportJob{
+			Uid:    uid,
+			Format: r.FormValue("format"),
+			Mode:   r.FormValue("mode"),
+		}
+
+		if job.Format == "" {
+			job.Format = tabular.FormatByName(fh.Filename)
+		}
+		if job.Format != tabular.FormatCSV && job.Format != tabular.FormatXLSX {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(tabular.ErrUnsupportedFormat.Error()))
+			return
+		}
+
+		if job.Mode == "" {
+			job.Mode = importer.ModeTransactional
+		}
+		if job.Mode != importer.ModeTransactional && job.Mode != importer.ModeResumable {
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("mode must be transactional or resumable"))
+			return
+		}
+
+		for name, dst := range map[string]*bool{"dry_run": &job.DryRun, "create_categories": &job.CreateCategories} {
+			if v := r.FormValue(name); v != "" {
+				if *dst, err = strconv.ParseBool(v); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					render.JSON(w, r, resp.Error(fmt.Sprintf("%s must be a boolean", name)))
+					return
+				}
+			}
+		}
+
+		if v := r.FormValue("mapping"); v != "" {
+			if err := json.Unmarshal([]byte(v), &job.Mapping); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("mapping must be a JSON object of strings"))
+				return
+			}
+		}
+
+		name, err := randomName()
+		if err != nil {
+			log.Error("failed to generate file name", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+		job.BlobKey = "imports/" + name + "." + job.Format
+
+		if err := store.Put(r.Context(), job.BlobKey, file, fh.Size, fh.Header.Get("Content-Type")); err != nil {
+			if r.Context().Err() != nil {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to store import file", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		job.ImportId, err = creatorImport.CreateImportJob(r.Context(), job)
+		if err != nil {
+			if err := store.Delete(context.WithoutCancel(r.Context()), job.BlobKey); err != nil {
+				log.Error("failed to delete import file", sl.Err(err))
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to create import job", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		enqueuer.Enqueue(job.ImportId)
+
+		log.Info("import queued", slog.Int("import_id", job.ImportId))
+
+		w.WriteHeader(http.StatusAccepted)
+		render.JSON(w, r, entity.ImportCreateResponse{ImportId: job.ImportId, Status: importer.StatusPending})
+	}
+}
+
+func GetImport(log *slog.Logger, getterImport GetterImport, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.importjob.GetImport"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		importId := chi.URLParam(r, "id")
+		if importId == "" {
+			log.Info("import id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("import id parameter is required"))
+			return
+		}
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		importIdInt, err := strconv.Atoi(importId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		response, err := getterImport.GetImportJob(r.Context(), importIdInt)
+		if err != nil {
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get import job", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		// Jobs are private to the user who uploaded the file.
+		if response.Uid != uid {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.Info("import job geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
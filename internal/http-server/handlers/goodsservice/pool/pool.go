@@ -0,0 +1,79 @@
+package pool
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"net/http"
+)
+
+type GetterStats interface {
+	PoolStats() entity.PoolStats
+}
+
+type GetterReplicas interface {
+	ReplicaStates() []entity.ReplicaState
+}
+
+// GetStats reports the database connection pool of this replica.
+func GetStats(log *slog.Logger, getterStats GetterStats, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.pool.GetStats"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		log.Info("pool stats geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, getterStats.PoolStats())
+	}
+}
+
+// GetReplicas reports the read replicas as of their last check.
+func GetReplicas(log *slog.Logger, getterReplicas GetterReplicas, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.pool.GetReplicas"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		log.Info("replica states geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, getterReplicas.ReplicaStates())
+	}
+}
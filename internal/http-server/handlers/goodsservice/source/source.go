@@ -0,0 +1,265 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/goodsource"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/storage/postgres"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+type GetterRuns interface {
+	GetFetchRuns(ctx context.Context, source string, limit int) ([]entity.FetchRun, error)
+}
+
+type GetterStates interface {
+	States(ctx context.Context) ([]entity.SourceState, error)
+}
+
+type ListJobs interface {
+	Jobs(ctx context.Context) ([]entity.SourceJob, error)
+}
+
+type ControllerJob interface {
+	Pause(ctx context.Context, source string) error
+	Resume(ctx context.Context, source string) error
+	Trigger(ctx context.Context, source string) error
+}
+
+// GetRuns lists the latest fetch runs, optionally of a single source.
+func GetRuns(log *slog.Logger, getterRuns GetterRuns, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.source.GetRuns"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		limit := defaultLimit
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxLimit {
+				log.Info("invalid limit", slog.String("limit", raw))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("limit must be between 1 and "+strconv.Itoa(maxLimit)))
+				return
+			}
+			limit = n
+		}
+
+		runs, err := getterRuns.GetFetchRuns(r.Context(), r.URL.Query().Get("source"), limit)
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get fetch runs", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("fetch runs geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, runs)
+	}
+}
+
+// GetStates reports the circuit breaker of every configured source.
+func GetStates(log *slog.Logger, getterStates GetterStates, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.source.GetStates"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		states, err := getterStates.States(r.Context())
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get source states", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("source states geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, states)
+	}
+}
+
+// GetJobs lists the source jobs with their schedules, last and next runs.
+func GetJobs(log *slog.Logger, listJobs ListJobs, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.source.GetJobs"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		jobs, err := listJobs.Jobs(r.Context())
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get source jobs", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("source jobs geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, jobs)
+	}
+}
+
+// Pause stops the scheduled runs of a source until Resume.
+func Pause(log *slog.Logger, controllerJob ControllerJob, secret string) http.HandlerFunc {
+	return control(log, "handlers.goodsservice.source.Pause", controllerJob.Pause, http.StatusOK, secret)
+}
+
+func Resume(log *slog.Logger, controllerJob ControllerJob, secret string) http.HandlerFunc {
+	return control(log, "handlers.goodsservice.source.Resume", controllerJob.Resume, http.StatusOK, secret)
+}
+
+// Run asks for a fetch of the source now; it starts within the poll interval, see GetRuns.
+func Run(log *slog.Logger, controllerJob ControllerJob, secret string) http.HandlerFunc {
+	return control(log, "handlers.goodsservice.source.Run", controllerJob.Trigger, http.StatusAccepted, secret)
+}
+
+func control(log *slog.Logger, op string, action func(ctx context.Context, source string) error, status int, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		if _, err := uidextractor.ValidateToken(authHeader, secret); err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		name := chi.URLParam(r, "name")
+		if name == "" {
+			log.Info("source name is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("source name parameter is required"))
+			return
+		}
+
+		if err := action(r.Context(), name); err != nil {
+			if errors.Is(err, goodsource.ErrUnknownJob) {
+				w.WriteHeader(http.StatusNotFound)
+				render.JSON(w, r, resp.Error(err.Error()))
+				return
+			}
+
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to control source job", slog.String("source", name), sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("source job updated", slog.String("source", name))
+
+		w.WriteHeader(status)
+		render.JSON(w, r, resp.OK())
+	}
+}
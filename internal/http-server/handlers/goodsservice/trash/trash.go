@@ -0,0 +1,235 @@
+package trash
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/storage/postgres"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type ListTrash interface {
+	GetTrash(ctx context.Context) (entity.Trash, error)
+}
+
+type RestorerGood interface {
+	RestoreGood(ctx context.Context, id, actorUid int) error
+}
+
+type RestorerCategory interface {
+	RestoreCategory(ctx context.Context, id int) error
+}
+
+// InvalidatorTrash drops the cached lists a restore makes stale, see cache.Lists.
+type InvalidatorTrash interface {
+	InvalidateCategories(ctx context.Context)
+	InvalidateGoods(ctx context.Context)
+}
+
+func GetTrash(log *slog.Logger, listTrash ListTrash, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.trash.GetTrash"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		_, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		response, err := listTrash.GetTrash(r.Context())
+		if err != nil {
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to get trash", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		log.Info("trash geted")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func RestoreGood(log *slog.Logger, restorerGood RestorerGood, invalidatorTrash InvalidatorTrash, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.trash.RestoreGood"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var response entity.GoodRestoreResponse
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		goodId := chi.URLParam(r, "id")
+		if goodId == "" {
+			log.Info("good id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("good id parameter is required"))
+			return
+		}
+
+		uid, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		goodIdInt, err := strconv.Atoi(goodId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		err = restorerGood.RestoreGood(r.Context(), goodIdInt, uid)
+		if err != nil {
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if err == postgres.ErrParentDeleted {
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Error(err.Error()))
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to restore good", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		response.GoodId = goodIdInt
+		response.Restored = true
+
+		invalidatorTrash.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("good restored")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
+
+func RestoreCategory(log *slog.Logger, restorerCategory RestorerCategory, invalidatorTrash InvalidatorTrash, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.goodsservice.trash.RestoreCategory"
+
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		var response entity.CategoryRestoreResponse
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			log.Error("user unauthorized: authorization header is missing")
+			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			return
+		}
+
+		categoryId := chi.URLParam(r, "id")
+		if categoryId == "" {
+			log.Info("category id is empty")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("category id parameter is required"))
+			return
+		}
+
+		_, err := uidextractor.ValidateToken(authHeader, secret)
+		if err != nil {
+			log.Error("user unauthorized", sl.Err(err))
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		categoryIdInt, err := strconv.Atoi(categoryId)
+		if err != nil {
+			http.Error(w, "invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		err = restorerCategory.RestoreCategory(r.Context(), categoryIdInt)
+		if err != nil {
+			if err == postgres.ErrNotFound {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			if postgres.Interrupted(err) {
+				log.Warn("request canceled", sl.Err(err))
+
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+			log.Error("failed to restore category", sl.Err(err))
+
+			w.WriteHeader(http.StatusInternalServerError)
+			render.JSON(w, r, resp.Error("internal error"))
+
+			return
+		}
+
+		response.CategoryId = categoryIdInt
+		response.Restored = true
+
+		// The goods of the category come back with it.
+		invalidatorTrash.InvalidateCategories(context.WithoutCancel(r.Context()))
+		invalidatorTrash.InvalidateGoods(context.WithoutCancel(r.Context()))
+
+		log.Info("category restored")
+
+		w.WriteHeader(http.StatusOK)
+		render.JSON(w, r, response)
+	}
+}
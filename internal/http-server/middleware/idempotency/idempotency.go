@@ -0,0 +1,200 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/uidextractor"
+	resp "inHouseAd/internal/lib/api/response"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/storage/postgres"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	pollInterval = 100 * time.Millisecond
+)
+
+type Store interface {
+	ReserveIdempotencyKey(ctx context.Context, uid int, key, requestHash string, ttl, lockTimeout time.Duration) (*entity.IdempotentResponse, error)
+	CompleteIdempotencyKey(ctx context.Context, uid int, key string, response entity.IdempotentResponse) error
+	ReleaseIdempotencyKey(ctx context.Context, uid int, key string) error
+}
+
+type Options struct {
+	// TTL is how long a stored response is replayed.
+	TTL time.Duration
+	// Wait is how long a duplicate of an in-flight request waits for it before getting 409.
+	Wait time.Duration
+	// LockTimeout after which an unfinished reservation is considered abandoned.
+	LockTimeout time.Duration
+	// MaxBodySize caps the body read to hash the request; larger requests with a key get 413.
+	MaxBodySize int64
+}
+
+// New makes authenticated POST requests carrying an Idempotency-Key header safe to retry: the
+// first response is stored per user and key, and repeats of the same request get it back without
+// running the handler. Server errors are not stored, so the client can retry them. Requests
+// without a valid token are passed through: a shared anonymous scope would replay one caller's
+// response, tokens included, to anyone sending the same key.
+func New(log *slog.Logger, store Store, secret string, opts Options) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/idempotency"),
+		)
+
+		log.Info("idempotency middleware enabled")
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log := log.With(
+				slog.String("idempotency_key", key),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+			)
+
+			if len(key) > maxKeyLength {
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("idempotency key is too long"))
+				return
+			}
+
+			uid, err := uidextractor.ValidateToken(r.Header.Get("Authorization"), secret)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The handlers apply their own, possibly larger, limits only after this read.
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.MaxBodySize))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					log.Warn("request body too large for idempotency key", slog.Int64("limit", maxBytesErr.Limit))
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					render.JSON(w, r, resp.Error("request body is too large for an idempotency key"))
+					return
+				}
+
+				log.Error("failed to read request body", sl.Err(err))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("failed to read request"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := requestHash(r, body)
+
+			deadline := time.Now().Add(opts.Wait)
+			for {
+				stored, err := store.ReserveIdempotencyKey(r.Context(), uid, key, hash, opts.TTL, opts.LockTimeout)
+				switch {
+				case err == nil && stored != nil:
+					log.Info("replaying stored response")
+					replay(w, *stored)
+					return
+				case err == nil:
+					execute(log, store, uid, key, next, w, r)
+					return
+				case err == postgres.ErrIdempotencyKeyReused:
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					render.JSON(w, r, resp.Error(err.Error()))
+					return
+				case err == postgres.ErrIdempotencyInProgress:
+					if time.Now().After(deadline) {
+						w.WriteHeader(http.StatusConflict)
+						render.JSON(w, r, resp.Error(err.Error()))
+						return
+					}
+				default:
+					log.Error("failed to reserve idempotency key", sl.Err(err))
+					w.WriteHeader(http.StatusInternalServerError)
+					render.JSON(w, r, resp.Error("internal error"))
+					return
+				}
+
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(pollInterval):
+				}
+			}
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func execute(log *slog.Logger, store Store, uid int, key string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	ww.Tee(&buf)
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		// The handler failed, panicked or was canceled; let a retry run it again.
+		if err := store.ReleaseIdempotencyKey(context.WithoutCancel(r.Context()), uid, key); err != nil {
+			log.Error("failed to release idempotency key", sl.Err(err))
+		}
+	}()
+
+	next.ServeHTTP(ww, r)
+
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= http.StatusInternalServerError || r.Context().Err() != nil {
+		return
+	}
+
+	response := entity.IdempotentResponse{
+		StatusCode: status,
+		Header:     ww.Header().Clone(),
+		Body:       buf.Bytes(),
+	}
+	if err := store.CompleteIdempotencyKey(context.WithoutCancel(r.Context()), uid, key, response); err != nil {
+		log.Error("failed to store idempotent response", sl.Err(err))
+		return
+	}
+
+	completed = true
+}
+
+func replay(w http.ResponseWriter, stored entity.IdempotentResponse) {
+	for name, values := range stored.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,193 @@
+package idempotency
+
+import (
+	"inHouseAd/internal/lib/accesstoken"
+	"inHouseAd/internal/storage/memory"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const secret = "secret"
+
+var options = Options{TTL: time.Hour, Wait: 50 * time.Millisecond, LockTimeout: time.Minute, MaxBodySize: 16}
+
+type request struct {
+	path       string
+	body       string
+	anonymous  bool
+	wantStatus int
+	replayed   bool
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		requests  []request
+		wantCalls int64
+	}{
+		{
+			name:   "replay",
+			status: http.StatusCreated,
+			requests: []request{
+				{path: "/good", body: "a", wantStatus: http.StatusCreated},
+				{path: "/good", body: "a", wantStatus: http.StatusCreated, replayed: true},
+				{path: "/good", body: "a", wantStatus: http.StatusCreated, replayed: true},
+			},
+			wantCalls: 1,
+		},
+		{
+			name:   "another body",
+			status: http.StatusCreated,
+			requests: []request{
+				{path: "/good", body: "a", wantStatus: http.StatusCreated},
+				{path: "/good", body: "b", wantStatus: http.StatusUnprocessableEntity},
+			},
+			wantCalls: 1,
+		},
+		{
+			name:   "another path",
+			status: http.StatusCreated,
+			requests: []request{
+				{path: "/good", body: "a", wantStatus: http.StatusCreated},
+				{path: "/category", body: "a", wantStatus: http.StatusUnprocessableEntity},
+			},
+			wantCalls: 1,
+		},
+		{
+			name:   "client errors are stored",
+			status: http.StatusBadRequest,
+			requests: []request{
+				{path: "/good", body: "a", wantStatus: http.StatusBadRequest},
+				{path: "/good", body: "a", wantStatus: http.StatusBadRequest, replayed: true},
+			},
+			wantCalls: 1,
+		},
+		{
+			name:   "server errors are retried",
+			status: http.StatusInternalServerError,
+			requests: []request{
+				{path: "/good", body: "a", wantStatus: http.StatusInternalServerError},
+				{path: "/good", body: "a", wantStatus: http.StatusInternalServerError},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:   "anonymous requests are not stored",
+			status: http.StatusOK,
+			requests: []request{
+				{path: "/signin", body: "a", anonymous: true, wantStatus: http.StatusOK},
+				{path: "/signin", body: "a", anonymous: true, wantStatus: http.StatusOK},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:   "body over the limit",
+			status: http.StatusCreated,
+			requests: []request{
+				{path: "/good", body: strings.Repeat("a", 17), wantStatus: http.StatusRequestEntityTooLarge},
+			},
+			wantCalls: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+			h := New(slog.New(slog.NewTextHandler(io.Discard, nil)), memory.New(), secret, options)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					calls.Add(1)
+					body, _ := io.ReadAll(r.Body)
+					w.WriteHeader(tt.status)
+					w.Write(body)
+				}),
+			)
+
+			for i, req := range tt.requests {
+				w := serve(t, h, req)
+				if w.Code != req.wantStatus {
+					t.Errorf("request %d: status %d, want %d", i, w.Code, req.wantStatus)
+				}
+				if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != req.replayed {
+					t.Errorf("request %d: replayed %t, want %t", i, replayed, req.replayed)
+				}
+				if req.replayed && w.Body.String() != req.body {
+					t.Errorf("request %d: body %q, want %q", i, w.Body.String(), req.body)
+				}
+			}
+
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// TestInFlight sends duplicates while the first request is still running: one that gives up
+// waiting gets 409, one that waits long enough gets the stored response.
+func TestInFlight(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int64
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(entered)
+			<-release
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	store := memory.New()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	impatient := New(log, store, secret, options)(handler)
+	patient := New(log, store, secret, Options{TTL: time.Hour, Wait: 5 * time.Second, LockTimeout: time.Minute, MaxBodySize: 16})(handler)
+
+	req := request{path: "/good", body: "a"}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- serve(t, impatient, req) }()
+	<-entered
+
+	if w := serve(t, impatient, req); w.Code != http.StatusConflict {
+		t.Errorf("duplicate in flight: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	waiting := make(chan *httptest.ResponseRecorder)
+	go func() { waiting <- serve(t, patient, req) }()
+
+	close(release)
+
+	if w := <-first; w.Code != http.StatusCreated || w.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("first request: status %d, replayed %q, want %d and not replayed", w.Code, w.Header().Get(ReplayedHeader), http.StatusCreated)
+	}
+	if w := <-waiting; w.Code != http.StatusCreated || w.Header().Get(ReplayedHeader) != "true" || w.Body.String() != "created" {
+		t.Errorf("waiting duplicate: got %d %q, replayed %q, want the stored response", w.Code, w.Body.String(), w.Header().Get(ReplayedHeader))
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+}
+
+func serve(t *testing.T, h http.Handler, req request) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, req.path, strings.NewReader(req.body))
+	r.Header.Set(Header, "key")
+	if !req.anonymous {
+		token, err := accesstoken.Generate(secret, 1, time.Hour)
+		if err != nil {
+			t.Errorf("Generate: %v", err)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
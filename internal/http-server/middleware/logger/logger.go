@@ -27,7 +27,11 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 
 			t1 := time.Now()
 			defer func() {
-				entry.Info("request completed",
+				msg := "request completed"
+				if r.Context().Err() != nil {
+					msg = "request canceled"
+				}
+				entry.Info(msg,
 					slog.Int("status", ww.Status()),
 					slog.Int("bytes", ww.BytesWritten()),
 					slog.String("duration", time.Since(t1).String()),
@@ -0,0 +1,51 @@
+package readprimary
+
+import (
+	"inHouseAd/internal/storage/postgres"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const CookieName = "read_primary"
+
+// New makes clients read their own writes when reads go to lagging replicas: requests that change
+// something read from the primary and set a cookie that sends the client's reads to the primary
+// for window after it. window is meant to be the replica lag threshold.
+func New(log *slog.Logger, window time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		log := log.With(
+			slog.String("component", "middleware/readprimary"),
+		)
+
+		log.Info("read primary middleware enabled", slog.Duration("window", window))
+
+		maxAge := int((window + time.Second - 1) / time.Second)
+		if maxAge < 1 {
+			maxAge = 1
+		}
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				if _, err := r.Cookie(CookieName); err == nil {
+					r = r.WithContext(postgres.WithPrimary(r.Context()))
+				}
+			default:
+				http.SetCookie(w, &http.Cookie{
+					Name:     CookieName,
+					Value:    "1",
+					Path:     "/",
+					MaxAge:   maxAge,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+				r = r.WithContext(postgres.WithPrimary(r.Context()))
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
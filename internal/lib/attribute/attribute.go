@@ -0,0 +1,234 @@
+package attribute
+
+import (
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeEnum    = "enum"
+	TypeBoolean = "boolean"
+)
+
+const (
+	OpEq  = "="
+	OpNe  = "!="
+	OpGt  = ">"
+	OpGte = ">="
+	OpLt  = "<"
+	OpLte = "<="
+)
+
+var (
+	ErrInvalidSchema = errors.New("invalid attribute schema")
+	ErrInvalidValue  = errors.New("invalid attribute value")
+	ErrInvalidFilter = errors.New("invalid attribute filter")
+)
+
+// ops is ordered so that a two-character operator wins over its prefix at the same position.
+var ops = []string{OpGte, OpLte, OpNe, OpGt, OpLt, OpEq}
+
+type Filter struct {
+	Name  string
+	Op    string
+	Value string
+}
+
+func ValidateSchema(attr entity.CategoryAttribute) error {
+	if strings.TrimSpace(attr.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSchema)
+	}
+
+	switch attr.Type {
+	case TypeString, TypeBoolean:
+		if attr.Unit != "" {
+			return fmt.Errorf("%w: unit is only allowed for number attributes", ErrInvalidSchema)
+		}
+	case TypeNumber:
+	case TypeEnum:
+		if len(attr.EnumValues) == 0 {
+			return fmt.Errorf("%w: enum attribute %q has no values", ErrInvalidSchema, attr.Name)
+		}
+		if attr.Unit != "" {
+			return fmt.Errorf("%w: unit is only allowed for number attributes", ErrInvalidSchema)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidSchema, attr.Type)
+	}
+
+	if attr.Type != TypeEnum && len(attr.EnumValues) != 0 {
+		return fmt.Errorf("%w: enum values are only allowed for enum attributes", ErrInvalidSchema)
+	}
+
+	return nil
+}
+
+// Validate checks values against the schemas of every category the good belongs to.
+// An attribute defined by several categories must satisfy all of the definitions.
+func Validate(schemas []entity.CategoryAttribute, values map[string]any) error {
+	known := make(map[string]bool, len(schemas))
+
+	for _, schema := range schemas {
+		known[schema.Name] = true
+
+		value, ok := values[schema.Name]
+		if !ok || value == nil {
+			if schema.Required {
+				return fmt.Errorf("%w: %q is required", ErrInvalidValue, schema.Name)
+			}
+			continue
+		}
+
+		if err := validateValue(schema, value); err != nil {
+			return err
+		}
+	}
+
+	for name := range values {
+		if !known[name] {
+			return fmt.Errorf("%w: %q is not defined for the good categories", ErrInvalidValue, name)
+		}
+	}
+
+	return nil
+}
+
+func validateValue(schema entity.CategoryAttribute, value any) error {
+	switch schema.Type {
+	case TypeString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%w: %q must be a string", ErrInvalidValue, schema.Name)
+		}
+	case TypeNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%w: %q must be a number", ErrInvalidValue, schema.Name)
+		}
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%w: %q must be a boolean", ErrInvalidValue, schema.Name)
+		}
+	case TypeEnum:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: %q must be a string", ErrInvalidValue, schema.Name)
+		}
+		for _, allowed := range schema.EnumValues {
+			if s == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %q must be one of %s", ErrInvalidValue, schema.Name, strings.Join(schema.EnumValues, ", "))
+	}
+
+	return nil
+}
+
+// ParseFilter splits s at the first operator in it, so that the value may contain operators:
+// "note=a>b" compares note with "a>b".
+func ParseFilter(s string) (Filter, error) {
+	at, op := -1, ""
+	for _, candidate := range ops {
+		if i := strings.Index(s, candidate); i >= 0 && (at < 0 || i < at) {
+			at, op = i, candidate
+		}
+	}
+	if at < 0 {
+		return Filter{}, fmt.Errorf("%w: %q", ErrInvalidFilter, s)
+	}
+
+	f := Filter{
+		Name:  strings.TrimSpace(s[:at]),
+		Op:    op,
+		Value: strings.TrimSpace(s[at+len(op):]),
+	}
+	if f.Name == "" || f.Value == "" {
+		return Filter{}, fmt.Errorf("%w: %q", ErrInvalidFilter, s)
+	}
+
+	if f.Op != OpEq && f.Op != OpNe {
+		if _, err := parseNumber(f.Value); err != nil {
+			return Filter{}, fmt.Errorf("%w: %q requires a numeric value", ErrInvalidFilter, s)
+		}
+	}
+
+	return f, nil
+}
+
+func ParseFilters(raw []string) ([]Filter, error) {
+	filters := make([]Filter, 0, len(raw))
+
+	for _, s := range raw {
+		f, err := ParseFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+
+	return filters, nil
+}
+
+// Typed converts the filter value into the JSON value matching the attribute type.
+func (f Filter) Typed(attrType string) (any, error) {
+	if f.Op != OpEq && f.Op != OpNe && attrType != TypeNumber {
+		return nil, fmt.Errorf("%w: %q is not a number attribute", ErrInvalidFilter, f.Name)
+	}
+
+	switch attrType {
+	case TypeNumber:
+		n, err := parseNumber(f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q requires a numeric value", ErrInvalidFilter, f.Name)
+		}
+		return n, nil
+	case TypeBoolean:
+		b, err := strconv.ParseBool(f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q requires a boolean value", ErrInvalidFilter, f.Name)
+		}
+		return b, nil
+	}
+
+	return f.Value, nil
+}
+
+// Parse converts a textual value (e.g. a spreadsheet cell) into the JSON value of the attribute type.
+func Parse(schema entity.CategoryAttribute, raw string) (any, error) {
+	raw = strings.TrimSpace(raw)
+
+	switch schema.Type {
+	case TypeNumber:
+		n, err := parseNumber(strings.Replace(raw, ",", ".", 1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q must be a number", ErrInvalidValue, schema.Name)
+		}
+		return n, nil
+	case TypeBoolean:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q must be a boolean", ErrInvalidValue, schema.Name)
+		}
+		return b, nil
+	}
+
+	return raw, nil
+}
+
+// parseNumber parses a finite number: NaN and infinities cannot be stored as JSON or compared.
+func parseNumber(s string) (float64, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", s)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,91 @@
+package attribute
+
+import (
+	"errors"
+	"inHouseAd/internal/entity"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Filter
+		wantErr bool
+	}{
+		{in: "color=red", want: Filter{Name: "color", Op: OpEq, Value: "red"}},
+		{in: "color!=red", want: Filter{Name: "color", Op: OpNe, Value: "red"}},
+		{in: "price>10", want: Filter{Name: "price", Op: OpGt, Value: "10"}},
+		{in: "price>=10.5", want: Filter{Name: "price", Op: OpGte, Value: "10.5"}},
+		{in: "price<10", want: Filter{Name: "price", Op: OpLt, Value: "10"}},
+		{in: "price<=-1", want: Filter{Name: "price", Op: OpLte, Value: "-1"}},
+		{in: " size = XL ", want: Filter{Name: "size", Op: OpEq, Value: "XL"}},
+		{in: "note=a>b", want: Filter{Name: "note", Op: OpEq, Value: "a>b"}},
+		{in: "note!=x<=y", want: Filter{Name: "note", Op: OpNe, Value: "x<=y"}},
+		{in: "url=a=b", want: Filter{Name: "url", Op: OpEq, Value: "a=b"}},
+		{in: "price>=1=1", wantErr: true},
+		{in: "=a>1", wantErr: true},
+		{in: "color=", wantErr: true},
+		{in: "=red", wantErr: true},
+		{in: "color", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "price>cheap", wantErr: true},
+		{in: "price>NaN", wantErr: true},
+		{in: "price<=Inf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFilter(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("ParseFilter(%q): got (%+v, %v), want %v", tt.in, got, err, ErrInvalidFilter)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseFilter(%q): got (%+v, %v), want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	color := entity.CategoryAttribute{Name: "color", Type: TypeEnum, EnumValues: []string{"red", "blue"}}
+	weight := entity.CategoryAttribute{Name: "weight", Type: TypeNumber, Unit: "kg", Required: true}
+	organic := entity.CategoryAttribute{Name: "organic", Type: TypeBoolean}
+	brand := entity.CategoryAttribute{Name: "brand", Type: TypeString}
+	schemas := []entity.CategoryAttribute{color, weight, organic, brand}
+
+	tests := []struct {
+		name    string
+		schemas []entity.CategoryAttribute
+		values  map[string]any
+		wantErr bool
+	}{
+		{name: "all set", schemas: schemas, values: map[string]any{"color": "red", "weight": 1.5, "organic": true, "brand": "acme"}},
+		{name: "required only", schemas: schemas, values: map[string]any{"weight": 2.0}},
+		{name: "no schemas", values: map[string]any{}},
+		{name: "required missing", schemas: schemas, values: map[string]any{"color": "red"}, wantErr: true},
+		{name: "required null", schemas: schemas, values: map[string]any{"weight": nil}, wantErr: true},
+		{name: "not an enum value", schemas: schemas, values: map[string]any{"weight": 1.0, "color": "green"}, wantErr: true},
+		{name: "number as string", schemas: schemas, values: map[string]any{"weight": "1"}, wantErr: true},
+		{name: "boolean as string", schemas: schemas, values: map[string]any{"weight": 1.0, "organic": "true"}, wantErr: true},
+		{name: "string as number", schemas: schemas, values: map[string]any{"weight": 1.0, "brand": 1.0}, wantErr: true},
+		{name: "unknown attribute", schemas: schemas, values: map[string]any{"weight": 1.0, "size": "XL"}, wantErr: true},
+		{
+			// An attribute defined by two categories must satisfy both definitions.
+			name:    "conflicting definitions",
+			schemas: []entity.CategoryAttribute{color, {Name: "color", Type: TypeEnum, EnumValues: []string{"red"}}},
+			values:  map[string]any{"color": "blue"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		err := Validate(tt.schemas, tt.values)
+		if tt.wantErr && !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrInvalidValue)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, want nil", tt.name, err)
+		}
+	}
+}
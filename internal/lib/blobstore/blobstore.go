@@ -0,0 +1,35 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"inHouseAd/internal/entity"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+type URLer interface {
+	URL(key string) string
+}
+
+// ResolveImage fills the public URLs of an image and its thumbnails from their blob keys.
+func ResolveImage(urler URLer, img *entity.GoodImage) {
+	if img == nil {
+		return
+	}
+
+	img.Url = urler.URL(img.Key)
+
+	img.Thumbnails = make(map[string]string, len(img.ThumbnailKeys))
+	for size, key := range img.ThumbnailKeys {
+		img.Thumbnails[size] = urler.URL(key)
+	}
+}
@@ -0,0 +1,252 @@
+// Package cache keeps the category and good lists out of the database between changes.
+// Lists wraps the storage and stores its lists in a Cache: an LRU in each replica (package lru)
+// or a Redis server shared by the replicas (package redis).
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/changes"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by a Cache after Close.
+var ErrClosed = errors.New("cache is closed")
+
+// Cache stores values for a while. Keys live in namespaces with a generation: Bump moves
+// a namespace to its next generation, which drops all of its keys at once without listing them.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Generation(ctx context.Context, namespace string) (int64, error)
+	Bump(ctx context.Context, namespace string) error
+	Close() error
+}
+
+type Source interface {
+	GetCategoryList(ctx context.Context) ([]entity.CategoryList, error)
+	GetGoodList(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]entity.GoodList, error)
+}
+
+const (
+	queryCategories = "categories"
+	queryGoods      = "goods"
+)
+
+// Options set how long each list is cached. Reads for which Bypass returns true go to the
+// source and are not stored: clients reading their own writes from the primary must not be
+// served, or fill the cache with, a list read from a lagging replica.
+type Options struct {
+	CategoryTTL time.Duration
+	GoodTTL     time.Duration
+	Bypass      func(ctx context.Context) bool
+}
+
+// Lists serves the category and good lists from the cache, reading them from the source on
+// a miss. A failing cache does not fail a read: the list is read from the source and the
+// error logged. A nil Cache turns caching off.
+type Lists struct {
+	log     *slog.Logger
+	cache   Cache
+	store   string
+	source  Source
+	opts    Options
+	queries map[string]*counters
+}
+
+type counters struct {
+	ttl    time.Duration
+	hits   atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+}
+
+func NewLists(log *slog.Logger, cache Cache, store string, source Source, opts Options) *Lists {
+	if cache == nil {
+		store = "off"
+	}
+
+	return &Lists{
+		log:    log,
+		cache:  cache,
+		store:  store,
+		source: source,
+		opts:   opts,
+		queries: map[string]*counters{
+			queryCategories: {ttl: opts.CategoryTTL},
+			queryGoods:      {ttl: opts.GoodTTL},
+		},
+	}
+}
+
+func (l *Lists) GetCategoryList(ctx context.Context) ([]entity.CategoryList, error) {
+	return load(ctx, l, queryCategories, "", func() ([]entity.CategoryList, error) {
+		return l.source.GetCategoryList(ctx)
+	})
+}
+
+func (l *Lists) GetGoodList(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]entity.GoodList, error) {
+	encoded, err := json.Marshal(filters)
+	if err != nil {
+		return nil, err
+	}
+	key := strconv.Itoa(categoryId) + ":" + strconv.FormatBool(collapseVariants) + ":" + string(encoded)
+
+	return load(ctx, l, queryGoods, key, func() ([]entity.GoodList, error) {
+		return l.source.GetGoodList(ctx, categoryId, filters, collapseVariants)
+	})
+}
+
+// InvalidateCategories drops the cached category lists.
+func (l *Lists) InvalidateCategories(ctx context.Context) {
+	l.invalidate(ctx, queryCategories)
+}
+
+// InvalidateGoods drops the cached good lists of every category.
+func (l *Lists) InvalidateGoods(ctx context.Context) {
+	l.invalidate(ctx, queryGoods)
+}
+
+// Follow drops the lists made stale by the changes the database notified until the channel is
+// closed, so that changes made through other replicas, imports and sources reach the cache too.
+// Changes queued up together are applied with one invalidation.
+func (l *Lists) Follow(ctx context.Context, events <-chan entity.Change) {
+	for c := range events {
+		categories, goods := stale(c)
+
+		for queued := len(events); queued > 0; queued-- {
+			moreCategories, moreGoods := stale(<-events)
+			categories = categories || moreCategories
+			goods = goods || moreGoods
+		}
+
+		if categories {
+			l.InvalidateCategories(ctx)
+		}
+		if goods {
+			l.InvalidateGoods(ctx)
+		}
+	}
+}
+
+// stale reports which lists a change makes stale. Deleting a category hides its goods too.
+func stale(c entity.Change) (categories, goods bool) {
+	if c.Op == changes.OpResync {
+		return true, true
+	}
+
+	switch c.Table {
+	case changes.TableCategory:
+		return true, true
+	case changes.TableGood, changes.TableGoodCategory:
+		return false, true
+	}
+
+	return false, false
+}
+
+func (l *Lists) Stats() entity.CacheStats {
+	stats := entity.CacheStats{Store: l.store}
+
+	for _, query := range []string{queryCategories, queryGoods} {
+		c := l.queries[query]
+
+		q := entity.CacheQueryStats{
+			Query:  query,
+			TTLMs:  c.ttl.Milliseconds(),
+			Hits:   c.hits.Load(),
+			Misses: c.misses.Load(),
+			Errors: c.errors.Load(),
+		}
+		if total := q.Hits + q.Misses; total != 0 {
+			q.HitRatio = float64(q.Hits) / float64(total)
+		}
+
+		stats.Queries = append(stats.Queries, q)
+	}
+
+	return stats
+}
+
+// load returns the cached list of the query's key, or reads it and caches it under the
+// generation seen before the read: a list read before a change is stored under a generation
+// the change has already left behind.
+func load[T any](ctx context.Context, l *Lists, query, key string, read func() ([]T, error)) ([]T, error) {
+	const op = "lib.cache.load"
+
+	c := l.queries[query]
+
+	if l.cache == nil || c.ttl <= 0 || (l.opts.Bypass != nil && l.opts.Bypass(ctx)) {
+		return read()
+	}
+
+	log := l.log.With(slog.String("op", op), slog.String("query", query))
+
+	gen, err := l.cache.Generation(ctx, query)
+	if err != nil {
+		c.misses.Add(1)
+		c.errors.Add(1)
+		log.Warn("failed to get cache generation", sl.Err(err))
+		return read()
+	}
+
+	key = fmt.Sprintf("%s:%d:%s", query, gen, key)
+
+	cached, ok, err := l.cache.Get(ctx, key)
+	if err != nil {
+		c.errors.Add(1)
+		log.Warn("failed to get cached list", sl.Err(err))
+	}
+	if ok {
+		var list []T
+		err := json.Unmarshal(cached, &list)
+		if err == nil {
+			c.hits.Add(1)
+			return list, nil
+		}
+		c.errors.Add(1)
+		log.Warn("failed to decode cached list", sl.Err(err))
+	}
+	c.misses.Add(1)
+
+	list, err := read()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.cache.Set(ctx, key, encoded, c.ttl); err != nil {
+		c.errors.Add(1)
+		log.Warn("failed to cache list", sl.Err(err))
+	}
+
+	return list, nil
+}
+
+func (l *Lists) invalidate(ctx context.Context, query string) {
+	const op = "lib.cache.invalidate"
+
+	if l.cache == nil {
+		return
+	}
+
+	if err := l.cache.Bump(ctx, query); err != nil {
+		l.log.Error("failed to invalidate cached lists",
+			slog.String("op", op),
+			slog.String("query", query),
+			sl.Err(err),
+		)
+	}
+}
@@ -0,0 +1,84 @@
+// Package cachetest is the conformance suite of the cache.Cache implementations, so that
+// cache.Lists behaves the same whichever one is configured.
+package cachetest
+
+import (
+	"context"
+	"inHouseAd/internal/lib/cache"
+	"testing"
+	"time"
+)
+
+// Run runs the suite against the cache returned by open, which is called once per test.
+func Run(t *testing.T, open func(t *testing.T) cache.Cache) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, c cache.Cache)
+	}{
+		{"GetSet", testGetSet},
+		{"Expiry", testExpiry},
+		{"Generations", testGenerations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+func testGetSet(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, "missing"); err != nil || ok {
+		t.Fatalf("Get a missing key: got (%v, %v), want (false, nil)", ok, err)
+	}
+
+	if err := c.Set(ctx, "key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := c.Set(ctx, "key", []byte("new\r\nvalue"), time.Minute); err != nil {
+		t.Fatalf("Set over a key: %v", err)
+	}
+
+	value, ok, err := c.Get(ctx, "key")
+	if err != nil || !ok || string(value) != "new\r\nvalue" {
+		t.Errorf("Get: got (%q, %v, %v), want (%q, true, nil)", value, ok, err, "new\r\nvalue")
+	}
+}
+
+func testExpiry(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "short", []byte("value"), 50*time.Millisecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, ok, err := c.Get(ctx, "short"); err != nil || ok {
+		t.Errorf("Get an expired key: got (%v, %v), want (false, nil)", ok, err)
+	}
+}
+
+func testGenerations(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+
+	gen, err := c.Generation(ctx, "lists")
+	if err != nil || gen != 0 {
+		t.Fatalf("Generation of a new namespace: got (%d, %v), want (0, nil)", gen, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.Bump(ctx, "lists"); err != nil {
+			t.Fatalf("Bump: %v", err)
+		}
+	}
+
+	if gen, err := c.Generation(ctx, "lists"); err != nil || gen != 2 {
+		t.Errorf("Generation after two bumps: got (%d, %v), want (2, nil)", gen, err)
+	}
+	if gen, err := c.Generation(ctx, "other"); err != nil || gen != 0 {
+		t.Errorf("Generation of another namespace: got (%d, %v), want (0, nil)", gen, err)
+	}
+}
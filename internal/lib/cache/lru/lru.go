@@ -0,0 +1,115 @@
+// Package lru is the in-process cache.Cache: each replica keeps its own entries, so a change
+// made through one replica reaches the others only when their entries expire.
+package lru
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache holds at most size entries and drops the least recently used one to make room.
+// Expired entries are dropped when they are read. Generations are kept apart from the entries
+// and never evicted: losing one would bring back the keys it dropped.
+type Cache struct {
+	mu          sync.Mutex
+	size        int
+	entries     map[string]*list.Element
+	order       *list.List
+	generations map[string]int64
+}
+
+type entry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func New(size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Cache{
+		size:        size,
+		entries:     make(map[string]*list.Element, size),
+		order:       list.New(),
+		generations: make(map[string]int64),
+	}
+}
+
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	e := el.Value.(*entry)
+	if !time.Now().Before(e.expiresAt) {
+		c.remove(el)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(el)
+
+	return e.value, true, nil
+}
+
+func (c *Cache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expiresAt = value, expiresAt
+		c.order.MoveToFront(el)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+func (c *Cache) Generation(ctx context.Context, namespace string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generations[namespace], nil
+}
+
+func (c *Cache) Bump(ctx context.Context, namespace string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[namespace]++
+
+	return nil
+}
+
+// Len is the number of entries, expired ones included until they are read or evicted.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache) Close() error {
+	return nil
+}
+
+func (c *Cache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
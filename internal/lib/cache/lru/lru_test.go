@@ -0,0 +1,38 @@
+package lru
+
+import (
+	"context"
+	"inHouseAd/internal/lib/cache"
+	"inHouseAd/internal/lib/cache/cachetest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	cachetest.Run(t, func(t *testing.T) cache.Cache {
+		return New(100)
+	})
+}
+
+func TestEviction(t *testing.T) {
+	ctx := context.Background()
+	c := New(2)
+
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			// Reading key 0 makes key 1 the least recently used.
+			c.Get(ctx, "0")
+		}
+		c.Set(ctx, strconv.Itoa(i), []byte("value"), time.Minute)
+	}
+
+	for key, want := range map[string]bool{"0": true, "1": false, "2": true} {
+		if _, ok, _ := c.Get(ctx, key); ok != want {
+			t.Errorf("Get(%q): got %v, want %v", key, ok, want)
+		}
+	}
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len: got %d, want 2", n)
+	}
+}
@@ -0,0 +1,303 @@
+// Package redis is the cache.Cache shared by the replicas: a client of the Redis protocol
+// (RESP) for the few commands the cache needs, so any server speaking it will do.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/lib/cache"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Error is an error reply of the server.
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+var errNil = errors.New("redis: nil reply")
+
+// Options of the client. Every key is stored under Prefix, so that several services can share
+// a server. A command waits for the server at most Timeout; at most PoolSize idle connections
+// are kept for the next commands.
+type Options struct {
+	Address  string
+	Password string
+	DB       int
+	Prefix   string
+	Timeout  time.Duration
+	PoolSize int
+}
+
+type Cache struct {
+	opts Options
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// New checks that the server answers and returns the client.
+func New(opts Options) (*Cache, error) {
+	const op = "lib.cache.redis.New"
+
+	if opts.PoolSize < 1 {
+		opts.PoolSize = 1
+	}
+
+	c := &Cache{opts: opts}
+
+	if _, err := c.do(context.Background(), "PING"); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return c, nil
+}
+
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	const op = "lib.cache.redis.Get"
+
+	reply, err := c.do(ctx, "GET", c.opts.Prefix+key)
+	if err == errNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("%s: unexpected reply %v", op, reply)
+	}
+
+	return value, true, nil
+}
+
+func (c *Cache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	const op = "lib.cache.redis.Set"
+
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+
+	if _, err := c.do(ctx, "SET", c.opts.Prefix+key, string(value), "PX", strconv.FormatInt(ms, 10)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Generation reads the counter Bump increments; a namespace never bumped is at 0.
+func (c *Cache) Generation(ctx context.Context, namespace string) (int64, error) {
+	const op = "lib.cache.redis.Generation"
+
+	reply, err := c.do(ctx, "GET", c.generationKey(namespace))
+	if err == errNil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return 0, fmt.Errorf("%s: unexpected reply %v", op, reply)
+	}
+
+	gen, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return gen, nil
+}
+
+func (c *Cache) Bump(ctx context.Context, namespace string) error {
+	const op = "lib.cache.redis.Bump"
+
+	if _, err := c.do(ctx, "INCR", c.generationKey(namespace)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Close closes the idle connections; the ones in use are closed when their command returns.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+
+	return nil
+}
+
+func (c *Cache) generationKey(namespace string) string {
+	return c.opts.Prefix + "generation:" + namespace
+}
+
+// do sends a command and reads its reply: a string, []byte, int64 or errNil. A connection
+// that failed mid-command is closed, since the next reply read from it could be this one's.
+func (c *Cache) do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Time{}
+	if c.opts.Timeout > 0 {
+		deadline = time.Now().Add(c.opts.Timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	if err := cn.SetDeadline(deadline); err != nil {
+		cn.Close()
+		return nil, err
+	}
+
+	if err := writeCommand(cn, args); err != nil {
+		cn.Close()
+		return nil, err
+	}
+
+	reply, err := readReply(cn.r)
+	var replyErr Error
+	if err != nil && err != errNil && !errors.As(err, &replyErr) {
+		cn.Close()
+		return nil, err
+	}
+
+	c.put(cn)
+
+	return reply, err
+}
+
+func (c *Cache) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, cache.ErrClosed
+	}
+	if n := len(c.idle); n != 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	dialer := net.Dialer{Timeout: c.opts.Timeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.opts.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc)}
+
+	var setup [][]string
+	if c.opts.Password != "" {
+		setup = append(setup, []string{"AUTH", c.opts.Password})
+	}
+	if c.opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.opts.DB)})
+	}
+	for _, args := range setup {
+		if c.opts.Timeout > 0 {
+			cn.SetDeadline(time.Now().Add(c.opts.Timeout))
+		}
+		if err := writeCommand(cn, args); err != nil {
+			cn.Close()
+			return nil, err
+		}
+		if _, err := readReply(cn.r); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("%s: %w", args[0], err)
+		}
+	}
+
+	return cn, nil
+}
+
+func (c *Cache) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || len(c.idle) >= c.opts.PoolSize {
+		cn.Close()
+		return
+	}
+
+	c.idle = append(c.idle, cn)
+}
+
+func writeCommand(w io.Writer, args []string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// readReply reads a simple string, error, integer or bulk string reply.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	}
+
+	return nil, fmt.Errorf("redis: unsupported reply %q", line)
+}
@@ -0,0 +1,192 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/lib/cache"
+	"inHouseAd/internal/lib/cache/cachetest"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	cachetest.Run(t, func(t *testing.T) cache.Cache {
+		addr := standIn(t, "secret")
+
+		c, err := New(Options{Address: addr, Password: "secret", DB: 1, Prefix: "test:", Timeout: time.Second, PoolSize: 2})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+
+		return c
+	})
+}
+
+func TestAuthFailure(t *testing.T) {
+	addr := standIn(t, "secret")
+
+	_, err := New(Options{Address: addr, Password: "wrong", Timeout: time.Second})
+
+	var replyErr Error
+	if !errors.As(err, &replyErr) {
+		t.Errorf("New with a wrong password: got %v, want an error reply", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	c, err := New(Options{Address: standIn(t, ""), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c.Close()
+
+	if _, _, err := c.Get(context.Background(), "key"); !errors.Is(err, cache.ErrClosed) {
+		t.Errorf("Get after Close: got %v, want %v", err, cache.ErrClosed)
+	}
+}
+
+// standIn serves the commands the client sends, the way a Redis server answers them, on a
+// local port until the test ends.
+func standIn(t *testing.T, password string) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &server{password: password, values: make(map[string]value)}
+
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(nc)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+type server struct {
+	password string
+
+	mu     sync.Mutex
+	values map[string]value
+}
+
+type value struct {
+	data      string
+	expiresAt time.Time
+}
+
+func (s *server) serve(nc net.Conn) {
+	defer nc.Close()
+
+	r := bufio.NewReader(nc)
+	authed := s.password == ""
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authed = args[1] == s.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "PING":
+			reply = "+PONG\r\n"
+		case cmd == "SELECT":
+			reply = "+OK\r\n"
+		default:
+			reply = s.exec(cmd, args[1:])
+		}
+
+		if _, err := io.WriteString(nc, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *server) exec(cmd string, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[args[0]]
+	if ok && !v.expiresAt.IsZero() && !time.Now().Before(v.expiresAt) {
+		delete(s.values, args[0])
+		ok = false
+	}
+
+	switch cmd {
+	case "GET":
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v.data), v.data)
+	case "SET":
+		v = value{data: args[1]}
+		if len(args) == 4 && strings.ToUpper(args[2]) == "PX" {
+			ms, _ := strconv.Atoi(args[3])
+			v.expiresAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		s.values[args[0]] = v
+		return "+OK\r\n"
+	case "INCR":
+		n, _ := strconv.ParseInt(v.data, 10, 64)
+		n++
+		s.values[args[0]] = value{data: strconv.FormatInt(n, 10), expiresAt: v.expiresAt}
+		return fmt.Sprintf(":%d\r\n", n)
+	}
+
+	return "-ERR unknown command '" + cmd + "'\r\n"
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("malformed command %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("malformed argument %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+
+	return args, nil
+}
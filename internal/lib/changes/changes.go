@@ -0,0 +1,180 @@
+// Package changes is the in-process bus of catalog changes. The database notifies every change
+// of a good, a category or a good's categories; the Listener passes the notifications to the
+// Bus, which fans them out to its subscribers.
+package changes
+
+import (
+	"context"
+	"encoding/json"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	TableGood         = "good"
+	TableCategory     = "category"
+	TableGoodCategory = "good_category"
+)
+
+// OpResync tells a subscriber that it may have missed changes, after the listener reconnected
+// or because it fell behind: whatever it derived from earlier changes should be reloaded.
+const OpResync = "RESYNC"
+
+// Bus delivers every published change to every subscriber. Publishing never blocks: a subscriber
+// whose buffer is full misses the change and gets a resync as soon as it has room again.
+type Bus struct {
+	log    *slog.Logger
+	buffer int
+
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	name   string
+	ch     chan entity.Change
+	behind bool
+}
+
+func NewBus(log *slog.Logger, buffer int) *Bus {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	return &Bus{log: log, buffer: buffer, subs: make(map[*subscriber]struct{})}
+}
+
+// Subscribe returns the channel of the changes published from now on and the function that
+// ends the subscription and closes the channel.
+func (b *Bus) Subscribe(name string) (<-chan entity.Change, func()) {
+	sub := &subscriber{name: name, ch: make(chan entity.Change, b.buffer)}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+
+	return sub.ch, unsubscribe
+}
+
+func (b *Bus) Publish(c entity.Change) {
+	const op = "lib.changes.Publish"
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if sub.behind {
+			select {
+			case sub.ch <- entity.Change{Op: OpResync}:
+				sub.behind = false
+			default:
+				continue
+			}
+		}
+
+		select {
+		case sub.ch <- c:
+		default:
+			sub.behind = true
+			b.log.Warn("subscriber fell behind, changes dropped",
+				slog.String("op", op),
+				slog.String("subscriber", sub.name),
+			)
+		}
+	}
+}
+
+// Source delivers the payloads notified on a channel, see postgres.Storage.Listen.
+type Source interface {
+	Listen(ctx context.Context, channel string, ready func(), fn func(payload string)) error
+}
+
+// Listener feeds the bus from the source. A lost connection is reopened after a delay that
+// doubles from MinDelay up to MaxDelay while reconnecting fails.
+type Listener struct {
+	log      *slog.Logger
+	source   Source
+	channel  string
+	bus      *Bus
+	minDelay time.Duration
+	maxDelay time.Duration
+}
+
+func NewListener(log *slog.Logger, source Source, channel string, bus *Bus, minDelay, maxDelay time.Duration) *Listener {
+	if minDelay <= 0 {
+		minDelay = time.Second
+	}
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+
+	return &Listener{
+		log:      log,
+		source:   source,
+		channel:  channel,
+		bus:      bus,
+		minDelay: minDelay,
+		maxDelay: maxDelay,
+	}
+}
+
+// Run listens until ctx is canceled. Every time it listens again after losing the connection
+// it publishes a resync, since the changes made meanwhile were not notified to it.
+func (l *Listener) Run(ctx context.Context) {
+	const op = "lib.changes.Run"
+
+	log := l.log.With(slog.String("op", op), slog.String("channel", l.channel))
+
+	delay := l.minDelay
+	listened := false
+
+	for {
+		err := l.source.Listen(ctx, l.channel, func() {
+			if listened {
+				l.bus.Publish(entity.Change{Op: OpResync})
+			}
+			listened = true
+			delay = l.minDelay
+
+			log.Info("listening for changes")
+		}, func(payload string) {
+			var c entity.Change
+			if err := json.Unmarshal([]byte(payload), &c); err != nil {
+				log.Error("failed to decode change", slog.String("payload", payload), sl.Err(err))
+				return
+			}
+			l.bus.Publish(c)
+		})
+		if ctx.Err() != nil {
+			log.Info("change listener stopped")
+			return
+		}
+
+		log.Error("change listener disconnected", slog.Duration("retry_in", delay), sl.Err(err))
+
+		select {
+		case <-ctx.Done():
+			log.Info("change listener stopped")
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > l.maxDelay {
+			delay = l.maxDelay
+		}
+	}
+}
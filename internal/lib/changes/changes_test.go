@@ -0,0 +1,233 @@
+package changes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestFanOut(t *testing.T) {
+	bus := NewBus(discard, 10)
+
+	a, unsubscribeA := bus.Subscribe("a")
+	b, unsubscribeB := bus.Subscribe("b")
+	defer unsubscribeB()
+
+	want := []entity.Change{good(1), good(2), good(3)}
+	for _, c := range want {
+		bus.Publish(c)
+	}
+
+	for name, ch := range map[string]<-chan entity.Change{"a": a, "b": b} {
+		if got := drain(ch, len(want)); !reflect.DeepEqual(got, want) {
+			t.Errorf("subscriber %s: got %v, want %v", name, got, want)
+		}
+	}
+
+	unsubscribeA()
+	unsubscribeA()
+	if _, ok := <-a; ok {
+		t.Errorf("channel of an ended subscription is open")
+	}
+
+	bus.Publish(good(4))
+	if got := drain(b, 1); !reflect.DeepEqual(got, []entity.Change{good(4)}) {
+		t.Errorf("subscriber b after a left: got %v, want [%v]", got, good(4))
+	}
+}
+
+// TestSlowSubscriber publishes past the buffer of a subscriber that does not read: the changes
+// that do not fit are dropped, and once it reads, a resync comes before the next change.
+func TestSlowSubscriber(t *testing.T) {
+	resync := entity.Change{Op: OpResync}
+
+	tests := []struct {
+		name    string
+		buffer  int
+		before  int // changes published before the subscriber reads
+		read    int // changes it reads then
+		after   int // changes published after that
+		wantAll []entity.Change
+	}{
+		{
+			name:    "fits",
+			buffer:  3,
+			before:  3,
+			read:    3,
+			after:   1,
+			wantAll: []entity.Change{good(1), good(2), good(3), good(4)},
+		},
+		{
+			name:    "resync after catching up",
+			buffer:  2,
+			before:  5,
+			read:    2,
+			after:   1,
+			wantAll: []entity.Change{good(1), good(2), resync, good(6)},
+		},
+		{
+			name:    "resync fills the room again",
+			buffer:  2,
+			before:  4,
+			read:    1,
+			after:   2,
+			wantAll: []entity.Change{good(1), good(2), resync},
+		},
+		{
+			name:    "no room for a resync",
+			buffer:  1,
+			before:  2,
+			read:    0,
+			after:   1,
+			wantAll: []entity.Change{good(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewBus(discard, tt.buffer)
+
+			slow, unsubscribeSlow := bus.Subscribe("slow")
+			defer unsubscribeSlow()
+			fast, unsubscribeFast := bus.Subscribe("fast")
+			defer unsubscribeFast()
+
+			var (
+				wg       sync.WaitGroup
+				fastGot  []entity.Change
+				total    = tt.before + tt.after
+				fastWant []entity.Change
+			)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fastGot = drain(fast, total)
+			}()
+
+			id := 0
+			publish := func(n int) {
+				for i := 0; i < n; i++ {
+					id++
+					bus.Publish(good(id))
+					fastWant = append(fastWant, good(id))
+					// Let the fast subscriber read every change before the next one.
+					waitFor(t, func() bool { return len(fast) == 0 })
+				}
+			}
+
+			publish(tt.before)
+			got := drain(slow, tt.read)
+			publish(tt.after)
+			got = append(got, drain(slow, len(slow))...)
+
+			if !reflect.DeepEqual(got, tt.wantAll) {
+				t.Errorf("slow subscriber: got %v, want %v", got, tt.wantAll)
+			}
+
+			wg.Wait()
+			if !reflect.DeepEqual(fastGot, fastWant) {
+				t.Errorf("fast subscriber: got %v, want %v", fastGot, fastWant)
+			}
+		})
+	}
+}
+
+// source disconnects after delivering the payloads of a session, and blocks in the last one
+// until the listener is stopped.
+type source struct {
+	sessions [][]string
+	calls    int
+}
+
+func (s *source) Listen(ctx context.Context, channel string, ready func(), fn func(payload string)) error {
+	session := s.sessions[s.calls]
+	s.calls++
+
+	ready()
+	for _, payload := range session {
+		fn(payload)
+	}
+
+	if s.calls == len(s.sessions) {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return errors.New("connection lost")
+}
+
+func TestListenerResync(t *testing.T) {
+	bus := NewBus(discard, 10)
+	events, unsubscribe := bus.Subscribe("test")
+	defer unsubscribe()
+
+	src := &source{sessions: [][]string{
+		{payload(1), "not json", payload(2)},
+		{},
+		{payload(3)},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewListener(discard, src, "catalog_changes", bus, time.Millisecond, 2*time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	resync := entity.Change{Op: OpResync}
+	want := []entity.Change{good(1), good(2), resync, resync, good(3)}
+
+	got := drain(events, len(want))
+	cancel()
+	<-done
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if src.calls != 3 {
+		t.Errorf("listened %d times, want 3", src.calls)
+	}
+}
+
+func good(id int) entity.Change {
+	return entity.Change{Table: TableGood, Op: "UPDATE", Id: id}
+}
+
+func payload(id int) string {
+	return fmt.Sprintf(`{"table": %q, "op": "UPDATE", "id": %d}`, TableGood, id)
+}
+
+// drain reads up to n changes, giving up after a second without one.
+func drain(ch <-chan entity.Change, n int) []entity.Change {
+	var got []entity.Change
+	for i := 0; i < n; i++ {
+		select {
+		case c, ok := <-ch:
+			if !ok {
+				return got
+			}
+			got = append(got, c)
+		case <-time.After(time.Second):
+			return got
+		}
+	}
+	return got
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,324 @@
+package commerceml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"inHouseAd/internal/entity"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Source is what goods and categories imported from 1C are keyed by, together with their GUIDs.
+const Source = "1c"
+
+// Handler receives the contents of a CommerceML 2 file in document order: groups (parents
+// before children) and goods from import.xml, offers from offers.xml. Split packages of the
+// 2.08 schema (prices, rests) arrive as offers too.
+type Handler interface {
+	Category(c entity.ExternalCategory) error
+	Good(g entity.ExternalGood) error
+	Offer(o entity.ExternalOffer) error
+}
+
+type xmlGroup struct {
+	Id     string     `xml:"Ид"`
+	Name   string     `xml:"Наименование"`
+	Groups []xmlGroup `xml:"Группы>Группа"`
+}
+
+type xmlProperty struct {
+	Id     string `xml:"Ид"`
+	Name   string `xml:"Наименование"`
+	Values []struct {
+		Id    string `xml:"ИдЗначения"`
+		Value string `xml:"Значение"`
+	} `xml:"ВариантыЗначений>Справочник"`
+}
+
+type xmlClassifier struct {
+	Groups     []xmlGroup    `xml:"Группы>Группа"`
+	Properties []xmlProperty `xml:"Свойства>Свойство"`
+	// Schemas before 2.04 name properties differently.
+	LegacyProperties []xmlProperty `xml:"Свойства>СвойствоНоменклатуры"`
+}
+
+type xmlCharacteristic struct {
+	Name  string `xml:"Наименование"`
+	Value string `xml:"Значение"`
+}
+
+type xmlItem struct {
+	Id          string   `xml:"Ид"`
+	Sku         string   `xml:"Артикул"`
+	Name        string   `xml:"Наименование"`
+	Description string   `xml:"Описание"`
+	Status      string   `xml:"Статус,attr"`
+	Deleted     string   `xml:"ПометкаУдаления"`
+	Groups      []string `xml:"Группы>Ид"`
+	Properties  []struct {
+		Id     string   `xml:"Ид"`
+		Values []string `xml:"Значение"`
+	} `xml:"ЗначенияСвойств>ЗначенияСвойства"`
+	Characteristics []xmlCharacteristic `xml:"ХарактеристикиТовара>ХарактеристикаТовара"`
+}
+
+type xmlPriceType struct {
+	Id   string `xml:"Ид"`
+	Name string `xml:"Наименование"`
+}
+
+type xmlOffer struct {
+	Id              string              `xml:"Ид"`
+	Sku             string              `xml:"Артикул"`
+	Name            string              `xml:"Наименование"`
+	Characteristics []xmlCharacteristic `xml:"ХарактеристикиТовара>ХарактеристикаТовара"`
+	Prices          []struct {
+		TypeId string `xml:"ИдТипаЦены"`
+		Price  string `xml:"ЦенаЗаЕдиницу"`
+	} `xml:"Цены>Цена"`
+	Quantity *string `xml:"Количество"`
+	Rests    []struct {
+		Quantity *string  `xml:"Количество"`
+		Stores   []string `xml:"Склад>Количество"`
+	} `xml:"Остатки>Остаток"`
+	Stores []struct {
+		Quantity string `xml:"КоличествоНаСкладе,attr"`
+	} `xml:"Склад"`
+}
+
+type reader struct {
+	h          Handler
+	priceType  string
+	properties map[string]xmlProperty
+	priceTypes map[string]string
+}
+
+// Read streams a CommerceML 2 document into h. Only the classifier and the price types are
+// held in memory; goods and offers are handed over one at a time. priceType selects the price by
+// its name in 1C; empty means the first price of each offer.
+func Read(r io.Reader, priceType string, h Handler) error {
+	rd := &reader{
+		h:          h,
+		priceType:  priceType,
+		properties: make(map[string]xmlProperty),
+		priceTypes: make(map[string]string),
+	}
+
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charsetReader
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "Классификатор":
+			var c xmlClassifier
+			if err := dec.DecodeElement(&c, &start); err != nil {
+				return err
+			}
+			if err := rd.classifier(c); err != nil {
+				return err
+			}
+		case "Товар":
+			var item xmlItem
+			if err := dec.DecodeElement(&item, &start); err != nil {
+				return err
+			}
+			if err := h.Good(rd.good(item)); err != nil {
+				return err
+			}
+		case "ТипЦены":
+			var t xmlPriceType
+			if err := dec.DecodeElement(&t, &start); err != nil {
+				return err
+			}
+			rd.priceTypes[t.Id] = t.Name
+		case "Предложение":
+			var o xmlOffer
+			if err := dec.DecodeElement(&o, &start); err != nil {
+				return err
+			}
+			offer, err := rd.offer(o)
+			if err != nil {
+				return err
+			}
+			if err := h.Offer(offer); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (rd *reader) classifier(c xmlClassifier) error {
+	for _, p := range append(c.Properties, c.LegacyProperties...) {
+		rd.properties[p.Id] = p
+	}
+
+	var walk func(groups []xmlGroup, parent string) error
+	walk = func(groups []xmlGroup, parent string) error {
+		for _, g := range groups {
+			err := rd.h.Category(entity.ExternalCategory{ExternalId: g.Id, ParentExternalId: parent, Name: strings.TrimSpace(g.Name)})
+			if err != nil {
+				return err
+			}
+			if err := walk(g.Groups, g.Id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return walk(c.Groups, "")
+}
+
+func (rd *reader) good(item xmlItem) entity.ExternalGood {
+	g := entity.ExternalGood{
+		ExternalId:          item.Id,
+		Name:                strings.TrimSpace(item.Name),
+		Sku:                 strings.TrimSpace(item.Sku),
+		CategoryExternalIds: item.Groups,
+		Attributes:          make(map[string]string),
+		Deleted:             item.Status == "Удален" || item.Deleted == "true",
+	}
+
+	// Characteristics sent in import.xml have ids of the form "<good>#<characteristic>".
+	if parent, _, ok := strings.Cut(item.Id, "#"); ok {
+		g.ParentExternalId = parent
+	}
+
+	if d := strings.TrimSpace(item.Description); d != "" {
+		g.Attributes["description"] = d
+	}
+
+	for _, pv := range item.Properties {
+		p, ok := rd.properties[pv.Id]
+		if !ok {
+			continue
+		}
+
+		var values []string
+		for _, v := range pv.Values {
+			values = append(values, rd.propertyValue(p, v))
+		}
+		if len(values) != 0 {
+			g.Attributes[strings.TrimSpace(p.Name)] = strings.Join(values, ", ")
+		}
+	}
+
+	for _, c := range item.Characteristics {
+		g.Attributes[strings.TrimSpace(c.Name)] = strings.TrimSpace(c.Value)
+	}
+
+	return g
+}
+
+// propertyValue resolves a reference to a directory entry of the property; other values are literal.
+func (rd *reader) propertyValue(p xmlProperty, raw string) string {
+	raw = strings.TrimSpace(raw)
+	for _, v := range p.Values {
+		if v.Id == raw {
+			return strings.TrimSpace(v.Value)
+		}
+	}
+	return raw
+}
+
+func (rd *reader) offer(o xmlOffer) (entity.ExternalOffer, error) {
+	offer := entity.ExternalOffer{
+		ExternalId: o.Id,
+		Name:       strings.TrimSpace(o.Name),
+		Sku:        strings.TrimSpace(o.Sku),
+		Attributes: make(map[string]string),
+	}
+
+	if parent, _, ok := strings.Cut(o.Id, "#"); ok {
+		offer.ParentExternalId = parent
+	}
+
+	for _, c := range o.Characteristics {
+		offer.Attributes[strings.TrimSpace(c.Name)] = strings.TrimSpace(c.Value)
+	}
+
+	for _, p := range o.Prices {
+		if rd.priceType != "" && rd.priceTypes[p.TypeId] != rd.priceType {
+			continue
+		}
+		price, err := number(p.Price)
+		if err != nil {
+			return entity.ExternalOffer{}, fmt.Errorf("offer %s: price: %w", o.Id, err)
+		}
+		offer.Price = &price
+		break
+	}
+
+	var quantities []string
+	if o.Quantity != nil {
+		quantities = append(quantities, *o.Quantity)
+	} else {
+		for _, rest := range o.Rests {
+			if rest.Quantity != nil {
+				quantities = append(quantities, *rest.Quantity)
+			}
+			quantities = append(quantities, rest.Stores...)
+		}
+		for _, store := range o.Stores {
+			quantities = append(quantities, store.Quantity)
+		}
+	}
+
+	if len(quantities) != 0 {
+		var total float64
+		for _, q := range quantities {
+			n, err := number(q)
+			if err != nil {
+				return entity.ExternalOffer{}, fmt.Errorf("offer %s: quantity: %w", o.Id, err)
+			}
+			total += n
+		}
+
+		// Stock is counted in whole units; 1C reports fractions for goods sold by weight.
+		stock := int(math.Max(0, math.Floor(total)))
+		offer.Stock = &stock
+	}
+
+	return offer, nil
+}
+
+// number parses 1C numbers, which may use a decimal comma and spaces between thousands.
+// NaN and infinities are rejected.
+func number(s string) (float64, error) {
+	s = strings.NewReplacer(" ", "", " ", "", ",", ".").Replace(strings.TrimSpace(s))
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", s)
+	}
+
+	return n, nil
+}
+
+// charsetReader decodes the windows-1251 documents older 1C configurations produce.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(label) {
+	case "windows-1251", "cp1251":
+		return charmap.Windows1251.NewDecoder().Reader(input), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", label)
+}
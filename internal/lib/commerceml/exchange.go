@@ -0,0 +1,244 @@
+package commerceml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/logger/sl"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	StatusProgress = "progress"
+	StatusSuccess  = "success"
+	StatusFailure  = "failure"
+)
+
+var ErrInvalidFilename = errors.New("invalid file name")
+
+type Storage interface {
+	UpsertExternalCategory(ctx context.Context, source string, c entity.ExternalCategory) (int, error)
+	UpsertExternalGood(ctx context.Context, source string, g entity.ExternalGood, actorUid int) (string, error)
+	UpsertExternalOffer(ctx context.Context, source string, o entity.ExternalOffer, actorUid int) (string, error)
+}
+
+// Invalidator drops the cached lists an import makes stale, see cache.Lists.
+type Invalidator interface {
+	InvalidateCategories(ctx context.Context)
+	InvalidateGoods(ctx context.Context)
+}
+
+// Result is the answer to an import request of the 1C exchange protocol.
+type Result struct {
+	Status  string
+	Message string
+}
+
+// Exchange keeps the files 1C uploads during an exchange session, one directory per user,
+// and imports them in the background: 1C polls the import until it stops reporting progress.
+type Exchange struct {
+	log         *slog.Logger
+	storage     Storage
+	invalidator Invalidator
+	dir         string
+	priceType   string
+
+	mu   sync.Mutex
+	jobs map[string]*Result
+}
+
+func NewExchange(log *slog.Logger, storage Storage, invalidator Invalidator, dir, priceType string) *Exchange {
+	return &Exchange{
+		log:         log,
+		storage:     storage,
+		invalidator: invalidator,
+		dir:         dir,
+		priceType:   priceType,
+		jobs:        make(map[string]*Result),
+	}
+}
+
+// Init starts a new session, dropping the files and results left by the previous one.
+func (e *Exchange) Init(uid int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	prefix := strconv.Itoa(uid) + "/"
+	for key, job := range e.jobs {
+		if strings.HasPrefix(key, prefix) && job.Status != StatusProgress {
+			delete(e.jobs, key)
+		}
+	}
+
+	dir := filepath.Join(e.dir, strconv.Itoa(uid))
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	return os.MkdirAll(dir, 0o755)
+}
+
+// Save appends r to the file: 1C sends big files in several requests.
+func (e *Exchange) Save(uid int, filename string, r io.Reader) error {
+	path, err := e.path(uid, filename)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Import starts importing the file on the first call and reports progress on the following ones.
+// A finished result is reported once, so a new exchange can import a file of the same name.
+func (e *Exchange) Import(uid int, filename string) Result {
+	path, err := e.path(uid, filename)
+	if err != nil {
+		return Result{Status: StatusFailure, Message: err.Error()}
+	}
+
+	key := strconv.Itoa(uid) + "/" + filename
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if job, ok := e.jobs[key]; ok {
+		if job.Status != StatusProgress {
+			delete(e.jobs, key)
+		}
+		return *job
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return Result{Status: StatusFailure, Message: fmt.Sprintf("file %s was not uploaded", filename)}
+	}
+
+	job := &Result{Status: StatusProgress}
+	e.jobs[key] = job
+
+	go func() {
+		result := e.run(uid, filename, path)
+
+		e.mu.Lock()
+		*job = result
+		e.mu.Unlock()
+	}()
+
+	return Result{Status: StatusProgress, Message: "import started"}
+}
+
+func (e *Exchange) run(uid int, filename, path string) Result {
+	const op = "lib.commerceml.run"
+
+	log := e.log.With(
+		slog.String("op", op),
+		slog.Int("uid", uid),
+		slog.String("filename", filename),
+	)
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Error("failed to open exchange file", sl.Err(err))
+		return Result{Status: StatusFailure, Message: "internal error"}
+	}
+	defer f.Close()
+
+	log.Info("exchange import started")
+
+	// The import outlives the request that started it.
+	h := &importHandler{ctx: context.Background(), log: log, storage: e.storage, uid: uid}
+
+	// A failed import may have stored part of the file already.
+	defer func() {
+		e.invalidator.InvalidateCategories(context.Background())
+		e.invalidator.InvalidateGoods(context.Background())
+	}()
+
+	if err := Read(f, e.priceType, h); err != nil {
+		log.Error("exchange import failed", sl.Err(err))
+		return Result{Status: StatusFailure, Message: err.Error()}
+	}
+
+	msg := fmt.Sprintf("categories: %d, goods: %d, offers: %d, rejected: %d", h.categories, h.goods, h.offers, h.rejected)
+
+	log.Info("exchange import finished", slog.String("result", msg))
+
+	return Result{Status: StatusSuccess, Message: msg}
+}
+
+// path confines the file to the user's directory; 1C sends pictures under import_files/.
+func (e *Exchange) path(uid int, filename string) (string, error) {
+	rel := strings.TrimPrefix(filepath.Clean("/"+filepath.FromSlash(filename)), string(filepath.Separator))
+	if filename == "" || rel == "" || rel == "." {
+		return "", ErrInvalidFilename
+	}
+
+	return filepath.Join(e.dir, strconv.Itoa(uid), rel), nil
+}
+
+// importHandler writes what Read finds to the storage. Rejected goods and offers are logged and
+// skipped so that one bad item does not stop the exchange.
+type importHandler struct {
+	ctx     context.Context
+	log     *slog.Logger
+	storage Storage
+	uid     int
+
+	categories, goods, offers, rejected int
+}
+
+func (h *importHandler) Category(c entity.ExternalCategory) error {
+	if _, err := h.storage.UpsertExternalCategory(h.ctx, Source, c); err != nil {
+		return err
+	}
+	h.categories++
+	return nil
+}
+
+func (h *importHandler) Good(g entity.ExternalGood) error {
+	msg, err := h.storage.UpsertExternalGood(h.ctx, Source, g, h.uid)
+	if err != nil {
+		return err
+	}
+	if msg != "" {
+		h.log.Warn("good rejected", slog.String("external_id", g.ExternalId), slog.String("reason", msg))
+		h.rejected++
+		return nil
+	}
+	h.goods++
+	return nil
+}
+
+func (h *importHandler) Offer(o entity.ExternalOffer) error {
+	msg, err := h.storage.UpsertExternalOffer(h.ctx, Source, o, h.uid)
+	if err != nil {
+		return err
+	}
+	if msg != "" {
+		h.log.Warn("offer rejected", slog.String("external_id", o.ExternalId), slog.String("reason", msg))
+		h.rejected++
+		return nil
+	}
+	h.offers++
+	return nil
+}
@@ -0,0 +1,240 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrSyntax = errors.New("invalid schedule")
+
+// Schedule tells when a job runs next.
+type Schedule interface {
+	// Next returns the first run time strictly after t.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// Every runs a job at a fixed interval.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e Every) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// Spec is a classic five-field cron expression: minute, hour, day of month, month and day of week
+// (0 is Sunday, 7 is accepted too). Fields take "*", numbers, ranges "a-b", lists "a,b"
+// and steps "*/n" or "a-b/n". As in cron, when both day fields are restricted a day matching
+// either is a match; only a bare "*" leaves a day field unrestricted, "*/n" restricts it. Times are in the location of the time passed to Next. When the clocks go
+// forward, the skipped times do not run; when they go back, a job with a restricted hour field
+// runs only the first time its time comes, while one running every hour runs in both hours.
+type Spec struct {
+	text                          string
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny, hourAny       bool
+}
+
+// Parse accepts a cron expression, one of @yearly, @monthly, @weekly, @daily, @hourly,
+// or "@every <duration>".
+func Parse(text string) (Schedule, error) {
+	text = strings.TrimSpace(text)
+
+	if rest, ok := strings.CutPrefix(text, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: %q: interval must be a positive duration", ErrSyntax, text)
+		}
+		return Every(d), nil
+	}
+
+	expr := text
+	if d, ok := descriptors[text]; ok {
+		expr = d
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("%w: %q: want %d fields", ErrSyntax, text, len(fields))
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %s", ErrSyntax, text, err)
+		}
+		sets[i] = set
+	}
+
+	// Sunday may be written as 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+
+	spec := &Spec{
+		text:    text,
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domAny:  parts[2] == "*",
+		dowAny:  parts[4] == "*",
+		hourAny: sets[1] == 1<<24-1,
+	}
+	if spec.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w: %q never matches", ErrSyntax, text)
+	}
+
+	return spec, nil
+}
+
+func parseField(text string, f field) (uint64, error) {
+	max := f.max
+	if f.name == "day of week" {
+		max = 7
+	}
+
+	var set uint64
+	for _, item := range strings.Split(text, ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%s: invalid step %q", f.name, stepText)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		default:
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("%s: invalid value %q", f.name, from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("%s: invalid value %q", f.name, to)
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%s: %q out of range %d-%d", f.name, rng, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+func (s *Spec) String() string {
+	return s.text
+}
+
+// Next searches minute by minute, skipping whole months, days and hours that cannot match,
+// so it ends within a few hundred steps. It gives up after five years: an expression like
+// "0 0 30 2 *" never matches.
+func (s *Spec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = skip(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = skip(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = skip(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 || (!s.hourAny && repeated(t)) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// skip moves t to next, the start of the following month, day or hour. A start the clocks jump
+// over is normalized by time.Date to a time before it, possibly not after t: t then moves on by
+// a minute, until it is past the jump.
+func skip(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Minute)
+}
+
+// repeated reports whether the clock already showed the time of t earlier, in the hour that
+// repeats when the clocks go back.
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-2 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+	return earlier.Day() == t.Day() && earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+func (s *Spec) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
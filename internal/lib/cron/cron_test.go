@@ -0,0 +1,194 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1- * * * *",
+		"@weekdays",
+		"@every",
+		"@every 0s",
+		"@every -1m",
+		"@every soon",
+		"0 0 30 2 *",
+	}
+
+	for _, text := range tests {
+		if s, err := Parse(text); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Parse(%q): got (%v, %v), want %v", text, s, err, ErrSyntax)
+		}
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		text                          string
+		minute, hour, dom, month, dow uint64
+		domAny, dowAny                bool
+	}{
+		{
+			text:   "* * * * *",
+			minute: span(0, 59), hour: span(0, 23), dom: span(1, 31), month: span(1, 12), dow: span(0, 6),
+			domAny: true, dowAny: true,
+		},
+		{
+			text:   "1,2,5-7 */6 1-10/3 * 7",
+			minute: bits(1, 2, 5, 6, 7), hour: bits(0, 6, 12, 18), dom: bits(1, 4, 7, 10), month: span(1, 12), dow: bits(0),
+			dowAny: false, domAny: false,
+		},
+		{
+			text:   "30/10 0 */10 2-3 1-5",
+			minute: bits(30, 40, 50), hour: bits(0), dom: bits(1, 11, 21, 31), month: bits(2, 3), dow: span(1, 5),
+		},
+		{
+			text:   "0 0 * * 5-7",
+			minute: bits(0), hour: bits(0), dom: span(1, 31), month: span(1, 12), dow: bits(0, 5, 6),
+			domAny: true,
+		},
+		{
+			text:   "0 0 */2 * */2",
+			minute: bits(0), hour: bits(0), dom: bits(1, 3, 5, 7, 9, 11, 13, 15, 17, 19, 21, 23, 25, 27, 29, 31), month: span(1, 12), dow: bits(0, 2, 4, 6),
+		},
+		{
+			text:   "@weekly",
+			minute: bits(0), hour: bits(0), dom: span(1, 31), month: span(1, 12), dow: bits(0),
+			domAny: true,
+		},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.text)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.text, err)
+			continue
+		}
+		s := schedule.(*Spec)
+
+		got := [5]uint64{s.minute, s.hour, s.dom, s.month, s.dow}
+		want := [5]uint64{tt.minute, tt.hour, tt.dom, tt.month, tt.dow}
+		for i := range fields {
+			if got[i] != want[i] {
+				t.Errorf("Parse(%q) %s: got %b, want %b", tt.text, fields[i].name, got[i], want[i])
+			}
+		}
+		if s.domAny != tt.domAny || s.dowAny != tt.dowAny {
+			t.Errorf("Parse(%q): any day of month %t, of week %t, want %t, %t", tt.text, s.domAny, s.dowAny, tt.domAny, tt.dowAny)
+		}
+		if s.String() != tt.text {
+			t.Errorf("String: got %q, want %q", s.String(), tt.text)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	newYork := location(t, "America/New_York")
+	santiago := location(t, "America/Santiago")
+
+	tests := []struct {
+		name string
+		text string
+		from time.Time
+		want time.Time
+	}{
+		{"step", "*/15 * * * *", utc(2024, 5, 1, 10, 7), utc(2024, 5, 1, 10, 15)},
+		{"strictly after", "*/15 * * * *", utc(2024, 5, 1, 10, 15), utc(2024, 5, 1, 10, 30)},
+		{"seconds", "*/15 * * * *", utc(2024, 5, 1, 10, 14).Add(59 * time.Second), utc(2024, 5, 1, 10, 15)},
+		{"next hour", "5 * * * *", utc(2024, 5, 1, 10, 7), utc(2024, 5, 1, 11, 5)},
+		{"next day", "0 9 * * *", utc(2024, 5, 1, 10, 0), utc(2024, 5, 2, 9, 0)},
+		{"month end", "0 0 1 * *", utc(2024, 1, 31, 12, 0), utc(2024, 2, 1, 0, 0)},
+		{"short month", "0 0 31 * *", utc(2024, 4, 1, 0, 0), utc(2024, 5, 31, 0, 0)},
+		{"leap day", "0 0 29 2 *", utc(2023, 3, 1, 0, 0), utc(2024, 2, 29, 0, 0)},
+		{"year end", "59 23 31 12 *", utc(2024, 12, 31, 23, 59), utc(2025, 12, 31, 23, 59)},
+		{"month", "0 0 1 6 *", utc(2024, 7, 1, 0, 0), utc(2025, 6, 1, 0, 0)},
+		{"descriptor", "@daily", utc(2024, 5, 1, 10, 0), utc(2024, 5, 2, 0, 0)},
+		{"interval", "@every 90s", utc(2024, 5, 1, 10, 0), utc(2024, 5, 1, 10, 1).Add(30 * time.Second)},
+
+		// With both day fields restricted, the 13th or a Friday will do.
+		{"day of month or week, friday", "0 0 13 * 5", utc(2024, 9, 1, 0, 0), utc(2024, 9, 6, 0, 0)},
+		{"day of month or week, 13th", "0 0 13 * 5", utc(2024, 10, 12, 0, 0), utc(2024, 10, 13, 0, 0)},
+		{"day of month only", "0 0 13 * *", utc(2024, 10, 1, 0, 0), utc(2024, 10, 13, 0, 0)},
+		{"day of week only", "0 0 * * 1", utc(2024, 10, 1, 0, 0), utc(2024, 10, 7, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", utc(2024, 10, 1, 0, 0), utc(2024, 10, 6, 0, 0)},
+		{"stepped day of month or week", "0 0 */2 * 1", utc(2024, 10, 1, 0, 0), utc(2024, 10, 3, 0, 0)},
+		{"stepped day of month", "0 0 */2 * *", utc(2024, 1, 1, 0, 0), utc(2024, 1, 3, 0, 0)},
+		{"stepped day of month, next", "0 0 */2 * *", utc(2024, 1, 3, 0, 0), utc(2024, 1, 5, 0, 0)},
+		{"stepped day of month, new month", "0 0 */2 * *", utc(2024, 1, 31, 0, 0), utc(2024, 2, 1, 0, 0)},
+		{"stepped day of week", "0 0 * * */2", utc(2024, 1, 5, 0, 0), utc(2024, 1, 6, 0, 0)},
+		{"stepped day of week, sunday", "0 0 * * */2", utc(2024, 1, 6, 0, 0), utc(2024, 1, 7, 0, 0)},
+		{"stepped day of week, skips monday", "0 0 * * */2", utc(2024, 1, 7, 0, 0), utc(2024, 1, 9, 0, 0)},
+
+		// 2:00-3:00 does not exist on 2024-03-10 in New York; 1:00-2:00 repeats on 2024-11-03.
+		{"skipped time", "30 2 * * *", at(newYork, 2024, 3, 10, 0, 0), at(newYork, 2024, 3, 11, 2, 30)},
+		{"hourly over the gap", "0 * * * *", at(newYork, 2024, 3, 10, 1, 30), at(newYork, 2024, 3, 10, 3, 0)},
+		{"first of the repeated hour", "30 1 * * *", at(newYork, 2024, 11, 3, 0, 0), at(newYork, 2024, 11, 3, 1, 30)},
+		{"repeated hour runs once", "30 1 * * *", at(newYork, 2024, 11, 3, 1, 30), at(newYork, 2024, 11, 4, 1, 30)},
+		{"every hour runs in both", "30 * * * *", at(newYork, 2024, 11, 3, 1, 30), at(newYork, 2024, 11, 3, 1, 30).Add(time.Hour)},
+
+		// Midnight does not exist on 2024-09-08 in Santiago: the day starts at 1:00.
+		{"skipped midnight", "0 0 * * *", at(santiago, 2024, 9, 7, 12, 0), at(santiago, 2024, 9, 9, 0, 0)},
+		{"day over the gap", "0 12 * * 0", at(santiago, 2024, 9, 7, 12, 0), at(santiago, 2024, 9, 8, 12, 0)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.text)
+		if err != nil {
+			t.Errorf("%s: Parse(%q): %v", tt.name, tt.text, err)
+			continue
+		}
+
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%s) of %q: got %s, want %s", tt.name, tt.from, tt.text, got, tt.want)
+		}
+	}
+}
+
+func bits(values ...int) uint64 {
+	var set uint64
+	for _, v := range values {
+		set |= 1 << v
+	}
+	return set
+}
+
+func span(lo, hi int) uint64 {
+	var set uint64
+	for v := lo; v <= hi; v++ {
+		set |= 1 << v
+	}
+	return set
+}
+
+func utc(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func at(loc *time.Location, year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, loc)
+}
+
+func location(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
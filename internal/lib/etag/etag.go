@@ -0,0 +1,135 @@
+package etag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrPreconditionRequired = errors.New("If-Match header is required")
+	ErrInvalid              = errors.New("If-Match must be the ETag of the resource")
+	ErrWeak                 = errors.New("If-Match requires a strong ETag")
+)
+
+// Version is the ETag of a single resource: its row version.
+func Version(v int) string {
+	return `"` + strconv.Itoa(v) + `"`
+}
+
+// Derived is the ETag of a resource whose representation v also shows other rows, like the
+// categories of a good: its row version and a hash of v, so that it changes with either.
+// IfMatch reads the version back from it.
+func Derived(version int, v any) (string, error) {
+	hash, err := Hash(v)
+	if err != nil {
+		return "", err
+	}
+
+	return `"` + strconv.Itoa(version) + "-" + strings.Trim(hash, `"`) + `"`, nil
+}
+
+// Hash is the ETag of a collection, derived from its JSON representation.
+func Hash(v any) (string, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+
+	return `"` + hex.EncodeToString(sum[:8]) + `"`, nil
+}
+
+// NotModified sets the ETag header and, when the request's If-None-Match matches it,
+// answers 304 and reports true so that the handler stops.
+func NotModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match is the condition of an If-Match header: the versions the client expects to modify.
+// An empty Match means any version: either the header is "*" or it is absent and not required.
+type Match []int
+
+// IfMatch parses the If-Match header, a "*" or a list of ETags made by Version or Derived; the
+// version of a Derived tag is what is compared. Weak tags (W/"3") are rejected: If-Match
+// compares tags strongly.
+func IfMatch(r *http.Request, required bool) (Match, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		if required {
+			return nil, ErrPreconditionRequired
+		}
+		return nil, nil
+	}
+	if header == "*" {
+		return nil, nil
+	}
+
+	var m Match
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			return nil, ErrWeak
+		}
+
+		version, _, _ := strings.Cut(strings.Trim(tag, `"`), "-")
+		v, err := strconv.Atoi(version)
+		if err != nil || v <= 0 {
+			return nil, ErrInvalid
+		}
+		if !slices.Contains(m, v) {
+			m = append(m, v)
+		}
+	}
+
+	return m, nil
+}
+
+// Try runs fn, a versioned change, with each expected version until one is current: fn returns
+// mismatch for a version that is not. Each call checks its version atomically and a mismatch
+// changes nothing, so at most one call succeeds. An empty Match runs fn once with version 0,
+// which skips the check.
+func (m Match) Try(mismatch error, fn func(version int) error) error {
+	if len(m) == 0 {
+		return fn(0)
+	}
+
+	var err error
+	for _, v := range m {
+		if err = fn(v); !errors.Is(err, mismatch) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// WritePreconditionError answers a failed IfMatch with 428 or 400.
+func WritePreconditionError(w http.ResponseWriter, err error) {
+	if err == ErrPreconditionRequired {
+		http.Error(w, err.Error(), http.StatusPreconditionRequired)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,159 @@
+package etag
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		header   string
+		required bool
+		want     Match
+		wantErr  error
+	}{
+		{header: `"3"`, want: Match{3}},
+		{header: ` "12" `, want: Match{12}},
+		{header: `3`, want: Match{3}},
+		{header: `"3", "4"`, want: Match{3, 4}},
+		{header: `"3","3"`, want: Match{3}},
+		{header: `"3-0123456789abcdef"`, want: Match{3}},
+		{header: `"3-0123456789abcdef", "3-fedcba9876543210"`, want: Match{3}},
+		{header: `*`, want: nil},
+		{header: `*`, required: true, want: nil},
+		{header: ``, want: nil},
+		{header: ``, required: true, wantErr: ErrPreconditionRequired},
+		{header: `W/"3"`, wantErr: ErrWeak},
+		{header: `"3", W/"4"`, wantErr: ErrWeak},
+		{header: `"0"`, wantErr: ErrInvalid},
+		{header: `"-1"`, wantErr: ErrInvalid},
+		{header: `"abc"`, wantErr: ErrInvalid},
+		{header: `"3",`, wantErr: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPatch, "/", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+
+		got, err := IfMatch(r, tt.required)
+		if err != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("IfMatch(%q, %t): got (%v, %v), want (%v, %v)", tt.header, tt.required, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTry(t *testing.T) {
+	mismatch := errors.New("mismatch")
+	failure := errors.New("failure")
+
+	tests := []struct {
+		match   Match
+		current int
+		fail    bool
+		want    []int
+		wantErr error
+	}{
+		{match: nil, current: 5, want: []int{0}},
+		{match: Match{5}, current: 5, want: []int{5}},
+		{match: Match{3, 5, 7}, current: 5, want: []int{3, 5}},
+		{match: Match{3, 4}, current: 5, want: []int{3, 4}, wantErr: mismatch},
+		{match: Match{5, 6}, current: 5, fail: true, want: []int{5}, wantErr: failure},
+	}
+
+	for _, tt := range tests {
+		var tried []int
+		err := tt.match.Try(mismatch, func(version int) error {
+			tried = append(tried, version)
+			switch {
+			case version != 0 && version != tt.current:
+				return mismatch
+			case tt.fail:
+				return failure
+			}
+			return nil
+		})
+
+		if err != tt.wantErr || !slices.Equal(tried, tt.want) {
+			t.Errorf("Try(%v) at version %d: tried %v, got %v, want %v and %v", tt.match, tt.current, tried, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tag := Version(3)
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: ``, want: false},
+		{header: `"3"`, want: true},
+		{header: `W/"3"`, want: true},
+		{header: `"2", "3"`, want: true},
+		{header: `*`, want: true},
+		{header: `"2"`, want: false},
+		{header: `3`, want: false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			r.Header.Set("If-None-Match", tt.header)
+		}
+		w := httptest.NewRecorder()
+
+		got := NotModified(w, r, tag)
+		if got != tt.want {
+			t.Errorf("NotModified(%q): got %t, want %t", tt.header, got, tt.want)
+		}
+		if w.Header().Get("ETag") != tag {
+			t.Errorf("NotModified(%q): ETag %q, want %q", tt.header, w.Header().Get("ETag"), tag)
+		}
+		if got && w.Code != http.StatusNotModified {
+			t.Errorf("NotModified(%q): status %d, want %d", tt.header, w.Code, http.StatusNotModified)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	a, err := Hash([]int{1, 2})
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	b, _ := Hash([]int{1, 2})
+	c, _ := Hash([]int{2, 1})
+
+	if a != b {
+		t.Errorf("Hash of equal values: %q != %q", a, b)
+	}
+	if a == c {
+		t.Errorf("Hash of different values: both %q", a)
+	}
+	if len(a) != 18 || a[0] != '"' || a[len(a)-1] != '"' {
+		t.Errorf("Hash: got %q, want a quoted 16-digit tag", a)
+	}
+}
+
+func TestDerived(t *testing.T) {
+	a, err := Derived(3, map[string]string{"category": "a"})
+	if err != nil {
+		t.Fatalf("Derived: %v", err)
+	}
+	b, _ := Derived(3, map[string]string{"category": "b"})
+	c, _ := Derived(4, map[string]string{"category": "a"})
+
+	if a == b || a == c {
+		t.Errorf("Derived: got %q, %q and %q, want all different", a, b, c)
+	}
+
+	r := httptest.NewRequest(http.MethodPatch, "/", nil)
+	r.Header.Set("If-Match", a)
+	if got, err := IfMatch(r, false); err != nil || !slices.Equal(got, Match{3}) {
+		t.Errorf("IfMatch(%q): got (%v, %v), want [3]", a, got, err)
+	}
+}
@@ -0,0 +1,392 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/importer"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/lib/tabular"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported format, expected csv, jsonl or xlsx")
+
+type Source interface {
+	GetExportAttributeNames(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]string, error)
+	ExportGoods(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool, fn func(entity.ExportGood) error) error
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// Export is a validated export, ready to be written.
+type Export struct {
+	source     Source
+	query      entity.ExportQuery
+	filters    []attr.Filter
+	attributes []string
+}
+
+// Prepare validates the query and looks up the attribute columns. Invalid filters are reported
+// here, before anything is written.
+func Prepare(ctx context.Context, source Source, query entity.ExportQuery) (*Export, error) {
+	filters, err := attr.ParseFilters(query.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := source.GetExportAttributeNames(ctx, query.CategoryId, filters, query.CollapseVariants)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{source: source, query: query, filters: filters, attributes: attributes}, nil
+}
+
+// WriteTo streams the goods to w in the format and returns the number of goods written.
+// Tabular formats use the import column names, so an exported file can be imported back.
+func (e *Export) WriteTo(ctx context.Context, format string, w io.Writer) (int, error) {
+	enc, err := newEncoder(format, w, e.attributes)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err = e.source.ExportGoods(ctx, e.query.CategoryId, e.filters, e.query.CollapseVariants, func(g entity.ExportGood) error {
+		n++
+		return enc.encode(g)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return n, enc.close()
+}
+
+type encoder interface {
+	encode(g entity.ExportGood) error
+	close() error
+}
+
+func newEncoder(format string, w io.Writer, attributes []string) (encoder, error) {
+	switch format {
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		enc.SetEscapeHTML(false)
+		return &jsonlEncoder{w: bw, enc: enc}, nil
+	case FormatCSV:
+		e := &csvEncoder{w: csv.NewWriter(w), attributes: attributes}
+		return e, e.w.Write(header(attributes))
+	case FormatXLSX:
+		xw, err := tabular.NewXLSXWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		cells := header(attributes)
+		values := make([]any, len(cells))
+		for i, c := range cells {
+			values[i] = c
+		}
+		return &xlsxEncoder{w: xw, attributes: attributes}, xw.WriteRow(values)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func header(attributes []string) []string {
+	cells := []string{"good_id", importer.FieldGoodName, "parent_id", importer.FieldCategory, importer.FieldSku, importer.FieldPrice, importer.FieldStock}
+	for _, name := range attributes {
+		cells = append(cells, importer.AttributePrefix+name)
+	}
+	return cells
+}
+
+// values lays a good out in header order.
+func values(g entity.ExportGood, attributes []string) []any {
+	row := []any{g.GoodId, g.GoodName, nil, strings.Join(g.Categories, importer.CategorySeparator), g.Sku, nil, g.Stock}
+	if g.ParentId != nil {
+		row[2] = *g.ParentId
+	}
+	if g.Price != nil {
+		row[5] = *g.Price
+	}
+	for _, name := range attributes {
+		row = append(row, g.Attributes[name])
+	}
+	return row
+}
+
+type jsonlEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) encode(g entity.ExportGood) error { return e.enc.Encode(g) }
+func (e *jsonlEncoder) close() error                     { return e.w.Flush() }
+
+type csvEncoder struct {
+	w          *csv.Writer
+	attributes []string
+}
+
+func (e *csvEncoder) encode(g entity.ExportGood) error {
+	row := values(g, e.attributes)
+	cells := make([]string, len(row))
+	for i, v := range row {
+		switch v := v.(type) {
+		case nil:
+		case float64:
+			cells[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			cells[i] = fmt.Sprint(v)
+		}
+	}
+	return e.w.Write(cells)
+}
+
+func (e *csvEncoder) close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type xlsxEncoder struct {
+	w          *tabular.XLSXWriter
+	attributes []string
+}
+
+func (e *xlsxEncoder) encode(g entity.ExportGood) error { return e.w.WriteRow(values(g, e.attributes)) }
+func (e *xlsxEncoder) close() error                     { return e.w.Close() }
+
+type Storage interface {
+	Source
+	GetExportJob(ctx context.Context, id int) (entity.ExportJob, error)
+	StartExportJob(ctx context.Context, id int) error
+	FinishExportJob(ctx context.Context, id int, status, blobKey string, rows int, jobError string) error
+	UnfinishedExportJobs(ctx context.Context) ([]int, error)
+}
+
+// Runner executes export jobs in the background, at most workers at a time. The file is
+// spooled to a temporary file first because blob stores need the size up front. Every job is
+// claimed with a lease first, so that only one replica runs it.
+type Runner struct {
+	ctx     context.Context
+	log     *slog.Logger
+	storage Storage
+	blobs   blobstore.BlobStore
+	elector importer.Elector
+	sem     chan struct{}
+	wg      sync.WaitGroup
+
+	mu     sync.Mutex
+	active map[int]bool
+}
+
+// New makes a runner whose jobs stop when ctx is canceled; interrupted jobs are run again later,
+// by this or another replica.
+func New(ctx context.Context, log *slog.Logger, storage Storage, blobs blobstore.BlobStore, elector importer.Elector, workers int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Runner{
+		ctx:     ctx,
+		log:     log,
+		storage: storage,
+		blobs:   blobs,
+		elector: elector,
+		sem:     make(chan struct{}, workers),
+		active:  make(map[int]bool),
+	}
+}
+
+// Enqueue runs the job in the background unless this runner already has it queued or running.
+func (r *Runner) Enqueue(id int) {
+	r.mu.Lock()
+	if r.active[id] {
+		r.mu.Unlock()
+		return
+	}
+	r.active[id] = true
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			r.mu.Lock()
+			delete(r.active, id)
+			r.mu.Unlock()
+		}()
+
+		select {
+		case r.sem <- struct{}{}:
+		case <-r.ctx.Done():
+			return
+		}
+		defer func() { <-r.sem }()
+
+		claimed := r.elector.TryRun(r.ctx, "export:"+strconv.Itoa(id), func(ctx context.Context) {
+			r.run(ctx, id)
+		})
+		if !claimed {
+			r.log.Debug("export claimed elsewhere", slog.Int("export_id", id))
+		}
+	}()
+}
+
+// Wait blocks until the background jobs have returned, after ctx is canceled.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Resume enqueues the jobs left pending or running; those still running on a live replica are
+// skipped when claiming them, the others run again from the start.
+func (r *Runner) Resume(ctx context.Context) {
+	const op = "lib.exporter.Resume"
+
+	ids, err := r.storage.UnfinishedExportJobs(ctx)
+	if err != nil {
+		r.log.Error("failed to list unfinished exports", slog.String("op", op), sl.Err(err))
+		return
+	}
+
+	for _, id := range ids {
+		r.Enqueue(id)
+	}
+}
+
+func (r *Runner) run(ctx context.Context, id int) {
+	const op = "lib.exporter.run"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.Int("export_id", id),
+	)
+
+	job, err := r.storage.GetExportJob(ctx, id)
+	if err != nil {
+		log.Error("failed to get export job", sl.Err(err))
+		return
+	}
+	if job.Status == StatusCompleted || job.Status == StatusFailed {
+		return
+	}
+
+	if err := r.storage.StartExportJob(ctx, id); err != nil {
+		log.Error("failed to start export job", sl.Err(err))
+		return
+	}
+
+	log.Info("export started")
+
+	key, rows, err := r.export(ctx, job)
+	if err != nil {
+		// A job stopped on shutdown or lease loss is left for Resume, not failed.
+		if ctx.Err() != nil {
+			log.Warn("export interrupted", sl.Err(ctx.Err()))
+			return
+		}
+
+		log.Error("export failed", sl.Err(err))
+
+		msg := "internal error"
+		if errors.Is(err, attr.ErrInvalidFilter) {
+			msg = err.Error()
+		}
+		if err := r.storage.FinishExportJob(ctx, id, StatusFailed, "", 0, msg); err != nil {
+			log.Error("failed to finish export job", sl.Err(err))
+		}
+		return
+	}
+
+	// The file is stored by now, it is linked even if ctx is canceled meanwhile.
+	if err := r.storage.FinishExportJob(context.WithoutCancel(ctx), id, StatusCompleted, key, rows, ""); err != nil {
+		log.Error("failed to finish export job", sl.Err(err))
+		return
+	}
+
+	log.Info("export finished", slog.Int("rows", rows))
+}
+
+func (r *Runner) export(ctx context.Context, job entity.ExportJob) (string, int, error) {
+	e, err := Prepare(ctx, r.storage, job.Query)
+	if err != nil {
+		return "", 0, err
+	}
+
+	tmp, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	rows, err := e.WriteTo(ctx, job.Format, tmp)
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return "", 0, err
+	}
+	key := "exports/" + name + "." + job.Format
+
+	if err := r.blobs.Put(ctx, key, tmp, size, ContentType(job.Format)); err != nil {
+		return "", 0, err
+	}
+
+	return key, rows, nil
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
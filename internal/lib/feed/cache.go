@@ -0,0 +1,236 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/etag"
+	"inHouseAd/internal/lib/logger/sl"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheSource interface {
+	Source
+	CatalogFingerprint(ctx context.Context) (string, error)
+}
+
+// Feed is a generated feed ready to be served.
+type Feed struct {
+	Body   []byte
+	ETag   string
+	Report entity.FeedReport
+
+	key string // of the published body
+}
+
+// Cache keeps the generated feeds in memory. The feeds are generated on one replica: Refresh
+// regenerates them when the catalog fingerprint has changed or when they are older than maxAge,
+// and publishes them to the store, from which every replica picks them up with Load.
+type Cache struct {
+	log    *slog.Logger
+	source CacheSource
+	urler  blobstore.URLer
+	store  blobstore.BlobStore
+	opts   Options
+	maxAge time.Duration
+
+	mu          sync.RWMutex
+	feeds       map[string]Feed
+	fingerprint string
+	generatedAt time.Time
+}
+
+// index describes the published feeds. It is written after the feed bodies, so that a replica
+// that reads it finds the bodies it lists.
+type index struct {
+	Fingerprint string                `json:"fingerprint"`
+	GeneratedAt time.Time             `json:"generated_at"`
+	Feeds       map[string]indexEntry `json:"feeds"`
+}
+
+type indexEntry struct {
+	Key    string            `json:"key"`
+	ETag   string            `json:"etag"`
+	Report entity.FeedReport `json:"report"`
+}
+
+const indexKey = "feeds/index.json"
+
+func NewCache(log *slog.Logger, source CacheSource, urler blobstore.URLer, store blobstore.BlobStore, opts Options, maxAge time.Duration) *Cache {
+	return &Cache{
+		log:    log,
+		source: source,
+		urler:  urler,
+		store:  store,
+		opts:   opts,
+		maxAge: maxAge,
+		feeds:  make(map[string]Feed, len(Formats)),
+	}
+}
+
+// Get returns the cached feed; false means it has not been generated yet.
+func (c *Cache) Get(format string) (Feed, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	f, ok := c.feeds[format]
+	return f, ok
+}
+
+// Refresh is not safe for concurrent use: it is meant to be called from a single ticker loop
+// on the replica holding the feed lease.
+func (c *Cache) Refresh(ctx context.Context) {
+	const op = "lib.feed.Refresh"
+
+	log := c.log.With(slog.String("op", op))
+
+	// Feeds published by the previous holder of the lease need not be generated again.
+	c.Load(ctx)
+
+	fingerprint, err := c.source.CatalogFingerprint(ctx)
+	if err != nil {
+		log.Error("failed to get catalog fingerprint", sl.Err(err))
+		return
+	}
+
+	c.mu.RLock()
+	fresh := fingerprint == c.fingerprint && time.Since(c.generatedAt) < c.maxAge
+	previous := c.feeds
+	c.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	generated := index{Fingerprint: fingerprint, GeneratedAt: time.Now(), Feeds: make(map[string]indexEntry, len(Formats))}
+	feeds := make(map[string]Feed, len(Formats))
+	for _, format := range Formats {
+		var buf bytes.Buffer
+
+		report, err := Generate(ctx, format, c.source, c.urler, c.opts, &buf)
+		if err != nil {
+			log.Error("failed to generate feed", slog.String("format", format), sl.Err(err))
+			return
+		}
+
+		tag, err := etag.Hash(fingerprint + "/" + report.GeneratedAt.String())
+		if err != nil {
+			log.Error("failed to hash feed", slog.String("format", format), sl.Err(err))
+			return
+		}
+
+		// Every generation goes under a key of its own: replicas may still be reading the last one.
+		key := "feeds/" + format + "-" + strings.Trim(tag, `"`)
+		if err := c.store.Put(ctx, key, bytes.NewReader(buf.Bytes()), int64(buf.Len()), "application/xml"); err != nil {
+			log.Error("failed to publish feed", slog.String("format", format), sl.Err(err))
+			return
+		}
+
+		feeds[format] = Feed{Body: buf.Bytes(), ETag: tag, Report: report, key: key}
+		generated.Feeds[format] = indexEntry{Key: key, ETag: tag, Report: report}
+
+		log.Info("feed generated",
+			slog.String("format", format),
+			slog.Int("offers", report.Offers),
+			slog.Int("skipped", report.Skipped),
+		)
+	}
+
+	encoded, err := json.Marshal(generated)
+	if err != nil {
+		log.Error("failed to encode feed index", sl.Err(err))
+		return
+	}
+	if err := c.store.Put(ctx, indexKey, bytes.NewReader(encoded), int64(len(encoded)), "application/json"); err != nil {
+		log.Error("failed to publish feed index", sl.Err(err))
+		return
+	}
+
+	c.mu.Lock()
+	c.feeds = feeds
+	c.fingerprint = fingerprint
+	c.generatedAt = generated.GeneratedAt
+	c.mu.Unlock()
+
+	// A replica that read the previous index just before fails to load its bodies and loads
+	// the new ones next time.
+	for format, f := range previous {
+		if f.key == "" || f.key == generated.Feeds[format].Key {
+			continue
+		}
+		if err := c.store.Delete(ctx, f.key); err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+			log.Warn("failed to delete an old feed", slog.String("key", f.key), sl.Err(err))
+		}
+	}
+}
+
+// Load picks up the feeds last published by Refresh, on whichever replica, when they are newer
+// than the ones in memory.
+func (c *Cache) Load(ctx context.Context) {
+	const op = "lib.feed.Load"
+
+	log := c.log.With(slog.String("op", op))
+
+	published, err := c.readIndex(ctx)
+	if err != nil {
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			log.Error("failed to read feed index", sl.Err(err))
+		}
+		return
+	}
+
+	c.mu.RLock()
+	current := published.GeneratedAt.Equal(c.generatedAt)
+	c.mu.RUnlock()
+	if current {
+		return
+	}
+
+	feeds := make(map[string]Feed, len(published.Feeds))
+	for format, entry := range published.Feeds {
+		body, err := c.readBlob(ctx, entry.Key)
+		if err != nil {
+			log.Error("failed to read feed", slog.String("format", format), sl.Err(err))
+			return
+		}
+		feeds[format] = Feed{Body: body, ETag: entry.ETag, Report: entry.Report, key: entry.Key}
+	}
+
+	c.mu.Lock()
+	c.feeds = feeds
+	c.fingerprint = published.Fingerprint
+	c.generatedAt = published.GeneratedAt
+	c.mu.Unlock()
+
+	log.Info("feeds loaded", slog.Time("generated_at", published.GeneratedAt))
+}
+
+func (c *Cache) readIndex(ctx context.Context) (index, error) {
+	var published index
+
+	encoded, err := c.readBlob(ctx, indexKey)
+	if err != nil {
+		return published, err
+	}
+	if err := json.Unmarshal(encoded, &published); err != nil {
+		return published, err
+	}
+
+	return published, nil
+}
+
+func (c *Cache) readBlob(ctx context.Context, key string) ([]byte, error) {
+	r, err := c.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,351 @@
+package feed
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/blobstore"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatYML is the Yandex.Market yml_catalog.
+	FormatYML = "yml"
+	// FormatGoogle is the Google Merchant RSS 2.0 feed.
+	FormatGoogle = "google"
+)
+
+var ErrUnknownFormat = errors.New("unknown feed format, expected yml or google")
+
+var Formats = []string{FormatYML, FormatGoogle}
+
+type Source interface {
+	GetCategoryList(ctx context.Context) ([]entity.CategoryList, error)
+	FeedGoods(ctx context.Context, fn func(entity.FeedGood) error) error
+}
+
+// Options describe the shop. GoodURL is the storefront page of a good, "{id}" is replaced
+// by the good id. Relative image URLs are resolved against ShopURL.
+type Options struct {
+	ShopName string
+	Company  string
+	ShopURL  string
+	GoodURL  string
+	Currency string
+}
+
+// Generate streams the feed to w. Goods failing validation are left out and listed in the report;
+// parents with variants are left out silently, their variants are grouped instead.
+func Generate(ctx context.Context, format string, source Source, urler blobstore.URLer, opts Options, w io.Writer) (entity.FeedReport, error) {
+	report := entity.FeedReport{Format: format, GeneratedAt: time.Now().UTC(), Goods: []entity.FeedGoodErrors{}}
+
+	categories, err := source.GetCategoryList(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	names := make(map[int]string, len(categories))
+	for _, c := range categories {
+		names[c.CategoryId] = c.CategoryName
+	}
+
+	var g generator
+	switch format {
+	case FormatYML:
+		g = &ymlGenerator{opts: opts, categories: categories}
+	case FormatGoogle:
+		g = &googleGenerator{opts: opts, names: names}
+	default:
+		return report, ErrUnknownFormat
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := xml.NewEncoder(bw)
+
+	if _, err := io.WriteString(bw, xml.Header); err != nil {
+		return report, err
+	}
+	if err := g.start(bw, enc, report.GeneratedAt); err != nil {
+		return report, err
+	}
+
+	err = source.FeedGoods(ctx, func(good entity.FeedGood) error {
+		if good.HasVariants {
+			return nil
+		}
+
+		problems := g.validate(good)
+		if len(problems) != 0 {
+			report.Skipped++
+			report.Goods = append(report.Goods, entity.FeedGoodErrors{GoodId: good.GoodId, GoodName: good.GoodName, Errors: problems})
+			return nil
+		}
+
+		report.Offers++
+		return enc.Encode(g.item(good, link(opts, good.GoodId), imageURL(urler, opts, good.ImageKey)))
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return report, err
+	}
+	if _, err := io.WriteString(bw, g.end()); err != nil {
+		return report, err
+	}
+
+	return report, bw.Flush()
+}
+
+type generator interface {
+	start(w io.Writer, enc *xml.Encoder, date time.Time) error
+	validate(good entity.FeedGood) []string
+	item(good entity.FeedGood, link, image string) any
+	end() string
+}
+
+// validate checks what both marketplaces require of an offer.
+func validate(good entity.FeedGood) []string {
+	var problems []string
+
+	if strings.TrimSpace(good.GoodName) == "" {
+		problems = append(problems, "name is empty")
+	}
+	if good.Price == nil {
+		problems = append(problems, "price is missing")
+	} else if *good.Price <= 0 {
+		problems = append(problems, "price must be positive")
+	}
+	if len(good.CategoryIds) == 0 {
+		problems = append(problems, "good has no category")
+	}
+
+	return problems
+}
+
+func link(opts Options, goodId int) string {
+	return strings.ReplaceAll(opts.GoodURL, "{id}", strconv.Itoa(goodId))
+}
+
+func imageURL(urler blobstore.URLer, opts Options, key string) string {
+	if key == "" {
+		return ""
+	}
+
+	raw := urler.URL(key)
+
+	base, err := url.Parse(opts.ShopURL)
+	if err != nil {
+		return raw
+	}
+	ref, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	return base.ResolveReference(ref).String()
+}
+
+// params turns attributes into name/value pairs sorted by name, so that feeds are stable.
+func params(attributes map[string]any) []param {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]param, 0, len(names))
+	for _, name := range names {
+		out = append(out, param{Name: name, Value: fmt.Sprint(attributes[name])})
+	}
+	return out
+}
+
+type param struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type ymlGenerator struct {
+	opts       Options
+	categories []entity.CategoryList
+}
+
+type ymlCategory struct {
+	XMLName  xml.Name `xml:"category"`
+	Id       int      `xml:"id,attr"`
+	ParentId int      `xml:"parentId,attr,omitempty"`
+	Name     string   `xml:",chardata"`
+}
+
+type ymlOffer struct {
+	XMLName    xml.Name `xml:"offer"`
+	Id         int      `xml:"id,attr"`
+	GroupId    int      `xml:"group_id,attr,omitempty"`
+	Available  bool     `xml:"available,attr"`
+	Name       string   `xml:"name"`
+	Url        string   `xml:"url,omitempty"`
+	Price      string   `xml:"price"`
+	CurrencyId string   `xml:"currencyId"`
+	CategoryId int      `xml:"categoryId"`
+	Picture    string   `xml:"picture,omitempty"`
+	VendorCode string   `xml:"vendorCode,omitempty"`
+	Count      int      `xml:"count"`
+	Params     []param  `xml:"param"`
+}
+
+func (y *ymlGenerator) start(w io.Writer, enc *xml.Encoder, date time.Time) error {
+	_, err := fmt.Fprintf(w,
+		`<yml_catalog date="%s"><shop><name>%s</name><company>%s</company><url>%s</url><currencies><currency id="%s" rate="1"/></currencies><categories>`,
+		date.Format(time.RFC3339), xmlEscape(y.opts.ShopName), xmlEscape(y.opts.Company), xmlEscape(y.opts.ShopURL), xmlEscape(y.opts.Currency),
+	)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[int]bool, len(y.categories))
+	for _, c := range y.categories {
+		live[c.CategoryId] = true
+	}
+
+	for _, c := range y.categories {
+		category := ymlCategory{Id: c.CategoryId, Name: c.CategoryName}
+		// A parent in the trash would be a dangling reference.
+		if c.ParentId != nil && live[*c.ParentId] {
+			category.ParentId = *c.ParentId
+		}
+		if err := enc.Encode(category); err != nil {
+			return err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</categories><offers>`)
+	return err
+}
+
+func (y *ymlGenerator) validate(good entity.FeedGood) []string {
+	return validate(good)
+}
+
+func (y *ymlGenerator) item(good entity.FeedGood, link, image string) any {
+	offer := ymlOffer{
+		Id:         good.GoodId,
+		Available:  good.Stock > 0,
+		Name:       good.GoodName,
+		Url:        link,
+		Price:      strconv.FormatFloat(*good.Price, 'f', -1, 64),
+		CurrencyId: y.opts.Currency,
+		CategoryId: good.CategoryIds[0],
+		Picture:    image,
+		VendorCode: good.Sku,
+		Count:      good.Stock,
+		Params:     params(good.Attributes),
+	}
+	if good.ParentId != nil {
+		offer.GroupId = *good.ParentId
+	}
+	return offer
+}
+
+func (y *ymlGenerator) end() string {
+	return `</offers></shop></yml_catalog>`
+}
+
+type googleGenerator struct {
+	opts  Options
+	names map[int]string
+}
+
+// Google attributes live in the g: namespace, declared on the rss element.
+type googleItem struct {
+	XMLName          xml.Name `xml:"item"`
+	Id               string   `xml:"g:id"`
+	Title            string   `xml:"g:title"`
+	Description      string   `xml:"g:description"`
+	Link             string   `xml:"g:link"`
+	ImageLink        string   `xml:"g:image_link"`
+	Availability     string   `xml:"g:availability"`
+	Price            string   `xml:"g:price"`
+	ProductType      string   `xml:"g:product_type,omitempty"`
+	ItemGroupId      string   `xml:"g:item_group_id,omitempty"`
+	Mpn              string   `xml:"g:mpn,omitempty"`
+	IdentifierExists string   `xml:"g:identifier_exists,omitempty"`
+	Brand            string   `xml:"g:brand,omitempty"`
+}
+
+func (g *googleGenerator) start(w io.Writer, enc *xml.Encoder, _ time.Time) error {
+	_, err := fmt.Fprintf(w,
+		`<rss version="2.0" xmlns:g="http://base.google.com/ns/1.0"><channel><title>%s</title><link>%s</link><description>%s</description>`,
+		xmlEscape(g.opts.ShopName), xmlEscape(g.opts.ShopURL), xmlEscape(g.opts.Company),
+	)
+	return err
+}
+
+func (g *googleGenerator) validate(good entity.FeedGood) []string {
+	problems := validate(good)
+	if good.ImageKey == "" {
+		problems = append(problems, "image is missing")
+	}
+	if len([]rune(good.GoodName)) > 150 {
+		problems = append(problems, "name is longer than 150 characters")
+	}
+	return problems
+}
+
+func (g *googleGenerator) item(good entity.FeedGood, link, image string) any {
+	item := googleItem{
+		Id:           strconv.Itoa(good.GoodId),
+		Title:        good.GoodName,
+		Description:  good.GoodName,
+		Link:         link,
+		ImageLink:    image,
+		Availability: "out_of_stock",
+		Price:        strconv.FormatFloat(*good.Price, 'f', 2, 64) + " " + g.opts.Currency,
+		Mpn:          good.Sku,
+	}
+	if good.Stock > 0 {
+		item.Availability = "in_stock"
+	}
+	if description, ok := good.Attributes["description"].(string); ok && description != "" {
+		item.Description = description
+	}
+	if brand, ok := good.Attributes["brand"].(string); ok {
+		item.Brand = brand
+	}
+	if item.Mpn == "" && item.Brand == "" {
+		item.IdentifierExists = "no"
+	}
+	if good.ParentId != nil {
+		item.ItemGroupId = strconv.Itoa(*good.ParentId)
+	}
+
+	types := make([]string, 0, len(good.CategoryIds))
+	for _, id := range good.CategoryIds {
+		types = append(types, g.names[id])
+	}
+	item.ProductType = strings.Join(types, ", ")
+
+	return item
+}
+
+func (g *googleGenerator) end() string {
+	return `</channel></rss>`
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
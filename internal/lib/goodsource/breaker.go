@@ -0,0 +1,122 @@
+package goodsource
+
+import (
+	"inHouseAd/internal/entity"
+	"sync"
+	"time"
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// breaker stops fetching a source after threshold failed runs in a row. Once cooldown has
+// passed a single trial run is let through: success closes the breaker, failure opens it again.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+
+	b.trial = true
+	return true
+}
+
+// success closes the breaker and reports whether it had counted any failures.
+func (b *breaker) success() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	changed := b.failures != 0 || !b.openUntil.IsZero()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.trial = false
+
+	return changed
+}
+
+func (b *breaker) failure(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// release ends a trial run that neither succeeded nor failed, e.g. one stopped by a shutdown or
+// a lost lease, so that the next run is let through as a trial again.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// restore sets the failures and the end of the cooldown saved by the replica that ran the source
+// before; a nil openUntil means the breaker was closed.
+func (b *breaker) restore(failures int, openUntil *time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = failures
+	b.openUntil = time.Time{}
+	if openUntil != nil {
+		b.openUntil = *openUntil
+	}
+}
+
+// saved returns what restore takes.
+func (b *breaker) saved() (int, *time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return b.failures, nil
+	}
+	openUntil := b.openUntil
+	return b.failures, &openUntil
+}
+
+func (b *breaker) state(source string, now time.Time) entity.SourceState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := entity.SourceState{Source: source, State: StateClosed, Failures: b.failures}
+
+	switch {
+	case b.openUntil.IsZero():
+	case now.Before(b.openUntil):
+		s.State = StateOpen
+		openUntil := b.openUntil
+		s.OpenUntil = &openUntil
+	default:
+		s.State = StateHalfOpen
+	}
+
+	return s
+}
@@ -0,0 +1,194 @@
+package goodsource
+
+import (
+	"context"
+	"errors"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/storage/memory"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	cooldown := time.Minute
+
+	type step struct {
+		action string // allow, success, failure or release
+		after  time.Duration
+		want   bool   // what allow returns
+		state  string // the state after the step, when set
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after the threshold",
+			steps: []step{
+				{action: "failure", state: StateClosed},
+				{action: "allow", want: true},
+				{action: "failure", state: StateOpen},
+				{action: "allow", after: 30 * time.Second, want: false},
+			},
+		},
+		{
+			name: "success resets the count",
+			steps: []step{
+				{action: "failure"},
+				{action: "success"},
+				{action: "failure", state: StateClosed},
+			},
+		},
+		{
+			name: "one trial after the cooldown",
+			steps: []step{
+				{action: "failure"},
+				{action: "failure"},
+				{action: "allow", after: cooldown, want: true, state: StateHalfOpen},
+				{action: "allow", after: cooldown, want: false},
+			},
+		},
+		{
+			name: "a successful trial closes",
+			steps: []step{
+				{action: "failure"},
+				{action: "failure"},
+				{action: "allow", after: cooldown, want: true},
+				{action: "success", state: StateClosed},
+				{action: "allow", after: cooldown, want: true},
+			},
+		},
+		{
+			name: "a failed trial opens again",
+			steps: []step{
+				{action: "failure"},
+				{action: "failure"},
+				{action: "allow", after: cooldown, want: true},
+				{action: "failure", after: cooldown, state: StateOpen},
+				{action: "allow", after: cooldown + 30*time.Second, want: false},
+				{action: "allow", after: 2 * cooldown, want: true},
+			},
+		},
+		{
+			name: "a released trial lets the next one through",
+			steps: []step{
+				{action: "failure"},
+				{action: "failure"},
+				{action: "allow", after: cooldown, want: true},
+				{action: "release", after: cooldown, state: StateHalfOpen},
+				{action: "allow", after: cooldown, want: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		b := newBreaker(2, cooldown)
+
+		for i, st := range tt.steps {
+			now := start.Add(st.after)
+
+			switch st.action {
+			case "allow":
+				if got := b.allow(now); got != st.want {
+					t.Errorf("%s: step %d: allow got %t, want %t", tt.name, i, got, st.want)
+				}
+			case "success":
+				b.success()
+			case "failure":
+				b.failure(now)
+			case "release":
+				b.release()
+			}
+
+			if st.state != "" {
+				if got := b.state("source", now).State; got != st.state {
+					t.Errorf("%s: step %d: state %q, want %q", tt.name, i, got, st.state)
+				}
+			}
+		}
+	}
+}
+
+// TestCanceledTrial stops a trial run midway, as a shutdown or a lost lease does: the breaker
+// must let the next scheduled run through instead of waiting for the trial forever.
+func TestCanceledTrial(t *testing.T) {
+	src := &stubSource{}
+	job := Job{Source: src}
+
+	s := NewScheduler(slog.New(slog.NewTextHandler(io.Discard, nil)), &stubStorage{}, nil, nil, []Job{job}, Options{
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Millisecond,
+	})
+	b := s.breakers["stub"]
+
+	b.failure(time.Now())
+	time.Sleep(2 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	src.fetch = func(context.Context) ([]entity.SourceGood, error) {
+		cancel()
+		return nil, ctx.Err()
+	}
+	s.RunOnce(ctx, job, TriggerSchedule)
+
+	if !b.allow(time.Now()) {
+		t.Errorf("allow after a canceled trial: got false, want true")
+	}
+}
+
+// TestSharedState opens the breaker on the replica running the source: another replica must
+// report it open, and pick it up open when it takes the source over.
+func TestSharedState(t *testing.T) {
+	storage := memory.New()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	opts := Options{BreakerThreshold: 1, BreakerCooldown: time.Hour}
+
+	running := NewScheduler(log, storage, nil, nil, []Job{{Source: &stubSource{}}}, opts)
+	other := NewScheduler(log, storage, nil, nil, []Job{{Source: &stubSource{}}}, opts)
+
+	ctx := context.Background()
+	running.RunOnce(ctx, running.jobs[0], TriggerSchedule)
+
+	states, err := other.States(ctx)
+	if err != nil {
+		t.Fatalf("States: %v", err)
+	}
+	if len(states) != 1 || states[0].State != StateOpen || states[0].Failures != 1 {
+		t.Errorf("States on another replica: got %+v, want one open with 1 failure", states)
+	}
+
+	other.restore(ctx, log, "stub")
+	if other.breakers["stub"].allow(time.Now()) {
+		t.Errorf("allow after taking an open source over: got true, want false")
+	}
+}
+
+type stubSource struct {
+	fetch func(ctx context.Context) ([]entity.SourceGood, error)
+}
+
+func (s *stubSource) Name() string { return "stub" }
+
+func (s *stubSource) Fetch(ctx context.Context) ([]entity.SourceGood, error) {
+	if s.fetch == nil {
+		return nil, errors.New("not stubbed")
+	}
+	return s.fetch(ctx)
+}
+
+// stubStorage records nothing; the methods RunOnce does not reach panic on the nil interface.
+type stubStorage struct {
+	Storage
+}
+
+func (s *stubStorage) StartFetchRun(ctx context.Context, source, trigger, status string) (int, error) {
+	return 1, nil
+}
+
+func (s *stubStorage) FinishFetchRun(ctx context.Context, run entity.FetchRun) error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package goodsource
+
+import (
+	"context"
+	"errors"
+	"inHouseAd/internal/entity"
+	"time"
+)
+
+var ErrUnknownJob = errors.New("unknown source job")
+
+// Jobs lists the configured sources with their admin state and the last and next runs.
+func (s *Scheduler) Jobs(ctx context.Context) ([]entity.SourceJob, error) {
+	controls, err := s.storage.GetSourceJobControls(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lastRuns, err := s.storage.GetLastFetchRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	jobs := make([]entity.SourceJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		name := job.Source.Name()
+		control := controls[name]
+
+		j := entity.SourceJob{
+			Source:       name,
+			Schedule:     job.Schedule.String(),
+			Paused:       control.Paused,
+			RunRequested: control.RunRequested,
+		}
+
+		base := now
+		if run, ok := lastRuns[name]; ok {
+			j.LastRun = &run
+			if run.FinishedAt != nil {
+				base = *run.FinishedAt
+			}
+		}
+
+		if !control.Paused {
+			// The schedule counts from the end of the last run; an overdue run is due now.
+			next := job.Schedule.Next(base)
+			if next.Before(now) {
+				next = job.Schedule.Next(now)
+			}
+			j.NextRun = &next
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// Pause stops the scheduled runs of the source; requested runs still happen.
+func (s *Scheduler) Pause(ctx context.Context, source string) error {
+	if !s.known(source) {
+		return ErrUnknownJob
+	}
+	return s.storage.SetSourceJobPaused(ctx, source, true)
+}
+
+func (s *Scheduler) Resume(ctx context.Context, source string) error {
+	if !s.known(source) {
+		return ErrUnknownJob
+	}
+	return s.storage.SetSourceJobPaused(ctx, source, false)
+}
+
+// Trigger asks for a run of the source as soon as the replica running it notices.
+func (s *Scheduler) Trigger(ctx context.Context, source string) error {
+	if !s.known(source) {
+		return ErrUnknownJob
+	}
+	return s.storage.RequestSourceJobRun(ctx, source)
+}
+
+func (s *Scheduler) known(source string) bool {
+	_, ok := s.breakers[source]
+	return ok
+}
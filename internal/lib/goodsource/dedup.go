@@ -0,0 +1,40 @@
+package goodsource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"inHouseAd/internal/entity"
+	"strings"
+)
+
+// hashPrefix marks keys computed from the content of a good, so they never collide with
+// external ids of the source.
+const hashPrefix = "sha256:"
+
+// Normalization decides which goods of a source are the same good. Trim drops leading and
+// trailing spaces and collapses inner runs of spaces, CaseFold ignores letter case.
+type Normalization struct {
+	Trim     bool
+	CaseFold bool
+}
+
+func (n Normalization) Normalize(s string) string {
+	if n.Trim {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	if n.CaseFold {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// Key is the external id of the good when the source provides one, otherwise a hash of its
+// normalized name and sku.
+func (n Normalization) Key(g entity.SourceGood) string {
+	if g.ExternalId != "" {
+		return g.ExternalId
+	}
+
+	sum := sha256.Sum256([]byte(n.Normalize(g.GoodName) + "\x00" + n.Normalize(g.Sku)))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
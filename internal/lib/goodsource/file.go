@@ -0,0 +1,170 @@
+package goodsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/tabular"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// processedDir is where files taken from a watched directory are moved, so they are read once.
+const processedDir = "processed"
+
+// FileSource reads a local file, or every file of a directory. JSON files are mapped with
+// items and fields like the JSON API, CSV and XLSX files by their header with mapping.
+// A single file is read again only when it changes; files of a directory are moved
+// to its "processed" subdirectory once their goods are stored.
+type FileSource struct {
+	name    string
+	path    string
+	json    jsonMapping
+	mapping map[string]string
+
+	mu sync.Mutex
+	// modTime is the version of a single file already stored, fetched the version last read.
+	modTime, fetched time.Time
+	pending          []string
+}
+
+func NewFile(name, path, items string, fields, mapping map[string]string) (*FileSource, error) {
+	s := &FileSource{name: name, path: path, mapping: mapping}
+
+	for field := range mapping {
+		if !isField(field) {
+			return nil, fmt.Errorf("source %s: unknown field %q", name, field)
+		}
+	}
+
+	if len(fields) != 0 {
+		var err error
+		if s.json, err = newJSONMapping(items, fields); err != nil {
+			return nil, fmt.Errorf("source %s: %w", name, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *FileSource) Name() string {
+	return s.name
+}
+
+func (s *FileSource) Fetch(ctx context.Context) ([]entity.SourceGood, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		if info.ModTime().Equal(s.modTime) {
+			return nil, nil
+		}
+		goods, err := s.read(s.path)
+		if err != nil {
+			return nil, err
+		}
+		s.fetched = info.ModTime()
+		return goods, nil
+	}
+
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && s.supported(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var goods []entity.SourceGood
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		list, err := s.read(filepath.Join(s.path, name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		goods = append(goods, list...)
+	}
+
+	s.pending = names
+
+	return goods, nil
+}
+
+// Done marks the last fetch as stored: the file is not read again until it changes, the files
+// of a directory are moved out of the way.
+func (s *FileSource) Done() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.modTime = s.fetched
+
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	dir := filepath.Join(s.path, processedDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, name := range s.pending {
+		if err := os.Rename(filepath.Join(s.path, name), filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	s.pending = nil
+
+	return nil
+}
+
+func (s *FileSource) supported(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return len(s.json.fields) != 0
+	case ".csv", ".xlsx":
+		return true
+	}
+	return false
+}
+
+func (s *FileSource) read(path string) ([]entity.SourceGood, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		if len(s.json.fields) == 0 {
+			return nil, fmt.Errorf("no fields mapped for JSON files")
+		}
+		var doc any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		return s.json.goods(doc), nil
+	}
+
+	rows, err := tabular.Read(tabular.FormatByName(path), data)
+	if err != nil {
+		return nil, err
+	}
+
+	return rowGoods(rows, s.mapping)
+}
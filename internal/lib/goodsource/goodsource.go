@@ -0,0 +1,205 @@
+package goodsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/importer"
+	"inHouseAd/internal/lib/jsonpath"
+	"inHouseAd/internal/lib/tabular"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GoodSource is an external system goods are fetched from in the background.
+type GoodSource interface {
+	Name() string
+	Fetch(ctx context.Context) ([]entity.SourceGood, error)
+}
+
+// Acknowledger is implemented by sources that need to know when the goods of the last fetch
+// are stored, e.g. to avoid reading the same file twice.
+type Acknowledger interface {
+	Done() error
+}
+
+// FieldExternalId maps the source's own key of a good.
+const FieldExternalId = "external_id"
+
+// Fields are the keys of a field mapping, shared with the file import:
+// good_name, sku, price, stock and attributes.<name>, plus external_id.
+var Fields = []string{importer.FieldGoodName, importer.FieldSku, importer.FieldPrice, importer.FieldStock, FieldExternalId}
+
+// jsonMapping selects the items of a JSON document and the fields of each item.
+type jsonMapping struct {
+	items  jsonpath.Path
+	fields map[string]jsonpath.Path
+}
+
+// newJSONMapping compiles the paths. items defaults to "$" (the document is a single good),
+// fields must map at least good_name.
+func newJSONMapping(items string, fields map[string]string) (jsonMapping, error) {
+	if items == "" {
+		items = "$"
+	}
+
+	m := jsonMapping{fields: make(map[string]jsonpath.Path, len(fields))}
+
+	var err error
+	if m.items, err = jsonpath.Compile(items); err != nil {
+		return jsonMapping{}, err
+	}
+
+	for field, raw := range fields {
+		if !isField(field) {
+			return jsonMapping{}, fmt.Errorf("unknown field %q", field)
+		}
+		if m.fields[field], err = jsonpath.Compile(raw); err != nil {
+			return jsonMapping{}, err
+		}
+	}
+	if _, ok := m.fields[importer.FieldGoodName]; !ok {
+		return jsonMapping{}, errors.New("good_name must be mapped")
+	}
+
+	return m, nil
+}
+
+func (m jsonMapping) goods(doc any) []entity.SourceGood {
+	var goods []entity.SourceGood
+
+	for i, item := range m.items.Get(doc) {
+		values := make(map[string]string, len(m.fields))
+		for field, path := range m.fields {
+			if v := path.First(item); v != nil {
+				values[field] = text(v)
+			}
+		}
+		goods = append(goods, good(i+1, values))
+	}
+
+	return goods
+}
+
+// rowGoods maps table rows: the first row is the header, mapping assigns header names to fields
+// and fields without a mapping are looked up by their own name.
+func rowGoods(rows []tabular.Row, mapping map[string]string) ([]entity.SourceGood, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := make(map[string]int, len(rows[0].Cells))
+	for i, name := range rows[0].Cells {
+		header[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	columns := make(map[string]int)
+	for _, field := range Fields {
+		name := field
+		if mapped, ok := mapping[field]; ok {
+			name = mapped
+		}
+		if i, ok := header[strings.ToLower(strings.TrimSpace(name))]; ok {
+			columns[field] = i
+		}
+	}
+	for field, name := range mapping {
+		if strings.HasPrefix(field, importer.AttributePrefix) {
+			if i, ok := header[strings.ToLower(strings.TrimSpace(name))]; ok {
+				columns[field] = i
+			}
+		}
+	}
+	for i, name := range rows[0].Cells {
+		name = strings.TrimSpace(name)
+		if _, ok := columns[name]; !ok && strings.HasPrefix(name, importer.AttributePrefix) {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns[importer.FieldGoodName]; !ok {
+		return nil, fmt.Errorf("column for %q not found", importer.FieldGoodName)
+	}
+
+	goods := make([]entity.SourceGood, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		values := make(map[string]string, len(columns))
+		for field, i := range columns {
+			if i < len(row.Cells) {
+				values[field] = row.Cells[i]
+			}
+		}
+		goods = append(goods, good(row.Line, values))
+	}
+
+	return goods, nil
+}
+
+// good builds a good from mapped text values; Err explains why it cannot be stored.
+func good(position int, values map[string]string) entity.SourceGood {
+	g := entity.SourceGood{
+		Position:   position,
+		ExternalId: strings.TrimSpace(values[FieldExternalId]),
+		GoodName:   strings.TrimSpace(values[importer.FieldGoodName]),
+		Sku:        strings.TrimSpace(values[importer.FieldSku]),
+		Attributes: make(map[string]string),
+	}
+
+	for field, v := range values {
+		if strings.HasPrefix(field, importer.AttributePrefix) {
+			g.Attributes[strings.TrimPrefix(field, importer.AttributePrefix)] = strings.TrimSpace(v)
+		}
+	}
+
+	if g.GoodName == "" {
+		g.Err = "good_name is empty"
+		return g
+	}
+
+	if raw := strings.TrimSpace(values[importer.FieldPrice]); raw != "" {
+		price, err := strconv.ParseFloat(strings.Replace(raw, ",", ".", 1), 64)
+		if err != nil || price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+			g.Err = fmt.Sprintf("price %q is not a non-negative number", raw)
+			return g
+		}
+		g.Price = &price
+	}
+
+	if raw := strings.TrimSpace(values[importer.FieldStock]); raw != "" {
+		stock, err := strconv.ParseFloat(raw, 64)
+		if err != nil || stock < 0 || math.IsInf(stock, 0) || stock != float64(int(stock)) {
+			g.Err = fmt.Sprintf("stock %q is not a non-negative integer", raw)
+			return g
+		}
+		n := int(stock)
+		g.Stock = &n
+	}
+
+	return g
+}
+
+func isField(field string) bool {
+	if strings.HasPrefix(field, importer.AttributePrefix) {
+		return len(field) > len(importer.AttributePrefix)
+	}
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// text renders a JSON value the way a user would type it into a table cell.
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,125 @@
+package goodsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/tabular"
+	"io"
+	"net/http"
+)
+
+// maxResponseSize guards against endpoints that stream without end.
+const maxResponseSize = 64 << 20
+
+// JSONSource requests a JSON API; items and fields are JSONPaths into the response.
+type JSONSource struct {
+	name    string
+	client  *http.Client
+	method  string
+	url     string
+	mapping jsonMapping
+}
+
+func NewJSON(name string, client *http.Client, method, url, items string, fields map[string]string) (*JSONSource, error) {
+	mapping, err := newJSONMapping(items, fields)
+	if err != nil {
+		return nil, fmt.Errorf("source %s: %w", name, err)
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	return &JSONSource{name: name, client: client, method: method, url: url, mapping: mapping}, nil
+}
+
+func (s *JSONSource) Name() string {
+	return s.name
+}
+
+func (s *JSONSource) Fetch(ctx context.Context) ([]entity.SourceGood, error) {
+	body, err := get(ctx, s.client, s.method, s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return s.mapping.goods(doc), nil
+}
+
+// CSVSource downloads a CSV table, e.g. a published spreadsheet.
+type CSVSource struct {
+	name    string
+	client  *http.Client
+	url     string
+	mapping map[string]string
+}
+
+func NewCSV(name string, client *http.Client, url string, mapping map[string]string) (*CSVSource, error) {
+	for field := range mapping {
+		if !isField(field) {
+			return nil, fmt.Errorf("source %s: unknown field %q", name, field)
+		}
+	}
+
+	return &CSVSource{name: name, client: client, url: url, mapping: mapping}, nil
+}
+
+func (s *CSVSource) Name() string {
+	return s.name
+}
+
+func (s *CSVSource) Fetch(ctx context.Context) ([]entity.SourceGood, error) {
+	body, err := get(ctx, s.client, http.MethodGet, s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tabular.Read(tabular.FormatCSV, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return rowGoods(rows, s.mapping)
+}
+
+// PermanentError is a failure that retrying will not fix, e.g. a wrong URL or credentials.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func get(ctx context.Context, client *http.Client, method, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status %s", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, &PermanentError{Err: err}
+		}
+		return nil, err
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
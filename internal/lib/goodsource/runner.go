@@ -0,0 +1,400 @@
+package goodsource
+
+import (
+	"context"
+	"errors"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/cron"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunSkipped   = "skipped"
+	RunCanceled  = "canceled"
+)
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+type Storage interface {
+	AddSourceGoods(ctx context.Context, source string, categoryId int, goods []entity.SourceGood) (entity.ImportBatchResult, error)
+	StartFetchRun(ctx context.Context, source, trigger, status string) (int, error)
+	FinishFetchRun(ctx context.Context, run entity.FetchRun) error
+	InterruptFetchRuns(ctx context.Context, source, from, status string) (int, error)
+	GetLastFetchRuns(ctx context.Context) (map[string]entity.FetchRun, error)
+	GetSourceJobControl(ctx context.Context, source string) (entity.SourceJobControl, error)
+	GetSourceJobControls(ctx context.Context) (map[string]entity.SourceJobControl, error)
+	SetSourceJobPaused(ctx context.Context, source string, paused bool) error
+	SetSourceBreaker(ctx context.Context, source string, failures int, openUntil *time.Time) error
+	RequestSourceJobRun(ctx context.Context, source string) error
+	TakeSourceJobRun(ctx context.Context, source string) (bool, error)
+}
+
+// Elector runs a job on one replica at a time, see leader.Elector.
+type Elector interface {
+	Run(ctx context.Context, name string, fn func(ctx context.Context))
+}
+
+// Invalidator drops the cached good lists a fetch makes stale, see cache.Lists.
+type Invalidator interface {
+	InvalidateGoods(ctx context.Context)
+}
+
+// Job is a source with its schedule: on every Schedule time its goods are stored into CategoryId,
+// BatchSize goods per transaction. Goods already fetched, by the keys of Normalization, are updated.
+type Job struct {
+	Source        GoodSource
+	CategoryId    int
+	Schedule      cron.Schedule
+	BatchSize     int
+	Normalization Normalization
+}
+
+// Options tune failure handling. A fetch is retried MaxRetries times, waiting BaseDelay doubled
+// on every attempt (at most MaxDelay, with jitter). After BreakerThreshold failed runs in a row
+// a source is left alone for BreakerCooldown. Pause and run requests made through any replica
+// are picked up every PollInterval.
+type Options struct {
+	MaxRetries       int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	PollInterval     time.Duration
+}
+
+// Scheduler runs every job on its own ticker, so a slow source does not hold up the others,
+// and records each run. With several replicas each source is fetched by the one holding
+// its lease.
+type Scheduler struct {
+	log         *slog.Logger
+	storage     Storage
+	elector     Elector
+	invalidator Invalidator
+	jobs        []Job
+	opts        Options
+	breakers    map[string]*breaker
+}
+
+func NewScheduler(log *slog.Logger, storage Storage, elector Elector, invalidator Invalidator, jobs []Job, opts Options) *Scheduler {
+	breakers := make(map[string]*breaker, len(jobs))
+	for _, job := range jobs {
+		breakers[job.Source.Name()] = newBreaker(opts.BreakerThreshold, opts.BreakerCooldown)
+	}
+
+	return &Scheduler{
+		log:         log,
+		storage:     storage,
+		elector:     elector,
+		invalidator: invalidator,
+		jobs:        jobs,
+		opts:        opts,
+		breakers:    breakers,
+	}
+}
+
+// Run blocks until ctx is canceled and every run in progress has stopped.
+func (s *Scheduler) Run(ctx context.Context) {
+	const op = "lib.goodsource.Run"
+
+	log := s.log.With(slog.String("op", op))
+
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			s.elector.Run(ctx, "source:"+job.Source.Name(), func(ctx context.Context) {
+				s.interrupt(ctx, log, job.Source.Name())
+				s.restore(ctx, log, job.Source.Name())
+				s.loop(ctx, job)
+			})
+		}(job)
+	}
+	wg.Wait()
+
+	log.Info("good sources stopped")
+}
+
+// States reports the circuit breaker of every source as saved by the replica running it, so that
+// every replica reports the same.
+func (s *Scheduler) States(ctx context.Context) ([]entity.SourceState, error) {
+	controls, err := s.storage.GetSourceJobControls(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	states := make([]entity.SourceState, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		control := controls[job.Source.Name()]
+
+		b := newBreaker(s.opts.BreakerThreshold, s.opts.BreakerCooldown)
+		b.restore(control.Failures, control.OpenUntil)
+		states = append(states, b.state(job.Source.Name(), now))
+	}
+
+	return states, nil
+}
+
+// restore picks up the circuit breaker where the replica that held the lease before left it.
+func (s *Scheduler) restore(ctx context.Context, log *slog.Logger, source string) {
+	control, err := s.storage.GetSourceJobControl(ctx, source)
+	if err != nil {
+		log.Error("failed to restore circuit breaker", slog.String("source", source), sl.Err(err))
+		return
+	}
+
+	s.breakers[source].restore(control.Failures, control.OpenUntil)
+}
+
+// interrupt closes the runs left by a replica that held the lease before and died mid-run.
+func (s *Scheduler) interrupt(ctx context.Context, log *slog.Logger, source string) {
+	n, err := s.storage.InterruptFetchRuns(ctx, source, RunRunning, RunCanceled)
+	if err != nil {
+		log.Error("failed to close interrupted fetch runs", slog.String("source", source), sl.Err(err))
+		return
+	}
+	if n != 0 {
+		log.Info("interrupted fetch runs closed", slog.String("source", source), slog.Int("runs", n))
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	name := job.Source.Name()
+
+	poll := time.NewTicker(s.opts.PollInterval)
+	defer poll.Stop()
+
+	timer := time.NewTimer(time.Until(job.Schedule.Next(time.Now())))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			control, err := s.storage.GetSourceJobControl(ctx, name)
+			if err != nil && ctx.Err() == nil {
+				s.log.Error("failed to get source job", slog.String("source", name), sl.Err(err))
+			} else if !control.Paused {
+				s.RunOnce(ctx, job, TriggerSchedule)
+			}
+			timer.Reset(time.Until(job.Schedule.Next(time.Now())))
+		case <-poll.C:
+			requested, err := s.storage.TakeSourceJobRun(ctx, name)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				s.log.Error("failed to check run requests", slog.String("source", name), sl.Err(err))
+				continue
+			}
+			if requested {
+				s.RunOnce(ctx, job, TriggerManual)
+			}
+		}
+	}
+}
+
+// RunOnce fetches the source, retrying failures, and stores what it returned. Manual runs are
+// let through an open circuit breaker: an admin asking for a run wants to see if the source is back.
+func (s *Scheduler) RunOnce(ctx context.Context, job Job, trigger string) {
+	const op = "lib.goodsource.RunOnce"
+
+	name := job.Source.Name()
+
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("source", name),
+		slog.String("trigger", trigger),
+	)
+
+	b := s.breakers[name]
+
+	if trigger != TriggerManual && !b.allow(time.Now()) {
+		log.Warn("source skipped: circuit breaker is open")
+		s.record(ctx, log, entity.FetchRun{Source: name, Trigger: trigger, Status: RunSkipped, Error: "circuit breaker is open"})
+		return
+	}
+
+	// A run that ends without success or failure must not hold the trial of a half-open breaker.
+	defer b.release()
+
+	runId, err := s.storage.StartFetchRun(ctx, name, trigger, RunRunning)
+	if err != nil {
+		log.Error("failed to record fetch run", sl.Err(err))
+		return
+	}
+
+	run := entity.FetchRun{RunId: runId, Source: name, Trigger: trigger}
+
+	goods, err := s.fetch(ctx, job, &run)
+	if err != nil {
+		run.Status, run.Error = RunFailed, err.Error()
+		if ctx.Err() != nil {
+			run.Status = RunCanceled
+		} else {
+			b.failure(time.Now())
+			s.save(ctx, log, name, b)
+		}
+		log.Error("failed to fetch goods", slog.Int("attempts", run.Attempts), sl.Err(err))
+		s.finish(ctx, log, run)
+		return
+	}
+	if b.success() {
+		s.save(ctx, log, name, b)
+	}
+
+	run.Fetched = len(goods)
+
+	for i := range goods {
+		goods[i].ExternalId = job.Normalization.Key(goods[i])
+	}
+
+	if err := s.store(ctx, job, goods, &run); err != nil {
+		run.Status, run.Error = RunFailed, err.Error()
+		if ctx.Err() != nil {
+			run.Status = RunCanceled
+		}
+		log.Error("failed to store goods", slog.Int("added", run.Added), sl.Err(err))
+		s.finish(ctx, log, run)
+		return
+	}
+
+	if ack, ok := job.Source.(Acknowledger); ok {
+		if err := ack.Done(); err != nil {
+			log.Error("failed to acknowledge fetch", sl.Err(err))
+		}
+	}
+
+	run.Status = RunSucceeded
+	s.finish(ctx, log, run)
+
+	log.Info("goods fetched", slog.Int("added", run.Added), slog.Int("rejected", run.Rejected))
+}
+
+func (s *Scheduler) fetch(ctx context.Context, job Job, run *entity.FetchRun) ([]entity.SourceGood, error) {
+	for attempt := 0; ; attempt++ {
+		run.Attempts++
+
+		goods, err := job.Source.Fetch(ctx)
+		if err == nil {
+			return goods, nil
+		}
+
+		var permanent *PermanentError
+		if attempt >= s.opts.MaxRetries || errors.As(err, &permanent) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := s.backoff(attempt)
+
+		s.log.Warn("fetch failed, retrying",
+			slog.String("source", job.Source.Name()),
+			slog.Int("attempt", run.Attempts),
+			slog.Duration("delay", delay),
+			sl.Err(err),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff doubles BaseDelay per attempt up to MaxDelay and waits a random half to full of it,
+// so that sources failing together do not retry in lockstep.
+func (s *Scheduler) backoff(attempt int) time.Duration {
+	delay := s.opts.BaseDelay << attempt
+	if delay <= 0 || delay > s.opts.MaxDelay {
+		delay = s.opts.MaxDelay
+	}
+
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// store saves the goods batch by batch; the cached lists are dropped once any batch got in.
+func (s *Scheduler) store(ctx context.Context, job Job, goods []entity.SourceGood, run *entity.FetchRun) error {
+	defer func() {
+		if run.Added > 0 {
+			s.invalidator.InvalidateGoods(context.WithoutCancel(ctx))
+		}
+	}()
+
+	batchSize := job.BatchSize
+	if batchSize < 1 {
+		batchSize = len(goods)
+	}
+
+	for start := 0; start < len(goods); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := min(start+batchSize, len(goods))
+
+		result, err := s.storage.AddSourceGoods(ctx, job.Source.Name(), job.CategoryId, goods[start:end])
+		if err != nil {
+			return err
+		}
+
+		for _, e := range result.Errors {
+			s.log.Warn("good rejected",
+				slog.String("source", job.Source.Name()),
+				slog.Int("position", e.Row),
+				slog.String("reason", e.Message),
+			)
+		}
+
+		run.Added += result.Succeeded
+		run.Rejected += len(result.Errors)
+	}
+
+	return nil
+}
+
+// save stores the circuit breaker of the source for States and for the next holder of the lease.
+func (s *Scheduler) save(ctx context.Context, log *slog.Logger, source string, b *breaker) {
+	failures, openUntil := b.saved()
+	if err := s.storage.SetSourceBreaker(context.WithoutCancel(ctx), source, failures, openUntil); err != nil {
+		log.Error("failed to save circuit breaker", sl.Err(err))
+	}
+}
+
+// record stores a run that ends as soon as it starts.
+func (s *Scheduler) record(ctx context.Context, log *slog.Logger, run entity.FetchRun) {
+	runId, err := s.storage.StartFetchRun(ctx, run.Source, run.Trigger, run.Status)
+	if err != nil {
+		log.Error("failed to record fetch run", sl.Err(err))
+		return
+	}
+
+	run.RunId = runId
+	s.finish(ctx, log, run)
+}
+
+// finish records the end of the run even when ctx is canceled, a canceled run is recorded as such.
+func (s *Scheduler) finish(ctx context.Context, log *slog.Logger, run entity.FetchRun) {
+	if err := s.storage.FinishFetchRun(context.WithoutCancel(ctx), run); err != nil {
+		log.Error("failed to record fetch run", slog.Int("run_id", run.RunId), sl.Err(err))
+	}
+}
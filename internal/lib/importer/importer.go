@@ -0,0 +1,425 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/logger/sl"
+	"inHouseAd/internal/lib/tabular"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+const (
+	// ModeTransactional imports all rows or none of them.
+	ModeTransactional = "transactional"
+	// ModeResumable commits in batches, skipping bad rows, and continues after a restart.
+	ModeResumable = "resumable"
+)
+
+const (
+	FieldGoodName   = "good_name"
+	FieldCategory   = "category"
+	FieldSku        = "sku"
+	FieldPrice      = "price"
+	FieldStock      = "stock"
+	AttributePrefix = "attributes."
+
+	// CategorySeparator splits several categories in one cell.
+	CategorySeparator = "|"
+)
+
+type Storage interface {
+	GetImportJob(ctx context.Context, id int) (entity.ImportJob, error)
+	StartImportJob(ctx context.Context, id, totalRows int) error
+	ImportGoods(ctx context.Context, job entity.ImportJob, rows []entity.ImportRow, processed int) (entity.ImportBatchResult, error)
+	FinishImportJob(ctx context.Context, id int, status, jobError string) error
+	UnfinishedImportJobs(ctx context.Context) ([]int, error)
+}
+
+// MapRows turns table rows into import rows. The first row is the header; mapping assigns
+// header names to fields ("good_name", "category", "sku", "price", "stock", "attributes.<name>"),
+// and fields without a mapping are looked up by their own name.
+func MapRows(rows []tabular.Row, mapping map[string]string) ([]entity.ImportRow, error) {
+	if len(rows) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	header := make(map[string]int, len(rows[0].Cells))
+	for i, name := range rows[0].Cells {
+		header[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	column := func(field string) int {
+		name := field
+		if mapped, ok := mapping[field]; ok {
+			name = mapped
+		}
+		if i, ok := header[strings.ToLower(strings.TrimSpace(name))]; ok {
+			return i
+		}
+		return -1
+	}
+
+	columns := map[string]int{}
+	for _, field := range []string{FieldGoodName, FieldCategory, FieldSku, FieldPrice, FieldStock} {
+		columns[field] = column(field)
+	}
+	for _, field := range []string{FieldGoodName, FieldCategory} {
+		if columns[field] < 0 {
+			return nil, fmt.Errorf("column for %q not found", field)
+		}
+	}
+
+	attributes := map[string]int{}
+	for field := range mapping {
+		if strings.HasPrefix(field, AttributePrefix) {
+			if i := column(field); i >= 0 {
+				attributes[strings.TrimPrefix(field, AttributePrefix)] = i
+			} else {
+				return nil, fmt.Errorf("column for %q not found", field)
+			}
+		}
+	}
+	for i, name := range rows[0].Cells {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, AttributePrefix) {
+			if _, ok := attributes[strings.TrimPrefix(name, AttributePrefix)]; !ok {
+				attributes[strings.TrimPrefix(name, AttributePrefix)] = i
+			}
+		}
+	}
+
+	result := make([]entity.ImportRow, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		result = append(result, mapRow(row, columns, attributes))
+	}
+
+	return result, nil
+}
+
+func mapRow(row tabular.Row, columns, attributes map[string]int) entity.ImportRow {
+	cell := func(i int) string {
+		if i < 0 || i >= len(row.Cells) {
+			return ""
+		}
+		return strings.TrimSpace(row.Cells[i])
+	}
+
+	r := entity.ImportRow{
+		Row:        row.Line,
+		GoodName:   cell(columns[FieldGoodName]),
+		Sku:        cell(columns[FieldSku]),
+		Attributes: make(map[string]string, len(attributes)),
+	}
+
+	for _, name := range strings.Split(cell(columns[FieldCategory]), CategorySeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			r.Categories = append(r.Categories, name)
+		}
+	}
+
+	for name, i := range attributes {
+		r.Attributes[name] = cell(i)
+	}
+
+	if r.GoodName == "" {
+		r.Err = "good_name is required"
+		return r
+	}
+	if len(r.Categories) == 0 {
+		r.Err = "category is required"
+		return r
+	}
+
+	if raw := cell(columns[FieldPrice]); raw != "" {
+		price, err := strconv.ParseFloat(strings.Replace(raw, ",", ".", 1), 64)
+		if err != nil || price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+			r.Err = fmt.Sprintf("price %q is not a non-negative number", raw)
+			return r
+		}
+		r.Price = &price
+	}
+
+	if raw := cell(columns[FieldStock]); raw != "" {
+		stock, err := strconv.Atoi(raw)
+		if err != nil || stock < 0 {
+			r.Err = fmt.Sprintf("stock %q is not a non-negative integer", raw)
+			return r
+		}
+		r.Stock = stock
+	}
+
+	return r
+}
+
+// Invalidator drops the cached lists an import makes stale, see cache.Lists.
+type Invalidator interface {
+	InvalidateCategories(ctx context.Context)
+	InvalidateGoods(ctx context.Context)
+}
+
+// Elector runs a job on a single replica, see leader.Elector.TryRun.
+type Elector interface {
+	TryRun(ctx context.Context, name string, fn func(ctx context.Context)) bool
+}
+
+// Runner executes import jobs in the background, at most workers at a time. Every job is claimed
+// with a lease first, so that only one replica runs it; a job whose replica died is taken over
+// by Resume once the lease expires.
+type Runner struct {
+	ctx         context.Context
+	log         *slog.Logger
+	storage     Storage
+	blobs       blobstore.BlobStore
+	elector     Elector
+	invalidator Invalidator
+	batchSize   int
+	sem         chan struct{}
+	wg          sync.WaitGroup
+
+	mu     sync.Mutex
+	active map[int]bool
+}
+
+// New makes a runner whose jobs stop when ctx is canceled; interrupted jobs keep their status
+// and are resumed later, by this or another replica.
+func New(ctx context.Context, log *slog.Logger, storage Storage, blobs blobstore.BlobStore, elector Elector, invalidator Invalidator, workers, batchSize int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+	if batchSize < 1 {
+		batchSize = 100
+	}
+
+	return &Runner{
+		ctx:         ctx,
+		log:         log,
+		storage:     storage,
+		blobs:       blobs,
+		elector:     elector,
+		invalidator: invalidator,
+		batchSize:   batchSize,
+		sem:         make(chan struct{}, workers),
+		active:      make(map[int]bool),
+	}
+}
+
+// Enqueue runs the job in the background unless this runner already has it queued or running.
+func (r *Runner) Enqueue(id int) {
+	r.mu.Lock()
+	if r.active[id] {
+		r.mu.Unlock()
+		return
+	}
+	r.active[id] = true
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			r.mu.Lock()
+			delete(r.active, id)
+			r.mu.Unlock()
+		}()
+
+		select {
+		case r.sem <- struct{}{}:
+		case <-r.ctx.Done():
+			return
+		}
+		defer func() { <-r.sem }()
+
+		r.Run(r.ctx, id)
+	}()
+}
+
+// Wait blocks until the background jobs have returned, after ctx is canceled.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Resume enqueues the jobs left pending or running. Those still running on a live replica are
+// skipped when claiming them; resumable jobs continue after their last committed batch, the
+// others start over.
+func (r *Runner) Resume(ctx context.Context) {
+	const op = "lib.importer.Resume"
+
+	ids, err := r.storage.UnfinishedImportJobs(ctx)
+	if err != nil {
+		r.log.Error("failed to list unfinished imports", slog.String("op", op), sl.Err(err))
+		return
+	}
+
+	for _, id := range ids {
+		r.Enqueue(id)
+	}
+}
+
+// Run processes the job in the calling goroutine if no other replica has claimed it; Enqueue
+// runs it in the background.
+func (r *Runner) Run(ctx context.Context, id int) {
+	const op = "lib.importer.Run"
+
+	claimed := r.elector.TryRun(ctx, "import:"+strconv.Itoa(id), func(ctx context.Context) {
+		r.run(ctx, id)
+	})
+	if !claimed {
+		r.log.Debug("import claimed elsewhere", slog.String("op", op), slog.Int("import_id", id))
+	}
+}
+
+func (r *Runner) run(ctx context.Context, id int) {
+	const op = "lib.importer.run"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.Int("import_id", id),
+	)
+
+	job, err := r.storage.GetImportJob(ctx, id)
+	if err != nil {
+		log.Error("failed to get import job", sl.Err(err))
+		return
+	}
+	if job.Status == StatusCompleted || job.Status == StatusFailed {
+		return
+	}
+
+	// Whatever was stored, even by an interrupted job, must reach the cached lists; the
+	// categories too, the import may create them.
+	if !job.DryRun {
+		defer func() {
+			r.invalidator.InvalidateCategories(context.WithoutCancel(ctx))
+			r.invalidator.InvalidateGoods(context.WithoutCancel(ctx))
+		}()
+	}
+
+	// The outcome is recorded even when ctx is canceled meanwhile: the rows are in by then,
+	// and a rerun of a transactional job would import them twice.
+	finish := func(status string, jobErr error) {
+		ctx := context.WithoutCancel(ctx)
+
+		msg := ""
+		if jobErr != nil {
+			msg = jobErr.Error()
+		}
+		if err := r.storage.FinishImportJob(ctx, id, status, msg); err != nil {
+			log.Error("failed to finish import job", sl.Err(err))
+			return
+		}
+		if err := r.blobs.Delete(ctx, job.BlobKey); err != nil {
+			log.Error("failed to delete import file", sl.Err(err))
+		}
+		log.Info("import finished", slog.String("status", status))
+	}
+
+	// A job stopped on shutdown or lease loss is left for Resume, not failed.
+	interrupted := func() bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		log.Warn("import interrupted", sl.Err(ctx.Err()))
+		return true
+	}
+
+	rows, err := r.readRows(ctx, job)
+	if err != nil {
+		if interrupted() {
+			return
+		}
+		log.Error("failed to read import file", sl.Err(err))
+		finish(StatusFailed, err)
+		return
+	}
+
+	if err := r.storage.StartImportJob(ctx, id, len(rows)); err != nil {
+		if interrupted() {
+			return
+		}
+		log.Error("failed to start import job", sl.Err(err))
+		return
+	}
+
+	log.Info("import started", slog.Int("rows", len(rows)), slog.Int("from", job.ProcessedRows))
+
+	if job.DryRun || job.Mode == ModeTransactional {
+		// The rows were processed in one go before the job was interrupted; only the outcome is left.
+		if len(rows) != 0 && job.ProcessedRows == len(rows) {
+			if !job.DryRun && job.Failed != 0 {
+				finish(StatusFailed, fmt.Errorf("%d rows failed, nothing was imported", job.Failed))
+				return
+			}
+			finish(StatusCompleted, nil)
+			return
+		}
+
+		result, err := r.storage.ImportGoods(ctx, job, rows, len(rows))
+		if err != nil {
+			if interrupted() {
+				return
+			}
+			log.Error("failed to import goods", sl.Err(err))
+			finish(StatusFailed, errors.New("internal error"))
+			return
+		}
+		if !job.DryRun && len(result.Errors) != 0 {
+			finish(StatusFailed, fmt.Errorf("%d rows failed, nothing was imported", len(result.Errors)))
+			return
+		}
+		finish(StatusCompleted, nil)
+		return
+	}
+
+	for start := job.ProcessedRows; start < len(rows); start += r.batchSize {
+		end := start + r.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		if _, err := r.storage.ImportGoods(ctx, job, rows[start:end], end); err != nil {
+			if interrupted() {
+				return
+			}
+			log.Error("failed to import goods", sl.Err(err), slog.Int("from", start))
+			finish(StatusFailed, errors.New("internal error"))
+			return
+		}
+	}
+
+	finish(StatusCompleted, nil)
+}
+
+func (r *Runner) readRows(ctx context.Context, job entity.ImportJob) ([]entity.ImportRow, error) {
+	rc, err := r.blobs.Get(ctx, job.BlobKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := tabular.Read(job.Format, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return MapRows(table, job.Mapping)
+}
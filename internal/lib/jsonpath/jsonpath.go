@@ -0,0 +1,138 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrSyntax = errors.New("invalid JSONPath")
+
+// Path is a compiled JSONPath. The supported subset covers what field mappings need:
+// the root "$", child names (".name", "['name']"), array indexes ("[0]", negative ones count
+// from the end) and wildcards (".*", "[*]").
+type Path struct {
+	raw   string
+	steps []step
+}
+
+type step struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func Compile(s string) (Path, error) {
+	p := Path{raw: s}
+
+	if !strings.HasPrefix(s, "$") {
+		return Path{}, fmt.Errorf("%w %q: must start with $", ErrSyntax, s)
+	}
+	rest := s[1:]
+
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return Path{}, fmt.Errorf("%w %q: recursive descent is not supported", ErrSyntax, s)
+
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+
+			switch name {
+			case "":
+				return Path{}, fmt.Errorf("%w %q: empty name", ErrSyntax, s)
+			case "*":
+				p.steps = append(p.steps, step{wildcard: true})
+			default:
+				p.steps = append(p.steps, step{name: name})
+			}
+
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return Path{}, fmt.Errorf("%w %q: unclosed bracket", ErrSyntax, s)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+
+			switch {
+			case inner == "*":
+				p.steps = append(p.steps, step{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p.steps = append(p.steps, step{name: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return Path{}, fmt.Errorf("%w %q: bad index %q", ErrSyntax, s, inner)
+				}
+				p.steps = append(p.steps, step{index: i, isIndex: true})
+			}
+
+		default:
+			return Path{}, fmt.Errorf("%w %q: unexpected %q", ErrSyntax, s, rest[:1])
+		}
+	}
+
+	return p, nil
+}
+
+func (p Path) String() string {
+	return p.raw
+}
+
+// Get returns every value the path selects in a document decoded by encoding/json.
+// Missing members select nothing rather than failing.
+func (p Path) Get(doc any) []any {
+	current := []any{doc}
+
+	for _, s := range p.steps {
+		var next []any
+
+		for _, v := range current {
+			switch v := v.(type) {
+			case map[string]any:
+				if s.wildcard {
+					for _, child := range v {
+						next = append(next, child)
+					}
+				} else if child, ok := v[s.name]; ok && !s.isIndex {
+					next = append(next, child)
+				}
+			case []any:
+				switch {
+				case s.wildcard:
+					next = append(next, v...)
+				case s.isIndex:
+					i := s.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+
+		current = next
+	}
+
+	return current
+}
+
+// First returns the first selected value, or nil when nothing matches.
+func (p Path) First(doc any) any {
+	values := p.Get(doc)
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
@@ -0,0 +1,110 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCompileErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"data",
+		"$..name",
+		"$.",
+		"$.a..b",
+		"$[0",
+		"$[x]",
+		"$[1.5]",
+		"$['a]",
+		"$a",
+		"$.a b[",
+	}
+
+	for _, s := range tests {
+		if _, err := Compile(s); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Compile(%q): got %v, want %v", s, err, ErrSyntax)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	const doc = `{
+		"msg": "hello",
+		"goods": [
+			{"name": "phone", "price": 10, "tags": ["a", "b"]},
+			{"name": "case", "price": 2, "tags": []},
+			{"name": "cable", "price": 1}
+		],
+		"odd key": {"x": 1, "y": 2},
+		"matrix": [[1, 2], [3, 4]]
+	}`
+
+	var v any
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want []any
+		// unordered compares the values in any order: wildcards over objects follow map order.
+		unordered bool
+	}{
+		{path: "$", want: []any{v}},
+		{path: "$.msg", want: []any{"hello"}},
+		{path: "$['msg']", want: []any{"hello"}},
+		{path: `$["msg"]`, want: []any{"hello"}},
+		{path: "$.missing", want: nil},
+		{path: "$.msg.deeper", want: nil},
+		{path: "$.goods[0].name", want: []any{"phone"}},
+		{path: "$.goods[ 1 ].name", want: []any{"case"}},
+		{path: "$.goods[-1].name", want: []any{"cable"}},
+		{path: "$.goods[-3].name", want: []any{"phone"}},
+		{path: "$.goods[-4].name", want: nil},
+		{path: "$.goods[3].name", want: nil},
+		{path: "$.goods[*].name", want: []any{"phone", "case", "cable"}},
+		{path: "$.goods.*.price", want: []any{10.0, 2.0, 1.0}},
+		{path: "$.goods[*].tags[*]", want: []any{"a", "b"}},
+		{path: "$.goods[0].tags[-1]", want: []any{"b"}},
+		{path: "$.matrix[*][0]", want: []any{1.0, 3.0}},
+		{path: "$.matrix[-1][-1]", want: []any{4.0}},
+		{path: "$['odd key'].*", want: []any{1.0, 2.0}, unordered: true},
+		{path: "$.goods.name", want: nil},
+		{path: "$.msg[0]", want: nil},
+	}
+
+	for _, tt := range tests {
+		p, err := Compile(tt.path)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.path, err)
+			continue
+		}
+
+		got := p.Get(v)
+		if tt.unordered {
+			sortValues(got)
+			sortValues(tt.want)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Get(%q): got %v, want %v", tt.path, got, tt.want)
+		}
+
+		var first any
+		if len(tt.want) != 0 && !tt.unordered {
+			first = tt.want[0]
+		}
+		if got := p.First(v); !tt.unordered && !reflect.DeepEqual(got, first) {
+			t.Errorf("First(%q): got %v, want %v", tt.path, got, first)
+		}
+	}
+}
+
+func sortValues(values []any) {
+	sort.Slice(values, func(i, j int) bool {
+		return fmt.Sprint(values[i]) < fmt.Sprint(values[j])
+	})
+}
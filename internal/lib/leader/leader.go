@@ -0,0 +1,149 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"os"
+	"time"
+)
+
+type Storage interface {
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// Elector makes sure each job runs on a single replica. A job runs only while its replica holds
+// the job's lease; the lease is renewed every third of its ttl, and when the holder dies another
+// replica takes the job over once the lease expires.
+type Elector struct {
+	log     *slog.Logger
+	storage Storage
+	holder  string
+	ttl     time.Duration
+}
+
+func New(log *slog.Logger, storage Storage, holder string, ttl time.Duration) *Elector {
+	return &Elector{log: log, storage: storage, holder: holder, ttl: ttl}
+}
+
+// Holder names this process among the replicas.
+func Holder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Run campaigns for the lease on the job until ctx is canceled. While the lease is held fn runs
+// with a context that is canceled when the lease is lost; fn is expected to return then.
+// On cancellation Run waits for fn and releases the lease.
+func (e *Elector) Run(ctx context.Context, name string, fn func(ctx context.Context)) {
+	const op = "lib.leader.Run"
+
+	log := e.log.With(
+		slog.String("op", op),
+		slog.String("job", name),
+	)
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		ok, err := e.storage.AcquireLease(ctx, name, e.holder, e.ttl)
+		if err != nil && ctx.Err() == nil {
+			log.Error("failed to acquire lease", sl.Err(err))
+		}
+		if ok {
+			log.Info("lease acquired")
+			e.lead(ctx, log, name, fn, ticker)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// TryRun runs fn under the lease on name if no other replica holds it, and reports whether it
+// did. Unlike Run it does not wait for the lease, it suits one-off jobs that any replica may
+// pick up: fn's context is canceled if the lease is lost, and the lease is released when fn returns.
+func (e *Elector) TryRun(ctx context.Context, name string, fn func(ctx context.Context)) bool {
+	const op = "lib.leader.TryRun"
+
+	log := e.log.With(
+		slog.String("op", op),
+		slog.String("job", name),
+	)
+
+	ok, err := e.storage.AcquireLease(ctx, name, e.holder, e.ttl)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error("failed to acquire lease", sl.Err(err))
+		}
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	e.lead(ctx, log, name, fn, ticker)
+
+	return true
+}
+
+func (e *Elector) lead(ctx context.Context, log *slog.Logger, name string, fn func(ctx context.Context), ticker *time.Ticker) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(jobCtx)
+	}()
+
+	renewed := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			<-done
+			// ctx is done already, the lease is released on the way out regardless.
+			if err := e.storage.ReleaseLease(context.WithoutCancel(ctx), name, e.holder); err != nil {
+				log.Error("failed to release lease", sl.Err(err))
+			}
+			return
+		case <-done:
+			if err := e.storage.ReleaseLease(ctx, name, e.holder); err != nil {
+				log.Error("failed to release lease", sl.Err(err))
+			}
+			return
+		case <-ticker.C:
+			ok, err := e.storage.AcquireLease(ctx, name, e.holder, e.ttl)
+			if err != nil {
+				log.Error("failed to renew lease", sl.Err(err))
+				// Keep the job while the lease surely holds, a short database outage
+				// should not stop it on every replica.
+				if time.Since(renewed)+e.ttl/3 < e.ttl {
+					continue
+				}
+			}
+			if ok {
+				renewed = time.Now()
+				continue
+			}
+
+			log.Warn("lease lost")
+			cancel()
+			<-done
+			return
+		}
+	}
+}
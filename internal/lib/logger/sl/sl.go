@@ -0,0 +1,12 @@
+package sl
+
+import (
+	"log/slog"
+)
+
+func Err(err error) slog.Attr {
+	return slog.Attr{
+		Key:   "error",
+		Value: slog.StringValue(err.Error()),
+	}
+}
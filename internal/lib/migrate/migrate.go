@@ -0,0 +1,193 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/pressly/goose/v3"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// ErrBehind means the database has not been migrated to the migrations built into the binary.
+var ErrBehind = errors.New("schema is behind")
+
+// Migrator applies goose migrations read straight from an fs.FS, such as the embedded ones,
+// so that nothing has to be written to disk.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations fs.FS
+
+	// Lock, when set, is held around every command, so that replicas starting together
+	// migrate one after another; the later ones find nothing left to do.
+	Lock func() (unlock func(), err error)
+}
+
+// Status is the state of one migration; AppliedAt is nil while it is pending.
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// dir is where goose finds the migrations within the Migrator's fs.FS.
+const dir = "."
+
+// New prepares the *.sql files at the root of migrations for db in the goose dialect,
+// e.g. postgres or sqlite3.
+func New(db *sql.DB, dialect string, migrations fs.FS) (*Migrator, error) {
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Up applies every pending migration, older ones missed by the database too: a migration
+// merged from a branch may be dated before the latest applied one.
+func (m *Migrator) Up() error {
+	return m.run(func() error {
+		return goose.Up(m.db, dir, goose.WithAllowMissing())
+	})
+}
+
+// Down rolls the latest applied migration back.
+func (m *Migrator) Down() error {
+	return m.run(func() error {
+		return goose.Down(m.db, dir)
+	})
+}
+
+// Redo rolls the latest applied migration back and applies it again.
+func (m *Migrator) Redo() error {
+	return m.run(func() error {
+		return goose.Redo(m.db, dir)
+	})
+}
+
+// To migrates up or down until version is the latest applied migration.
+func (m *Migrator) To(version int64) error {
+	return m.run(func() error {
+		current, err := goose.GetDBVersion(m.db)
+		if err != nil {
+			return err
+		}
+		if version < current {
+			return goose.DownTo(m.db, dir, version)
+		}
+		return goose.UpTo(m.db, dir, version, goose.WithAllowMissing())
+	})
+}
+
+// Status lists every migration, oldest first.
+func (m *Migrator) Status() ([]Status, error) {
+	var statuses []Status
+
+	err := m.run(func() error {
+		migrations, applied, err := m.state()
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			s := Status{Version: migration.Version, Name: path.Base(migration.Source)}
+			if t, ok := applied[migration.Version]; ok {
+				s.AppliedAt = &t
+			}
+			statuses = append(statuses, s)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Check returns ErrBehind unless every migration is applied. Versions the binary does not
+// know are fine, they are applied by a newer release while it rolls out.
+func (m *Migrator) Check() error {
+	return m.run(func() error {
+		migrations, applied, err := m.state()
+		if err != nil {
+			return err
+		}
+
+		var pending []int64
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; !ok {
+				pending = append(pending, migration.Version)
+			}
+		}
+		if len(pending) != 0 {
+			return fmt.Errorf("%w: migrations %v are not applied", ErrBehind, pending)
+		}
+
+		return nil
+	})
+}
+
+// state returns the migrations, oldest first, and when each applied version was applied.
+func (m *Migrator) state() (goose.Migrations, map[int64]time.Time, error) {
+	migrations, err := goose.CollectMigrations(dir, 0, goose.MaxVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Sort(migrations)
+
+	if _, err := goose.EnsureDBVersion(m.db); err != nil {
+		return nil, nil, err
+	}
+
+	// The latest record of a version tells whether it is applied or rolled back.
+	applied := make(map[int64]time.Time)
+	rows, err := m.db.Query(`SELECT version_id, is_applied, tstamp FROM ` + goose.TableName() + ` ORDER BY id;`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version   int64
+			isApplied bool
+			tstamp    time.Time
+		)
+		if err := rows.Scan(&version, &isApplied, &tstamp); err != nil {
+			return nil, nil, err
+		}
+		if isApplied {
+			applied[version] = tstamp
+		} else {
+			delete(applied, version)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return migrations, applied, nil
+}
+
+// run holds the lock around fn. goose keeps its dialect and file system in globals, so they
+// are set for each command.
+func (m *Migrator) run(fn func() error) error {
+	const op = "lib.migrate.run"
+
+	if m.Lock != nil {
+		unlock, err := m.Lock()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		defer unlock()
+	}
+
+	if err := goose.SetDialect(m.dialect); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	goose.SetBaseFS(m.migrations)
+
+	if err := fn(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
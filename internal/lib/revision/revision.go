@@ -0,0 +1,82 @@
+package revision
+
+import (
+	"inHouseAd/internal/entity"
+	"reflect"
+	"sort"
+)
+
+const (
+	// ActionBaseline marks the first revision of goods created before history was recorded.
+	ActionBaseline = "baseline"
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionRestore  = "restore"
+	ActionRevert   = "revert"
+	ActionImport   = "import"
+)
+
+// Diff lists the fields that differ between two snapshots. Attributes are compared key by key
+// and reported as "attributes.<name>".
+func Diff(from, to entity.GoodSnapshot) []entity.FieldChange {
+	changes := []entity.FieldChange{}
+
+	add := func(field string, a, b any) {
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, entity.FieldChange{Field: field, From: a, To: b})
+		}
+	}
+
+	add("good_name", from.GoodName, to.GoodName)
+	add("parent_id", deref(from.ParentId), deref(to.ParentId))
+	add("sku", from.Sku, to.Sku)
+	add("price", deref(from.Price), deref(to.Price))
+	add("stock", from.Stock, to.Stock)
+	add("category_ids", normalize(from.CategoryIds), normalize(to.CategoryIds))
+	add("deleted", from.Deleted, to.Deleted)
+
+	names := make(map[string]bool, len(from.Attributes)+len(to.Attributes))
+	for name := range from.Attributes {
+		names[name] = true
+	}
+	for name := range to.Attributes {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		add("attributes."+name, from.Attributes[name], to.Attributes[name])
+	}
+
+	return changes
+}
+
+// History fills Changes of every revision with the diff against its predecessor.
+// Revisions must be ordered by rev ascending; the first one is diffed against an empty good.
+func History(revisions []entity.GoodRevision) {
+	prev := entity.GoodSnapshot{}
+	for i := range revisions {
+		revisions[i].Changes = Diff(prev, revisions[i].Snapshot)
+		prev = revisions[i].Snapshot
+	}
+}
+
+func deref[T any](v *T) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func normalize(ids []int) []int {
+	if ids == nil {
+		return []int{}
+	}
+	return ids
+}
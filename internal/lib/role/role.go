@@ -0,0 +1,13 @@
+// Package role names the roles a user can have. Users who sign up get User; admins are
+// created with the admin command.
+package role
+
+const (
+	User  = "user"
+	Admin = "admin"
+)
+
+// Valid reports whether r is a known role.
+func Valid(r string) bool {
+	return r == User || r == Admin
+}
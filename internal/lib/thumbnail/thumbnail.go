@@ -0,0 +1,104 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypePNG  = "image/png"
+	ContentTypeGIF  = "image/gif"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooManyPixels   = errors.New("image has too many pixels")
+)
+
+// DetectType sniffs the content type from the data itself instead of trusting the client.
+func DetectType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+
+	switch contentType {
+	case ContentTypeJPEG, ContentTypePNG, ContentTypeGIF:
+		return contentType, nil
+	}
+
+	return "", ErrUnsupportedType
+}
+
+func Extension(contentType string) string {
+	switch contentType {
+	case ContentTypePNG:
+		return ".png"
+	case ContentTypeGIF:
+		return ".gif"
+	}
+	return ".jpg"
+}
+
+// Decode decodes an image of at most maxPixels pixels. The size is read from the header first:
+// a small file may declare a huge image, and decoding it would allocate all of its pixels.
+func Decode(data []byte, maxPixels int64) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d, at most %d", ErrTooManyPixels, cfg.Width, cfg.Height, maxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Resize scales img down so that its longest side is at most maxSide, keeping the aspect ratio.
+// Images that are already small enough are returned unchanged.
+func Resize(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxSide/w)
+		w = maxSide
+	} else {
+		w = max(1, w*maxSide/h)
+		h = maxSide
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	return dst
+}
+
+// Encode writes thumbnails as PNG for sources that may carry transparency and as JPEG otherwise.
+func Encode(img image.Image, sourceType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch sourceType {
+	case ContentTypePNG, ContentTypeGIF:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ContentTypePNG, nil
+	}
+
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), ContentTypeJPEG, nil
+}
@@ -0,0 +1,38 @@
+package trashpurger
+
+import (
+	"context"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/blobstore"
+	"inHouseAd/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+)
+
+type Purger interface {
+	PurgeTrash(ctx context.Context, retention time.Duration) (entity.PurgeResult, error)
+}
+
+func PurgeTrash(ctx context.Context, log *slog.Logger, purger Purger, store blobstore.BlobStore, retention time.Duration) {
+	const op = "internal.lib.trashpurger.PurgeTrash"
+
+	log = log.With(slog.String("op", op))
+
+	result, err := purger.PurgeTrash(ctx, retention)
+	if err != nil {
+		log.Error("failed to purge trash", sl.Err(err))
+		return
+	}
+
+	for _, key := range result.BlobKeys {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Error("failed to delete blob", slog.String("key", key), sl.Err(err))
+		}
+	}
+
+	log.Info("trash purged",
+		slog.Int("goods", result.Goods),
+		slog.Int("categories", result.Categories),
+		slog.Int("blobs", len(result.BlobKeys)),
+	)
+}
@@ -0,0 +1,50 @@
+// Package trigram measures how alike two names are the way pg_trgm does, for the backends
+// that run without it.
+package trigram
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Set is the trigrams of a text.
+type Set map[string]bool
+
+// Of splits the text into lowercase alphanumeric words and pads each with two spaces in front
+// and one behind before cutting it into trigrams, as pg_trgm does.
+func Of(text string) Set {
+	set := make(Set)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+
+	return set
+}
+
+// Similarity is the share of trigrams the two sets have in common, from 0 to 1.
+func (s Set) Similarity(other Set) float64 {
+	if len(s) == 0 || len(other) == 0 {
+		return 0
+	}
+
+	common := 0
+	for g := range s {
+		if other[g] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(s)+len(other)-common)
+}
+
+// Similarity compares two texts.
+func Similarity(a, b string) float64 {
+	return Of(a).Similarity(Of(b))
+}
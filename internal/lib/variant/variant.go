@@ -0,0 +1,118 @@
+package variant
+
+import (
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"strings"
+)
+
+var ErrInvalidAxes = errors.New("invalid variant axes")
+
+// maxCombinations keeps a single generator call from creating an unbounded number of goods.
+const maxCombinations = 1000
+
+func ValidateAxes(axes []entity.VariantAxis) error {
+	if len(axes) == 0 {
+		return fmt.Errorf("%w: at least one axis is required", ErrInvalidAxes)
+	}
+
+	total := 1
+	seen := make(map[string]bool, len(axes))
+
+	for _, axis := range axes {
+		if strings.TrimSpace(axis.Name) == "" {
+			return fmt.Errorf("%w: axis name is required", ErrInvalidAxes)
+		}
+		if seen[axis.Name] {
+			return fmt.Errorf("%w: axis %q is declared twice", ErrInvalidAxes, axis.Name)
+		}
+		seen[axis.Name] = true
+
+		if len(axis.Values) == 0 {
+			return fmt.Errorf("%w: axis %q has no values", ErrInvalidAxes, axis.Name)
+		}
+
+		values := make(map[string]bool, len(axis.Values))
+		for _, v := range axis.Values {
+			if values[v] {
+				return fmt.Errorf("%w: axis %q has duplicate value %q", ErrInvalidAxes, axis.Name, v)
+			}
+			values[v] = true
+		}
+
+		total *= len(axis.Values)
+		if total > maxCombinations {
+			return fmt.Errorf("%w: more than %d combinations", ErrInvalidAxes, maxCombinations)
+		}
+	}
+
+	return nil
+}
+
+func Names(axes []entity.VariantAxis) []string {
+	names := make([]string, 0, len(axes))
+	for _, axis := range axes {
+		names = append(names, axis.Name)
+	}
+	return names
+}
+
+// Combinations returns the cartesian product of the axis values, the first axis varying slowest.
+func Combinations(axes []entity.VariantAxis) []map[string]string {
+	combinations := []map[string]string{{}}
+
+	for _, axis := range axes {
+		next := make([]map[string]string, 0, len(combinations)*len(axis.Values))
+		for _, combination := range combinations {
+			for _, value := range axis.Values {
+				c := make(map[string]string, len(combination)+1)
+				for k, v := range combination {
+					c[k] = v
+				}
+				c[axis.Name] = value
+				next = append(next, c)
+			}
+		}
+		combinations = next
+	}
+
+	return combinations
+}
+
+func Key(names []string, combination map[string]string) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, combination[name])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func Name(parentName string, names []string, combination map[string]string) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, combination[name])
+	}
+	return fmt.Sprintf("%s (%s)", parentName, strings.Join(parts, ", "))
+}
+
+func Sku(prefix string, names []string, combination map[string]string) string {
+	parts := []string{prefix}
+	for _, name := range names {
+		parts = append(parts, skuPart(combination[name]))
+	}
+	return strings.Join(parts, "-")
+}
+
+func skuPart(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(value) {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r > 127:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '_' || r == '.':
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/storage"
+	"sort"
+)
+
+func (s *Storage) CreateAttribute(ctx context.Context, categoryId int, a entity.CategoryAttribute) (int, error) {
+	const op = "storage.memory.CreateAttribute"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Like the foreign key, a category in the trash still takes attributes.
+	if _, ok := s.categories[categoryId]; !ok {
+		return 0, storage.ErrNotFound
+	}
+
+	for _, existing := range s.attributes {
+		if existing.CategoryId == categoryId && existing.Name == a.Name {
+			return 0, storage.ErrAttributeExists
+		}
+	}
+
+	// The goods already in the category must have a valid value, if the attribute requires one.
+	for goodId, g := range s.goods {
+		if g.deletedAt != nil || !s.links[goodId][categoryId] {
+			continue
+		}
+
+		values := make(map[string]any)
+		if value, ok := g.attributes[a.Name]; ok {
+			values[a.Name] = value
+		}
+		if err := attr.Validate([]entity.CategoryAttribute{a}, values); err != nil {
+			return 0, fmt.Errorf("good %d: %w", goodId, err)
+		}
+	}
+
+	a.AttributeId = s.nextId("category_attribute")
+	a.CategoryId = categoryId
+	a.EnumValues = append([]string{}, a.EnumValues...)
+	s.attributes[a.AttributeId] = &a
+
+	return a.AttributeId, nil
+}
+
+func (s *Storage) GetAttributeList(ctx context.Context, categoryId int) ([]entity.CategoryAttribute, error) {
+	const op = "storage.memory.GetAttributeList"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.categoryAttributes(categoryId), nil
+}
+
+func (s *Storage) DeleteAttribute(ctx context.Context, id int) error {
+	const op = "storage.memory.DeleteAttribute"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.attributes[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.attributes, id)
+
+	return nil
+}
+
+func (s *Storage) SetGoodAttributes(ctx context.Context, goodId int, values map[string]any, version, actorUid int) (map[string]any, error) {
+	const op = "storage.memory.SetGoodAttributes"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.checkVersion(goodId, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attr.Validate(s.goodSchemas(goodId), values); err != nil {
+		return nil, err
+	}
+
+	normalized, err := normalizeAttributes(values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	g.attributes = normalized
+	g.version++
+
+	if _, err := s.writeRevision(goodId, revision.ActionUpdate, actorUid, nil); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if values == nil {
+		values = map[string]any{}
+	}
+
+	return values, nil
+}
+
+// categoryAttributes returns the schemas of the category ordered by id, nil when it has none.
+func (s *Storage) categoryAttributes(categoryId int) []entity.CategoryAttribute {
+	var list []entity.CategoryAttribute
+	for _, a := range s.attributes {
+		if a.CategoryId == categoryId {
+			list = append(list, copyAttribute(*a))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AttributeId < list[j].AttributeId })
+	return list
+}
+
+// goodSchemas returns the schemas of the good's live categories.
+func (s *Storage) goodSchemas(goodId int) []entity.CategoryAttribute {
+	var schemas []entity.CategoryAttribute
+	for _, c := range s.goodCategories(goodId) {
+		schemas = append(schemas, s.categoryAttributes(c.id)...)
+	}
+	return schemas
+}
+
+// schemasOf returns the schemas of the categories, live or not, in the order given.
+func (s *Storage) schemasOf(categoryIds []int) []entity.CategoryAttribute {
+	var schemas []entity.CategoryAttribute
+	for _, id := range categoryIds {
+		schemas = append(schemas, s.categoryAttributes(id)...)
+	}
+	return schemas
+}
+
+func copyAttribute(a entity.CategoryAttribute) entity.CategoryAttribute {
+	a.EnumValues = append([]string{}, a.EnumValues...)
+	return a
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/trigram"
+	"sort"
+)
+
+// GetNearDuplicates pairs live goods whose names have a trigram similarity of at least
+// threshold, most similar first. Variants are left out: they share the name of their good.
+// Trigrams are built the way pg_trgm builds them, so the backends score pairs alike.
+func (s *Storage) GetNearDuplicates(ctx context.Context, threshold float64, limit int) ([]entity.NearDuplicate, error) {
+	const op = "storage.memory.GetNearDuplicates"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var goods []*good
+	for _, g := range s.sortedGoods() {
+		if g.deletedAt == nil && g.parentId == nil {
+			goods = append(goods, g)
+		}
+	}
+
+	grams := make([]trigram.Set, len(goods))
+	for i, g := range goods {
+		grams[i] = trigram.Of(g.name)
+	}
+
+	duplicates := []entity.NearDuplicate{}
+	for i, a := range goods {
+		for j := i + 1; j < len(goods); j++ {
+			score := grams[i].Similarity(grams[j])
+			if score < threshold {
+				continue
+			}
+			b := goods[j]
+			duplicates = append(duplicates, entity.NearDuplicate{
+				GoodId:        a.id,
+				GoodName:      a.name,
+				DuplicateId:   b.id,
+				DuplicateName: b.name,
+				Similarity:    score,
+			})
+		}
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Similarity > duplicates[j].Similarity
+	})
+	if len(duplicates) > limit {
+		duplicates = duplicates[:limit]
+	}
+
+	return duplicates, nil
+}
@@ -0,0 +1,248 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/exporter"
+	"inHouseAd/internal/storage"
+	"sort"
+	"time"
+)
+
+// exportGoods selects the goods of an export the same way GetGoodList does, except that
+// a zero categoryId means every category.
+func (s *Storage) exportGoods(categoryId int, filters []attr.Filter, collapseVariants bool) ([]*good, error) {
+	if categoryId == 0 && len(filters) != 0 {
+		return nil, fmt.Errorf("%w: filters require a category", attr.ErrInvalidFilter)
+	}
+
+	match, err := s.filterMatcher(categoryId, filters, collapseVariants)
+	if err != nil {
+		return nil, err
+	}
+
+	var goods []*good
+	for _, g := range s.sortedGoods() {
+		if g.deletedAt != nil {
+			continue
+		}
+		if categoryId != 0 && (!s.links[g.id][categoryId] || s.liveCategory(categoryId) == nil) {
+			continue
+		}
+		if collapseVariants && g.parentId != nil {
+			continue
+		}
+		if match(g) {
+			goods = append(goods, g)
+		}
+	}
+
+	return goods, nil
+}
+
+// GetExportAttributeNames lists the attribute names used by the exported goods, so that
+// tabular formats can write their header before streaming the rows.
+func (s *Storage) GetExportAttributeNames(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]string, error) {
+	const op = "storage.memory.GetExportAttributeNames"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	goods, err := s.exportGoods(categoryId, filters, collapseVariants)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, g := range goods {
+		for name := range g.attributes {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// ExportGoods hands the selected goods to fn one at a time, ordered by id. The goods are
+// copied first so that fn, which writes to a client, does not hold the lock.
+func (s *Storage) ExportGoods(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool, fn func(entity.ExportGood) error) error {
+	const op = "storage.memory.ExportGoods"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+
+	goods, err := s.exportGoods(categoryId, filters, collapseVariants)
+	if err != nil {
+		s.mu.RUnlock()
+		return err
+	}
+
+	export := make([]entity.ExportGood, 0, len(goods))
+	for _, g := range goods {
+		categories := []string{}
+		for _, c := range s.goodCategories(g.id) {
+			categories = append(categories, c.name)
+		}
+
+		export = append(export, entity.ExportGood{
+			GoodId:     g.id,
+			GoodName:   g.name,
+			ParentId:   copyInt(g.parentId),
+			Categories: categories,
+			Sku:        g.sku,
+			Price:      copyFloat(g.price),
+			Stock:      g.stock,
+			Attributes: cloneAttributes(g.attributes),
+		})
+	}
+
+	s.mu.RUnlock()
+
+	for _, g := range export {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateExportJob(ctx context.Context, job entity.ExportJob) (int, error) {
+	const op = "storage.memory.CreateExportJob"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := entity.ExportJob{
+		ExportId:  s.nextId("export_job"),
+		Uid:       job.Uid,
+		Status:    exporter.StatusPending,
+		Format:    job.Format,
+		Query:     copyQuery(job.Query),
+		CreatedAt: now(),
+	}
+	s.exportJobs[stored.ExportId] = &stored
+
+	return stored.ExportId, nil
+}
+
+func (s *Storage) GetExportJob(ctx context.Context, id int) (entity.ExportJob, error) {
+	const op = "storage.memory.GetExportJob"
+
+	if err := ctx.Err(); err != nil {
+		return entity.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.exportJobs[id]
+	if !ok {
+		return entity.ExportJob{}, storage.ErrNotFound
+	}
+
+	copied := *job
+	copied.Query = copyQuery(job.Query)
+	copied.FinishedAt = copyTime(job.FinishedAt)
+
+	return copied, nil
+}
+
+// UnfinishedExportJobs lists jobs that were queued or interrupted; they are run again from the start.
+func (s *Storage) UnfinishedExportJobs(ctx context.Context) ([]int, error) {
+	const op = "storage.memory.UnfinishedExportJobs"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	unfinished := make(map[int]bool)
+	for id, job := range s.exportJobs {
+		if job.Status == exporter.StatusPending || job.Status == exporter.StatusRunning {
+			unfinished[id] = true
+		}
+	}
+
+	ids := sortedIds(unfinished)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return ids, nil
+}
+
+func (s *Storage) StartExportJob(ctx context.Context, id int) error {
+	const op = "storage.memory.StartExportJob"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.exportJobs[id]; ok {
+		job.Status = exporter.StatusRunning
+	}
+
+	return nil
+}
+
+func (s *Storage) FinishExportJob(ctx context.Context, id int, status, blobKey string, rows int, jobError string) error {
+	const op = "storage.memory.FinishExportJob"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.exportJobs[id]; ok {
+		t := now()
+		job.Status = status
+		job.BlobKey = blobKey
+		job.Rows = rows
+		job.Error = jobError
+		job.FinishedAt = &t
+	}
+
+	return nil
+}
+
+func copyQuery(q entity.ExportQuery) entity.ExportQuery {
+	q.Filters = append([]string(nil), q.Filters...)
+	return q
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
@@ -0,0 +1,343 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/revision"
+	"reflect"
+	"strconv"
+)
+
+// UpsertExternalCategory creates or updates the category the source knows by c.ExternalId and
+// returns its id. The parent must have been upserted before; an unknown parent makes it a root.
+// Nothing is written when the category is already up to date, so re-imports do not bump versions.
+func (s *Storage) UpsertExternalCategory(ctx context.Context, source string, c entity.ExternalCategory) (int, error) {
+	const op = "storage.memory.UpsertExternalCategory"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var parentId *int
+	if c.ParentExternalId != "" {
+		if parent := s.externalCategory(source, c.ParentExternalId); parent != nil {
+			parentId = &parent.id
+		}
+	}
+
+	existing := s.externalCategory(source, c.ExternalId)
+	if existing == nil {
+		return s.insertCategory(c.Name, parentId, source, c.ExternalId).id, nil
+	}
+
+	if existing.name != c.Name || !sameInt(existing.parentId, parentId) {
+		existing.name = c.Name
+		existing.parentId = parentId
+		existing.version++
+	}
+
+	return existing.id, nil
+}
+
+// UpsertExternalGood creates or updates the good the source knows by g.ExternalId, marking it
+// deleted when g.Deleted is set. Attributes are merged into the existing ones and only links to
+// categories of the same source are replaced, so local edits survive a re-import. Unchanged
+// goods are left alone. A non-empty message means the good was rejected.
+func (s *Storage) UpsertExternalGood(ctx context.Context, source string, g entity.ExternalGood, actorUid int) (string, error) {
+	const op = "storage.memory.UpsertExternalGood"
+
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.externalGood(source, g.ExternalId)
+
+	if g.Deleted {
+		if existing != nil {
+			if err := s.trashGood(existing.id, actorUid); err != nil {
+				return "", fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		return "", nil
+	}
+
+	var parentId *int
+	if g.ParentExternalId != "" {
+		parent := s.externalGood(source, g.ParentExternalId)
+		if parent == nil {
+			return fmt.Sprintf("parent %q not found", g.ParentExternalId), nil
+		}
+		parentId = &parent.id
+	}
+
+	var categoryIds []int
+	for _, externalId := range g.CategoryExternalIds {
+		c := s.externalCategory(source, externalId)
+		if c == nil || c.deletedAt != nil {
+			return fmt.Sprintf("group %q not found", externalId), nil
+		}
+		categoryIds = append(categoryIds, c.id)
+	}
+	if len(categoryIds) == 0 && parentId != nil {
+		categoryIds = sortedIds(s.links[*parentId])
+	}
+	if len(categoryIds) == 0 {
+		return "good has no group", nil
+	}
+
+	var current map[string]any
+	if existing != nil {
+		current = existing.attributes
+	}
+
+	values, msg, err := s.externalAttributes(categoryIds, current, g.Attributes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if msg != "" {
+		return msg, nil
+	}
+
+	var goodId int
+	if existing != nil {
+		goodId = existing.id
+	}
+	if s.skuTaken(g.Sku, goodId) {
+		return "sku " + strconv.Quote(g.Sku) + " already taken", nil
+	}
+
+	changed := false
+
+	if existing == nil {
+		existing = s.insertGood(&good{
+			name:       g.Name,
+			sku:        g.Sku,
+			parentId:   parentId,
+			attributes: values,
+			source:     source,
+			externalId: g.ExternalId,
+		})
+		changed = true
+	} else {
+		merged := mergeAttributes(existing.attributes, values)
+		if existing.name != g.Name || existing.sku != g.Sku || !sameInt(existing.parentId, parentId) || !reflect.DeepEqual(existing.attributes, merged) {
+			existing.name = g.Name
+			existing.sku = g.Sku
+			existing.parentId = parentId
+			existing.attributes = merged
+			existing.version++
+			changed = true
+		}
+	}
+
+	linked := s.syncExternalCategories(source, existing.id, categoryIds)
+	if linked && !changed {
+		existing.version++
+	}
+
+	if changed || linked {
+		if _, err := s.writeRevision(existing.id, revision.ActionImport, actorUid, nil); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return "", nil
+}
+
+// UpsertExternalOffer applies the price, stock and sku of an offer, creating the variant first
+// when the source offers a characteristic of a known good. A non-empty message means the offer
+// was rejected.
+func (s *Storage) UpsertExternalOffer(ctx context.Context, source string, o entity.ExternalOffer, actorUid int) (string, error) {
+	const op = "storage.memory.UpsertExternalOffer"
+
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.externalGood(source, o.ExternalId)
+
+	var variant *good
+
+	if g == nil {
+		if o.ParentExternalId == "" {
+			return fmt.Sprintf("good %q not found", o.ExternalId), nil
+		}
+
+		parent := s.externalGood(source, o.ParentExternalId)
+		if parent == nil {
+			return fmt.Sprintf("good %q not found", o.ParentExternalId), nil
+		}
+
+		categoryIds := sortedIds(s.links[parent.id])
+
+		values, msg, err := s.externalAttributes(categoryIds, parent.attributes, o.Attributes)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		if msg != "" {
+			return msg, nil
+		}
+
+		name := o.Name
+		if name == "" {
+			name = parent.name
+		}
+
+		variant = &good{
+			name:       name,
+			parentId:   &parent.id,
+			attributes: mergeAttributes(parent.attributes, values),
+			source:     source,
+			externalId: o.ExternalId,
+		}
+		g = variant
+	}
+
+	sku := g.sku
+	if o.Sku != "" {
+		sku = o.Sku
+	}
+
+	var goodId int
+	if variant == nil {
+		goodId = g.id
+	}
+	if sku != g.sku && s.skuTaken(sku, goodId) {
+		return "sku " + strconv.Quote(o.Sku) + " already taken", nil
+	}
+
+	if variant != nil {
+		categoryIds := sortedIds(s.links[*variant.parentId])
+		s.insertGood(variant)
+		for _, id := range categoryIds {
+			s.links[variant.id][id] = true
+		}
+	}
+
+	newPrice := g.price
+	if o.Price != nil {
+		newPrice = priceOf(o.Price)
+	}
+	newStock := g.stock
+	if o.Stock != nil {
+		newStock = *o.Stock
+	}
+
+	changed := !sameFloat(newPrice, g.price) || newStock != g.stock || sku != g.sku
+	if changed {
+		g.price = newPrice
+		g.stock = newStock
+		g.sku = sku
+		g.version++
+	}
+
+	if variant != nil || changed {
+		if _, err := s.writeRevision(g.id, revision.ActionImport, actorUid, nil); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return "", nil
+}
+
+// externalGood returns the good the source imported under externalId, live or in the trash.
+func (s *Storage) externalGood(source, externalId string) *good {
+	for _, g := range s.goods {
+		if g.source == source && g.externalId == externalId {
+			return g
+		}
+	}
+	return nil
+}
+
+// externalCategory returns the category the source imported under externalId, live or in the trash.
+func (s *Storage) externalCategory(source, externalId string) *category {
+	for _, c := range s.categories {
+		if c.source == source && c.externalId == externalId {
+			return c
+		}
+	}
+	return nil
+}
+
+// externalAttributes types raw values against the schemas of the categories. Values without
+// a schema are dropped: external systems carry many properties the catalog does not model.
+// Required attributes are checked against the values merged into current.
+func (s *Storage) externalAttributes(categoryIds []int, current map[string]any, raw map[string]string) (map[string]any, string, error) {
+	schemas := s.schemasOf(categoryIds)
+
+	byName := make(map[string]entity.CategoryAttribute, len(schemas))
+	for _, schema := range schemas {
+		byName[schema.Name] = schema
+	}
+
+	values := make(map[string]any, len(raw))
+	for name, value := range raw {
+		schema, ok := byName[name]
+		if !ok || value == "" {
+			continue
+		}
+		v, err := attr.Parse(schema, value)
+		if err != nil {
+			return nil, err.Error(), nil
+		}
+		values[name] = v
+	}
+
+	if err := attr.Validate(schemas, mergeAttributes(current, values)); err != nil {
+		if errors.Is(err, attr.ErrInvalidValue) {
+			return nil, err.Error(), nil
+		}
+		return nil, "", err
+	}
+
+	return values, "", nil
+}
+
+// syncExternalCategories makes the good's links to the source's categories exactly categoryIds
+// and reports whether anything changed. Links to local categories are kept.
+func (s *Storage) syncExternalCategories(source string, goodId int, categoryIds []int) bool {
+	wanted := make(map[int]bool, len(categoryIds))
+	for _, id := range categoryIds {
+		wanted[id] = true
+	}
+
+	links := s.links[goodId]
+	changed := false
+
+	for id := range links {
+		if c, ok := s.categories[id]; ok && c.source == source && !wanted[id] {
+			delete(links, id)
+			changed = true
+		}
+	}
+	for id := range wanted {
+		if !links[id] {
+			links[id] = true
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// mergeAttributes returns current with values laid over it, like jsonb concatenation.
+func mergeAttributes(current, values map[string]any) map[string]any {
+	merged := cloneAttributes(current)
+	for k, v := range values {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+)
+
+// FeedGoods hands the live goods to fn ordered by id. The goods are copied first so that fn
+// does not hold the lock.
+func (s *Storage) FeedGoods(ctx context.Context, fn func(entity.FeedGood) error) error {
+	const op = "storage.memory.FeedGoods"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+
+	var feed []entity.FeedGood
+	for _, g := range s.sortedGoods() {
+		if g.deletedAt != nil {
+			continue
+		}
+
+		categoryIds := []int{}
+		for _, c := range s.goodCategories(g.id) {
+			categoryIds = append(categoryIds, c.id)
+		}
+
+		var imageKey string
+		if img := s.primaryImage(g.id); img != nil {
+			imageKey = img.Key
+		}
+
+		feed = append(feed, entity.FeedGood{
+			GoodId:      g.id,
+			GoodName:    g.name,
+			ParentId:    copyInt(g.parentId),
+			Sku:         g.sku,
+			Price:       copyFloat(g.price),
+			Stock:       g.stock,
+			Attributes:  cloneAttributes(g.attributes),
+			CategoryIds: categoryIds,
+			ImageKey:    imageKey,
+			HasVariants: len(s.liveVariants(g.id)) != 0,
+		})
+	}
+
+	s.mu.RUnlock()
+
+	for _, g := range feed {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CatalogFingerprint changes whenever a good or category is created, modified or purged:
+// every change bumps a version, so the sums of versions move along with the counts.
+func (s *Storage) CatalogFingerprint(ctx context.Context) (string, error) {
+	const op = "storage.memory.CatalogFingerprint"
+
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var goodVersions, goodMax, categoryVersions, categoryMax int
+	for _, g := range s.goods {
+		goodVersions += g.version
+		goodMax = max(goodMax, g.id)
+	}
+	for _, c := range s.categories {
+		categoryVersions += c.version
+		categoryMax = max(categoryMax, c.id)
+	}
+
+	return fmt.Sprintf("%d.%d.%d-%d.%d.%d", len(s.goods), goodVersions, goodMax, len(s.categories), categoryVersions, categoryMax), nil
+}
@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"sort"
+)
+
+// StartFetchRun records the start of a fetch and returns the run id.
+func (s *Storage) StartFetchRun(ctx context.Context, source, trigger, status string) (int, error) {
+	const op = "storage.memory.StartFetchRun"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := &entity.FetchRun{
+		RunId:     s.nextId("fetch_run"),
+		Source:    source,
+		Trigger:   trigger,
+		Status:    status,
+		StartedAt: now(),
+	}
+	s.fetchRuns[run.RunId] = run
+
+	return run.RunId, nil
+}
+
+func (s *Storage) FinishFetchRun(ctx context.Context, run entity.FetchRun) error {
+	const op = "storage.memory.FinishFetchRun"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.fetchRuns[run.RunId]; ok {
+		t := now()
+		stored.Status = run.Status
+		stored.Attempts = run.Attempts
+		stored.Fetched = run.Fetched
+		stored.Added = run.Added
+		stored.Rejected = run.Rejected
+		stored.Error = run.Error
+		stored.FinishedAt = &t
+	}
+
+	return nil
+}
+
+// InterruptFetchRuns closes the runs of the source a previous process left unfinished with
+// the given status.
+func (s *Storage) InterruptFetchRuns(ctx context.Context, source, from, status string) (int, error) {
+	const op = "storage.memory.InterruptFetchRuns"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+
+	var n int
+	for _, run := range s.fetchRuns {
+		if run.Source == source && run.Status == from {
+			finishedAt := t
+			run.Status = status
+			run.Error = "interrupted"
+			run.FinishedAt = &finishedAt
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// GetFetchRuns returns the latest runs first; an empty source means every source.
+func (s *Storage) GetFetchRuns(ctx context.Context, source string, limit int) ([]entity.FetchRun, error) {
+	const op = "storage.memory.GetFetchRuns"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := []entity.FetchRun{}
+	for _, run := range s.latestFetchRuns() {
+		if len(runs) == limit {
+			break
+		}
+		if source == "" || run.Source == source {
+			runs = append(runs, copyFetchRun(run))
+		}
+	}
+
+	return runs, nil
+}
+
+// GetLastFetchRuns returns the latest run of every source by its name.
+func (s *Storage) GetLastFetchRuns(ctx context.Context) (map[string]entity.FetchRun, error) {
+	const op = "storage.memory.GetLastFetchRuns"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bySource := make(map[string]entity.FetchRun)
+	for _, run := range s.latestFetchRuns() {
+		if _, ok := bySource[run.Source]; !ok {
+			bySource[run.Source] = copyFetchRun(run)
+		}
+	}
+
+	return bySource, nil
+}
+
+// latestFetchRuns returns the runs ordered by id, latest first.
+func (s *Storage) latestFetchRuns() []*entity.FetchRun {
+	runs := make([]*entity.FetchRun, 0, len(s.fetchRuns))
+	for _, run := range s.fetchRuns {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].RunId > runs[j].RunId })
+	return runs
+}
+
+func copyFetchRun(run *entity.FetchRun) entity.FetchRun {
+	copied := *run
+	copied.FinishedAt = copyTime(run.FinishedAt)
+	if run.FinishedAt != nil {
+		duration := run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+		copied.DurationMs = &duration
+	}
+	return copied
+}
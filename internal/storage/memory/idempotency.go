@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/storage"
+	"time"
+)
+
+type idempotencyKey struct {
+	uid int
+	key string
+}
+
+// idempotencyRecord is a reservation until response is set.
+type idempotencyRecord struct {
+	requestHash string
+	response    *entity.IdempotentResponse
+	createdAt   time.Time
+	expiresAt   time.Time
+}
+
+// ReserveIdempotencyKey claims the key for a new request and returns nil. If the key already
+// holds a finished request with the same hash its stored response is returned instead.
+// Expired keys and reservations older than lockTimeout (the owner died) are taken over.
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, uid int, key, requestHash string, ttl, lockTimeout time.Duration) (*entity.IdempotentResponse, error) {
+	const op = "storage.memory.ReserveIdempotencyKey"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{uid: uid, key: key}
+	t := now()
+
+	r, ok := s.idempotency[k]
+	if ok && (r.expiresAt.Before(t) || (r.response == nil && r.createdAt.Before(t.Add(-lockTimeout)))) {
+		ok = false
+	}
+
+	if !ok {
+		s.idempotency[k] = &idempotencyRecord{requestHash: requestHash, createdAt: t, expiresAt: t.Add(ttl)}
+		return nil, nil
+	}
+
+	if r.requestHash != requestHash {
+		return nil, storage.ErrIdempotencyKeyReused
+	}
+	if r.response == nil {
+		return nil, storage.ErrIdempotencyInProgress
+	}
+
+	response := copyResponse(*r.response)
+
+	return &response, nil
+}
+
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, uid int, key string, response entity.IdempotentResponse) error {
+	const op = "storage.memory.CompleteIdempotencyKey"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.idempotency[idempotencyKey{uid: uid, key: key}]; ok {
+		stored := copyResponse(response)
+		r.response = &stored
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey drops an unfinished reservation so that the request can be retried.
+func (s *Storage) ReleaseIdempotencyKey(ctx context.Context, uid int, key string) error {
+	const op = "storage.memory.ReleaseIdempotencyKey"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{uid: uid, key: key}
+	if r, ok := s.idempotency[k]; ok && r.response == nil {
+		delete(s.idempotency, k)
+	}
+
+	return nil
+}
+
+func (s *Storage) PurgeIdempotencyKeys(ctx context.Context) (int, error) {
+	const op = "storage.memory.PurgeIdempotencyKeys"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+
+	var n int
+	for k, r := range s.idempotency {
+		if r.expiresAt.Before(t) {
+			delete(s.idempotency, k)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func copyResponse(r entity.IdempotentResponse) entity.IdempotentResponse {
+	var header map[string][]string
+	if r.Header != nil {
+		header = make(map[string][]string, len(r.Header))
+		for name, values := range r.Header {
+			header[name] = append([]string(nil), values...)
+		}
+	}
+
+	return entity.IdempotentResponse{
+		StatusCode: r.StatusCode,
+		Header:     header,
+		Body:       append([]byte(nil), r.Body...),
+	}
+}
@@ -0,0 +1,213 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/storage"
+	"sort"
+)
+
+func (s *Storage) AddGoodImage(ctx context.Context, img entity.GoodImage) (entity.GoodImage, error) {
+	const op = "storage.memory.AddGoodImage"
+
+	if err := ctx.Err(); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.liveGood(img.GoodId)
+	if g == nil {
+		return entity.GoodImage{}, storage.ErrNotFound
+	}
+
+	images := s.sortedImages(img.GoodId)
+
+	img.Position = 0
+	for _, other := range images {
+		img.Position = max(img.Position, other.Position+1)
+	}
+	img.Primary = len(images) == 0
+	img.ImageId = s.nextId("good_image")
+
+	stored := copyImage(img)
+	s.images[img.ImageId] = &stored
+
+	g.version++
+
+	return img, nil
+}
+
+func (s *Storage) GetGoodImages(ctx context.Context, goodId int) ([]entity.GoodImage, error) {
+	const op = "storage.memory.GetGoodImages"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var images []entity.GoodImage
+	for _, img := range s.sortedImages(goodId) {
+		images = append(images, copyImage(*img))
+	}
+
+	return images, nil
+}
+
+// DeleteGoodImage removes the image record and returns it so that the caller can drop the blobs.
+// When the primary image is deleted the next one in order becomes primary.
+func (s *Storage) DeleteGoodImage(ctx context.Context, imageId int) (entity.GoodImage, error) {
+	const op = "storage.memory.DeleteGoodImage"
+
+	if err := ctx.Err(); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	img, ok := s.images[imageId]
+	if !ok {
+		return entity.GoodImage{}, storage.ErrNotFound
+	}
+	delete(s.images, imageId)
+
+	if img.Primary {
+		if rest := s.sortedImages(img.GoodId); len(rest) != 0 {
+			rest[0].Primary = true
+		}
+	}
+
+	s.goods[img.GoodId].version++
+
+	return copyImage(*img), nil
+}
+
+func (s *Storage) ReorderGoodImages(ctx context.Context, goodId int, imageIds []int) ([]entity.GoodImage, error) {
+	const op = "storage.memory.ReorderGoodImages"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.sortedImages(goodId)
+	if len(current) != len(imageIds) {
+		return nil, storage.ErrInvalidOrder
+	}
+
+	known := make(map[int]bool, len(current))
+	for _, img := range current {
+		known[img.ImageId] = true
+	}
+	for _, id := range imageIds {
+		if !known[id] {
+			return nil, storage.ErrInvalidOrder
+		}
+		delete(known, id)
+	}
+
+	for position, id := range imageIds {
+		s.images[id].Position = position
+	}
+
+	// An empty order for a good that does not exist is not an error in the postgres storage either.
+	if g, ok := s.goods[goodId]; ok {
+		g.version++
+	}
+
+	var images []entity.GoodImage
+	for _, img := range s.sortedImages(goodId) {
+		images = append(images, copyImage(*img))
+	}
+
+	return images, nil
+}
+
+func (s *Storage) SetPrimaryImage(ctx context.Context, imageId int) (entity.GoodImage, error) {
+	const op = "storage.memory.SetPrimaryImage"
+
+	if err := ctx.Err(); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	img, ok := s.images[imageId]
+	if !ok {
+		return entity.GoodImage{}, storage.ErrNotFound
+	}
+
+	for _, other := range s.sortedImages(img.GoodId) {
+		other.Primary = false
+	}
+	img.Primary = true
+
+	s.goods[img.GoodId].version++
+
+	return copyImage(*img), nil
+}
+
+// sortedImages returns the stored images of the good ordered by position, then id.
+func (s *Storage) sortedImages(goodId int) []*entity.GoodImage {
+	var images []*entity.GoodImage
+	for _, img := range s.images {
+		if img.GoodId == goodId {
+			images = append(images, img)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Position != images[j].Position {
+			return images[i].Position < images[j].Position
+		}
+		return images[i].ImageId < images[j].ImageId
+	})
+	return images
+}
+
+// goodImages returns copies of the good's images, an empty slice when it has none.
+func (s *Storage) goodImages(goodId int) []entity.GoodImage {
+	images := []entity.GoodImage{}
+	for _, img := range s.sortedImages(goodId) {
+		images = append(images, copyImage(*img))
+	}
+	return images
+}
+
+func (s *Storage) primaryImage(goodId int) *entity.GoodImage {
+	for _, img := range s.images {
+		if img.GoodId == goodId && img.Primary {
+			primary := copyImage(*img)
+			return &primary
+		}
+	}
+	return nil
+}
+
+// copyImage keeps only what the storage knows about an image: URLs are filled in by handlers.
+func copyImage(img entity.GoodImage) entity.GoodImage {
+	thumbnails := make(map[string]string, len(img.ThumbnailKeys))
+	for size, key := range img.ThumbnailKeys {
+		thumbnails[size] = key
+	}
+
+	return entity.GoodImage{
+		ImageId:       img.ImageId,
+		GoodId:        img.GoodId,
+		Key:           img.Key,
+		ThumbnailKeys: thumbnails,
+		ContentType:   img.ContentType,
+		Size:          img.Size,
+		Width:         img.Width,
+		Height:        img.Height,
+		Position:      img.Position,
+		Primary:       img.Primary,
+	}
+}
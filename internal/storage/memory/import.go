@@ -0,0 +1,318 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/importer"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/storage"
+	"strconv"
+)
+
+// maxImportErrors caps the per-row errors kept on a job; the failed counter stays exact.
+const maxImportErrors = 1000
+
+func (s *Storage) CreateImportJob(ctx context.Context, job entity.ImportJob) (int, error) {
+	const op = "storage.memory.CreateImportJob"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := entity.ImportJob{
+		ImportId:         s.nextId("import_job"),
+		Uid:              job.Uid,
+		Status:           importer.StatusPending,
+		Format:           job.Format,
+		Mode:             job.Mode,
+		DryRun:           job.DryRun,
+		CreateCategories: job.CreateCategories,
+		Mapping:          copyMapping(job.Mapping),
+		BlobKey:          job.BlobKey,
+		Errors:           []entity.ImportRowError{},
+		CreatedAt:        now(),
+	}
+	s.importJobs[stored.ImportId] = &stored
+
+	return stored.ImportId, nil
+}
+
+func (s *Storage) GetImportJob(ctx context.Context, id int) (entity.ImportJob, error) {
+	const op = "storage.memory.GetImportJob"
+
+	if err := ctx.Err(); err != nil {
+		return entity.ImportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.importJobs[id]
+	if !ok {
+		return entity.ImportJob{}, storage.ErrNotFound
+	}
+
+	copied := *job
+	copied.Mapping = copyMapping(job.Mapping)
+	copied.Errors = append([]entity.ImportRowError{}, job.Errors...)
+	copied.StartedAt = copyTime(job.StartedAt)
+	copied.FinishedAt = copyTime(job.FinishedAt)
+
+	return copied, nil
+}
+
+// UnfinishedImportJobs lists jobs that were queued or interrupted, oldest first.
+func (s *Storage) UnfinishedImportJobs(ctx context.Context) ([]int, error) {
+	const op = "storage.memory.UnfinishedImportJobs"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	unfinished := make(map[int]bool)
+	for id, job := range s.importJobs {
+		if job.Status == importer.StatusPending || job.Status == importer.StatusRunning {
+			unfinished[id] = true
+		}
+	}
+
+	ids := sortedIds(unfinished)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return ids, nil
+}
+
+func (s *Storage) StartImportJob(ctx context.Context, id, totalRows int) error {
+	const op = "storage.memory.StartImportJob"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.importJobs[id]; ok {
+		job.Status = importer.StatusRunning
+		job.TotalRows = totalRows
+		if job.StartedAt == nil {
+			t := now()
+			job.StartedAt = &t
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) FinishImportJob(ctx context.Context, id int, status, jobError string) error {
+	const op = "storage.memory.FinishImportJob"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.importJobs[id]; ok {
+		t := now()
+		job.Status = status
+		job.Error = jobError
+		job.FinishedAt = &t
+	}
+
+	return nil
+}
+
+// ImportGoods stores a batch of rows and moves the job's checkpoint to processed under the same
+// lock, so a resumed job never imports a row twice. A bad row is reported and skipped. What the
+// batch stored is taken back on a dry run and, in transactional mode, when any row failed.
+func (s *Storage) ImportGoods(ctx context.Context, job entity.ImportJob, rows []entity.ImportRow, processed int) (entity.ImportBatchResult, error) {
+	const op = "storage.memory.ImportGoods"
+
+	if err := ctx.Err(); err != nil {
+		return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := entity.ImportBatchResult{Errors: []entity.ImportRowError{}}
+
+	var batch importBatch
+
+	for _, row := range rows {
+		msg, err := s.importRow(row, job, &batch)
+		if err != nil {
+			batch.rollback(s)
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: row %d: %w", op, row.Row, err)
+		}
+		if msg != "" {
+			result.Errors = append(result.Errors, entity.ImportRowError{Row: row.Row, Message: msg})
+			continue
+		}
+		result.Succeeded++
+	}
+
+	commit := !job.DryRun && !(job.Mode == importer.ModeTransactional && len(result.Errors) != 0)
+	if !commit {
+		batch.rollback(s)
+		if !job.DryRun {
+			result.Succeeded = 0
+		}
+	}
+
+	if stored, ok := s.importJobs[job.ImportId]; ok {
+		stored.ProcessedRows = processed
+		stored.Succeeded += result.Succeeded
+		stored.Failed += len(result.Errors)
+		if len(stored.Errors) < maxImportErrors {
+			stored.Errors = append(stored.Errors, result.Errors...)
+		}
+	}
+
+	return result, nil
+}
+
+// importBatch remembers what a batch created so that it can be taken back.
+type importBatch struct {
+	goods      []int
+	categories []int
+}
+
+func (b *importBatch) rollback(s *Storage) {
+	for _, id := range b.goods {
+		delete(s.goods, id)
+		delete(s.links, id)
+		delete(s.revisions, id)
+	}
+	for _, id := range b.categories {
+		delete(s.categories, id)
+	}
+}
+
+// importRow inserts one good. A non-empty message means the row is invalid; an error means
+// the import cannot go on. The row is checked completely before anything is stored, so
+// a rejected row leaves nothing behind, not even the categories it would have created.
+func (s *Storage) importRow(row entity.ImportRow, job entity.ImportJob, batch *importBatch) (string, error) {
+	if row.Err != "" {
+		return row.Err, nil
+	}
+
+	var (
+		categoryIds []int
+		missing     []string
+	)
+	seen := make(map[int]bool)
+	seenMissing := make(map[string]bool)
+
+	for _, name := range row.Categories {
+		c := s.liveCategoryByName(name)
+		switch {
+		case c == nil && job.CreateCategories:
+			if !seenMissing[name] {
+				seenMissing[name] = true
+				missing = append(missing, name)
+			}
+			continue
+		case c == nil:
+			return fmt.Sprintf("category %q not found", name), nil
+		}
+		if !seen[c.id] {
+			seen[c.id] = true
+			categoryIds = append(categoryIds, c.id)
+		}
+	}
+
+	// Categories about to be created have no schemas yet.
+	schemas := s.schemasOf(categoryIds)
+
+	byName := make(map[string]entity.CategoryAttribute, len(schemas))
+	for _, schema := range schemas {
+		byName[schema.Name] = schema
+	}
+
+	values := make(map[string]any, len(row.Attributes))
+	for name, raw := range row.Attributes {
+		if raw == "" {
+			continue
+		}
+		schema, ok := byName[name]
+		if !ok {
+			return fmt.Sprintf("attribute %q is not defined for the good's categories", name), nil
+		}
+		v, err := attr.Parse(schema, raw)
+		if err != nil {
+			return err.Error(), nil
+		}
+		values[name] = v
+	}
+
+	if err := attr.Validate(schemas, values); err != nil {
+		if errors.Is(err, attr.ErrInvalidValue) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+
+	if s.skuTaken(row.Sku, 0) {
+		return "sku " + strconv.Quote(row.Sku) + " already taken", nil
+	}
+
+	for _, name := range missing {
+		c := s.insertCategory(name, nil, "", "")
+		batch.categories = append(batch.categories, c.id)
+		categoryIds = append(categoryIds, c.id)
+	}
+
+	g := s.insertGood(&good{
+		name:       row.GoodName,
+		sku:        row.Sku,
+		price:      priceOf(row.Price),
+		stock:      row.Stock,
+		attributes: values,
+	})
+	batch.goods = append(batch.goods, g.id)
+
+	for _, id := range categoryIds {
+		s.links[g.id][id] = true
+	}
+
+	if _, err := s.writeRevision(g.id, revision.ActionImport, job.Uid, nil); err != nil {
+		return "", err
+	}
+
+	return "", nil
+}
+
+// liveCategoryByName returns the oldest live category with the name, nil when there is none.
+func (s *Storage) liveCategoryByName(name string) *category {
+	for _, c := range s.sortedCategories() {
+		if c.deletedAt == nil && c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func copyMapping(mapping map[string]string) map[string]string {
+	if mapping == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(mapping))
+	for k, v := range mapping {
+		copied[k] = v
+	}
+	return copied
+}
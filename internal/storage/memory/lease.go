@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type lease struct {
+	holder     string
+	acquiredAt time.Time
+	expiresAt  time.Time
+}
+
+// AcquireLease takes the lease on a job for ttl, or extends it when holder already has it.
+// It reports false while another holder's lease is unexpired. A memory backend serves a single
+// process, so the lease only matters between the jobs of that process.
+func (s *Storage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	const op = "storage.memory.AcquireLease"
+
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := now()
+
+	l, ok := s.leases[name]
+	switch {
+	case !ok:
+		s.leases[name] = &lease{holder: holder, acquiredAt: t, expiresAt: t.Add(ttl)}
+	case l.holder == holder:
+		l.expiresAt = t.Add(ttl)
+	case l.expiresAt.Before(t):
+		l.holder = holder
+		l.acquiredAt = t
+		l.expiresAt = t.Add(ttl)
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// ReleaseLease gives the lease up, so that another holder can take over without waiting for it
+// to expire.
+func (s *Storage) ReleaseLease(ctx context.Context, name, holder string) error {
+	const op = "storage.memory.ReleaseLease"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.leases[name]; ok && l.holder == holder {
+		delete(s.leases, name)
+	}
+
+	return nil
+}
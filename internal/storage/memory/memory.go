@@ -0,0 +1,757 @@
+// Package memory keeps the catalog in process memory. It behaves like the postgres storage,
+// down to versions, the trash and revisions, so the service can run and be tested without
+// a database. Nothing survives a restart.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/signin"
+	"inHouseAd/internal/http-server/handlers/auth/signup"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/lib/role"
+	"inHouseAd/internal/storage"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage guards all of its state with one lock, so every method is atomic the way
+// a transaction of the postgres storage is.
+type Storage struct {
+	mu sync.RWMutex
+
+	seq map[string]int
+
+	users      map[int]*user
+	emails     map[string]int
+	categories map[int]*category
+	goods      map[int]*good
+	// links are the categories of every good by good id, live or in the trash.
+	links      map[int]map[int]bool
+	attributes map[int]*entity.CategoryAttribute
+	images     map[int]*entity.GoodImage
+	revisions  map[int][]revisionRecord
+
+	idempotency map[idempotencyKey]*idempotencyRecord
+	importJobs  map[int]*entity.ImportJob
+	exportJobs  map[int]*entity.ExportJob
+	fetchRuns   map[int]*entity.FetchRun
+	leases      map[string]*lease
+	sourceJobs  map[string]entity.SourceJobControl
+}
+
+type user struct {
+	id             int
+	email          string
+	passwordHashed []byte
+	role           string
+}
+
+type category struct {
+	id         int
+	name       string
+	parentId   *int
+	source     string
+	externalId string
+	version    int
+	deletedAt  *time.Time
+}
+
+type good struct {
+	id          int
+	name        string
+	parentId    *int
+	variantAxes []string
+	sku         string
+	price       *float64
+	stock       int
+	attributes  map[string]any
+	source      string
+	externalId  string
+	version     int
+	deletedAt   *time.Time
+}
+
+// New returns an empty catalog with the default category, like a freshly migrated database.
+func New() *Storage {
+	s := &Storage{
+		seq:         make(map[string]int),
+		users:       make(map[int]*user),
+		emails:      make(map[string]int),
+		categories:  make(map[int]*category),
+		goods:       make(map[int]*good),
+		links:       make(map[int]map[int]bool),
+		attributes:  make(map[int]*entity.CategoryAttribute),
+		images:      make(map[int]*entity.GoodImage),
+		revisions:   make(map[int][]revisionRecord),
+		idempotency: make(map[idempotencyKey]*idempotencyRecord),
+		importJobs:  make(map[int]*entity.ImportJob),
+		exportJobs:  make(map[int]*entity.ExportJob),
+		fetchRuns:   make(map[int]*entity.FetchRun),
+		leases:      make(map[string]*lease),
+		sourceJobs:  make(map[string]entity.SourceJobControl),
+	}
+
+	s.insertCategory("No category", nil, "", "")
+
+	return s
+}
+
+// Close is a no-op; it is there so that the storage can be swapped for the postgres one.
+func (s *Storage) Close() {}
+
+// nextId hands out ids per table, starting from 1 like a serial column.
+func (s *Storage) nextId(table string) int {
+	s.seq[table]++
+	return s.seq[table]
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func (s *Storage) Register(ctx context.Context, email string, passwordHashed []byte) (int, error) {
+	return s.CreateUser(ctx, email, passwordHashed, role.User)
+}
+
+func (s *Storage) CreateUser(ctx context.Context, email string, passwordHashed []byte, userRole string) (int, error) {
+	const op = "storage.memory.CreateUser"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.emails[email]; ok {
+		return 0, signup.ErrEmailTaken
+	}
+
+	u := &user{id: s.nextId("users"), email: email, passwordHashed: append([]byte(nil), passwordHashed...), role: userRole}
+	s.users[u.id] = u
+	s.emails[email] = u.id
+
+	return u.id, nil
+}
+
+// SetPassword replaces the password of the user with the email.
+func (s *Storage) SetPassword(ctx context.Context, email string, passwordHashed []byte) error {
+	const op = "storage.memory.SetPassword"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.emails[email]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	s.users[id].passwordHashed = append([]byte(nil), passwordHashed...)
+
+	return nil
+}
+
+func (s *Storage) Authorizate(ctx context.Context, email string) ([]byte, int, error) {
+	const op = "storage.memory.Authorizate"
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.emails[email]
+	if !ok {
+		return nil, 0, signin.ErrInvalidEmail
+	}
+
+	return append([]byte(nil), s.users[id].passwordHashed...), id, nil
+}
+
+func (s *Storage) Create(ctx context.Context, name string, uid int) (int, error) {
+	const op = "storage.memory.Create"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insertCategory(name, nil, "", "").id, nil
+}
+
+func (s *Storage) insertCategory(name string, parentId *int, source, externalId string) *category {
+	c := &category{
+		id:         s.nextId("category"),
+		name:       name,
+		parentId:   parentId,
+		source:     source,
+		externalId: externalId,
+		version:    1,
+	}
+	s.categories[c.id] = c
+	return c
+}
+
+// liveCategory returns nil for a category that does not exist or is in the trash.
+func (s *Storage) liveCategory(id int) *category {
+	c, ok := s.categories[id]
+	if !ok || c.deletedAt != nil {
+		return nil
+	}
+	return c
+}
+
+// EditCategory renames the category. A non-zero version must match the current one.
+func (s *Storage) EditCategory(ctx context.Context, id int, newName string, version int) (int, error) {
+	const op = "storage.memory.EditCategory"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.liveCategory(id)
+	if c == nil {
+		return 0, storage.ErrNotFound
+	}
+	if version != 0 && version != c.version {
+		return 0, storage.ErrVersionMismatch
+	}
+
+	c.name = newName
+	c.version++
+
+	return id, nil
+}
+
+// DeleteCategory moves the category to the trash. Its links to goods are kept so that
+// a restore brings them back; they are only dropped when the trash is purged.
+func (s *Storage) DeleteCategory(ctx context.Context, id, version int) error {
+	const op = "storage.memory.DeleteCategory"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.liveCategory(id)
+	if c == nil {
+		return storage.ErrNotFound
+	}
+	if version != 0 && version != c.version {
+		return storage.ErrVersionMismatch
+	}
+
+	t := now()
+	c.deletedAt = &t
+	c.version++
+
+	return nil
+}
+
+// liveGood returns nil for a good that does not exist or is in the trash.
+func (s *Storage) liveGood(id int) *good {
+	g, ok := s.goods[id]
+	if !ok || g.deletedAt != nil {
+		return nil
+	}
+	return g
+}
+
+// checkVersion finds the live good and compares its version with the expected one (0 skips the check).
+func (s *Storage) checkVersion(goodId, version int) (*good, error) {
+	g := s.liveGood(goodId)
+	if g == nil {
+		return nil, storage.ErrNotFound
+	}
+	if version != 0 && version != g.version {
+		return nil, storage.ErrVersionMismatch
+	}
+	return g, nil
+}
+
+func (s *Storage) insertGood(g *good) *good {
+	g.id = s.nextId("good")
+	g.version = 1
+	if g.attributes == nil {
+		g.attributes = map[string]any{}
+	}
+	s.goods[g.id] = g
+	s.links[g.id] = make(map[int]bool)
+	return g
+}
+
+// skuTaken reports whether another good, live or in the trash, has the sku.
+func (s *Storage) skuTaken(sku string, goodId int) bool {
+	if sku == "" {
+		return false
+	}
+	for _, g := range s.goods {
+		if g.sku == sku && g.id != goodId {
+			return true
+		}
+	}
+	return false
+}
+
+// AddGood creates the good in the category with the attribute values, which must satisfy
+// the attributes of the category.
+func (s *Storage) AddGood(ctx context.Context, goodName string, categoryId int, attributes map[string]any, actorUid int) (int, string, error) {
+	const op = "storage.memory.AddGood"
+
+	if err := ctx.Err(); err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.liveCategory(categoryId)
+	if c == nil {
+		return 0, "", storage.ErrNotFound
+	}
+
+	if err := attr.Validate(s.categoryAttributes(categoryId), attributes); err != nil {
+		return 0, "", err
+	}
+
+	normalized, err := normalizeAttributes(attributes)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	g := s.insertGood(&good{name: goodName, attributes: normalized})
+	s.links[g.id][categoryId] = true
+
+	if _, err := s.writeRevision(g.id, revision.ActionCreate, actorUid, nil); err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return g.id, c.name, nil
+}
+
+func (s *Storage) UpdateGood(ctx context.Context, goodId, categoryIdToAdd int, goodName string, version, actorUid int) (int, []string, string, error) {
+	const op = "storage.memory.UpdateGood"
+
+	if err := ctx.Err(); err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.checkVersion(goodId, version)
+	if err != nil {
+		return 0, nil, "", err
+	}
+
+	if categoryIdToAdd != 0 {
+		if s.liveCategory(categoryIdToAdd) == nil {
+			return 0, nil, "", fmt.Errorf("%s: category not found", op)
+		}
+		if s.links[goodId][categoryIdToAdd] {
+			return 0, nil, "", fmt.Errorf("%s: good is already in category %d", op, categoryIdToAdd)
+		}
+
+		// The good must have the values the category it joins requires.
+		schemas := append(s.goodSchemas(goodId), s.categoryAttributes(categoryIdToAdd)...)
+		if err := attr.Validate(schemas, g.attributes); err != nil {
+			return 0, nil, "", err
+		}
+	}
+
+	if goodName != "" {
+		g.name = goodName
+		g.version++
+	}
+
+	if categoryIdToAdd != 0 {
+		s.links[goodId][categoryIdToAdd] = true
+		if goodName == "" {
+			g.version++
+		}
+	}
+
+	var categoryNames []string
+	for _, c := range s.goodCategories(goodId) {
+		categoryNames = append(categoryNames, c.name)
+	}
+
+	if _, err := s.writeRevision(goodId, revision.ActionUpdate, actorUid, nil); err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return goodId, categoryNames, g.name, nil
+}
+
+// goodCategories returns the live categories of the good ordered by id.
+func (s *Storage) goodCategories(goodId int) []*category {
+	var categories []*category
+	for id := range s.links[goodId] {
+		if c := s.liveCategory(id); c != nil {
+			categories = append(categories, c)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].id < categories[j].id })
+	return categories
+}
+
+// DeleteGood moves the good and its variants to the trash with a shared timestamp,
+// which is what RestoreGood uses to bring back exactly the goods deleted together.
+func (s *Storage) DeleteGood(ctx context.Context, id, version, actorUid int) error {
+	const op = "storage.memory.DeleteGood"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.checkVersion(id, version); err != nil {
+		return err
+	}
+
+	if err := s.trashGood(id, actorUid); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// trashGood moves the live good and its live variants to the trash.
+func (s *Storage) trashGood(id, actorUid int) error {
+	t := now()
+
+	for _, goodId := range s.familyIds(id) {
+		g := s.goods[goodId]
+		if g.deletedAt != nil {
+			continue
+		}
+		g.deletedAt = &t
+		g.version++
+		if _, err := s.writeRevision(goodId, revision.ActionDelete, actorUid, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// familyIds returns the good and its variants, live or not, ordered by id.
+func (s *Storage) familyIds(id int) []int {
+	ids := []int{id}
+	for _, g := range s.goods {
+		if g.parentId != nil && *g.parentId == id {
+			ids = append(ids, g.id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (s *Storage) GetGood(ctx context.Context, id int) (entity.GoodDetail, error) {
+	const op = "storage.memory.GetGood"
+
+	if err := ctx.Err(); err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	g := s.liveGood(id)
+	if g == nil {
+		return entity.GoodDetail{}, storage.ErrNotFound
+	}
+
+	detail := entity.GoodDetail{
+		GoodId:     g.id,
+		GoodName:   g.name,
+		ParentId:   copyInt(g.parentId),
+		Sku:        g.sku,
+		Price:      copyFloat(g.price),
+		Stock:      g.stock,
+		Attributes: cloneAttributes(g.attributes),
+		Categories: []entity.CategoryList{},
+		Images:     s.goodImages(id),
+		Version:    g.version,
+	}
+	for _, c := range s.goodCategories(id) {
+		detail.Categories = append(detail.Categories, entity.CategoryList{CategoryId: c.id, CategoryName: c.name, Version: c.version})
+	}
+
+	return detail, nil
+}
+
+func (s *Storage) GetCategoryList(ctx context.Context) ([]entity.CategoryList, error) {
+	const op = "storage.memory.GetCategoryList"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var response []entity.CategoryList
+	for _, c := range s.sortedCategories() {
+		if c.deletedAt != nil {
+			continue
+		}
+		response = append(response, entity.CategoryList{
+			CategoryId:   c.id,
+			CategoryName: c.name,
+			ParentId:     copyInt(c.parentId),
+			Version:      c.version,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *Storage) GetGoodList(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]entity.GoodList, error) {
+	const op = "storage.memory.GetGoodList"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	match, err := s.filterMatcher(categoryId, filters, collapseVariants)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.liveCategory(categoryId) == nil {
+		return nil, nil
+	}
+
+	var response []entity.GoodList
+	for _, g := range s.sortedGoods() {
+		if g.deletedAt != nil || !s.links[g.id][categoryId] {
+			continue
+		}
+		if collapseVariants && g.parentId != nil {
+			continue
+		}
+		if !match(g) {
+			continue
+		}
+
+		response = append(response, entity.GoodList{
+			GoodId:       g.id,
+			GoodName:     g.name,
+			Attributes:   cloneAttributes(g.attributes),
+			ParentId:     copyInt(g.parentId),
+			Sku:          g.sku,
+			Price:        copyFloat(g.price),
+			Stock:        g.stock,
+			VariantCount: len(s.liveVariants(g.id)),
+			Image:        s.primaryImage(g.id),
+			Version:      g.version,
+		})
+	}
+
+	return response, nil
+}
+
+// filterMatcher turns attribute filters into a predicate on goods, typed by the category's
+// schemas. A collapsed parent matches a filter when the parent itself or any of its live
+// variants does.
+func (s *Storage) filterMatcher(categoryId int, filters []attr.Filter, collapseVariants bool) (func(*good) bool, error) {
+	if len(filters) == 0 {
+		return func(*good) bool { return true }, nil
+	}
+
+	types := make(map[string]string)
+	for _, a := range s.categoryAttributes(categoryId) {
+		types[a.Name] = a.Type
+	}
+
+	var conditions []func(map[string]any) bool
+
+	for _, f := range filters {
+		attrType, ok := types[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not defined for the category", attr.ErrInvalidFilter, f.Name)
+		}
+
+		value, err := f.Typed(attrType)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, attributeCondition(f, value))
+	}
+
+	return func(g *good) bool {
+		for _, condition := range conditions {
+			matched := condition(g.attributes)
+			if !matched && collapseVariants {
+				for _, v := range s.liveVariants(g.id) {
+					if condition(v.attributes) {
+						matched = true
+						break
+					}
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// attributeCondition matches the way the postgres conditions do: equality is containment,
+// so a missing attribute is never equal and always not equal, and comparisons only hold
+// for numbers.
+func attributeCondition(f attr.Filter, value any) func(map[string]any) bool {
+	return func(attributes map[string]any) bool {
+		current, ok := attributes[f.Name]
+
+		switch f.Op {
+		case attr.OpEq:
+			return ok && reflect.DeepEqual(current, value)
+		case attr.OpNe:
+			return !ok || !reflect.DeepEqual(current, value)
+		}
+
+		n, ok := current.(float64)
+		if !ok {
+			return false
+		}
+		bound := value.(float64)
+
+		switch f.Op {
+		case attr.OpGt:
+			return n > bound
+		case attr.OpGte:
+			return n >= bound
+		case attr.OpLt:
+			return n < bound
+		case attr.OpLte:
+			return n <= bound
+		}
+
+		return false
+	}
+}
+
+// liveVariants returns the variants of the good that are not in the trash, ordered by id.
+func (s *Storage) liveVariants(parentId int) []*good {
+	var variants []*good
+	for _, g := range s.goods {
+		if g.parentId != nil && *g.parentId == parentId && g.deletedAt == nil {
+			variants = append(variants, g)
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool { return variants[i].id < variants[j].id })
+	return variants
+}
+
+func (s *Storage) sortedGoods() []*good {
+	goods := make([]*good, 0, len(s.goods))
+	for _, g := range s.goods {
+		goods = append(goods, g)
+	}
+	sort.Slice(goods, func(i, j int) bool { return goods[i].id < goods[j].id })
+	return goods
+}
+
+func (s *Storage) sortedCategories() []*category {
+	categories := make([]*category, 0, len(s.categories))
+	for _, c := range s.categories {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].id < categories[j].id })
+	return categories
+}
+
+// normalizeAttributes copies the values through JSON, the way they round-trip through a jsonb
+// column: numbers become float64 and anything JSON cannot hold is an error.
+func normalizeAttributes(values map[string]any) (map[string]any, error) {
+	normalized := map[string]any{}
+	if len(values) == 0 {
+		return normalized, nil
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return nil, err
+	}
+
+	return normalized, nil
+}
+
+// cloneAttributes copies stored values for a caller. They went through normalizeAttributes
+// and are scalars, so a shallow copy shares nothing with the storage.
+func cloneAttributes(values map[string]any) map[string]any {
+	clone := make(map[string]any, len(values))
+	for k, v := range values {
+		clone[k] = v
+	}
+	return clone
+}
+
+func copyInt(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	i := *v
+	return &i
+}
+
+func copyFloat(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := *v
+	return &f
+}
+
+// priceOf rounds to cents like the NUMERIC(12, 2) column of the postgres storage.
+func priceOf(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	p := math.Round(*v*100) / 100
+	return &p
+}
+
+func sameFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"inHouseAd/internal/storage/storagetest"
+	"math"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return New()
+	})
+}
+
+// TestRevisionEncodeError checks that a change whose revision cannot be encoded fails instead of
+// taking the process down.
+func TestRevisionEncodeError(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	// The default category made by the first migration has id 1.
+	id, _, err := s.AddGood(ctx, "Phone", 1, nil, 1)
+	if err != nil {
+		t.Fatalf("AddGood: %v", err)
+	}
+
+	nan := math.NaN()
+	_, err = s.UpdateOffer(ctx, id, nil, &nan, nil, 1, 1)
+
+	var unsupported *json.UnsupportedValueError
+	if !errors.As(err, &unsupported) {
+		t.Errorf("UpdateOffer with a NaN price: got %v, want an encoding error", err)
+	}
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/storage"
+	"time"
+)
+
+// revisionRecord keeps the snapshot encoded, so that a revision cannot change once written.
+type revisionRecord struct {
+	rev       int
+	action    string
+	snapshot  []byte
+	actorUid  *int
+	sourceRev *int
+	createdAt time.Time
+}
+
+// writeRevision appends a snapshot of the good's current state. It must be called under the
+// write lock of the change itself so that history never disagrees with the data.
+// actorUid 0 means the change was made by the system (e.g. the periodic fetch).
+func (s *Storage) writeRevision(goodId int, action string, actorUid int, sourceRev *int) (int, error) {
+	encoded, err := json.Marshal(s.snapshot(goodId))
+	if err != nil {
+		return 0, fmt.Errorf("snapshot of good %d: %w", goodId, err)
+	}
+
+	r := revisionRecord{
+		rev:       len(s.revisions[goodId]) + 1,
+		action:    action,
+		snapshot:  encoded,
+		sourceRev: copyInt(sourceRev),
+		createdAt: now(),
+	}
+	if actorUid != 0 {
+		r.actorUid = &actorUid
+	}
+
+	s.revisions[goodId] = append(s.revisions[goodId], r)
+
+	return r.rev, nil
+}
+
+func (s *Storage) snapshot(goodId int) entity.GoodSnapshot {
+	g := s.goods[goodId]
+
+	return entity.GoodSnapshot{
+		GoodName:    g.name,
+		ParentId:    copyInt(g.parentId),
+		Sku:         g.sku,
+		Price:       copyFloat(g.price),
+		Stock:       g.stock,
+		Attributes:  cloneAttributes(g.attributes),
+		CategoryIds: sortedIds(s.links[goodId]),
+		Deleted:     g.deletedAt != nil,
+	}
+}
+
+// GetGoodHistory returns every revision of the good, oldest first, each with the diff
+// against the previous one. Goods in the trash keep their history.
+func (s *Storage) GetGoodHistory(ctx context.Context, goodId int) ([]entity.GoodRevision, error) {
+	const op = "storage.memory.GetGoodHistory"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.goods[goodId]; !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	history := []entity.GoodRevision{}
+	for _, r := range s.revisions[goodId] {
+		h := entity.GoodRevision{
+			Rev:       r.rev,
+			Action:    r.action,
+			ActorUid:  copyInt(r.actorUid),
+			SourceRev: copyInt(r.sourceRev),
+			CreatedAt: r.createdAt,
+		}
+		if err := json.Unmarshal(r.snapshot, &h.Snapshot); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		history = append(history, h)
+	}
+
+	revision.History(history)
+
+	return history, nil
+}
+
+// RevertGood brings the good's name, offer, attributes and category links back to the state
+// recorded in rev and records that as a new revision. A good in the trash is restored by the revert;
+// its variants are left alone. Attributes are restored as they were, without validating them
+// against the current schemas.
+func (s *Storage) RevertGood(ctx context.Context, goodId, rev, actorUid int) (entity.GoodRevertResponse, error) {
+	const op = "storage.memory.RevertGood"
+
+	if err := ctx.Err(); err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.goods[goodId]
+	if !ok {
+		return entity.GoodRevertResponse{}, storage.ErrNotFound
+	}
+
+	revisions := s.revisions[goodId]
+	if rev < 1 || rev > len(revisions) {
+		return entity.GoodRevertResponse{}, storage.ErrNotFound
+	}
+
+	var target entity.GoodSnapshot
+	if err := json.Unmarshal(revisions[rev-1].snapshot, &target); err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if target.Deleted {
+		return entity.GoodRevertResponse{}, storage.ErrRevertDeleted
+	}
+
+	if g.deletedAt != nil && g.parentId != nil && s.goods[*g.parentId].deletedAt != nil {
+		return entity.GoodRevertResponse{}, storage.ErrParentDeleted
+	}
+
+	if s.skuTaken(target.Sku, goodId) {
+		return entity.GoodRevertResponse{}, storage.ErrSkuTaken
+	}
+
+	attributes, err := normalizeAttributes(target.Attributes)
+	if err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	g.name = target.GoodName
+	g.sku = target.Sku
+	g.price = priceOf(target.Price)
+	g.stock = target.Stock
+	g.attributes = attributes
+	g.deletedAt = nil
+	g.version++
+
+	// Categories purged since the revision was taken cannot be linked again and are skipped.
+	links := make(map[int]bool, len(target.CategoryIds))
+	for _, id := range target.CategoryIds {
+		if _, ok := s.categories[id]; ok {
+			links[id] = true
+		}
+	}
+	s.links[goodId] = links
+
+	newRev, err := s.writeRevision(goodId, revision.ActionRevert, actorUid, &rev)
+	if err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entity.GoodRevertResponse{GoodId: goodId, Rev: newRev, Good: s.snapshot(goodId)}, nil
+}
@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/storage"
+	"reflect"
+	"strconv"
+)
+
+// AddSourceGoods stores goods fetched from an external source in the category, keyed by
+// the source and their ExternalId so that fetching a good again updates it. A bad good is
+// reported and skipped. Attributes without a schema in the category are dropped.
+func (s *Storage) AddSourceGoods(ctx context.Context, source string, categoryId int, goods []entity.SourceGood) (entity.ImportBatchResult, error) {
+	const op = "storage.memory.AddSourceGoods"
+
+	if err := ctx.Err(); err != nil {
+		return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.liveCategory(categoryId) == nil {
+		return entity.ImportBatchResult{}, storage.ErrNotFound
+	}
+
+	result := entity.ImportBatchResult{Errors: []entity.ImportRowError{}}
+
+	for _, g := range goods {
+		if g.Err != "" {
+			result.Errors = append(result.Errors, entity.ImportRowError{Row: g.Position, Message: g.Err})
+			continue
+		}
+
+		msg, err := s.addSourceGood(source, categoryId, g)
+		if err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: good %d: %w", op, g.Position, err)
+		}
+		if msg != "" {
+			result.Errors = append(result.Errors, entity.ImportRowError{Row: g.Position, Message: msg})
+			continue
+		}
+		result.Succeeded++
+	}
+
+	return result, nil
+}
+
+// addSourceGood inserts the good or, when the source has stored its key before, updates it.
+// Attributes are merged and a missing price or stock keeps the stored one. Goods moved to the
+// trash stay there: the source does not bring them back on every fetch.
+func (s *Storage) addSourceGood(source string, categoryId int, g entity.SourceGood) (string, error) {
+	existing := s.externalGood(source, g.ExternalId)
+	if existing != nil && existing.deletedAt != nil {
+		return "", nil
+	}
+
+	var current map[string]any
+	if existing != nil {
+		current = existing.attributes
+	}
+
+	values, msg, err := s.externalAttributes([]int{categoryId}, current, g.Attributes)
+	if err != nil || msg != "" {
+		return msg, err
+	}
+
+	var goodId int
+	if existing != nil {
+		goodId = existing.id
+	}
+	if s.skuTaken(g.Sku, goodId) {
+		return "sku " + strconv.Quote(g.Sku) + " already taken", nil
+	}
+
+	changed := false
+
+	if existing == nil {
+		var stock int
+		if g.Stock != nil {
+			stock = *g.Stock
+		}
+		existing = s.insertGood(&good{
+			name:       g.GoodName,
+			sku:        g.Sku,
+			price:      priceOf(g.Price),
+			stock:      stock,
+			attributes: values,
+			source:     source,
+			externalId: g.ExternalId,
+		})
+		changed = true
+	} else {
+		price := existing.price
+		if g.Price != nil {
+			price = priceOf(g.Price)
+		}
+		stock := existing.stock
+		if g.Stock != nil {
+			stock = *g.Stock
+		}
+		merged := mergeAttributes(existing.attributes, values)
+
+		if existing.name != g.GoodName || existing.sku != g.Sku || !sameFloat(existing.price, price) || existing.stock != stock || !reflect.DeepEqual(existing.attributes, merged) {
+			existing.name = g.GoodName
+			existing.sku = g.Sku
+			existing.price = price
+			existing.stock = stock
+			existing.attributes = merged
+			existing.version++
+			changed = true
+		}
+	}
+
+	linked := !s.links[existing.id][categoryId]
+	if linked {
+		s.links[existing.id][categoryId] = true
+		if !changed {
+			existing.version++
+		}
+	}
+
+	if changed || linked {
+		if _, err := s.writeRevision(existing.id, revision.ActionImport, 0, nil); err != nil {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
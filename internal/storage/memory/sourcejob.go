@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"time"
+)
+
+// GetSourceJobControls returns the admin state of every source job changed at least once.
+func (s *Storage) GetSourceJobControls(ctx context.Context) (map[string]entity.SourceJobControl, error) {
+	const op = "storage.memory.GetSourceJobControls"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	controls := make(map[string]entity.SourceJobControl, len(s.sourceJobs))
+	for source, c := range s.sourceJobs {
+		controls[source] = c
+	}
+
+	return controls, nil
+}
+
+func (s *Storage) GetSourceJobControl(ctx context.Context, source string) (entity.SourceJobControl, error) {
+	const op = "storage.memory.GetSourceJobControl"
+
+	if err := ctx.Err(); err != nil {
+		return entity.SourceJobControl{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sourceJobs[source], nil
+}
+
+func (s *Storage) SetSourceJobPaused(ctx context.Context, source string, paused bool) error {
+	const op = "storage.memory.SetSourceJobPaused"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.sourceJobs[source]
+	c.Paused = paused
+	s.sourceJobs[source] = c
+
+	return nil
+}
+
+// SetSourceBreaker saves the circuit breaker of the source. A nil openUntil means the breaker
+// is closed.
+func (s *Storage) SetSourceBreaker(ctx context.Context, source string, failures int, openUntil *time.Time) error {
+	const op = "storage.memory.SetSourceBreaker"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.sourceJobs[source]
+	c.Failures = failures
+	c.OpenUntil = nil
+	if openUntil != nil {
+		until := *openUntil
+		c.OpenUntil = &until
+	}
+	s.sourceJobs[source] = c
+
+	return nil
+}
+
+// RequestSourceJobRun asks for a run of the source outside its schedule. The request is
+// stored rather than executed, like on the other backends.
+func (s *Storage) RequestSourceJobRun(ctx context.Context, source string) error {
+	const op = "storage.memory.RequestSourceJobRun"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.sourceJobs[source]
+	c.RunRequested = true
+	s.sourceJobs[source] = c
+
+	return nil
+}
+
+// TakeSourceJobRun clears a pending run request and reports whether there was one.
+func (s *Storage) TakeSourceJobRun(ctx context.Context, source string) (bool, error) {
+	const op = "storage.memory.TakeSourceJobRun"
+
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.sourceJobs[source]
+	if !ok || !c.RunRequested {
+		return false, nil
+	}
+
+	c.RunRequested = false
+	s.sourceJobs[source] = c
+
+	return true, nil
+}
@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/storage"
+	"sort"
+	"time"
+)
+
+func (s *Storage) GetTrash(ctx context.Context) (entity.Trash, error) {
+	const op = "storage.memory.GetTrash"
+
+	if err := ctx.Err(); err != nil {
+		return entity.Trash{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	trash := entity.Trash{
+		Goods:      []entity.TrashGood{},
+		Categories: []entity.TrashCategory{},
+	}
+
+	for _, g := range s.sortedGoods() {
+		if g.deletedAt != nil {
+			trash.Goods = append(trash.Goods, entity.TrashGood{
+				GoodId:    g.id,
+				GoodName:  g.name,
+				ParentId:  copyInt(g.parentId),
+				DeletedAt: *g.deletedAt,
+			})
+		}
+	}
+	sort.SliceStable(trash.Goods, func(i, j int) bool { return trash.Goods[i].DeletedAt.After(trash.Goods[j].DeletedAt) })
+
+	for _, c := range s.sortedCategories() {
+		if c.deletedAt != nil {
+			trash.Categories = append(trash.Categories, entity.TrashCategory{
+				CategoryId:   c.id,
+				CategoryName: c.name,
+				DeletedAt:    *c.deletedAt,
+			})
+		}
+	}
+	sort.SliceStable(trash.Categories, func(i, j int) bool {
+		return trash.Categories[i].DeletedAt.After(trash.Categories[j].DeletedAt)
+	})
+
+	return trash, nil
+}
+
+// RestoreGood takes the good out of the trash together with the variants that were deleted with it.
+// Category links are never removed by a soft delete, so they come back as they were.
+func (s *Storage) RestoreGood(ctx context.Context, id, actorUid int) error {
+	const op = "storage.memory.RestoreGood"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.goods[id]
+	if !ok || g.deletedAt == nil {
+		return storage.ErrNotFound
+	}
+
+	if g.parentId != nil && s.goods[*g.parentId].deletedAt != nil {
+		return storage.ErrParentDeleted
+	}
+
+	deletedAt := *g.deletedAt
+
+	for _, goodId := range s.familyIds(id) {
+		member := s.goods[goodId]
+		if member.deletedAt == nil || !member.deletedAt.Equal(deletedAt) {
+			continue
+		}
+		member.deletedAt = nil
+		member.version++
+		if _, err := s.writeRevision(goodId, revision.ActionRestore, actorUid, nil); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) RestoreCategory(ctx context.Context, id int) error {
+	const op = "storage.memory.RestoreCategory"
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.categories[id]
+	if !ok || c.deletedAt == nil {
+		return storage.ErrNotFound
+	}
+
+	c.deletedAt = nil
+	c.version++
+
+	return nil
+}
+
+// PurgeTrash hard-deletes everything that has been in the trash for longer than retention,
+// with what the postgres foreign keys would take along: variants, images, revisions,
+// category links and attributes. The blob keys of the purged images are returned so that
+// the caller can remove the files.
+func (s *Storage) PurgeTrash(ctx context.Context, retention time.Duration) (entity.PurgeResult, error) {
+	const op = "storage.memory.PurgeTrash"
+
+	if err := ctx.Err(); err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result entity.PurgeResult
+
+	cutoff := now().Add(-retention)
+	expired := func(t *time.Time) bool { return t != nil && t.Before(cutoff) }
+
+	purged := make(map[int]bool)
+	for _, g := range s.goods {
+		if expired(g.deletedAt) {
+			purged[g.id] = true
+			result.Goods++
+		}
+	}
+	// Variants of a purged parent go too, live or not, like through ON DELETE CASCADE.
+	for _, g := range s.goods {
+		if g.parentId != nil && purged[*g.parentId] {
+			purged[g.id] = true
+		}
+	}
+
+	for _, img := range s.images {
+		if !purged[img.GoodId] {
+			continue
+		}
+		result.BlobKeys = append(result.BlobKeys, img.Key)
+		for _, key := range img.ThumbnailKeys {
+			result.BlobKeys = append(result.BlobKeys, key)
+		}
+		delete(s.images, img.ImageId)
+	}
+
+	for id := range purged {
+		delete(s.goods, id)
+		delete(s.links, id)
+		delete(s.revisions, id)
+	}
+
+	for _, c := range s.categories {
+		if !expired(c.deletedAt) {
+			continue
+		}
+		delete(s.categories, c.id)
+		result.Categories++
+
+		for _, links := range s.links {
+			delete(links, c.id)
+		}
+		for _, a := range s.attributes {
+			if a.CategoryId == c.id {
+				delete(s.attributes, a.AttributeId)
+			}
+		}
+	}
+	// Children of a purged category become roots, like through ON DELETE SET NULL.
+	for _, c := range s.categories {
+		if c.parentId != nil {
+			if _, ok := s.categories[*c.parentId]; !ok {
+				c.parentId = nil
+				c.version++
+			}
+		}
+	}
+
+	return result, nil
+}
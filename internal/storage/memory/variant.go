@@ -0,0 +1,206 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/lib/variant"
+	"inHouseAd/internal/storage"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+func (s *Storage) GenerateVariants(ctx context.Context, parentId int, axes []entity.VariantAxis, skuPrefix string, price *float64, stock, actorUid int) ([]entity.GoodVariant, int, error) {
+	const op = "storage.memory.GenerateVariants"
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parent := s.liveGood(parentId)
+	if parent == nil {
+		return nil, 0, storage.ErrNotFound
+	}
+	if parent.parentId != nil {
+		return nil, 0, storage.ErrNotParent
+	}
+
+	names := variant.Names(axes)
+
+	if len(parent.variantAxes) != 0 && !reflect.DeepEqual(parent.variantAxes, names) {
+		return nil, 0, storage.ErrAxesMismatch
+	}
+
+	schemas := s.goodSchemas(parentId)
+	existing := s.variantKeys(parentId, names)
+
+	if skuPrefix == "" {
+		skuPrefix = parent.sku
+	}
+	if skuPrefix == "" {
+		skuPrefix = "G" + strconv.Itoa(parentId)
+	}
+
+	// Everything is checked before the first variant is stored, so a failure leaves no trace.
+	var (
+		pending []*good
+		skipped int
+	)
+	skus := make(map[string]bool)
+
+	for _, combination := range variant.Combinations(axes) {
+		if existing[variant.Key(names, combination)] {
+			skipped++
+			continue
+		}
+
+		attributes := cloneAttributes(parent.attributes)
+		for k, v := range combination {
+			attributes[k] = v
+		}
+
+		if err := attr.Validate(schemas, attributes); err != nil {
+			return nil, 0, err
+		}
+
+		sku := variant.Sku(skuPrefix, names, combination)
+		if skus[sku] || s.skuTaken(sku, 0) {
+			return nil, 0, storage.ErrSkuTaken
+		}
+		skus[sku] = true
+
+		pending = append(pending, &good{
+			name:       variant.Name(parent.name, names, combination),
+			parentId:   &parentId,
+			sku:        sku,
+			price:      price,
+			stock:      stock,
+			attributes: attributes,
+		})
+	}
+
+	parent.variantAxes = names
+	parent.version++
+
+	var created []entity.GoodVariant
+
+	for _, v := range pending {
+		v.price = priceOf(v.price)
+		s.insertGood(v)
+		for id := range s.links[parentId] {
+			s.links[v.id][id] = true
+		}
+
+		if _, err := s.writeRevision(v.id, revision.ActionCreate, actorUid, nil); err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		created = append(created, variantOf(v))
+	}
+
+	return created, skipped, nil
+}
+
+// variantKeys returns the axis values of every variant of the parent, including the ones
+// in the trash, so that generating again does not recreate them.
+func (s *Storage) variantKeys(parentId int, names []string) map[string]bool {
+	keys := make(map[string]bool)
+
+	for _, g := range s.goods {
+		if g.parentId == nil || *g.parentId != parentId {
+			continue
+		}
+
+		combination := make(map[string]string, len(names))
+		for _, name := range names {
+			combination[name] = fmt.Sprint(g.attributes[name])
+		}
+		keys[variant.Key(names, combination)] = true
+	}
+
+	return keys
+}
+
+func (s *Storage) GetVariantList(ctx context.Context, parentId int) ([]entity.GoodVariant, error) {
+	const op = "storage.memory.GetVariantList"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var response []entity.GoodVariant
+	for _, v := range s.liveVariants(parentId) {
+		response = append(response, variantOf(v))
+	}
+
+	return response, nil
+}
+
+func (s *Storage) UpdateOffer(ctx context.Context, goodId int, sku *string, price *float64, stock *int, version, actorUid int) (entity.GoodVariant, error) {
+	const op = "storage.memory.UpdateOffer"
+
+	if err := ctx.Err(); err != nil {
+		return entity.GoodVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.checkVersion(goodId, version)
+	if err != nil {
+		return entity.GoodVariant{}, err
+	}
+
+	if sku != nil && s.skuTaken(*sku, goodId) {
+		return entity.GoodVariant{}, storage.ErrSkuTaken
+	}
+
+	if sku != nil {
+		g.sku = *sku
+	}
+	if price != nil {
+		g.price = priceOf(price)
+	}
+	if stock != nil {
+		g.stock = *stock
+	}
+	g.version++
+
+	if _, err := s.writeRevision(goodId, revision.ActionUpdate, actorUid, nil); err != nil {
+		return entity.GoodVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return variantOf(g), nil
+}
+
+func variantOf(g *good) entity.GoodVariant {
+	return entity.GoodVariant{
+		GoodId:     g.id,
+		ParentId:   copyInt(g.parentId),
+		GoodName:   g.name,
+		Sku:        g.sku,
+		Price:      copyFloat(g.price),
+		Stock:      g.stock,
+		Attributes: cloneAttributes(g.attributes),
+		Version:    g.version,
+	}
+}
+
+// sortedIds returns the keys of a set in ascending order.
+func sortedIds(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,307 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/revision"
+	"strconv"
+)
+
+// attributeCondition builds a WHERE condition for a single attribute filter.
+// Equality goes through jsonb containment so that the GIN index on good.attributes is used.
+func attributeCondition(f attr.Filter, attrType string, argc int, alias string) (string, []any, error) {
+	value, err := f.Typed(attrType)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch f.Op {
+	case attr.OpEq, attr.OpNe:
+		contains, err := json.Marshal(map[string]any{f.Name: value})
+		if err != nil {
+			return "", nil, err
+		}
+		condition := alias + ".attributes @> $" + strconv.Itoa(argc+1) + "::jsonb"
+		if f.Op == attr.OpNe {
+			condition = "NOT " + condition
+		}
+		return condition, []any{string(contains)}, nil
+	}
+
+	name := "$" + strconv.Itoa(argc+1) + "::text"
+	condition := fmt.Sprintf(
+		"(jsonb_typeof(%[1]s.attributes->%[2]s) = 'number' AND (%[1]s.attributes->>%[2]s)::numeric %[3]s $%[4]d)",
+		alias, name, f.Op, argc+2,
+	)
+
+	return condition, []any{f.Name, value}, nil
+}
+
+func (s *Storage) CreateAttribute(ctx context.Context, categoryId int, a entity.CategoryAttribute) (int, error) {
+	const op = "storage.postgres.CreateAttribute"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var id int
+
+	enumValues, err := json.Marshal(a.EnumValues)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if a.EnumValues == nil {
+		enumValues = []byte("[]")
+	}
+
+	query := `
+		INSERT INTO category_attribute (category_id, name, attr_type, unit, enum_values, required) 
+		VALUES ($1, $2, $3, $4, $5, $6) 
+		RETURNING id;
+		`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, categoryId, a.Name, a.Type, a.Unit, string(enumValues), a.Required).Scan(&id)
+	if err != nil {
+		switch pgCode(err) {
+		case "23505":
+			return 0, ErrAttributeExists
+		case "23503":
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkCategoryGoods(ctx, tx, categoryId, a); err != nil {
+		if errors.Is(err, attr.ErrInvalidValue) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// checkCategoryGoods checks the values the goods of the category have for a new attribute,
+// so that a required attribute is not added while some of them lack it.
+func checkCategoryGoods(ctx context.Context, tx *sql.Tx, categoryId int, a entity.CategoryAttribute) error {
+	query := `
+		SELECT g.id, g.attributes -> $2::text
+		FROM good AS g
+		JOIN good_category AS gc ON gc.good_id = g.id
+		WHERE gc.category_id = $1 AND g.deleted_at IS NULL;
+		`
+
+	rows, err := tx.QueryContext(ctx, query, categoryId, a.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id      int
+			encoded []byte
+		)
+		if err := rows.Scan(&id, &encoded); err != nil {
+			return err
+		}
+
+		values := make(map[string]any)
+		if encoded != nil {
+			var value any
+			if err := json.Unmarshal(encoded, &value); err != nil {
+				return err
+			}
+			values[a.Name] = value
+		}
+
+		if err := attr.Validate([]entity.CategoryAttribute{a}, values); err != nil {
+			return fmt.Errorf("good %d: %w", id, err)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Storage) GetAttributeList(ctx context.Context, categoryId int) ([]entity.CategoryAttribute, error) {
+	const op = "storage.postgres.GetAttributeList"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	db := s.reader(ctx)
+
+	query := `
+		SELECT id, category_id, name, attr_type, unit, enum_values, required
+		FROM category_attribute
+		WHERE category_id = $1
+		ORDER BY id;
+		`
+
+	response, err := queryAttributes(ctx, db, query, categoryId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, nil
+}
+
+func (s *Storage) DeleteAttribute(ctx context.Context, id int) error {
+	const op = "storage.postgres.DeleteAttribute"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		DELETE FROM category_attribute 
+		WHERE id = $1;
+		`
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SetGoodAttributes(ctx context.Context, goodId int, values map[string]any, version, actorUid int) (map[string]any, error) {
+	const op = "storage.postgres.SetGoodAttributes"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkVersion(ctx, tx, goodId, version); err != nil {
+		if err == ErrNotFound || err == ErrVersionMismatch {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	schemas, err := goodSchemas(ctx, tx, goodId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := attr.Validate(schemas, values); err != nil {
+		return nil, err
+	}
+
+	if values == nil {
+		values = map[string]any{}
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `UPDATE good SET attributes = $1 WHERE id = $2;`
+	if _, err := tx.ExecContext(ctx, query, string(encoded), goodId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := writeRevision(ctx, tx, goodId, revision.ActionUpdate, actorUid, nil); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return values, nil
+}
+
+// goodSchemas returns the attributes of the categories the good belongs to.
+func goodSchemas(ctx context.Context, q querier, goodId int) ([]entity.CategoryAttribute, error) {
+	query := `
+		SELECT ca.id, ca.category_id, ca.name, ca.attr_type, ca.unit, ca.enum_values, ca.required
+		FROM category_attribute AS ca
+		JOIN good_category AS gc ON gc.category_id = ca.category_id
+		JOIN category AS c ON c.id = ca.category_id
+		WHERE gc.good_id = $1 AND c.deleted_at IS NULL;
+		`
+	return queryAttributes(ctx, q, query, goodId)
+}
+
+// validateGood checks the stored attribute values of the good against the attributes of its
+// categories, so that a good linked to a category has the values the category requires.
+func validateGood(ctx context.Context, tx *sql.Tx, goodId int) error {
+	schemas, err := goodSchemas(ctx, tx, goodId)
+	if err != nil {
+		return err
+	}
+
+	var encoded []byte
+	if err := tx.QueryRowContext(ctx, `SELECT attributes FROM good WHERE id = $1;`, goodId).Scan(&encoded); err != nil {
+		return err
+	}
+
+	values := make(map[string]any)
+	if err := json.Unmarshal(encoded, &values); err != nil {
+		return err
+	}
+
+	return attr.Validate(schemas, values)
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func queryAttributes(ctx context.Context, q querier, query string, args ...any) ([]entity.CategoryAttribute, error) {
+	var response []entity.CategoryAttribute
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			a          entity.CategoryAttribute
+			enumValues []byte
+		)
+		if err := rows.Scan(&a.AttributeId, &a.CategoryId, &a.Name, &a.Type, &a.Unit, &enumValues, &a.Required); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(enumValues, &a.EnumValues); err != nil {
+			return nil, err
+		}
+		response = append(response, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
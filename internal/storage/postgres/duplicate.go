@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"strconv"
+)
+
+// GetNearDuplicates pairs live goods whose names have a trigram similarity of at least
+// threshold, most similar first. Variants are left out: they share the name of their good.
+// Trigrams ignore case and punctuation, so names differing only in those score 1.
+func (s *Storage) GetNearDuplicates(ctx context.Context, threshold float64, limit int) ([]entity.NearDuplicate, error) {
+	const op = "storage.postgres.GetNearDuplicates"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// The % operator can use the trigram index, but only with the threshold of the session.
+	query := `SELECT set_config('pg_trgm.similarity_threshold', $1, true);`
+	if _, err := tx.ExecContext(ctx, query, strconv.FormatFloat(threshold, 'f', -1, 64)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+		SELECT a.id, a.good_name, b.id, b.good_name, similarity(a.good_name, b.good_name) AS score
+		FROM good AS a
+		JOIN good AS b ON b.id > a.id AND b.good_name % a.good_name
+		WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+		  AND a.parent_id IS NULL AND b.parent_id IS NULL
+		ORDER BY score DESC, a.id, b.id
+		LIMIT $1;
+		`
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	duplicates := []entity.NearDuplicate{}
+	for rows.Next() {
+		var d entity.NearDuplicate
+		if err := rows.Scan(&d.GoodId, &d.GoodName, &d.DuplicateId, &d.DuplicateName, &d.Similarity); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		duplicates = append(duplicates, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return duplicates, nil
+}
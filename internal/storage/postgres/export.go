@@ -0,0 +1,249 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/exporter"
+	"time"
+)
+
+// exportWhere selects the goods of an export the same way GetGoodList does, except that
+// a zero categoryId means every category.
+func (s *Storage) exportWhere(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) (string, []any, error) {
+	where := " WHERE g.deleted_at IS NULL"
+	var args []any
+
+	if categoryId != 0 {
+		args = append(args, categoryId)
+		where += ` AND EXISTS (
+			SELECT 1 FROM good_category AS gc JOIN category AS c ON c.id = gc.category_id
+			WHERE gc.good_id = g.id AND gc.category_id = $1 AND c.deleted_at IS NULL)`
+	} else if len(filters) != 0 {
+		return "", nil, fmt.Errorf("%w: filters require a category", attr.ErrInvalidFilter)
+	}
+
+	if collapseVariants {
+		where += " AND g.parent_id IS NULL"
+	}
+
+	conditions, args, err := s.filterConditions(ctx, categoryId, filters, collapseVariants, args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return where + conditions, args, nil
+}
+
+// GetExportAttributeNames lists the attribute names used by the exported goods, so that
+// tabular formats can write their header before streaming the rows.
+func (s *Storage) GetExportAttributeNames(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]string, error) {
+	const op = "storage.postgres.GetExportAttributeNames"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	db := s.reader(ctx)
+
+	where, args, err := s.exportWhere(ctx, categoryId, filters, collapseVariants)
+	if err != nil {
+		if errors.Is(err, attr.ErrInvalidFilter) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `SELECT DISTINCT jsonb_object_keys(g.attributes) AS name FROM good AS g` + where + ` ORDER BY name;`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return names, nil
+}
+
+// ExportGoods streams the selected goods to fn one at a time, ordered by id,
+// without holding the result in memory.
+func (s *Storage) ExportGoods(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool, fn func(entity.ExportGood) error) error {
+	const op = "storage.postgres.ExportGoods"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	db := s.reader(ctx)
+
+	where, args, err := s.exportWhere(ctx, categoryId, filters, collapseVariants)
+	if err != nil {
+		if errors.Is(err, attr.ErrInvalidFilter) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		SELECT g.id, g.good_name, g.parent_id, g.sku, g.price, g.stock, g.attributes,
+		       COALESCE((
+		           SELECT jsonb_agg(c.category_name ORDER BY c.id)
+		           FROM good_category AS gc JOIN category AS c ON c.id = gc.category_id
+		           WHERE gc.good_id = g.id AND c.deleted_at IS NULL
+		       ), '[]')
+		FROM good AS g` + where + ` ORDER BY g.id;`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			g          entity.ExportGood
+			parentId   sql.NullInt64
+			sku        sql.NullString
+			price      sql.NullFloat64
+			attributes []byte
+			categories []byte
+		)
+		if err := rows.Scan(&g.GoodId, &g.GoodName, &parentId, &sku, &price, &g.Stock, &attributes, &categories); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal(attributes, &g.Attributes); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal(categories, &g.Categories); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		g.ParentId = nullInt(parentId)
+		g.Sku = sku.String
+		g.Price = nullFloat(price)
+
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateExportJob(ctx context.Context, job entity.ExportJob) (int, error) {
+	const op = "storage.postgres.CreateExportJob"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var id int
+
+	query, err := json.Marshal(job.Query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.db.QueryRowContext(ctx,
+		`INSERT INTO export_job (uid, status, format, query) VALUES ($1, $2, $3, $4) RETURNING id;`,
+		job.Uid, exporter.StatusPending, job.Format, string(query),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetExportJob(ctx context.Context, id int) (entity.ExportJob, error) {
+	const op = "storage.postgres.GetExportJob"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var (
+		job        entity.ExportJob
+		query      []byte
+		finishedAt sql.NullTime
+	)
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, uid, status, format, query, blob_key, row_count, error, created_at, finished_at FROM export_job WHERE id = $1;`, id,
+	).Scan(&job.ExportId, &job.Uid, &job.Status, &job.Format, &query, &job.BlobKey, &job.Rows, &job.Error, &job.CreatedAt, &finishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return entity.ExportJob{}, ErrNotFound
+		}
+		return entity.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := json.Unmarshal(query, &job.Query); err != nil {
+		return entity.ExportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return job, nil
+}
+
+// UnfinishedExportJobs lists jobs that were queued or interrupted; they are run again from the start.
+func (s *Storage) UnfinishedExportJobs(ctx context.Context) ([]int, error) {
+	const op = "storage.postgres.UnfinishedExportJobs"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	ids, err := queryIds(ctx, s.db, `SELECT id FROM export_job WHERE status IN ($1, $2) ORDER BY id;`, exporter.StatusPending, exporter.StatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
+
+func (s *Storage) StartExportJob(ctx context.Context, id int) error {
+	const op = "storage.postgres.StartExportJob"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, `UPDATE export_job SET status = $2 WHERE id = $1;`, id, exporter.StatusRunning); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) FinishExportJob(ctx context.Context, id int, status, blobKey string, rows int, jobError string) error {
+	const op = "storage.postgres.FinishExportJob"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		UPDATE export_job
+		SET status = $2, blob_key = $3, row_count = $4, error = $5, finished_at = $6
+		WHERE id = $1;
+		`
+	if _, err := s.db.ExecContext(ctx, query, id, status, blobKey, rows, jobError, time.Now().UTC()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
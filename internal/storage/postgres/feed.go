@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+)
+
+// FeedGoods streams the live goods to fn ordered by id.
+func (s *Storage) FeedGoods(ctx context.Context, fn func(entity.FeedGood) error) error {
+	const op = "storage.postgres.FeedGoods"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	db := s.reader(ctx)
+
+	query := `
+		SELECT g.id, g.good_name, g.parent_id, g.sku, g.price, g.stock, g.attributes,
+		       COALESCE((
+		           SELECT jsonb_agg(c.id ORDER BY c.id)
+		           FROM good_category AS gc JOIN category AS c ON c.id = gc.category_id
+		           WHERE gc.good_id = g.id AND c.deleted_at IS NULL
+		       ), '[]'),
+		       gi.blob_key,
+		       EXISTS (SELECT 1 FROM good AS v WHERE v.parent_id = g.id AND v.deleted_at IS NULL)
+		FROM good AS g
+		LEFT JOIN good_image AS gi
+		ON gi.good_id = g.id AND gi.is_primary
+		WHERE g.deleted_at IS NULL
+		ORDER BY g.id;
+		`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			g          entity.FeedGood
+			parentId   sql.NullInt64
+			sku        sql.NullString
+			price      sql.NullFloat64
+			attributes []byte
+			categories []byte
+			imageKey   sql.NullString
+		)
+		err := rows.Scan(&g.GoodId, &g.GoodName, &parentId, &sku, &price, &g.Stock, &attributes, &categories, &imageKey, &g.HasVariants)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal(attributes, &g.Attributes); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal(categories, &g.CategoryIds); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		g.ParentId = nullInt(parentId)
+		g.Sku = sku.String
+		g.Price = nullFloat(price)
+		g.ImageKey = imageKey.String
+
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CatalogFingerprint changes whenever a good or category is created, modified or purged:
+// every update bumps a row version, so the sums of versions move along with the row counts.
+func (s *Storage) CatalogFingerprint(ctx context.Context) (string, error) {
+	const op = "storage.postgres.CatalogFingerprint"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	db := s.reader(ctx)
+
+	var goods, goodVersions, goodMax, categories, categoryVersions, categoryMax int64
+
+	query := `
+		SELECT
+		    (SELECT count(*) FROM good), (SELECT COALESCE(sum(version), 0) FROM good), (SELECT COALESCE(max(id), 0) FROM good),
+		    (SELECT count(*) FROM category), (SELECT COALESCE(sum(version), 0) FROM category), (SELECT COALESCE(max(id), 0) FROM category);
+		`
+	err := db.QueryRowContext(ctx, query).Scan(&goods, &goodVersions, &goodMax, &categories, &categoryVersions, &categoryMax)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return fmt.Sprintf("%d.%d.%d-%d.%d.%d", goods, goodVersions, goodMax, categories, categoryVersions, categoryMax), nil
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/storage"
+	"time"
+)
+
+var (
+	ErrIdempotencyInProgress = storage.ErrIdempotencyInProgress
+	ErrIdempotencyKeyReused  = storage.ErrIdempotencyKeyReused
+)
+
+// ReserveIdempotencyKey claims the key for a new request and returns nil. If the key already
+// holds a finished request with the same hash its stored response is returned instead.
+// Expired keys and reservations older than lockTimeout (the owner died) are taken over.
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, uid int, key, requestHash string, ttl, lockTimeout time.Duration) (*entity.IdempotentResponse, error) {
+	const op = "storage.postgres.ReserveIdempotencyKey"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		DELETE FROM idempotency_key
+		WHERE uid = $1 AND idem_key = $2
+		  AND (expires_at < NOW() OR (status_code IS NULL AND created_at < NOW() - make_interval(secs => $3)));
+		`
+	if _, err := s.db.ExecContext(ctx, query, uid, key, lockTimeout.Seconds()); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+		INSERT INTO idempotency_key (uid, idem_key, request_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+		ON CONFLICT (uid, idem_key) DO NOTHING;
+		`
+	res, err := s.db.ExecContext(ctx, query, uid, key, requestHash, ttl.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 1 {
+		return nil, nil
+	}
+
+	var (
+		storedHash string
+		statusCode sql.NullInt64
+		header     []byte
+		response   entity.IdempotentResponse
+	)
+
+	query = `SELECT request_hash, status_code, headers, body FROM idempotency_key WHERE uid = $1 AND idem_key = $2;`
+	err = s.db.QueryRowContext(ctx, query, uid, key).Scan(&storedHash, &statusCode, &header, &response.Body)
+	if err != nil {
+		// The row vanished between the insert and the select; the caller retries.
+		if err == sql.ErrNoRows {
+			return nil, ErrIdempotencyInProgress
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if storedHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !statusCode.Valid {
+		return nil, ErrIdempotencyInProgress
+	}
+
+	if err := json.Unmarshal(header, &response.Header); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	response.StatusCode = int(statusCode.Int64)
+
+	return &response, nil
+}
+
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, uid int, key string, response entity.IdempotentResponse) error {
+	const op = "storage.postgres.CompleteIdempotencyKey"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		UPDATE idempotency_key
+		SET status_code = $3, headers = $4, body = $5
+		WHERE uid = $1 AND idem_key = $2;
+		`
+	if _, err := s.db.ExecContext(ctx, query, uid, key, response.StatusCode, string(header), response.Body); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey drops an unfinished reservation so that the request can be retried.
+func (s *Storage) ReleaseIdempotencyKey(ctx context.Context, uid int, key string) error {
+	const op = "storage.postgres.ReleaseIdempotencyKey"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `DELETE FROM idempotency_key WHERE uid = $1 AND idem_key = $2 AND status_code IS NULL;`
+	if _, err := s.db.ExecContext(ctx, query, uid, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) PurgeIdempotencyKeys(ctx context.Context) (int, error) {
+	const op = "storage.postgres.PurgeIdempotencyKeys"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE expires_at < NOW();`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(n), nil
+}
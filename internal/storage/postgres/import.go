@@ -0,0 +1,356 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/importer"
+	"inHouseAd/internal/lib/revision"
+	"strconv"
+	"time"
+)
+
+// maxImportErrors caps the per-row errors kept on a job; the failed counter stays exact.
+const maxImportErrors = 1000
+
+func (s *Storage) CreateImportJob(ctx context.Context, job entity.ImportJob) (int, error) {
+	const op = "storage.postgres.CreateImportJob"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var id int
+
+	mapping, err := json.Marshal(job.Mapping)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		INSERT INTO import_job (uid, status, format, mode, dry_run, create_categories, mapping, blob_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id;
+		`
+	err = s.db.QueryRowContext(ctx, query,
+		job.Uid, importer.StatusPending, job.Format, job.Mode, job.DryRun, job.CreateCategories, string(mapping), job.BlobKey,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) GetImportJob(ctx context.Context, id int) (entity.ImportJob, error) {
+	const op = "storage.postgres.GetImportJob"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var (
+		job        entity.ImportJob
+		mapping    []byte
+		rowErrors  []byte
+		startedAt  sql.NullTime
+		finishedAt sql.NullTime
+	)
+
+	query := `
+		SELECT id, uid, status, format, mode, dry_run, create_categories, mapping, blob_key,
+		       total_rows, processed_rows, succeeded, failed, errors, error, created_at, started_at, finished_at
+		FROM import_job
+		WHERE id = $1;
+		`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&job.ImportId, &job.Uid, &job.Status, &job.Format, &job.Mode, &job.DryRun, &job.CreateCategories, &mapping, &job.BlobKey,
+		&job.TotalRows, &job.ProcessedRows, &job.Succeeded, &job.Failed, &rowErrors, &job.Error, &job.CreatedAt, &startedAt, &finishedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return entity.ImportJob{}, ErrNotFound
+		}
+		return entity.ImportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := json.Unmarshal(mapping, &job.Mapping); err != nil {
+		return entity.ImportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := json.Unmarshal(rowErrors, &job.Errors); err != nil {
+		return entity.ImportJob{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return job, nil
+}
+
+// UnfinishedImportJobs lists jobs that were queued or interrupted, oldest first.
+func (s *Storage) UnfinishedImportJobs(ctx context.Context) ([]int, error) {
+	const op = "storage.postgres.UnfinishedImportJobs"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `SELECT id FROM import_job WHERE status IN ($1, $2) ORDER BY id;`
+
+	ids, err := queryIds(ctx, s.db, query, importer.StatusPending, importer.StatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
+
+func (s *Storage) StartImportJob(ctx context.Context, id, totalRows int) error {
+	const op = "storage.postgres.StartImportJob"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		UPDATE import_job
+		SET status = $2, total_rows = $3, started_at = COALESCE(started_at, NOW())
+		WHERE id = $1;
+		`
+	if _, err := s.db.ExecContext(ctx, query, id, importer.StatusRunning, totalRows); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) FinishImportJob(ctx context.Context, id int, status, jobError string) error {
+	const op = "storage.postgres.FinishImportJob"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `UPDATE import_job SET status = $2, error = $3, finished_at = $4 WHERE id = $1;`
+	if _, err := s.db.ExecContext(ctx, query, id, status, jobError, time.Now().UTC()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ImportGoods stores a batch of rows and moves the job's checkpoint to processed in the same
+// transaction, so a resumed job never imports a row twice. Each row runs under a savepoint:
+// a bad row is reported and skipped. The batch is rolled back instead of committed on a dry run
+// and, in transactional mode, when any row failed.
+func (s *Storage) ImportGoods(ctx context.Context, job entity.ImportJob, rows []entity.ImportRow, processed int) (entity.ImportBatchResult, error) {
+	const op = "storage.postgres.ImportGoods"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	result := entity.ImportBatchResult{Errors: []entity.ImportRowError{}}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	categories := make(map[string]int)
+
+	for _, row := range rows {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT import_row;`); err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		created := make(map[string]int)
+
+		msg, err := importRow(ctx, tx, row, job, categories, created)
+		if err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: row %d: %w", op, row.Row, err)
+		}
+
+		if msg != "" {
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row;`); err != nil {
+				return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+			}
+			result.Errors = append(result.Errors, entity.ImportRowError{Row: row.Row, Message: msg})
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row;`); err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+		for name, id := range created {
+			categories[name] = id
+		}
+		result.Succeeded++
+	}
+
+	commit := !job.DryRun && !(job.Mode == importer.ModeTransactional && len(result.Errors) != 0)
+	if !commit && !job.DryRun {
+		result.Succeeded = 0
+	}
+
+	var progress execer = tx
+	if !commit {
+		if err := tx.Rollback(); err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+		progress = s.db
+	}
+
+	if err := saveImportProgress(ctx, progress, job.ImportId, processed, result); err != nil {
+		return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if commit {
+		if err := tx.Commit(); err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return result, nil
+}
+
+func saveImportProgress(ctx context.Context, q execer, jobId, processed int, result entity.ImportBatchResult) error {
+	rowErrors, err := json.Marshal(result.Errors)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE import_job
+		SET processed_rows = $2,
+		    succeeded = succeeded + $3,
+		    failed = failed + $4,
+		    errors = CASE WHEN jsonb_array_length(errors) < $5 THEN errors || $6::jsonb ELSE errors END
+		WHERE id = $1;
+		`
+	_, err = q.ExecContext(ctx, query, jobId, processed, result.Succeeded, len(result.Errors), maxImportErrors, string(rowErrors))
+
+	return err
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// importRow inserts one good. A non-empty message means the row is invalid; an error means
+// the import cannot go on. Categories the row creates go to created, not to the known categories,
+// because they disappear again if the row's savepoint is rolled back.
+func importRow(ctx context.Context, tx *sql.Tx, row entity.ImportRow, job entity.ImportJob, categories, created map[string]int) (string, error) {
+	if row.Err != "" {
+		return row.Err, nil
+	}
+
+	var categoryIds []int
+	seen := make(map[int]bool)
+
+	for _, name := range row.Categories {
+		id, ok := categories[name]
+		if !ok {
+			id, ok = created[name]
+		}
+		if !ok {
+			query := `SELECT id FROM category WHERE category_name = $1 AND deleted_at IS NULL ORDER BY id LIMIT 1;`
+			err := tx.QueryRowContext(ctx, query, name).Scan(&id)
+			switch {
+			case err == sql.ErrNoRows && job.CreateCategories:
+				query = `INSERT INTO category (category_name) VALUES ($1) RETURNING id;`
+				if err := tx.QueryRowContext(ctx, query, name).Scan(&id); err != nil {
+					return "", err
+				}
+				created[name] = id
+			case err == sql.ErrNoRows:
+				return fmt.Sprintf("category %q not found", name), nil
+			case err != nil:
+				return "", err
+			default:
+				categories[name] = id
+			}
+		}
+		if !seen[id] {
+			seen[id] = true
+			categoryIds = append(categoryIds, id)
+		}
+	}
+
+	var schemas []entity.CategoryAttribute
+	for _, id := range categoryIds {
+		query := `
+			SELECT id, category_id, name, attr_type, unit, enum_values, required
+			FROM category_attribute
+			WHERE category_id = $1;
+			`
+		list, err := queryAttributes(ctx, tx, query, id)
+		if err != nil {
+			return "", err
+		}
+		schemas = append(schemas, list...)
+	}
+
+	byName := make(map[string]entity.CategoryAttribute, len(schemas))
+	for _, schema := range schemas {
+		byName[schema.Name] = schema
+	}
+
+	values := make(map[string]any, len(row.Attributes))
+	for name, raw := range row.Attributes {
+		if raw == "" {
+			continue
+		}
+		schema, ok := byName[name]
+		if !ok {
+			return fmt.Sprintf("attribute %q is not defined for the good's categories", name), nil
+		}
+		v, err := attr.Parse(schema, raw)
+		if err != nil {
+			return err.Error(), nil
+		}
+		values[name] = v
+	}
+
+	if err := attr.Validate(schemas, values); err != nil {
+		if errors.Is(err, attr.ErrInvalidValue) {
+			return err.Error(), nil
+		}
+		return "", err
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	var goodId int
+
+	query := `
+		INSERT INTO good (good_name, sku, price, stock, attributes)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING id;
+		`
+	err = tx.QueryRowContext(ctx, query, row.GoodName, row.Sku, row.Price, row.Stock, string(encoded)).Scan(&goodId)
+	if err != nil {
+		if pgCode(err) == "23505" {
+			return "sku " + strconv.Quote(row.Sku) + " already taken", nil
+		}
+		return "", err
+	}
+
+	for _, id := range categoryIds {
+		query = `INSERT INTO good_category (good_id, category_id) VALUES ($1, $2);`
+		if _, err := tx.ExecContext(ctx, query, goodId, id); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := writeRevision(ctx, tx, goodId, revision.ActionImport, job.Uid, nil); err != nil {
+		return "", err
+	}
+
+	return "", nil
+}
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AcquireLease takes the lease on a job for ttl, or extends it when holder already has it.
+// It reports false while another holder's lease is unexpired. Expiry uses the database clock,
+// so replicas with skewed clocks agree on it.
+func (s *Storage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	const op = "storage.postgres.AcquireLease"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		INSERT INTO job_lease (name, holder, acquired_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW() + $3 * INTERVAL '1 millisecond')
+		ON CONFLICT (name) DO UPDATE
+		SET holder = EXCLUDED.holder,
+		    acquired_at = CASE WHEN job_lease.holder = EXCLUDED.holder THEN job_lease.acquired_at ELSE NOW() END,
+		    expires_at = EXCLUDED.expires_at
+		WHERE job_lease.holder = EXCLUDED.holder OR job_lease.expires_at < NOW()
+		RETURNING holder;
+		`
+	var current string
+	err := s.db.QueryRowContext(ctx, query, name, holder, ttl.Milliseconds()).Scan(&current)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+// ReleaseLease gives the lease up, so that another replica can take over without waiting for it
+// to expire.
+func (s *Storage) ReleaseLease(ctx context.Context, name, holder string) error {
+	const op = "storage.postgres.ReleaseLease"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `DELETE FROM job_lease WHERE name = $1 AND holder = $2;`
+	if _, err := s.db.ExecContext(ctx, query, name, holder); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
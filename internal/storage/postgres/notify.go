@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
+	"time"
+)
+
+// ChangesChannel is the channel the catalog triggers notify, see the catalog_notify migration.
+const ChangesChannel = "catalog_changes"
+
+// listenPing is how long Listen waits for a notification before it pings the server: a
+// connection dropped without a reset would otherwise be waited on forever.
+const listenPing = 30 * time.Second
+
+// Listen opens a connection to the primary next to the pool, so that it does not hold one of
+// the pool's connections for good, and listens on channel. ready is called once the server
+// listens; fn gets the payload of every notification. Listen returns when ctx is canceled
+// or the connection fails; notifications sent in between are lost.
+func (s *Storage) Listen(ctx context.Context, channel string, ready func(), fn func(payload string)) error {
+	const op = "storage.postgres.Listen"
+
+	cfg := s.pool.Config().ConnConfig.Copy()
+	// An expired wait only interrupts the read; the default handler would also send the server
+	// a cancel request over a new connection every listenPing.
+	cfg.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.DeadlineContextWatcherHandler{Conn: conn.Conn()}
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	ready()
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, listenPing)
+		n, err := conn.WaitForNotification(waitCtx)
+		cancel()
+
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			pingCtx, cancel := context.WithTimeout(ctx, listenPing)
+			err := conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		fn(n.Payload)
+	}
+}
@@ -1,64 +1,288 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/lib/pq"
-	_ "github.com/lib/pq"
-	"github.com/pressly/goose"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"inHouseAd/db/migrations"
 	"inHouseAd/internal/entity"
 	"inHouseAd/internal/http-server/handlers/auth/signin"
 	"inHouseAd/internal/http-server/handlers/auth/signup"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/migrate"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/lib/role"
+	"inHouseAd/internal/storage"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-var ErrNotFound = errors.New("record not found")
+var (
+	ErrNotFound        = storage.ErrNotFound
+	ErrAttributeExists = storage.ErrAttributeExists
+	ErrVersionMismatch = storage.ErrVersionMismatch
+)
 
+// Storage runs its queries through database/sql on top of a pgx pool: the pool owns the
+// connections, the sql.DB keeps none of its own.
 type Storage struct {
-	db *sql.DB
+	db       *sql.DB
+	pool     *pgxpool.Pool
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+	timeouts Timeouts
+}
+
+// Pool configures the connections. SSLMode takes the libpq values (disable, allow, prefer, require,
+// verify-ca, verify-full), SSLRootCert is the CA file for the verify modes. StatementCache is
+// prepare (prepared statements cached per connection), describe (only the result descriptions
+// are cached, works behind PgBouncer in transaction mode) or off. Zero values keep the pgx defaults.
+type Pool struct {
+	SSLMode            string
+	SSLRootCert        string
+	MaxConns           int32
+	MinConns           int32
+	MaxConnLifetime    time.Duration
+	MaxConnIdleTime    time.Duration
+	HealthCheckPeriod  time.Duration
+	StatementCache     string
+	StatementCacheSize int
+}
+
+// Timeouts bound the queries of a storage method: Default applies to every method not listed
+// in Methods by name, e.g. "GetGoodList". Zero means no limit.
+type Timeouts struct {
+	Default time.Duration
+	Methods map[string]time.Duration
+}
+
+// streaming methods hand every row to a callback writing to a client, so how long they take
+// depends on the client; they are not limited unless configured.
+var streaming = map[string]bool{
+	"ExportGoods": true,
+	"FeedGoods":   true,
 }
 
-func New(host, port, user, password, dbName string) (*Storage, error) {
+func New(host, port, user, password, dbName string, pool Pool, replicas Replicas, timeouts Timeouts) (*Storage, error) {
 	const op = "storage.postgres.New"
 
+	sslMode := pool.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
 	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbName)
+		"password=%s dbname=%s sslmode=%s",
+		host, port, user, password, dbName, sslMode)
+	if pool.SSLRootCert != "" {
+		psqlInfo += " sslrootcert=" + pool.SSLRootCert
+	}
 
-	db, err := sql.Open("postgres", psqlInfo)
+	p, err := openPool(psqlInfo, pool)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = db.Ping()
+	err = p.Ping(context.Background())
 	if err != nil {
+		p.Close()
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	storage := &Storage{db: db}
+	storage := &Storage{db: stdlib.OpenDBFromPool(p), pool: p, maxLag: replicas.MaxLag, timeouts: timeouts}
 
-	err = goose.Up(storage.db, "db/migrations")
-	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+	// Replicas are not required to be up: they are read from once CheckReplicas finds them healthy.
+	for _, dsn := range replicas.DSNs {
+		rp, err := openPool(dsn, pool)
+		if err != nil {
+			storage.Close()
+			return nil, fmt.Errorf("%s: replica: %w", op, err)
+		}
+		storage.replicas = append(storage.replicas, &replica{
+			host: fmt.Sprintf("%s:%d", rp.Config().ConnConfig.Host, rp.Config().ConnConfig.Port),
+			db:   stdlib.OpenDBFromPool(rp),
+			pool: rp,
+		})
 	}
 
 	return storage, nil
 }
 
-func (s *Storage) Register(email string, passwordHashed []byte) (int, error) {
+// migrationLockId is the advisory lock held while migrating.
+const migrationLockId = 0x676f6f7365
+
+// Migrator migrates the database with the embedded migrations. Replicas starting together take
+// turns on an advisory lock, so only the first one applies the pending migrations.
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	m, err := migrate.New(s.db, "postgres", migrations.Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Lock = func() (func(), error) {
+		ctx := context.Background()
+
+		// The lock belongs to the session, so it is taken and released on one connection.
+		conn, err := s.db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationLockId); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return func() {
+			conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1);`, migrationLockId)
+			conn.Close()
+		}, nil
+	}
+
+	return m, nil
+}
+
+func openPool(dsn string, pool Pool) (*pgxpool.Pool, error) {
+	config, err := poolConfig(dsn, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgxpool.NewWithConfig(context.Background(), config)
+}
+
+func poolConfig(dsn string, pool Pool) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if pool.MaxConns > 0 {
+		config.MaxConns = pool.MaxConns
+	}
+	if pool.MinConns > 0 {
+		config.MinConns = pool.MinConns
+	}
+	if pool.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = pool.MaxConnLifetime
+	}
+	if pool.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = pool.MaxConnIdleTime
+	}
+	if pool.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = pool.HealthCheckPeriod
+	}
+
+	switch pool.StatementCache {
+	case "", "prepare":
+		config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	case "describe":
+		config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheDescribe
+	case "off":
+		config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeDescribeExec
+	default:
+		return nil, fmt.Errorf("unknown statement cache %q, expected prepare, describe or off", pool.StatementCache)
+	}
+	if pool.StatementCacheSize > 0 {
+		config.ConnConfig.StatementCacheCapacity = pool.StatementCacheSize
+		config.ConnConfig.DescriptionCacheCapacity = pool.StatementCacheSize
+	}
+
+	return config, nil
+}
+
+// PoolStats reports the connection pool for monitoring.
+func (s *Storage) PoolStats() entity.PoolStats {
+	stat := s.pool.Stat()
+
+	return entity.PoolStats{
+		TotalConns:              stat.TotalConns(),
+		IdleConns:               stat.IdleConns(),
+		AcquiredConns:           stat.AcquiredConns(),
+		ConstructingConns:       stat.ConstructingConns(),
+		MaxConns:                stat.MaxConns(),
+		AcquireCount:            stat.AcquireCount(),
+		EmptyAcquireCount:       stat.EmptyAcquireCount(),
+		CanceledAcquireCount:    stat.CanceledAcquireCount(),
+		AcquireDurationMs:       stat.AcquireDuration().Milliseconds(),
+		NewConnsCount:           stat.NewConnsCount(),
+		MaxLifetimeDestroyCount: stat.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     stat.MaxIdleDestroyCount(),
+	}
+}
+
+// Close closes the connections; it is meant to be called once nothing uses the storage anymore.
+func (s *Storage) Close() {
+	for _, r := range s.replicas {
+		r.db.Close()
+		r.pool.Close()
+	}
+	s.db.Close()
+	s.pool.Close()
+}
+
+// pgCode returns the SQLSTATE of a server error, "" for other errors.
+func pgCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+func (s *Storage) withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	name := strings.TrimPrefix(op, "storage.postgres.")
+
+	timeout, ok := s.timeouts.Methods[name]
+	if !ok && !streaming[name] {
+		timeout = s.timeouts.Default
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Interrupted reports whether err comes from a query stopped by its context, because
+// the caller gave up or the query ran out of time, rather than from a failure.
+func Interrupted(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// The server reports a query canceled on the client's request as query_canceled.
+	return pgCode(err) == "57014"
+}
+
+func (s *Storage) Register(ctx context.Context, email string, passwordHashed []byte) (int, error) {
+	return s.CreateUser(ctx, email, passwordHashed, role.User)
+}
+
+func (s *Storage) CreateUser(ctx context.Context, email string, passwordHashed []byte, userRole string) (int, error) {
 	const op = "storage.postgres.CreateUser"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
 	query := `
-		INSERT INTO users (email, password_hashed) 
-		VALUES ($1, $2) 
+		INSERT INTO users (email, password_hashed, role) 
+		VALUES ($1, $2, $3) 
 		RETURNING id;
 		`
 
 	var id int
 
-	err := s.db.QueryRow(query, email, passwordHashed).Scan(&id)
+	err := s.db.QueryRowContext(ctx, query, email, passwordHashed, userRole).Scan(&id)
 	if err != nil {
-		if err, ok := err.(*pq.Error); ok && err.Code == "23505" {
+		if pgCode(err) == "23505" {
 			return 0, signup.ErrEmailTaken
 		}
 		return 0, fmt.Errorf("%s: %w", op, err)
@@ -67,9 +291,37 @@ func (s *Storage) Register(email string, passwordHashed []byte) (int, error) {
 	return id, nil
 }
 
-func (s *Storage) Authorizate(email string) ([]byte, int, error) {
+// SetPassword replaces the password of the user with the email.
+func (s *Storage) SetPassword(ctx context.Context, email string, passwordHashed []byte) error {
+	const op = "storage.postgres.SetPassword"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `UPDATE users SET password_hashed = $2 WHERE email = $1;`
+
+	res, err := s.db.ExecContext(ctx, query, email, passwordHashed)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) Authorizate(ctx context.Context, email string) ([]byte, int, error) {
 	const op = "storage.postgres.Authorizate"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
 	query := `
 		SELECT users.password_hashed, users.id 
 		FROM users 
@@ -80,11 +332,11 @@ func (s *Storage) Authorizate(email string) ([]byte, int, error) {
 	var hash []byte
 	var id int
 
-	err := s.db.QueryRow(query, email).Scan(&hash, &id)
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&hash, &id)
 	if err == sql.ErrNoRows {
 		return nil, 0, signin.ErrInvalidEmail
 	} else if err != nil {
-		if err, ok := err.(*pq.Error); ok && err.Code == "23505" {
+		if pgCode(err) == "23505" {
 			return nil, 0, signup.ErrEmailTaken
 		}
 		return nil, 0, fmt.Errorf("%s: %w", op, err)
@@ -93,9 +345,12 @@ func (s *Storage) Authorizate(email string) ([]byte, int, error) {
 	return hash, id, nil
 }
 
-func (s *Storage) Create(name string, uid int) (int, error) {
+func (s *Storage) Create(ctx context.Context, name string, uid int) (int, error) {
 	const op = "storage.postgres.Create"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
 	var id int
 
 	query := `
@@ -104,7 +359,7 @@ func (s *Storage) Create(name string, uid int) (int, error) {
 		RETURNING id;
 		`
 
-	err := s.db.QueryRow(query, name).Scan(&id)
+	err := s.db.QueryRowContext(ctx, query, name).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
@@ -112,63 +367,134 @@ func (s *Storage) Create(name string, uid int) (int, error) {
 	return id, nil
 }
 
-func (s *Storage) EditCategory(id int, newName string) (int, error) {
+// EditCategory renames the category. A non-zero version must match the current one.
+func (s *Storage) EditCategory(ctx context.Context, id int, newName string, version int) (int, error) {
 	const op = "storage.postgres.EditCategory"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
 	query := `
 		UPDATE category 
 		SET category_name = $1 
-		WHERE id = $2 
+		WHERE id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)
 		RETURNING id;
 		`
 
-	err := s.db.QueryRow(query, newName, id).Scan(&id)
+	err := s.db.QueryRowContext(ctx, query, newName, id, version).Scan(&id)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, s.missingOrStale(ctx, "category", id)
+		}
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return id, nil
 }
 
-func (s *Storage) DeleteCategory(id int) error {
+// DeleteCategory moves the category to the trash. Its links to goods are kept so that
+// a restore brings them back; they are only dropped when the trash is purged.
+func (s *Storage) DeleteCategory(ctx context.Context, id, version int) error {
 	const op = "storage.postgres.DeleteCategory"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
 	query := `
-			DELETE FROM category 
-       		WHERE id = $1;
+			UPDATE category 
+			SET deleted_at = NOW()
+       		WHERE id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2);
 			`
 
-	_, err := s.db.Exec(query, id)
+	res, err := s.db.ExecContext(ctx, query, id, version)
 	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return s.missingOrStale(ctx, "category", id)
+	}
+
+	return nil
+}
+
+// missingOrStale tells why a versioned update of a live row matched nothing.
+func (s *Storage) missingOrStale(ctx context.Context, table string, id int) error {
+	var exists bool
+
+	query := `SELECT EXISTS (SELECT 1 FROM ` + table + ` WHERE id = $1 AND deleted_at IS NULL);`
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	return ErrVersionMismatch
+}
+
+// checkVersion locks the live good and compares its version with the expected one (0 skips the check).
+func checkVersion(ctx context.Context, tx *sql.Tx, goodId, version int) error {
+	var current int
+
+	query := `SELECT version FROM good WHERE id = $1 AND deleted_at IS NULL FOR UPDATE;`
+	if err := tx.QueryRowContext(ctx, query, goodId).Scan(&current); err != nil {
 		if err == sql.ErrNoRows {
 			return ErrNotFound
 		}
-		return fmt.Errorf("%s: %w", op, err)
+		return err
+	}
+	if version != 0 && version != current {
+		return ErrVersionMismatch
 	}
 
 	return nil
 }
 
-func (s *Storage) AddGood(goodName string, categoryId int) (int, string, error) {
+// touchGood bumps the good's version for changes stored outside its row (category links, images).
+func touchGood(ctx context.Context, tx *sql.Tx, goodId int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE good SET version = version + 1 WHERE id = $1;`, goodId)
+	return err
+}
+
+// AddGood creates the good in the category with the attribute values, which must satisfy
+// the attributes of the category.
+func (s *Storage) AddGood(ctx context.Context, goodName string, categoryId int, attributes map[string]any, actorUid int) (int, string, error) {
 	const op = "storage.postgres.AddGood"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
 	var (
 		goodId       int
 		categoryName string
 	)
 
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
 	query := `
-			INSERT INTO good (good_name) 
-			VALUES ($1) 
+			INSERT INTO good (good_name, attributes) 
+			VALUES ($1, $2) 
 			RETURNING id;
 		`
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	err = tx.QueryRow(query, goodName).Scan(&goodId)
+	err = tx.QueryRowContext(ctx, query, goodName, string(encoded)).Scan(&goodId)
 	if err != nil {
 		tx.Rollback()
 		return 0, "", fmt.Errorf("%s: %w", op, err)
@@ -179,21 +505,40 @@ func (s *Storage) AddGood(goodName string, categoryId int) (int, string, error)
 			VALUES ($1, $2);
 		`
 
-	_, err = tx.Exec(query, goodId, categoryId)
+	_, err = tx.ExecContext(ctx, query, goodId, categoryId)
 	if err != nil {
 		tx.Rollback()
+		if pgCode(err) == "23503" {
+			return 0, "", ErrNotFound
+		}
 		return 0, "", fmt.Errorf("%s: %w", op, err)
 	}
 
 	query = `
 			SELECT category.category_name 
 			FROM category 
-			WHERE id = $1
+			WHERE id = $1 AND deleted_at IS NULL
 			LIMIT 1;
 		`
 
-	err = tx.QueryRow(query, categoryId).Scan(&categoryName)
+	err = tx.QueryRowContext(ctx, query, categoryId).Scan(&categoryName)
 	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return 0, "", ErrNotFound
+		}
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := validateGood(ctx, tx, goodId); err != nil {
+		tx.Rollback()
+		if errors.Is(err, attr.ErrInvalidValue) {
+			return 0, "", err
+		}
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := writeRevision(ctx, tx, goodId, revision.ActionCreate, actorUid, nil); err != nil {
 		tx.Rollback()
 		return 0, "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -206,43 +551,46 @@ func (s *Storage) AddGood(goodName string, categoryId int) (int, string, error)
 	return goodId, categoryName, nil
 }
 
-func (s *Storage) UpdateGood(goodId, categoryIdToAdd int, goodName string) (int, []string, string, error) {
+func (s *Storage) UpdateGood(ctx context.Context, goodId, categoryIdToAdd int, goodName string, version, actorUid int) (int, []string, string, error) {
 	const op = "storage.postgres.UpdateGood"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
 	var (
 		rGoodName     string
 		categoryNames []string
 	)
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
 	}
-	defer func() {
-		if r := recover(); r != nil || err != nil {
-			tx.Rollback()
+	defer tx.Rollback()
+
+	if err := checkVersion(ctx, tx, goodId, version); err != nil {
+		if err == ErrNotFound || err == ErrVersionMismatch {
+			return 0, nil, "", err
 		}
-	}()
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
 
 	query := `SELECT good_name FROM good WHERE id = $1;`
-	if err := tx.QueryRow(query, goodId).Scan(&rGoodName); err != nil {
-		if err == sql.ErrNoRows {
-			return 0, nil, "", fmt.Errorf("%s: good not found", op)
-		}
+	if err := tx.QueryRowContext(ctx, query, goodId).Scan(&rGoodName); err != nil {
 		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
 	}
 
 	if goodName != "" {
 		query = `UPDATE good SET good_name = $1 WHERE id = $2 RETURNING good_name;`
-		if err := tx.QueryRow(query, goodName, goodId).Scan(&rGoodName); err != nil {
+		if err := tx.QueryRowContext(ctx, query, goodName, goodId).Scan(&rGoodName); err != nil {
 			return 0, nil, "", fmt.Errorf("%s: %w", op, err)
 		}
 	}
 
 	if categoryIdToAdd != 0 {
-		query = `SELECT category_name FROM category WHERE id = $1;`
+		query = `SELECT category_name FROM category WHERE id = $1 AND deleted_at IS NULL;`
 		var categoryName string
-		if err := tx.QueryRow(query, categoryIdToAdd).Scan(&categoryName); err != nil {
+		if err := tx.QueryRowContext(ctx, query, categoryIdToAdd).Scan(&categoryName); err != nil {
 			if err == sql.ErrNoRows {
 				return 0, nil, "", fmt.Errorf("%s: category not found", op)
 			}
@@ -250,18 +598,31 @@ func (s *Storage) UpdateGood(goodId, categoryIdToAdd int, goodName string) (int,
 		}
 
 		query = `INSERT INTO good_category (good_id, category_id) VALUES ($1, $2);`
-		if _, err := tx.Exec(query, goodId, categoryIdToAdd); err != nil {
+		if _, err := tx.ExecContext(ctx, query, goodId, categoryIdToAdd); err != nil {
+			return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := validateGood(ctx, tx, goodId); err != nil {
+			if errors.Is(err, attr.ErrInvalidValue) {
+				return 0, nil, "", err
+			}
 			return 0, nil, "", fmt.Errorf("%s: %w", op, err)
 		}
+
+		if goodName == "" {
+			if err := touchGood(ctx, tx, goodId); err != nil {
+				return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+			}
+		}
 	}
 
 	query = `
         SELECT c.category_name
         FROM category AS c
         JOIN good_category gc ON c.id = gc.category_id
-		WHERE gc.good_id = $1;
+		WHERE gc.good_id = $1 AND c.deleted_at IS NULL;
 		`
-	rows, err := tx.Query(query, goodId)
+	rows, err := tx.QueryContext(ctx, query, goodId)
 	if err != nil {
 		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -279,6 +640,10 @@ func (s *Storage) UpdateGood(goodId, categoryIdToAdd int, goodName string) (int,
 		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
 	}
 
+	if _, err := writeRevision(ctx, tx, goodId, revision.ActionUpdate, actorUid, nil); err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
 	}
@@ -286,45 +651,158 @@ func (s *Storage) UpdateGood(goodId, categoryIdToAdd int, goodName string) (int,
 	return goodId, categoryNames, rGoodName, nil
 }
 
-func (s *Storage) DeleteGood(id int) error {
+// DeleteGood moves the good and its variants to the trash with a shared timestamp,
+// which is what RestoreGood uses to bring back exactly the rows deleted together.
+func (s *Storage) DeleteGood(ctx context.Context, id, version, actorUid int) error {
 	const op = "storage.postgres.DeleteGood"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkVersion(ctx, tx, id, version); err != nil {
+		if err == ErrNotFound || err == ErrVersionMismatch {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	query := `
-			DELETE FROM good 
-       		WHERE id = $1;
+			UPDATE good 
+			SET deleted_at = NOW()
+       		WHERE (id = $1 OR parent_id = $1) AND deleted_at IS NULL
+			RETURNING id;
 			`
 
-	_, err := s.db.Exec(query, id)
+	ids, err := queryIds(ctx, tx, query, id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return ErrNotFound
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(ids) == 0 {
+		return ErrNotFound
+	}
+
+	for _, goodId := range ids {
+		if _, err := writeRevision(ctx, tx, goodId, revision.ActionDelete, actorUid, nil); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
 		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *Storage) GetCategoryList() ([]entity.CategoryList, error) {
+func (s *Storage) GetGood(ctx context.Context, id int) (entity.GoodDetail, error) {
+	const op = "storage.postgres.GetGood"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	db := s.reader(ctx)
+
+	var (
+		good       entity.GoodDetail
+		parentId   sql.NullInt64
+		sku        sql.NullString
+		price      sql.NullFloat64
+		attributes []byte
+	)
+
+	query := `
+		SELECT id, good_name, parent_id, sku, price, stock, attributes, version
+		FROM good
+		WHERE id = $1 AND deleted_at IS NULL;
+		`
+	err := db.QueryRowContext(ctx, query, id).Scan(&good.GoodId, &good.GoodName, &parentId, &sku, &price, &good.Stock, &attributes, &good.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return entity.GoodDetail{}, ErrNotFound
+		}
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := json.Unmarshal(attributes, &good.Attributes); err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	good.ParentId = nullInt(parentId)
+	good.Sku = sku.String
+	good.Price = nullFloat(price)
+
+	query = `
+		SELECT c.id, c.category_name, c.version
+		FROM category AS c
+		JOIN good_category AS gc ON gc.category_id = c.id
+		WHERE gc.good_id = $1 AND c.deleted_at IS NULL
+		ORDER BY c.id;
+		`
+	rows, err := db.QueryContext(ctx, query, id)
+	if err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	good.Categories = []entity.CategoryList{}
+	for rows.Next() {
+		var c entity.CategoryList
+		if err := rows.Scan(&c.CategoryId, &c.CategoryName, &c.Version); err != nil {
+			return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+		}
+		good.Categories = append(good.Categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	good.Images, err = s.GetGoodImages(ctx, id)
+	if err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if good.Images == nil {
+		good.Images = []entity.GoodImage{}
+	}
+
+	return good, nil
+}
+
+func (s *Storage) GetCategoryList(ctx context.Context) ([]entity.CategoryList, error) {
 	const op = "storage.postgres.GetCategoryList"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	db := s.reader(ctx)
+
 	var response []entity.CategoryList
 
 	query := `
-        SELECT *
-        FROM category;
+        SELECT id, category_name, parent_id, version
+        FROM category
+        WHERE deleted_at IS NULL
+        ORDER BY id;
 		`
-	rows, err := s.db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var r entity.CategoryList
-		if err := rows.Scan(&r.CategoryId, &r.CategoryName); err != nil {
+		var (
+			r        entity.CategoryList
+			parentId sql.NullInt64
+		)
+		if err := rows.Scan(&r.CategoryId, &r.CategoryName, &parentId, &r.Version); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
+		r.ParentId = nullInt(parentId)
 		response = append(response, r)
 	}
 	if err := rows.Err(); err != nil {
@@ -334,29 +812,73 @@ func (s *Storage) GetCategoryList() ([]entity.CategoryList, error) {
 	return response, nil
 }
 
-func (s *Storage) GetGoodList(categoryId int) ([]entity.GoodList, error) {
+func (s *Storage) GetGoodList(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]entity.GoodList, error) {
 	const op = "storage.postgres.GetGoodList"
 
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	db := s.reader(ctx)
+
 	var response []entity.GoodList
 
 	query := `
-        SELECT g.id, g.good_name
+        SELECT g.id, g.good_name, g.attributes, g.parent_id, g.sku, g.price, g.stock, g.version,
+            (SELECT count(*) FROM good AS v WHERE v.parent_id = g.id AND v.deleted_at IS NULL),
+            gi.id, gi.blob_key, gi.thumbnails, gi.content_type, gi.size, gi.width, gi.height, gi.position
         FROM good AS g 
         JOIN good_category AS gc 
         ON g.id = gc.good_id
         JOIN category AS c 
         ON gc.category_id = c.id
-        WHERE gc.category_id = $1;
-		`
-	rows, err := s.db.Query(query, categoryId)
+        LEFT JOIN good_image AS gi
+        ON gi.good_id = g.id AND gi.is_primary
+        WHERE gc.category_id = $1 AND g.deleted_at IS NULL AND c.deleted_at IS NULL`
+	args := []any{categoryId}
+
+	if collapseVariants {
+		query += " AND g.parent_id IS NULL"
+	}
+
+	conditions, args, err := s.filterConditions(ctx, categoryId, filters, collapseVariants, args)
+	if err != nil {
+		if errors.Is(err, attr.ErrInvalidFilter) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	query += conditions
+
+	rows, err := db.QueryContext(ctx, query+" ORDER BY g.id;", args...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var r entity.GoodList
-		if err := rows.Scan(&r.GoodId, &r.GoodName); err != nil {
+		var (
+			r          entity.GoodList
+			attributes []byte
+			parentId   sql.NullInt64
+			sku        sql.NullString
+			price      sql.NullFloat64
+			img        nullImage
+		)
+		err := rows.Scan(
+			&r.GoodId, &r.GoodName, &attributes, &parentId, &sku, &price, &r.Stock, &r.Version, &r.VariantCount,
+			&img.id, &img.key, &img.thumbnails, &img.contentType, &img.size, &img.width, &img.height, &img.position,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal(attributes, &r.Attributes); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.ParentId = nullInt(parentId)
+		r.Sku = sku.String
+		r.Price = nullFloat(price)
+		r.Image, err = img.image(r.GoodId)
+		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 		response = append(response, r)
@@ -367,3 +889,85 @@ func (s *Storage) GetGoodList(categoryId int) ([]entity.GoodList, error) {
 
 	return response, nil
 }
+
+// filterConditions turns attribute filters into SQL conditions on the good aliased "g", typed by
+// the category's schemas. Placeholders continue after args, which are returned extended.
+func (s *Storage) filterConditions(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool, args []any) (string, []any, error) {
+	if len(filters) == 0 {
+		return "", args, nil
+	}
+
+	schemas, err := s.GetAttributeList(ctx, categoryId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	types := make(map[string]string, len(schemas))
+	for _, schema := range schemas {
+		types[schema.Name] = schema.Type
+	}
+
+	var conditions string
+
+	for _, f := range filters {
+		attrType, ok := types[f.Name]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %q is not defined for the category", attr.ErrInvalidFilter, f.Name)
+		}
+
+		alias := "g"
+		if collapseVariants {
+			alias = "f"
+		}
+
+		condition, filterArgs, err := attributeCondition(f, attrType, len(args), alias)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// A collapsed parent matches when the parent itself or any of its variants matches.
+		if collapseVariants {
+			condition = "EXISTS (SELECT 1 FROM good AS f WHERE (f.id = g.id OR f.parent_id = g.id) AND f.deleted_at IS NULL AND " + condition + ")"
+		}
+
+		conditions += " AND " + condition
+		args = append(args, filterArgs...)
+	}
+
+	return conditions, args, nil
+}
+
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+func queryIds(ctx context.Context, q querier, query string, args ...any) ([]int, error) {
+	var ids []int
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"fmt"
+	"inHouseAd/internal/storage/storagetest"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestConformance runs against a throwaway database created on the server in TEST_POSTGRES_HOST,
+// TEST_POSTGRES_PORT, TEST_POSTGRES_USER, TEST_POSTGRES_PASSWORD and TEST_POSTGRES_DB, and is
+// skipped without it: the suite purges the whole trash, which must not hit a database in use.
+// The migrations are applied to it first.
+func TestConformance(t *testing.T) {
+	host := os.Getenv("TEST_POSTGRES_HOST")
+	if host == "" {
+		t.Skip("TEST_POSTGRES_HOST is not set")
+	}
+
+	open := func(dbName string) *Storage {
+		s, err := New(
+			host,
+			env("TEST_POSTGRES_PORT", "5432"),
+			env("TEST_POSTGRES_USER", "postgres"),
+			env("TEST_POSTGRES_PASSWORD", "postgres"),
+			dbName,
+			Pool{MaxConns: 10, MinConns: 1, MaxConnLifetime: time.Hour, MaxConnIdleTime: time.Minute, HealthCheckPeriod: time.Minute},
+			Replicas{},
+			Timeouts{Default: 10 * time.Second},
+		)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		return s
+	}
+
+	admin := open(env("TEST_POSTGRES_DB", "postgres"))
+	t.Cleanup(admin.Close)
+
+	dbName := fmt.Sprintf("storagetest_%d", time.Now().UnixNano())
+	if _, err := admin.db.Exec(`CREATE DATABASE ` + dbName + `;`); err != nil {
+		t.Fatalf("CREATE DATABASE: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.db.Exec(`DROP DATABASE IF EXISTS ` + dbName + `;`); err != nil {
+			t.Errorf("DROP DATABASE: %v", err)
+		}
+	})
+
+	s := open(dbName)
+	t.Cleanup(s.Close)
+
+	m, err := s.Migrator()
+	if err != nil {
+		t.Fatalf("Migrator: %v", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return s
+	})
+}
+
+func env(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
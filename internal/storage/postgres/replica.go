@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"inHouseAd/internal/entity"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Replicas are read-only copies of the database. DSNs are complete connection strings, the pool
+// settings are shared with the primary. A replica lagging behind by more than MaxLag is not read
+// from until it catches up; zero means any lag is fine.
+type Replicas struct {
+	DSNs   []string
+	MaxLag time.Duration
+}
+
+type replica struct {
+	host string
+	db   *sql.DB
+	pool *pgxpool.Pool
+
+	healthy atomic.Bool
+
+	mu    sync.Mutex
+	state entity.ReplicaState
+}
+
+// reader is what read-only queries run on: the primary or a replica.
+type reader interface {
+	querier
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type primaryKey struct{}
+
+// WithPrimary marks ctx so that reads go to the primary too, for requests that must see
+// their own writes.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary reports whether ctx was marked with WithPrimary.
+func UsesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// reader picks the next healthy replica round-robin, or the primary when there is none
+// or ctx asks for it.
+func (s *Storage) reader(ctx context.Context) reader {
+	if len(s.replicas) == 0 || UsesPrimary(ctx) {
+		return s.db
+	}
+
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		r := s.replicas[(start+uint64(i))%uint64(len(s.replicas))]
+		if r.healthy.Load() {
+			return replicaReader{replica: r, primary: s.db}
+		}
+	}
+
+	return s.db
+}
+
+// replicaReader sends a query that cannot reach its replica to the primary and takes the replica
+// out of rotation until the next check finds it healthy.
+type replicaReader struct {
+	replica *replica
+	primary *sql.DB
+}
+
+func (r replicaReader) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := r.replica.db.QueryContext(ctx, query, args...)
+	if err != nil && unreachable(err) {
+		r.replica.down(err)
+		return r.primary.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+func (r replicaReader) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	row := r.replica.db.QueryRowContext(ctx, query, args...)
+	if err := row.Err(); err != nil && unreachable(err) {
+		r.replica.down(err)
+		return r.primary.QueryRowContext(ctx, query, args...)
+	}
+	return row
+}
+
+// unreachable tells a replica that cannot serve queries from a query that failed on its own.
+func unreachable(err error) bool {
+	if Interrupted(err) {
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	// connection_exception and operator_intervention (shutdown, recovery conflicts).
+	code := pgCode(err)
+	return strings.HasPrefix(code, "08") || strings.HasPrefix(code, "57P")
+}
+
+func (r *replica) down(err error) {
+	r.healthy.Store(false)
+
+	r.mu.Lock()
+	r.state.Healthy = false
+	r.state.Error = err.Error()
+	r.mu.Unlock()
+}
+
+// CheckReplicas measures how far behind every replica is and puts the ones within the lag
+// threshold in rotation. It returns the new states.
+func (s *Storage) CheckReplicas(ctx context.Context) []entity.ReplicaState {
+	states := make([]entity.ReplicaState, len(s.replicas))
+
+	var wg sync.WaitGroup
+	for i, r := range s.replicas {
+		wg.Add(1)
+		go func(i int, r *replica) {
+			defer wg.Done()
+			states[i] = s.checkReplica(ctx, r)
+		}(i, r)
+	}
+	wg.Wait()
+
+	return states
+}
+
+func (s *Storage) checkReplica(ctx context.Context, r *replica) entity.ReplicaState {
+	// A replica that has replayed everything it received is not behind, however old the last
+	// replayed transaction is, but only while it is streaming: one cut off from the primary
+	// has replayed everything too. Without pg_read_all_stats the status of the WAL receiver
+	// is hidden, and a running receiver process is taken for a streaming one.
+	query := `
+		SELECT
+			pg_is_in_recovery(),
+			EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status = 'streaming', pid IS NOT NULL)),
+			CASE
+				WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+			END;
+		`
+
+	var (
+		inRecovery, streaming bool
+		lag                   float64
+	)
+
+	state := entity.ReplicaState{Host: r.host, CheckedAt: time.Now()}
+
+	err := r.db.QueryRowContext(ctx, query).Scan(&inRecovery, &streaming, &lag)
+	switch {
+	case err != nil:
+		state.Error = err.Error()
+	case inRecovery && !streaming:
+		state.Error = "replica is not streaming from the primary"
+	default:
+		state.LagMs = int64(lag * 1000)
+		state.Healthy = s.maxLag <= 0 || time.Duration(lag*float64(time.Second)) <= s.maxLag
+		if !state.Healthy {
+			state.Error = "replica lag exceeds the threshold"
+		}
+	}
+
+	r.healthy.Store(state.Healthy)
+
+	r.mu.Lock()
+	r.state = state
+	r.mu.Unlock()
+
+	return state
+}
+
+// ReplicaStates reports the replicas as of their last check.
+func (s *Storage) ReplicaStates() []entity.ReplicaState {
+	states := make([]entity.ReplicaState, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		r.mu.Lock()
+		states = append(states, r.state)
+		r.mu.Unlock()
+	}
+	return states
+}
@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/storage"
+)
+
+var ErrRevertDeleted = storage.ErrRevertDeleted
+
+// writeRevision appends an immutable snapshot of the good's current state. It must run in the
+// same transaction as the change itself so that history never disagrees with the data.
+// actorUid 0 means the change was made by the system (e.g. the periodic fetch).
+func writeRevision(ctx context.Context, tx *sql.Tx, goodId int, action string, actorUid int, sourceRev *int) (int, error) {
+	var rev int
+
+	// Lock the good so concurrent writers cannot pick the same revision number.
+	query := `SELECT id FROM good WHERE id = $1 FOR UPDATE;`
+	if _, err := tx.ExecContext(ctx, query, goodId); err != nil {
+		return 0, err
+	}
+
+	snapshot, err := goodSnapshot(ctx, tx, goodId)
+	if err != nil {
+		return 0, err
+	}
+
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+		INSERT INTO good_revision (good_id, rev, action, snapshot, actor_uid, source_rev)
+		SELECT $1, COALESCE(MAX(rev), 0) + 1, $2, $3, $4, $5
+		FROM good_revision
+		WHERE good_id = $1
+		RETURNING rev;
+		`
+	err = tx.QueryRowContext(ctx, query,
+		goodId, action, string(encoded), sql.NullInt64{Int64: int64(actorUid), Valid: actorUid != 0}, sourceRev,
+	).Scan(&rev)
+	if err != nil {
+		return 0, err
+	}
+
+	return rev, nil
+}
+
+func goodSnapshot(ctx context.Context, tx *sql.Tx, goodId int) (entity.GoodSnapshot, error) {
+	var (
+		snapshot    entity.GoodSnapshot
+		parentId    sql.NullInt64
+		sku         sql.NullString
+		price       sql.NullFloat64
+		attributes  []byte
+		categoryIds []byte
+	)
+
+	query := `
+		SELECT good_name, parent_id, sku, price, stock, attributes, deleted_at IS NOT NULL,
+		       COALESCE((SELECT jsonb_agg(category_id ORDER BY category_id) FROM good_category WHERE good_id = g.id), '[]')
+		FROM good AS g
+		WHERE id = $1;
+		`
+	err := tx.QueryRowContext(ctx, query, goodId).Scan(
+		&snapshot.GoodName, &parentId, &sku, &price, &snapshot.Stock, &attributes, &snapshot.Deleted, &categoryIds,
+	)
+	if err != nil {
+		return entity.GoodSnapshot{}, err
+	}
+	if err := json.Unmarshal(attributes, &snapshot.Attributes); err != nil {
+		return entity.GoodSnapshot{}, err
+	}
+	if err := json.Unmarshal(categoryIds, &snapshot.CategoryIds); err != nil {
+		return entity.GoodSnapshot{}, err
+	}
+
+	snapshot.ParentId = nullInt(parentId)
+	snapshot.Sku = sku.String
+	snapshot.Price = nullFloat(price)
+
+	return snapshot, nil
+}
+
+// GetGoodHistory returns every revision of the good, oldest first, each with the diff
+// against the previous one. Goods in the trash keep their history.
+func (s *Storage) GetGoodHistory(ctx context.Context, goodId int) ([]entity.GoodRevision, error) {
+	const op = "storage.postgres.GetGoodHistory"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var history []entity.GoodRevision
+
+	query := `
+		SELECT rev, action, snapshot, actor_uid, source_rev, created_at
+		FROM good_revision
+		WHERE good_id = $1
+		ORDER BY rev;
+		`
+	rows, err := s.db.QueryContext(ctx, query, goodId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			r         entity.GoodRevision
+			snapshot  []byte
+			actorUid  sql.NullInt64
+			sourceRev sql.NullInt64
+		)
+		if err := rows.Scan(&r.Rev, &r.Action, &snapshot, &actorUid, &sourceRev, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal(snapshot, &r.Snapshot); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.ActorUid = nullInt(actorUid)
+		r.SourceRev = nullInt(sourceRev)
+		history = append(history, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(history) == 0 {
+		var exists bool
+		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM good WHERE id = $1);`, goodId).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !exists {
+			return nil, ErrNotFound
+		}
+		return []entity.GoodRevision{}, nil
+	}
+
+	revision.History(history)
+
+	return history, nil
+}
+
+// RevertGood brings the good's name, offer, attributes and category links back to the state
+// recorded in rev and records that as a new revision. A good in the trash is restored by the revert;
+// its variants are left alone. Attributes are restored as they were, without validating them
+// against the current schemas.
+func (s *Storage) RevertGood(ctx context.Context, goodId, rev, actorUid int) (entity.GoodRevertResponse, error) {
+	const op = "storage.postgres.RevertGood"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var (
+		deleted  bool
+		parentId sql.NullInt64
+		raw      []byte
+		target   entity.GoodSnapshot
+	)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT deleted_at IS NOT NULL, parent_id FROM good WHERE id = $1 FOR UPDATE;`
+	if err := tx.QueryRowContext(ctx, query, goodId).Scan(&deleted, &parentId); err != nil {
+		if err == sql.ErrNoRows {
+			return entity.GoodRevertResponse{}, ErrNotFound
+		}
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `SELECT snapshot FROM good_revision WHERE good_id = $1 AND rev = $2;`
+	if err := tx.QueryRowContext(ctx, query, goodId, rev).Scan(&raw); err != nil {
+		if err == sql.ErrNoRows {
+			return entity.GoodRevertResponse{}, ErrNotFound
+		}
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := json.Unmarshal(raw, &target); err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if target.Deleted {
+		return entity.GoodRevertResponse{}, ErrRevertDeleted
+	}
+
+	if deleted && parentId.Valid {
+		var parentDeleted bool
+
+		query = `SELECT deleted_at IS NOT NULL FROM good WHERE id = $1;`
+		if err := tx.QueryRowContext(ctx, query, parentId.Int64).Scan(&parentDeleted); err != nil {
+			return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if parentDeleted {
+			return entity.GoodRevertResponse{}, ErrParentDeleted
+		}
+	}
+
+	if target.Attributes == nil {
+		target.Attributes = map[string]any{}
+	}
+	attributes, err := json.Marshal(target.Attributes)
+	if err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+		UPDATE good
+		SET good_name = $2, sku = NULLIF($3, ''), price = $4, stock = $5, attributes = $6, deleted_at = NULL
+		WHERE id = $1;
+		`
+	_, err = tx.ExecContext(ctx, query, goodId, target.GoodName, target.Sku, target.Price, target.Stock, string(attributes))
+	if err != nil {
+		if pgCode(err) == "23505" {
+			return entity.GoodRevertResponse{}, ErrSkuTaken
+		}
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	categoryIds, err := json.Marshal(target.CategoryIds)
+	if err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM good_category WHERE good_id = $1;`, goodId); err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Categories purged since the revision was taken cannot be linked again and are skipped.
+	query = `
+		INSERT INTO good_category (good_id, category_id)
+		SELECT $1, c.id
+		FROM category AS c
+		WHERE c.id IN (SELECT jsonb_array_elements_text(COALESCE($2::jsonb, '[]'))::int);
+		`
+	if _, err := tx.ExecContext(ctx, query, goodId, string(categoryIds)); err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	newRev, err := writeRevision(ctx, tx, goodId, revision.ActionRevert, actorUid, &rev)
+	if err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	current, err := goodSnapshot(ctx, tx, goodId)
+	if err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.GoodRevertResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entity.GoodRevertResponse{GoodId: goodId, Rev: newRev, Good: current}, nil
+}
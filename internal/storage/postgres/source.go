@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/revision"
+	"strconv"
+)
+
+// AddSourceGoods stores goods fetched from an external source in the category, in one
+// transaction, keyed by the source and their ExternalId so that fetching a good again updates it.
+// Each good runs under a savepoint: a bad one is reported and skipped. Attributes without
+// a schema in the category are dropped.
+func (s *Storage) AddSourceGoods(ctx context.Context, source string, categoryId int, goods []entity.SourceGood) (entity.ImportBatchResult, error) {
+	const op = "storage.postgres.AddSourceGoods"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	result := entity.ImportBatchResult{Errors: []entity.ImportRowError{}}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM category WHERE id = $1 AND deleted_at IS NULL);`
+	if err := tx.QueryRowContext(ctx, query, categoryId).Scan(&exists); err != nil {
+		return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return entity.ImportBatchResult{}, ErrNotFound
+	}
+
+	for _, g := range goods {
+		if g.Err != "" {
+			result.Errors = append(result.Errors, entity.ImportRowError{Row: g.Position, Message: g.Err})
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT source_good;`); err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		msg, err := addSourceGood(ctx, tx, source, categoryId, g)
+		if err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: good %d: %w", op, g.Position, err)
+		}
+
+		if msg != "" {
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT source_good;`); err != nil {
+				return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+			}
+			result.Errors = append(result.Errors, entity.ImportRowError{Row: g.Position, Message: msg})
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT source_good;`); err != nil {
+			return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+		result.Succeeded++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.ImportBatchResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result, nil
+}
+
+// addSourceGood inserts the good or, when the source has stored its key before, updates it.
+// Attributes are merged and a missing price or stock keeps the stored one. Goods moved to the
+// trash stay there: the source does not bring them back on every fetch.
+func addSourceGood(ctx context.Context, tx *sql.Tx, source string, categoryId int, g entity.SourceGood) (string, error) {
+	var (
+		goodId    int
+		deletedAt sql.NullTime
+	)
+
+	query := `SELECT id, deleted_at FROM good WHERE source = $1 AND external_id = $2 FOR UPDATE;`
+	err := tx.QueryRowContext(ctx, query, source, g.ExternalId).Scan(&goodId, &deletedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if deletedAt.Valid {
+		return "", nil
+	}
+
+	values, msg, err := externalAttributes(ctx, tx, goodId, []int{categoryId}, g.Attributes)
+	if err != nil || msg != "" {
+		return msg, err
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	changed := false
+
+	if goodId == 0 {
+		query = `
+			INSERT INTO good (good_name, sku, price, stock, attributes, source, external_id)
+			VALUES ($1, NULLIF($2, ''), $3, COALESCE($4, 0), $5, $6, $7)
+			RETURNING id;
+			`
+		err = tx.QueryRowContext(ctx, query, g.GoodName, g.Sku, g.Price, g.Stock, string(encoded), source, g.ExternalId).Scan(&goodId)
+		changed = true
+	} else {
+		var res sql.Result
+		query = `
+			UPDATE good
+			SET good_name = $2, sku = NULLIF($3, ''), price = COALESCE($4, price), stock = COALESCE($5, stock),
+			    attributes = attributes || $6::jsonb
+			WHERE id = $1
+			  AND (good_name, sku, price, stock, attributes)
+			      IS DISTINCT FROM ($2, NULLIF($3, ''), COALESCE($4, price), COALESCE($5, stock), attributes || $6::jsonb);
+			`
+		res, err = tx.ExecContext(ctx, query, goodId, g.GoodName, g.Sku, g.Price, g.Stock, string(encoded))
+		if err == nil {
+			changed, err = affected(res)
+		}
+	}
+	if err != nil {
+		if pgCode(err) == "23505" {
+			return "sku " + strconv.Quote(g.Sku) + " already taken", nil
+		}
+		return "", err
+	}
+
+	query = `INSERT INTO good_category (good_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+	res, err := tx.ExecContext(ctx, query, goodId, categoryId)
+	if err != nil {
+		return "", err
+	}
+	linked, err := affected(res)
+	if err != nil {
+		return "", err
+	}
+	if linked && !changed {
+		if err := touchGood(ctx, tx, goodId); err != nil {
+			return "", err
+		}
+	}
+
+	if changed || linked {
+		if _, err := writeRevision(ctx, tx, goodId, revision.ActionImport, 0, nil); err != nil {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"time"
+)
+
+// GetSourceJobControls returns the admin state of every source job changed at least once.
+func (s *Storage) GetSourceJobControls(ctx context.Context) (map[string]entity.SourceJobControl, error) {
+	const op = "storage.postgres.GetSourceJobControls"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `SELECT source, paused, run_requested, breaker_failures, breaker_open_until FROM source_job;`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	controls := make(map[string]entity.SourceJobControl)
+	for rows.Next() {
+		var (
+			source    string
+			c         entity.SourceJobControl
+			openUntil sql.NullTime
+		)
+		if err := rows.Scan(&source, &c.Paused, &c.RunRequested, &c.Failures, &openUntil); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if openUntil.Valid {
+			c.OpenUntil = &openUntil.Time
+		}
+		controls[source] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return controls, nil
+}
+
+func (s *Storage) GetSourceJobControl(ctx context.Context, source string) (entity.SourceJobControl, error) {
+	const op = "storage.postgres.GetSourceJobControl"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var (
+		c         entity.SourceJobControl
+		openUntil sql.NullTime
+	)
+
+	query := `SELECT paused, run_requested, breaker_failures, breaker_open_until FROM source_job WHERE source = $1;`
+	err := s.db.QueryRowContext(ctx, query, source).Scan(&c.Paused, &c.RunRequested, &c.Failures, &openUntil)
+	if err != nil && err != sql.ErrNoRows {
+		return entity.SourceJobControl{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if openUntil.Valid {
+		c.OpenUntil = &openUntil.Time
+	}
+
+	return c, nil
+}
+
+func (s *Storage) SetSourceJobPaused(ctx context.Context, source string, paused bool) error {
+	const op = "storage.postgres.SetSourceJobPaused"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		INSERT INTO source_job (source, paused, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (source) DO UPDATE
+		SET paused = EXCLUDED.paused, updated_at = EXCLUDED.updated_at;
+		`
+	if _, err := s.db.ExecContext(ctx, query, source, paused); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetSourceBreaker saves the circuit breaker of the source, so that the other replicas report it
+// and the next one to run the job starts from it. A nil openUntil means the breaker is closed.
+func (s *Storage) SetSourceBreaker(ctx context.Context, source string, failures int, openUntil *time.Time) error {
+	const op = "storage.postgres.SetSourceBreaker"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var until sql.NullTime
+	if openUntil != nil {
+		until = sql.NullTime{Time: openUntil.UTC(), Valid: true}
+	}
+
+	query := `
+		INSERT INTO source_job (source, breaker_failures, breaker_open_until, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (source) DO UPDATE
+		SET breaker_failures = EXCLUDED.breaker_failures, breaker_open_until = EXCLUDED.breaker_open_until,
+		    updated_at = EXCLUDED.updated_at;
+		`
+	if _, err := s.db.ExecContext(ctx, query, source, failures, until); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RequestSourceJobRun asks for a run of the source outside its schedule. The request is
+// stored rather than executed, because the job may be running on another replica.
+func (s *Storage) RequestSourceJobRun(ctx context.Context, source string) error {
+	const op = "storage.postgres.RequestSourceJobRun"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		INSERT INTO source_job (source, run_requested, updated_at)
+		VALUES ($1, TRUE, NOW())
+		ON CONFLICT (source) DO UPDATE
+		SET run_requested = TRUE, updated_at = EXCLUDED.updated_at;
+		`
+	if _, err := s.db.ExecContext(ctx, query, source); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeSourceJobRun clears a pending run request and reports whether there was one.
+func (s *Storage) TakeSourceJobRun(ctx context.Context, source string) (bool, error) {
+	const op = "storage.postgres.TakeSourceJobRun"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `UPDATE source_job SET run_requested = FALSE WHERE source = $1 AND run_requested;`
+	res, err := s.db.ExecContext(ctx, query, source)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	taken, err := affected(res)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return taken, nil
+}
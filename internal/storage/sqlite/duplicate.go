@@ -0,0 +1,53 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"inHouseAd/internal/entity"
+)
+
+// GetNearDuplicates pairs live goods whose names have a trigram similarity of at least
+// threshold, most similar first. Variants are left out: they share the name of their good.
+// Trigrams ignore case and punctuation, so names differing only in those score 1.
+func (s *Storage) GetNearDuplicates(ctx context.Context, threshold float64, limit int) ([]entity.NearDuplicate, error) {
+	const op = "storage.sqlite.GetNearDuplicates"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	// similarity is the Go function registered with the driver; every pair is scored,
+	// there is no trigram index to narrow them down.
+	query := `
+		SELECT a_id, a_name, b_id, b_name, score
+		FROM (
+			SELECT a.id AS a_id, a.good_name AS a_name, b.id AS b_id, b.good_name AS b_name,
+			       similarity(a.good_name, b.good_name) AS score
+			FROM good AS a
+			JOIN good AS b ON b.id > a.id
+			WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+			  AND a.parent_id IS NULL AND b.parent_id IS NULL
+		)
+		WHERE score >= ?1
+		ORDER BY score DESC, a_id, b_id
+		LIMIT ?2;
+		`
+	rows, err := s.db.QueryContext(ctx, query, threshold, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	duplicates := []entity.NearDuplicate{}
+	for rows.Next() {
+		var d entity.NearDuplicate
+		if err := rows.Scan(&d.GoodId, &d.GoodName, &d.DuplicateId, &d.DuplicateName, &d.Similarity); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		duplicates = append(duplicates, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return duplicates, nil
+}
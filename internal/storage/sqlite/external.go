@@ -0,0 +1,452 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/revision"
+	"strconv"
+)
+
+// UpsertExternalCategory creates or updates the category the source knows by c.ExternalId and
+// returns its id. The parent must have been upserted before; an unknown parent makes it a root.
+// Nothing is written when the category is already up to date, so re-imports do not bump versions.
+func (s *Storage) UpsertExternalCategory(ctx context.Context, source string, c entity.ExternalCategory) (int, error) {
+	const op = "storage.sqlite.UpsertExternalCategory"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var parentId sql.NullInt64
+	if c.ParentExternalId != "" {
+		query := `SELECT id FROM category WHERE source = ?1 AND external_id = ?2;`
+		err := tx.QueryRowContext(ctx, query, source, c.ParentExternalId).Scan(&parentId)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	var id int
+
+	query := `SELECT id FROM category WHERE source = ?1 AND external_id = ?2;`
+	err = tx.QueryRowContext(ctx, query, source, c.ExternalId).Scan(&id)
+	switch {
+	case err == sql.ErrNoRows:
+		query = `
+			INSERT INTO category (category_name, parent_id, source, external_id)
+			VALUES (?1, ?2, ?3, ?4)
+			RETURNING id;
+			`
+		if err := tx.QueryRowContext(ctx, query, c.Name, parentId, source, c.ExternalId).Scan(&id); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	case err != nil:
+		return 0, fmt.Errorf("%s: %w", op, err)
+	default:
+		query = `
+			UPDATE category
+			SET category_name = ?2, parent_id = ?3
+			WHERE id = ?1 AND (category_name, parent_id) IS NOT (?2, ?3);
+			`
+		if _, err := tx.ExecContext(ctx, query, id, c.Name, parentId); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// UpsertExternalGood creates or updates the good the source knows by g.ExternalId, marking it
+// deleted when g.Deleted is set. Attributes are merged into the existing ones and only links to
+// categories of the same source are replaced, so local edits survive a re-import. Unchanged
+// goods are left alone. A non-empty message means the good was rejected.
+func (s *Storage) UpsertExternalGood(ctx context.Context, source string, g entity.ExternalGood, actorUid int) (string, error) {
+	const op = "storage.sqlite.UpsertExternalGood"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	goodId, err := externalGoodId(ctx, tx, source, g.ExternalId)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if g.Deleted {
+		if goodId != 0 {
+			if err := deleteExternalGood(ctx, tx, goodId, actorUid); err != nil {
+				return "", fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		return "", nil
+	}
+
+	var parentId sql.NullInt64
+	if g.ParentExternalId != "" {
+		id, err := externalGoodId(ctx, tx, source, g.ParentExternalId)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		if id == 0 {
+			return fmt.Sprintf("parent %q not found", g.ParentExternalId), nil
+		}
+		parentId = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	var categoryIds []int
+	for _, externalId := range g.CategoryExternalIds {
+		var id int
+		query := `SELECT id FROM category WHERE source = ?1 AND external_id = ?2 AND deleted_at IS NULL;`
+		err := tx.QueryRowContext(ctx, query, source, externalId).Scan(&id)
+		if err == sql.ErrNoRows {
+			return fmt.Sprintf("group %q not found", externalId), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		categoryIds = append(categoryIds, id)
+	}
+	if len(categoryIds) == 0 && parentId.Valid {
+		query := `SELECT category_id FROM good_category WHERE good_id = ?1 ORDER BY category_id;`
+		if categoryIds, err = queryIds(ctx, tx, query, parentId.Int64); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if len(categoryIds) == 0 {
+		return "good has no group", nil
+	}
+
+	values, msg, err := externalAttributes(ctx, tx, goodId, categoryIds, g.Attributes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if msg != "" {
+		return msg, nil
+	}
+
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	changed := false
+
+	if goodId == 0 {
+		query := `
+			INSERT INTO good (good_name, sku, parent_id, attributes, source, external_id)
+			VALUES (?1, NULLIF(?2, ''), ?3, ?4, ?5, ?6)
+			RETURNING id;
+			`
+		err = tx.QueryRowContext(ctx, query, g.Name, g.Sku, parentId, string(encoded), source, g.ExternalId).Scan(&goodId)
+		changed = true
+	} else {
+		var res sql.Result
+		query := `
+			UPDATE good
+			SET good_name = ?2, sku = NULLIF(?3, ''), parent_id = ?4, attributes = json_patch(attributes, ?5)
+			WHERE id = ?1
+			  AND (good_name, sku, parent_id, attributes) IS NOT (?2, NULLIF(?3, ''), ?4, json_patch(attributes, ?5));
+			`
+		res, err = tx.ExecContext(ctx, query, goodId, g.Name, g.Sku, parentId, string(encoded))
+		if err == nil {
+			changed, err = affected(res)
+		}
+	}
+	if err != nil {
+		if constraint(err) == sqlite3.ErrConstraintUnique {
+			return "sku " + strconv.Quote(g.Sku) + " already taken", nil
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	linked, err := syncExternalCategories(ctx, tx, source, goodId, categoryIds)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if linked && !changed {
+		if err := touchGood(ctx, tx, goodId); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if changed || linked {
+		if _, err := writeRevision(ctx, tx, goodId, revision.ActionImport, actorUid, nil); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return "", nil
+}
+
+// UpsertExternalOffer applies the price, stock and sku of an offer, creating the variant first
+// when the source offers a characteristic of a known good. A non-empty message means the offer
+// was rejected.
+func (s *Storage) UpsertExternalOffer(ctx context.Context, source string, o entity.ExternalOffer, actorUid int) (string, error) {
+	const op = "storage.sqlite.UpsertExternalOffer"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	goodId, err := externalGoodId(ctx, tx, source, o.ExternalId)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	created := false
+
+	if goodId == 0 {
+		if o.ParentExternalId == "" {
+			return fmt.Sprintf("good %q not found", o.ExternalId), nil
+		}
+
+		parentId, err := externalGoodId(ctx, tx, source, o.ParentExternalId)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		if parentId == 0 {
+			return fmt.Sprintf("good %q not found", o.ParentExternalId), nil
+		}
+
+		query := `SELECT category_id FROM good_category WHERE good_id = ?1 ORDER BY category_id;`
+		categoryIds, err := queryIds(ctx, tx, query, parentId)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		values, msg, err := externalAttributes(ctx, tx, parentId, categoryIds, o.Attributes)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		if msg != "" {
+			return msg, nil
+		}
+
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		query = `
+			INSERT INTO good (good_name, parent_id, attributes, source, external_id)
+			SELECT COALESCE(NULLIF(?2, ''), good_name), id, json_patch(attributes, ?3), ?4, ?5
+			FROM good
+			WHERE id = ?1
+			RETURNING id;
+			`
+		if err := tx.QueryRowContext(ctx, query, parentId, o.Name, string(encoded), source, o.ExternalId).Scan(&goodId); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, id := range categoryIds {
+			query = `INSERT INTO good_category (good_id, category_id) VALUES (?1, ?2);`
+			if _, err := tx.ExecContext(ctx, query, goodId, id); err != nil {
+				return "", fmt.Errorf("%s: %w", op, err)
+			}
+		}
+
+		created = true
+	}
+
+	query := `
+		UPDATE good
+		SET price = COALESCE(ROUND(?2, 2), price), stock = COALESCE(?3, stock), sku = COALESCE(NULLIF(?4, ''), sku)
+		WHERE id = ?1
+		  AND (price, stock, sku) IS NOT (COALESCE(ROUND(?2, 2), price), COALESCE(?3, stock), COALESCE(NULLIF(?4, ''), sku));
+		`
+	res, err := tx.ExecContext(ctx, query, goodId, o.Price, o.Stock, o.Sku)
+	if err != nil {
+		if constraint(err) == sqlite3.ErrConstraintUnique {
+			return "sku " + strconv.Quote(o.Sku) + " already taken", nil
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	changed, err := affected(res)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if created || changed {
+		if _, err := writeRevision(ctx, tx, goodId, revision.ActionImport, actorUid, nil); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return "", nil
+}
+
+// externalGoodId returns 0 when the source has not imported the good yet.
+func externalGoodId(ctx context.Context, tx *sql.Tx, source, externalId string) (int, error) {
+	var id int
+
+	query := `SELECT id FROM good WHERE source = ?1 AND external_id = ?2;`
+	err := tx.QueryRowContext(ctx, query, source, externalId).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return id, err
+}
+
+// externalAttributes types raw values against the schemas of the categories. Values without
+// a schema are dropped: external systems carry many properties the catalog does not model.
+// Required attributes are checked against the good's current values (goodId 0 for a new good).
+func externalAttributes(ctx context.Context, tx *sql.Tx, goodId int, categoryIds []int, raw map[string]string) (map[string]any, string, error) {
+	var schemas []entity.CategoryAttribute
+	for _, id := range categoryIds {
+		query := `
+			SELECT id, category_id, name, attr_type, unit, enum_values, required
+			FROM category_attribute
+			WHERE category_id = ?1;
+			`
+		list, err := queryAttributes(ctx, tx, query, id)
+		if err != nil {
+			return nil, "", err
+		}
+		schemas = append(schemas, list...)
+	}
+
+	byName := make(map[string]entity.CategoryAttribute, len(schemas))
+	for _, schema := range schemas {
+		byName[schema.Name] = schema
+	}
+
+	values := make(map[string]any, len(raw))
+	for name, value := range raw {
+		schema, ok := byName[name]
+		if !ok || value == "" {
+			continue
+		}
+		v, err := attr.Parse(schema, value)
+		if err != nil {
+			return nil, err.Error(), nil
+		}
+		values[name] = v
+	}
+
+	merged := make(map[string]any)
+	if goodId != 0 {
+		var current []byte
+		if err := tx.QueryRowContext(ctx, `SELECT attributes FROM good WHERE id = ?1;`, goodId).Scan(&current); err != nil {
+			return nil, "", err
+		}
+		if err := json.Unmarshal(current, &merged); err != nil {
+			return nil, "", err
+		}
+	}
+	for name, v := range values {
+		merged[name] = v
+	}
+
+	if err := attr.Validate(schemas, merged); err != nil {
+		if errors.Is(err, attr.ErrInvalidValue) {
+			return nil, err.Error(), nil
+		}
+		return nil, "", err
+	}
+
+	return values, "", nil
+}
+
+// syncExternalCategories makes the good's links to the source's categories exactly categoryIds
+// and reports whether anything changed. Links to local categories are kept.
+func syncExternalCategories(ctx context.Context, tx *sql.Tx, source string, goodId int, categoryIds []int) (bool, error) {
+	encoded, err := json.Marshal(categoryIds)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		DELETE FROM good_category
+		WHERE good_id = ?1
+		  AND category_id IN (SELECT id FROM category WHERE source = ?2)
+		  AND category_id NOT IN (SELECT value FROM json_each(?3));
+		`
+	res, err := tx.ExecContext(ctx, query, goodId, source, string(encoded))
+	if err != nil {
+		return false, err
+	}
+	changed, err := affected(res)
+	if err != nil {
+		return false, err
+	}
+
+	for _, id := range categoryIds {
+		query = `INSERT INTO good_category (good_id, category_id) VALUES (?1, ?2) ON CONFLICT DO NOTHING;`
+		res, err := tx.ExecContext(ctx, query, goodId, id)
+		if err != nil {
+			return false, err
+		}
+		added, err := affected(res)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || added
+	}
+
+	return changed, nil
+}
+
+// deleteExternalGood moves the good and its variants to the trash like DeleteGood.
+func deleteExternalGood(ctx context.Context, tx *sql.Tx, goodId, actorUid int) error {
+	query := `
+		UPDATE good
+		SET deleted_at = ?2
+		WHERE (id = ?1 OR parent_id = ?1) AND deleted_at IS NULL
+		RETURNING id;
+		`
+	ids, err := queryIds(ctx, tx, query, goodId, now())
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := writeRevision(ctx, tx, id, revision.ActionDelete, actorUid, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func affected(res sql.Result) (bool, error) {
+	n, err := res.RowsAffected()
+	return n != 0, err
+}
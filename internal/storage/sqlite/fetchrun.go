@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"time"
+)
+
+// StartFetchRun records the start of a fetch and returns the run id.
+func (s *Storage) StartFetchRun(ctx context.Context, source, trigger, status string) (int, error) {
+	const op = "storage.sqlite.StartFetchRun"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var id int
+
+	query := `INSERT INTO fetch_run (source, trigger, status, started_at) VALUES (?1, ?2, ?3, ?4) RETURNING id;`
+	if err := s.db.QueryRowContext(ctx, query, source, trigger, status, time.Now().UTC()).Scan(&id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) FinishFetchRun(ctx context.Context, run entity.FetchRun) error {
+	const op = "storage.sqlite.FinishFetchRun"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		UPDATE fetch_run
+		SET status = ?2, attempts = ?3, fetched = ?4, added = ?5, rejected = ?6, error = ?7, finished_at = ?8
+		WHERE id = ?1;
+		`
+	_, err := s.db.ExecContext(ctx, query, run.RunId, run.Status, run.Attempts, run.Fetched, run.Added, run.Rejected, run.Error, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// InterruptFetchRuns closes the runs of the source a previous process left unfinished with
+// the given status.
+func (s *Storage) InterruptFetchRuns(ctx context.Context, source, from, status string) (int, error) {
+	const op = "storage.sqlite.InterruptFetchRuns"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		UPDATE fetch_run
+		SET status = ?2, error = 'interrupted', finished_at = ?3
+		WHERE source = ?4 AND status = ?1;
+		`
+	res, err := s.db.ExecContext(ctx, query, from, status, time.Now().UTC(), source)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(n), nil
+}
+
+// GetFetchRuns returns the latest runs first; an empty source means every source.
+func (s *Storage) GetFetchRuns(ctx context.Context, source string, limit int) ([]entity.FetchRun, error) {
+	const op = "storage.sqlite.GetFetchRuns"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		SELECT id, source, trigger, status, attempts, fetched, added, rejected, error, started_at, finished_at
+		FROM fetch_run
+		WHERE ?1 = '' OR source = ?1
+		ORDER BY id DESC
+		LIMIT ?2;
+		`
+	runs, err := queryFetchRuns(ctx, s.db, query, source, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return runs, nil
+}
+
+// GetLastFetchRuns returns the latest run of every source by its name.
+func (s *Storage) GetLastFetchRuns(ctx context.Context) (map[string]entity.FetchRun, error) {
+	const op = "storage.sqlite.GetLastFetchRuns"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		SELECT id, source, trigger, status, attempts, fetched, added, rejected, error, started_at, finished_at
+		FROM fetch_run
+		WHERE id IN (SELECT max(id) FROM fetch_run GROUP BY source);
+		`
+	runs, err := queryFetchRuns(ctx, s.db, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	bySource := make(map[string]entity.FetchRun, len(runs))
+	for _, r := range runs {
+		bySource[r.Source] = r
+	}
+
+	return bySource, nil
+}
+
+func queryFetchRuns(ctx context.Context, q querier, query string, args ...any) ([]entity.FetchRun, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []entity.FetchRun{}
+	for rows.Next() {
+		var (
+			r          entity.FetchRun
+			finishedAt sql.NullTime
+		)
+		err := rows.Scan(&r.RunId, &r.Source, &r.Trigger, &r.Status, &r.Attempts, &r.Fetched, &r.Added, &r.Rejected, &r.Error, &r.StartedAt, &finishedAt)
+		if err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			r.FinishedAt = &finishedAt.Time
+			duration := finishedAt.Time.Sub(r.StartedAt).Milliseconds()
+			r.DurationMs = &duration
+		}
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
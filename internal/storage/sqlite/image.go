@@ -0,0 +1,315 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/storage"
+)
+
+var ErrInvalidOrder = storage.ErrInvalidOrder
+
+const imageColumns = `id, good_id, blob_key, thumbnails, content_type, size, width, height, position, is_primary`
+
+func (s *Storage) AddGoodImage(ctx context.Context, img entity.GoodImage) (entity.GoodImage, error) {
+	const op = "storage.sqlite.AddGoodImage"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id FROM good WHERE id = ?1 AND deleted_at IS NULL;`
+	if err := tx.QueryRowContext(ctx, query, img.GoodId).Scan(&img.GoodId); err != nil {
+		if err == sql.ErrNoRows {
+			return entity.GoodImage{}, ErrNotFound
+		}
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var count int
+
+	query = `SELECT count(*), COALESCE(MAX(position) + 1, 0) FROM good_image WHERE good_id = ?1;`
+	if err := tx.QueryRowContext(ctx, query, img.GoodId).Scan(&count, &img.Position); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	img.Primary = count == 0
+
+	thumbnails, err := json.Marshal(img.ThumbnailKeys)
+	if err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+		INSERT INTO good_image (good_id, blob_key, thumbnails, content_type, size, width, height, position, is_primary)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+		RETURNING id;
+		`
+	err = tx.QueryRowContext(ctx, query,
+		img.GoodId, img.Key, string(thumbnails), img.ContentType, img.Size, img.Width, img.Height, img.Position, img.Primary,
+	).Scan(&img.ImageId)
+	if err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := touchGood(ctx, tx, img.GoodId); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return img, nil
+}
+
+func (s *Storage) GetGoodImages(ctx context.Context, goodId int) ([]entity.GoodImage, error) {
+	const op = "storage.sqlite.GetGoodImages"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `SELECT ` + imageColumns + ` FROM good_image WHERE good_id = ?1 ORDER BY position, id;`
+
+	images, err := queryImages(ctx, s.db, query, goodId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return images, nil
+}
+
+// DeleteGoodImage removes the image record and returns it so that the caller can drop the blobs.
+// When the primary image is deleted the next one in order becomes primary.
+func (s *Storage) DeleteGoodImage(ctx context.Context, imageId int) (entity.GoodImage, error) {
+	const op = "storage.sqlite.DeleteGoodImage"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM good_image WHERE id = ?1 RETURNING ` + imageColumns + `;`
+
+	img, err := scanImage(tx.QueryRowContext(ctx, query, imageId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return entity.GoodImage{}, ErrNotFound
+		}
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if img.Primary {
+		query = `
+			UPDATE good_image SET is_primary = TRUE
+			WHERE id = (SELECT id FROM good_image WHERE good_id = ?1 ORDER BY position, id LIMIT 1);
+			`
+		if _, err := tx.ExecContext(ctx, query, img.GoodId); err != nil {
+			return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := touchGood(ctx, tx, img.GoodId); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return img, nil
+}
+
+func (s *Storage) ReorderGoodImages(ctx context.Context, goodId int, imageIds []int) ([]entity.GoodImage, error) {
+	const op = "storage.sqlite.ReorderGoodImages"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + imageColumns + ` FROM good_image WHERE good_id = ?1;`
+
+	current, err := queryImages(ctx, tx, query, goodId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(current) != len(imageIds) {
+		return nil, ErrInvalidOrder
+	}
+
+	known := make(map[int]bool, len(current))
+	for _, img := range current {
+		known[img.ImageId] = true
+	}
+
+	for position, id := range imageIds {
+		if !known[id] {
+			return nil, ErrInvalidOrder
+		}
+		delete(known, id)
+
+		query = `UPDATE good_image SET position = ?1 WHERE id = ?2;`
+		if _, err := tx.ExecContext(ctx, query, position, id); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := touchGood(ctx, tx, goodId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `SELECT ` + imageColumns + ` FROM good_image WHERE good_id = ?1 ORDER BY position, id;`
+
+	images, err := queryImages(ctx, tx, query, goodId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return images, nil
+}
+
+func (s *Storage) SetPrimaryImage(ctx context.Context, imageId int) (entity.GoodImage, error) {
+	const op = "storage.sqlite.SetPrimaryImage"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var goodId int
+
+	query := `SELECT good_id FROM good_image WHERE id = ?1;`
+	if err := tx.QueryRowContext(ctx, query, imageId).Scan(&goodId); err != nil {
+		if err == sql.ErrNoRows {
+			return entity.GoodImage{}, ErrNotFound
+		}
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Two statements because the partial unique index allows only one primary image per good at any moment.
+	query = `UPDATE good_image SET is_primary = FALSE WHERE good_id = ?1 AND is_primary;`
+	if _, err := tx.ExecContext(ctx, query, goodId); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `UPDATE good_image SET is_primary = TRUE WHERE id = ?1 RETURNING ` + imageColumns + `;`
+
+	img, err := scanImage(tx.QueryRowContext(ctx, query, imageId))
+	if err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := touchGood(ctx, tx, goodId); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.GoodImage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return img, nil
+}
+
+func queryImages(ctx context.Context, q querier, query string, args ...any) ([]entity.GoodImage, error) {
+	var images []entity.GoodImage
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+func scanImage(row scanner) (entity.GoodImage, error) {
+	var (
+		img        entity.GoodImage
+		thumbnails []byte
+	)
+
+	err := row.Scan(
+		&img.ImageId, &img.GoodId, &img.Key, &thumbnails, &img.ContentType,
+		&img.Size, &img.Width, &img.Height, &img.Position, &img.Primary,
+	)
+	if err != nil {
+		return entity.GoodImage{}, err
+	}
+
+	if err := json.Unmarshal(thumbnails, &img.ThumbnailKeys); err != nil {
+		return entity.GoodImage{}, err
+	}
+
+	return img, nil
+}
+
+// nullImage receives the columns of an optional LEFT JOINed primary image.
+type nullImage struct {
+	id          sql.NullInt64
+	key         sql.NullString
+	thumbnails  []byte
+	contentType sql.NullString
+	size        sql.NullInt64
+	width       sql.NullInt64
+	height      sql.NullInt64
+	position    sql.NullInt64
+}
+
+func (n nullImage) image(goodId int) (*entity.GoodImage, error) {
+	if !n.id.Valid {
+		return nil, nil
+	}
+
+	img := &entity.GoodImage{
+		ImageId:     int(n.id.Int64),
+		GoodId:      goodId,
+		Key:         n.key.String,
+		ContentType: n.contentType.String,
+		Size:        n.size.Int64,
+		Width:       int(n.width.Int64),
+		Height:      int(n.height.Int64),
+		Position:    int(n.position.Int64),
+		Primary:     true,
+	}
+
+	if err := json.Unmarshal(n.thumbnails, &img.ThumbnailKeys); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
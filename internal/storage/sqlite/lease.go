@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AcquireLease takes the lease on a job for ttl, or extends it when holder already has it.
+// It reports false while another holder's lease is unexpired. A single node shares one clock,
+// so expiry is computed here rather than in SQL.
+func (s *Storage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	const op = "storage.sqlite.AcquireLease"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		INSERT INTO job_lease (name, holder, acquired_at, expires_at)
+		VALUES (?1, ?2, ?3, ?4)
+		ON CONFLICT (name) DO UPDATE
+		SET holder = excluded.holder,
+		    acquired_at = CASE WHEN job_lease.holder = excluded.holder THEN job_lease.acquired_at ELSE excluded.acquired_at END,
+		    expires_at = excluded.expires_at
+		WHERE job_lease.holder = excluded.holder OR job_lease.expires_at < ?3
+		RETURNING holder;
+		`
+	t := now()
+
+	var current string
+	err := s.db.QueryRowContext(ctx, query, name, holder, t, t.Add(ttl)).Scan(&current)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+// ReleaseLease gives the lease up, so that another replica can take over without waiting for it
+// to expire.
+func (s *Storage) ReleaseLease(ctx context.Context, name, holder string) error {
+	const op = "storage.sqlite.ReleaseLease"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `DELETE FROM job_lease WHERE name = ?1 AND holder = ?2;`
+	if _, err := s.db.ExecContext(ctx, query, name, holder); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,845 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"inHouseAd/db/migrations"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/signin"
+	"inHouseAd/internal/http-server/handlers/auth/signup"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/migrate"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/lib/role"
+	"inHouseAd/internal/lib/trigram"
+	"inHouseAd/internal/storage"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound        = storage.ErrNotFound
+	ErrAttributeExists = storage.ErrAttributeExists
+	ErrVersionMismatch = storage.ErrVersionMismatch
+)
+
+// Storage keeps the catalog in a single SQLite file. The database runs in WAL mode, so reads
+// go on while a write is in progress; writes wait for each other up to the busy timeout.
+type Storage struct {
+	db       *sql.DB
+	timeouts Timeouts
+}
+
+// Timeouts bound the queries of a storage method: Default applies to every method not listed
+// in Methods by name, e.g. "GetGoodList". Zero means no limit.
+type Timeouts struct {
+	Default time.Duration
+	Methods map[string]time.Duration
+}
+
+// streaming methods hand every row to a callback writing to a client, so how long they take
+// depends on the client; they are not limited unless configured.
+var streaming = map[string]bool{
+	"ExportGoods": true,
+	"FeedGoods":   true,
+}
+
+// driverName is the sqlite3 driver with the SQL functions the queries need on every connection.
+const driverName = "sqlite3_catalog"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("similarity", trigram.Similarity, true)
+		},
+	})
+}
+
+// New opens the database file at path, creating it when missing. A write waits up to
+// busyTimeout for another one to finish before it fails.
+func New(path string, busyTimeout time.Duration, timeouts Timeouts) (*Storage, error) {
+	const op = "storage.sqlite.New"
+
+	// Transactions take the write lock when they begin: a read-then-write transaction that
+	// started as a reader could not be upgraded while another one writes.
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_synchronous", "NORMAL")
+	params.Set("_foreign_keys", "on")
+	params.Set("_busy_timeout", strconv.FormatInt(busyTimeout.Milliseconds(), 10))
+	params.Set("_txlock", "immediate")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	db, err := sql.Open(driverName, "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Storage{db: db, timeouts: timeouts}, nil
+}
+
+// Migrator migrates the database with the embedded migrations. Writes are serialized by the
+// file lock, so no lock is needed beyond the transaction of each migration.
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	dir, err := fs.Sub(migrations.Sqlite, "sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.New(s.db, "sqlite3", dir)
+}
+
+// Close closes the database; it is meant to be called once nothing uses the storage anymore.
+func (s *Storage) Close() {
+	s.db.Close()
+}
+
+// constraint returns the extended code of a failed constraint, 0 for other errors.
+func constraint(err error) sqlite3.ErrNoExtended {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return sqliteErr.ExtendedCode
+	}
+	return 0
+}
+
+func (s *Storage) withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	name := strings.TrimPrefix(op, "storage.sqlite.")
+
+	timeout, ok := s.timeouts.Methods[name]
+	if !ok && !streaming[name] {
+		timeout = s.timeouts.Default
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// now is the time stored in timestamp columns. Timestamps are kept as text in one format and
+// one zone, so that they compare in SQL the way the times do.
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func (s *Storage) Register(ctx context.Context, email string, passwordHashed []byte) (int, error) {
+	return s.CreateUser(ctx, email, passwordHashed, role.User)
+}
+
+func (s *Storage) CreateUser(ctx context.Context, email string, passwordHashed []byte, userRole string) (int, error) {
+	const op = "storage.sqlite.CreateUser"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		INSERT INTO users (email, password_hashed, role) 
+		VALUES (?1, ?2, ?3) 
+		RETURNING id;
+		`
+
+	var id int
+
+	err := s.db.QueryRowContext(ctx, query, email, passwordHashed, userRole).Scan(&id)
+	if err != nil {
+		if constraint(err) == sqlite3.ErrConstraintUnique {
+			return 0, signup.ErrEmailTaken
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// SetPassword replaces the password of the user with the email.
+func (s *Storage) SetPassword(ctx context.Context, email string, passwordHashed []byte) error {
+	const op = "storage.sqlite.SetPassword"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `UPDATE users SET password_hashed = ?2 WHERE email = ?1;`
+
+	res, err := s.db.ExecContext(ctx, query, email, passwordHashed)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) Authorizate(ctx context.Context, email string) ([]byte, int, error) {
+	const op = "storage.sqlite.Authorizate"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		SELECT users.password_hashed, users.id 
+		FROM users 
+		WHERE email = ?1 
+		LIMIT 1;
+		`
+
+	var hash []byte
+	var id int
+
+	err := s.db.QueryRowContext(ctx, query, email).Scan(&hash, &id)
+	if err == sql.ErrNoRows {
+		return nil, 0, signin.ErrInvalidEmail
+	} else if err != nil {
+		if constraint(err) == sqlite3.ErrConstraintUnique {
+			return nil, 0, signup.ErrEmailTaken
+		}
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return hash, id, nil
+}
+
+func (s *Storage) Create(ctx context.Context, name string, uid int) (int, error) {
+	const op = "storage.sqlite.Create"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var id int
+
+	query := `
+		INSERT INTO category (category_name) 
+		VALUES (?1) 
+		RETURNING id;
+		`
+
+	err := s.db.QueryRowContext(ctx, query, name).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// EditCategory renames the category. A non-zero version must match the current one.
+func (s *Storage) EditCategory(ctx context.Context, id int, newName string, version int) (int, error) {
+	const op = "storage.sqlite.EditCategory"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		UPDATE category 
+		SET category_name = ?1 
+		WHERE id = ?2 AND deleted_at IS NULL AND (?3 = 0 OR version = ?3)
+		RETURNING id;
+		`
+
+	err := s.db.QueryRowContext(ctx, query, newName, id, version).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, s.missingOrStale(ctx, "category", id)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// DeleteCategory moves the category to the trash. Its links to goods are kept so that
+// a restore brings them back; they are only dropped when the trash is purged.
+func (s *Storage) DeleteCategory(ctx context.Context, id, version int) error {
+	const op = "storage.sqlite.DeleteCategory"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+			UPDATE category 
+			SET deleted_at = ?3
+       		WHERE id = ?1 AND deleted_at IS NULL AND (?2 = 0 OR version = ?2);
+			`
+
+	res, err := s.db.ExecContext(ctx, query, id, version, now())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return s.missingOrStale(ctx, "category", id)
+	}
+
+	return nil
+}
+
+// missingOrStale tells why a versioned update of a live row matched nothing.
+func (s *Storage) missingOrStale(ctx context.Context, table string, id int) error {
+	var exists bool
+
+	query := `SELECT EXISTS (SELECT 1 FROM ` + table + ` WHERE id = ?1 AND deleted_at IS NULL);`
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	return ErrVersionMismatch
+}
+
+// checkVersion locks the live good and compares its version with the expected one (0 skips the check).
+func checkVersion(ctx context.Context, tx *sql.Tx, goodId, version int) error {
+	var current int
+
+	query := `SELECT version FROM good WHERE id = ?1 AND deleted_at IS NULL;`
+	if err := tx.QueryRowContext(ctx, query, goodId).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	if version != 0 && version != current {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// touchGood bumps the good's version for changes stored outside its row (category links, images).
+func touchGood(ctx context.Context, tx *sql.Tx, goodId int) error {
+	_, err := tx.ExecContext(ctx, `UPDATE good SET version = version + 1 WHERE id = ?1;`, goodId)
+	return err
+}
+
+// AddGood creates the good in the category with the attribute values, which must satisfy
+// the attributes of the category.
+func (s *Storage) AddGood(ctx context.Context, goodName string, categoryId int, attributes map[string]any, actorUid int) (int, string, error) {
+	const op = "storage.sqlite.AddGood"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var (
+		goodId       int
+		categoryName string
+	)
+
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+			INSERT INTO good (good_name, attributes) 
+			VALUES (?1, ?2) 
+			RETURNING id;
+		`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.QueryRowContext(ctx, query, goodName, string(encoded)).Scan(&goodId)
+	if err != nil {
+		tx.Rollback()
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+			INSERT INTO good_category (good_id, category_id) 
+			VALUES (?1, ?2);
+		`
+
+	_, err = tx.ExecContext(ctx, query, goodId, categoryId)
+	if err != nil {
+		tx.Rollback()
+		if constraint(err) == sqlite3.ErrConstraintForeignKey {
+			return 0, "", ErrNotFound
+		}
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+			SELECT category.category_name 
+			FROM category 
+			WHERE id = ?1 AND deleted_at IS NULL
+			LIMIT 1;
+		`
+
+	err = tx.QueryRowContext(ctx, query, categoryId).Scan(&categoryName)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return 0, "", ErrNotFound
+		}
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := validateGood(ctx, tx, goodId); err != nil {
+		tx.Rollback()
+		if errors.Is(err, attr.ErrInvalidValue) {
+			return 0, "", err
+		}
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := writeRevision(ctx, tx, goodId, revision.ActionCreate, actorUid, nil); err != nil {
+		tx.Rollback()
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return goodId, categoryName, nil
+}
+
+func (s *Storage) UpdateGood(ctx context.Context, goodId, categoryIdToAdd int, goodName string, version, actorUid int) (int, []string, string, error) {
+	const op = "storage.sqlite.UpdateGood"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var (
+		rGoodName     string
+		categoryNames []string
+	)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkVersion(ctx, tx, goodId, version); err != nil {
+		if err == ErrNotFound || err == ErrVersionMismatch {
+			return 0, nil, "", err
+		}
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `SELECT good_name FROM good WHERE id = ?1;`
+	if err := tx.QueryRowContext(ctx, query, goodId).Scan(&rGoodName); err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if goodName != "" {
+		query = `UPDATE good SET good_name = ?1 WHERE id = ?2 RETURNING good_name;`
+		if err := tx.QueryRowContext(ctx, query, goodName, goodId).Scan(&rGoodName); err != nil {
+			return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if categoryIdToAdd != 0 {
+		query = `SELECT category_name FROM category WHERE id = ?1 AND deleted_at IS NULL;`
+		var categoryName string
+		if err := tx.QueryRowContext(ctx, query, categoryIdToAdd).Scan(&categoryName); err != nil {
+			if err == sql.ErrNoRows {
+				return 0, nil, "", fmt.Errorf("%s: category not found", op)
+			}
+			return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		query = `INSERT INTO good_category (good_id, category_id) VALUES (?1, ?2);`
+		if _, err := tx.ExecContext(ctx, query, goodId, categoryIdToAdd); err != nil {
+			return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := validateGood(ctx, tx, goodId); err != nil {
+			if errors.Is(err, attr.ErrInvalidValue) {
+				return 0, nil, "", err
+			}
+			return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+
+		if goodName == "" {
+			if err := touchGood(ctx, tx, goodId); err != nil {
+				return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	query = `
+        SELECT c.category_name
+        FROM category AS c
+        JOIN good_category gc ON c.id = gc.category_id
+		WHERE gc.good_id = ?1 AND c.deleted_at IS NULL;
+		`
+	rows, err := tx.QueryContext(ctx, query, goodId)
+	if err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var categoryName string
+		if err := rows.Scan(&categoryName); err != nil {
+			return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		categoryNames = append(categoryNames, categoryName)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := writeRevision(ctx, tx, goodId, revision.ActionUpdate, actorUid, nil); err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return goodId, categoryNames, rGoodName, nil
+}
+
+// DeleteGood moves the good and its variants to the trash with a shared timestamp,
+// which is what RestoreGood uses to bring back exactly the rows deleted together.
+func (s *Storage) DeleteGood(ctx context.Context, id, version, actorUid int) error {
+	const op = "storage.sqlite.DeleteGood"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkVersion(ctx, tx, id, version); err != nil {
+		if err == ErrNotFound || err == ErrVersionMismatch {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+			UPDATE good 
+			SET deleted_at = ?2
+       		WHERE (id = ?1 OR parent_id = ?1) AND deleted_at IS NULL
+			RETURNING id;
+			`
+
+	ids, err := queryIds(ctx, tx, query, id, now())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(ids) == 0 {
+		return ErrNotFound
+	}
+
+	for _, goodId := range ids {
+		if _, err := writeRevision(ctx, tx, goodId, revision.ActionDelete, actorUid, nil); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetGood(ctx context.Context, id int) (entity.GoodDetail, error) {
+	const op = "storage.sqlite.GetGood"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var (
+		good       entity.GoodDetail
+		parentId   sql.NullInt64
+		sku        sql.NullString
+		price      sql.NullFloat64
+		attributes []byte
+	)
+
+	query := `
+		SELECT id, good_name, parent_id, sku, price, stock, attributes, version
+		FROM good
+		WHERE id = ?1 AND deleted_at IS NULL;
+		`
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&good.GoodId, &good.GoodName, &parentId, &sku, &price, &good.Stock, &attributes, &good.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return entity.GoodDetail{}, ErrNotFound
+		}
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := json.Unmarshal(attributes, &good.Attributes); err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	good.ParentId = nullInt(parentId)
+	good.Sku = sku.String
+	good.Price = nullFloat(price)
+
+	query = `
+		SELECT c.id, c.category_name, c.version
+		FROM category AS c
+		JOIN good_category AS gc ON gc.category_id = c.id
+		WHERE gc.good_id = ?1 AND c.deleted_at IS NULL
+		ORDER BY c.id;
+		`
+	rows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	good.Categories = []entity.CategoryList{}
+	for rows.Next() {
+		var c entity.CategoryList
+		if err := rows.Scan(&c.CategoryId, &c.CategoryName, &c.Version); err != nil {
+			return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+		}
+		good.Categories = append(good.Categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	good.Images, err = s.GetGoodImages(ctx, id)
+	if err != nil {
+		return entity.GoodDetail{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if good.Images == nil {
+		good.Images = []entity.GoodImage{}
+	}
+
+	return good, nil
+}
+
+func (s *Storage) GetCategoryList(ctx context.Context) ([]entity.CategoryList, error) {
+	const op = "storage.sqlite.GetCategoryList"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var response []entity.CategoryList
+
+	query := `
+        SELECT id, category_name, parent_id, version
+        FROM category
+        WHERE deleted_at IS NULL
+        ORDER BY id;
+		`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			r        entity.CategoryList
+			parentId sql.NullInt64
+		)
+		if err := rows.Scan(&r.CategoryId, &r.CategoryName, &parentId, &r.Version); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.ParentId = nullInt(parentId)
+		response = append(response, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, nil
+}
+
+func (s *Storage) GetGoodList(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]entity.GoodList, error) {
+	const op = "storage.sqlite.GetGoodList"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var response []entity.GoodList
+
+	query := `
+        SELECT g.id, g.good_name, g.attributes, g.parent_id, g.sku, g.price, g.stock, g.version,
+            (SELECT count(*) FROM good AS v WHERE v.parent_id = g.id AND v.deleted_at IS NULL),
+            gi.id, gi.blob_key, gi.thumbnails, gi.content_type, gi.size, gi.width, gi.height, gi.position
+        FROM good AS g 
+        JOIN good_category AS gc 
+        ON g.id = gc.good_id
+        JOIN category AS c 
+        ON gc.category_id = c.id
+        LEFT JOIN good_image AS gi
+        ON gi.good_id = g.id AND gi.is_primary
+        WHERE gc.category_id = ?1 AND g.deleted_at IS NULL AND c.deleted_at IS NULL`
+	args := []any{categoryId}
+
+	if collapseVariants {
+		query += " AND g.parent_id IS NULL"
+	}
+
+	conditions, args, err := s.filterConditions(ctx, categoryId, filters, collapseVariants, args)
+	if err != nil {
+		if errors.Is(err, attr.ErrInvalidFilter) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	query += conditions
+
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY g.id;", args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			r          entity.GoodList
+			attributes []byte
+			parentId   sql.NullInt64
+			sku        sql.NullString
+			price      sql.NullFloat64
+			img        nullImage
+		)
+		err := rows.Scan(
+			&r.GoodId, &r.GoodName, &attributes, &parentId, &sku, &price, &r.Stock, &r.Version, &r.VariantCount,
+			&img.id, &img.key, &img.thumbnails, &img.contentType, &img.size, &img.width, &img.height, &img.position,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal(attributes, &r.Attributes); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.ParentId = nullInt(parentId)
+		r.Sku = sku.String
+		r.Price = nullFloat(price)
+		r.Image, err = img.image(r.GoodId)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		response = append(response, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, nil
+}
+
+// filterConditions turns attribute filters into SQL conditions on the good aliased "g", typed by
+// the category's schemas. Placeholders continue after args, which are returned extended.
+func (s *Storage) filterConditions(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool, args []any) (string, []any, error) {
+	if len(filters) == 0 {
+		return "", args, nil
+	}
+
+	schemas, err := s.GetAttributeList(ctx, categoryId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	types := make(map[string]string, len(schemas))
+	for _, schema := range schemas {
+		types[schema.Name] = schema.Type
+	}
+
+	var conditions string
+
+	for _, f := range filters {
+		attrType, ok := types[f.Name]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %q is not defined for the category", attr.ErrInvalidFilter, f.Name)
+		}
+
+		alias := "g"
+		if collapseVariants {
+			alias = "f"
+		}
+
+		condition, filterArgs, err := attributeCondition(f, attrType, len(args), alias)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// A collapsed parent matches when the parent itself or any of its variants matches.
+		if collapseVariants {
+			condition = "EXISTS (SELECT 1 FROM good AS f WHERE (f.id = g.id OR f.parent_id = g.id) AND f.deleted_at IS NULL AND " + condition + ")"
+		}
+
+		conditions += " AND " + condition
+		args = append(args, filterArgs...)
+	}
+
+	return conditions, args, nil
+}
+
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+func queryIds(ctx context.Context, q querier, query string, args ...any) ([]int, error) {
+	var ids []int
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,29 @@
+package sqlite
+
+import (
+	"inHouseAd/internal/storage/storagetest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestConformance gives every subtest a fresh database file.
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		s, err := New(filepath.Join(t.TempDir(), "catalog.db"), 5*time.Second, Timeouts{Default: 10 * time.Second})
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(s.Close)
+
+		m, err := s.Migrator()
+		if err != nil {
+			t.Fatalf("Migrator: %v", err)
+		}
+		if err := m.Up(); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+
+		return s
+	})
+}
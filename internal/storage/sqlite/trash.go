@@ -0,0 +1,250 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/storage"
+	"time"
+)
+
+var ErrParentDeleted = storage.ErrParentDeleted
+
+func (s *Storage) GetTrash(ctx context.Context) (entity.Trash, error) {
+	const op = "storage.sqlite.GetTrash"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	trash := entity.Trash{
+		Goods:      []entity.TrashGood{},
+		Categories: []entity.TrashCategory{},
+	}
+
+	query := `
+		SELECT id, good_name, parent_id, deleted_at
+		FROM good
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id;
+		`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return entity.Trash{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			g        entity.TrashGood
+			parentId sql.NullInt64
+		)
+		if err := rows.Scan(&g.GoodId, &g.GoodName, &parentId, &g.DeletedAt); err != nil {
+			return entity.Trash{}, fmt.Errorf("%s: %w", op, err)
+		}
+		g.ParentId = nullInt(parentId)
+		trash.Goods = append(trash.Goods, g)
+	}
+	if err := rows.Err(); err != nil {
+		return entity.Trash{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+		SELECT id, category_name, deleted_at
+		FROM category
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id;
+		`
+	rows, err = s.db.QueryContext(ctx, query)
+	if err != nil {
+		return entity.Trash{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c entity.TrashCategory
+		if err := rows.Scan(&c.CategoryId, &c.CategoryName, &c.DeletedAt); err != nil {
+			return entity.Trash{}, fmt.Errorf("%s: %w", op, err)
+		}
+		trash.Categories = append(trash.Categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return entity.Trash{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return trash, nil
+}
+
+// RestoreGood takes the good out of the trash together with the variants that were deleted with it.
+// Category links are never removed by a soft delete, so they come back as they were.
+func (s *Storage) RestoreGood(ctx context.Context, id, actorUid int) error {
+	const op = "storage.sqlite.RestoreGood"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var parentId sql.NullInt64
+
+	query := `SELECT parent_id FROM good WHERE id = ?1 AND deleted_at IS NOT NULL;`
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&parentId); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if parentId.Valid {
+		var parentDeleted bool
+
+		query = `SELECT deleted_at IS NOT NULL FROM good WHERE id = ?1;`
+		if err := tx.QueryRowContext(ctx, query, parentId.Int64).Scan(&parentDeleted); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if parentDeleted {
+			return ErrParentDeleted
+		}
+	}
+
+	query = `
+		UPDATE good
+		SET deleted_at = NULL
+		WHERE (id = ?1 OR parent_id = ?1)
+		  AND deleted_at = (SELECT deleted_at FROM good WHERE id = ?1)
+		RETURNING id;
+		`
+	ids, err := queryIds(ctx, tx, query, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, goodId := range ids {
+		if _, err := writeRevision(ctx, tx, goodId, revision.ActionRestore, actorUid, nil); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RestoreCategory(ctx context.Context, id int) error {
+	const op = "storage.sqlite.RestoreCategory"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	query := `
+		UPDATE category
+		SET deleted_at = NULL
+		WHERE id = ?1 AND deleted_at IS NOT NULL;
+		`
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// PurgeTrash hard-deletes everything that has been in the trash for longer than retention.
+// The blob keys of the purged goods' images are returned so that the caller can remove the files.
+func (s *Storage) PurgeTrash(ctx context.Context, retention time.Duration) (entity.PurgeResult, error) {
+	const op = "storage.sqlite.PurgeTrash"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var result entity.PurgeResult
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	cutoff := now().Add(-retention)
+
+	query := `
+		SELECT gi.blob_key, gi.thumbnails
+		FROM good_image AS gi
+		JOIN good AS g ON g.id = gi.good_id
+		LEFT JOIN good AS p ON p.id = g.parent_id
+		WHERE g.deleted_at < ?1 OR p.deleted_at < ?1;
+		`
+	rows, err := tx.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key        string
+			thumbnails []byte
+			thumbKeys  map[string]string
+		)
+		if err := rows.Scan(&key, &thumbnails); err != nil {
+			return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal(thumbnails, &thumbKeys); err != nil {
+			return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		result.BlobKeys = append(result.BlobKeys, key)
+		for _, k := range thumbKeys {
+			result.BlobKeys = append(result.BlobKeys, k)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Variants of a purged parent go away through ON DELETE CASCADE.
+	query = `DELETE FROM good WHERE deleted_at < ?1;`
+	res, err := tx.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	result.Goods = int(n)
+
+	query = `DELETE FROM category WHERE deleted_at < ?1;`
+	res, err = tx.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err = res.RowsAffected()
+	if err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	result.Categories = int(n)
+
+	if err := tx.Commit(); err != nil {
+		return entity.PurgeResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,321 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"inHouseAd/internal/entity"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/revision"
+	"inHouseAd/internal/lib/variant"
+	"inHouseAd/internal/storage"
+	"reflect"
+	"strconv"
+)
+
+var (
+	ErrNotParent    = storage.ErrNotParent
+	ErrAxesMismatch = storage.ErrAxesMismatch
+	ErrSkuTaken     = storage.ErrSkuTaken
+)
+
+func (s *Storage) GenerateVariants(ctx context.Context, parentId int, axes []entity.VariantAxis, skuPrefix string, price *float64, stock, actorUid int) ([]entity.GoodVariant, int, error) {
+	const op = "storage.sqlite.GenerateVariants"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var (
+		parentName     string
+		parentParentId sql.NullInt64
+		parentAttrs    []byte
+		declaredAxes   []byte
+		parentSku      sql.NullString
+		created        []entity.GoodVariant
+		skipped        int
+	)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT good_name, parent_id, attributes, variant_axes, sku
+		FROM good
+		WHERE id = ?1 AND deleted_at IS NULL;
+		`
+	err = tx.QueryRowContext(ctx, query, parentId).Scan(&parentName, &parentParentId, &parentAttrs, &declaredAxes, &parentSku)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, ErrNotFound
+		}
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if parentParentId.Valid {
+		return nil, 0, ErrNotParent
+	}
+
+	names := variant.Names(axes)
+
+	var declared []string
+	if err := json.Unmarshal(declaredAxes, &declared); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(declared) != 0 && !reflect.DeepEqual(declared, names) {
+		return nil, 0, ErrAxesMismatch
+	}
+
+	encodedNames, err := json.Marshal(names)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `UPDATE good SET variant_axes = ?1 WHERE id = ?2;`
+	if _, err := tx.ExecContext(ctx, query, string(encodedNames), parentId); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `
+		SELECT ca.id, ca.category_id, ca.name, ca.attr_type, ca.unit, ca.enum_values, ca.required
+		FROM category_attribute AS ca
+		JOIN good_category AS gc ON gc.category_id = ca.category_id
+		JOIN category AS c ON c.id = ca.category_id
+		WHERE gc.good_id = ?1 AND c.deleted_at IS NULL;
+		`
+	schemas, err := queryAttributes(ctx, tx, query, parentId)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	existing, err := variantKeys(ctx, tx, parentId, names)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if skuPrefix == "" {
+		skuPrefix = parentSku.String
+	}
+	if skuPrefix == "" {
+		skuPrefix = "G" + strconv.Itoa(parentId)
+	}
+
+	for _, combination := range variant.Combinations(axes) {
+		if existing[variant.Key(names, combination)] {
+			skipped++
+			continue
+		}
+
+		attributes := map[string]any{}
+		if err := json.Unmarshal(parentAttrs, &attributes); err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+		for k, v := range combination {
+			attributes[k] = v
+		}
+
+		if err := attr.Validate(schemas, attributes); err != nil {
+			return nil, 0, err
+		}
+
+		encoded, err := json.Marshal(attributes)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		v := entity.GoodVariant{
+			ParentId:   &parentId,
+			GoodName:   variant.Name(parentName, names, combination),
+			Sku:        variant.Sku(skuPrefix, names, combination),
+			Price:      price,
+			Stock:      stock,
+			Attributes: attributes,
+		}
+
+		query = `
+			INSERT INTO good (good_name, parent_id, attributes, sku, price, stock)
+			VALUES (?1, ?2, ?3, ?4, ROUND(?5, 2), ?6)
+			RETURNING id, version;
+			`
+		err = tx.QueryRowContext(ctx, query, v.GoodName, parentId, string(encoded), v.Sku, price, stock).Scan(&v.GoodId, &v.Version)
+		if err != nil {
+			if constraint(err) == sqlite3.ErrConstraintUnique {
+				return nil, 0, ErrSkuTaken
+			}
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		query = `
+			INSERT INTO good_category (good_id, category_id)
+			SELECT ?1, category_id FROM good_category WHERE good_id = ?2;
+			`
+		if _, err := tx.ExecContext(ctx, query, v.GoodId, parentId); err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if _, err := writeRevision(ctx, tx, v.GoodId, revision.ActionCreate, actorUid, nil); err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		created = append(created, v)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return created, skipped, nil
+}
+
+func variantKeys(ctx context.Context, tx *sql.Tx, parentId int, names []string) (map[string]bool, error) {
+	keys := make(map[string]bool)
+
+	rows, err := tx.QueryContext(ctx, `SELECT attributes FROM good WHERE parent_id = ?1;`, parentId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			raw        []byte
+			attributes map[string]any
+		)
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &attributes); err != nil {
+			return nil, err
+		}
+
+		combination := make(map[string]string, len(names))
+		for _, name := range names {
+			combination[name] = fmt.Sprint(attributes[name])
+		}
+		keys[variant.Key(names, combination)] = true
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *Storage) GetVariantList(ctx context.Context, parentId int) ([]entity.GoodVariant, error) {
+	const op = "storage.sqlite.GetVariantList"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	var response []entity.GoodVariant
+
+	query := `
+		SELECT id, parent_id, good_name, sku, price, stock, attributes, version
+		FROM good
+		WHERE parent_id = ?1 AND deleted_at IS NULL
+		ORDER BY id;
+		`
+	rows, err := s.db.QueryContext(ctx, query, parentId)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := scanVariant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		response = append(response, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return response, nil
+}
+
+func (s *Storage) UpdateOffer(ctx context.Context, goodId int, sku *string, price *float64, stock *int, version, actorUid int) (entity.GoodVariant, error) {
+	const op = "storage.sqlite.UpdateOffer"
+
+	ctx, cancel := s.withTimeout(ctx, op)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.GoodVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := checkVersion(ctx, tx, goodId, version); err != nil {
+		if err == ErrNotFound || err == ErrVersionMismatch {
+			return entity.GoodVariant{}, err
+		}
+		return entity.GoodVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		UPDATE good
+		SET sku = COALESCE(?2, sku),
+		    price = COALESCE(ROUND(?3, 2), price),
+		    stock = COALESCE(?4, stock)
+		WHERE id = ?1 AND deleted_at IS NULL;
+		`
+	if _, err := tx.ExecContext(ctx, query, goodId, sku, price, stock); err != nil {
+		if constraint(err) == sqlite3.ErrConstraintUnique {
+			return entity.GoodVariant{}, ErrSkuTaken
+		}
+		return entity.GoodVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// RETURNING would report the version from before the bump_version trigger ran.
+	query = `
+		SELECT id, parent_id, good_name, sku, price, stock, attributes, version
+		FROM good
+		WHERE id = ?1 AND deleted_at IS NULL;
+		`
+	v, err := scanVariant(tx.QueryRowContext(ctx, query, goodId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return entity.GoodVariant{}, ErrNotFound
+		}
+		return entity.GoodVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := writeRevision(ctx, tx, goodId, revision.ActionUpdate, actorUid, nil); err != nil {
+		return entity.GoodVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.GoodVariant{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return v, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVariant(row scanner) (entity.GoodVariant, error) {
+	var (
+		v          entity.GoodVariant
+		parentId   sql.NullInt64
+		sku        sql.NullString
+		price      sql.NullFloat64
+		attributes []byte
+	)
+
+	if err := row.Scan(&v.GoodId, &parentId, &v.GoodName, &sku, &price, &v.Stock, &attributes, &v.Version); err != nil {
+		return entity.GoodVariant{}, err
+	}
+	if err := json.Unmarshal(attributes, &v.Attributes); err != nil {
+		return entity.GoodVariant{}, err
+	}
+
+	v.ParentId = nullInt(parentId)
+	v.Sku = sku.String
+	v.Price = nullFloat(price)
+
+	return v, nil
+}
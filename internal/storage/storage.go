@@ -0,0 +1,22 @@
+// Package storage holds what the storage backends share: the errors the handlers tell apart.
+// Every backend returns these values, so a handler checks them the same way whichever is configured.
+package storage
+
+import "errors"
+
+var (
+	ErrNotFound        = errors.New("record not found")
+	ErrAttributeExists = errors.New("attribute already exists")
+	ErrVersionMismatch = errors.New("record was modified since it was read")
+
+	ErrNotParent    = errors.New("good is a variant and cannot have variants")
+	ErrAxesMismatch = errors.New("variant axes differ from the ones already declared")
+	ErrSkuTaken     = errors.New("sku already taken")
+
+	ErrInvalidOrder  = errors.New("image ids must list every image of the good exactly once")
+	ErrParentDeleted = errors.New("parent good is in the trash, restore it first")
+	ErrRevertDeleted = errors.New("revision is a deleted state, delete the good instead")
+
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was already used for a different request")
+)
@@ -0,0 +1,662 @@
+// Package storagetest is the conformance suite of the storage backends: every backend runs it
+// so that the handlers see the same behaviour whichever one is configured. The tests only look
+// at the rows they create, except PurgeTrash, which empties the whole trash: a backend runs the
+// suite against a database of its own.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"inHouseAd/internal/entity"
+	"inHouseAd/internal/http-server/handlers/auth/signin"
+	"inHouseAd/internal/http-server/handlers/auth/signup"
+	attr "inHouseAd/internal/lib/attribute"
+	"inHouseAd/internal/lib/role"
+	"inHouseAd/internal/storage"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Storage is the part of a backend the suite exercises.
+type Storage interface {
+	Register(ctx context.Context, email string, passwordHashed []byte) (int, error)
+	Authorizate(ctx context.Context, email string) ([]byte, int, error)
+	CreateUser(ctx context.Context, email string, passwordHashed []byte, role string) (int, error)
+	SetPassword(ctx context.Context, email string, passwordHashed []byte) error
+	Create(ctx context.Context, name string, uid int) (int, error)
+	EditCategory(ctx context.Context, id int, newName string, version int) (int, error)
+	DeleteCategory(ctx context.Context, id, version int) error
+	GetCategoryList(ctx context.Context) ([]entity.CategoryList, error)
+	AddGood(ctx context.Context, goodName string, categoryId int, attributes map[string]any, actorUid int) (int, string, error)
+	UpdateGood(ctx context.Context, goodId, categoryIdToAdd int, goodName string, version, actorUid int) (int, []string, string, error)
+	DeleteGood(ctx context.Context, id, version, actorUid int) error
+	GetGood(ctx context.Context, id int) (entity.GoodDetail, error)
+	GetGoodList(ctx context.Context, categoryId int, filters []attr.Filter, collapseVariants bool) ([]entity.GoodList, error)
+	GetGoodHistory(ctx context.Context, goodId int) ([]entity.GoodRevision, error)
+	CreateAttribute(ctx context.Context, categoryId int, a entity.CategoryAttribute) (int, error)
+	GetAttributeList(ctx context.Context, categoryId int) ([]entity.CategoryAttribute, error)
+	GenerateVariants(ctx context.Context, parentId int, axes []entity.VariantAxis, skuPrefix string, price *float64, stock, actorUid int) ([]entity.GoodVariant, int, error)
+	GetVariantList(ctx context.Context, parentId int) ([]entity.GoodVariant, error)
+	AddGoodImage(ctx context.Context, img entity.GoodImage) (entity.GoodImage, error)
+	GetGoodImages(ctx context.Context, goodId int) ([]entity.GoodImage, error)
+	RestoreGood(ctx context.Context, id, actorUid int) error
+	RestoreCategory(ctx context.Context, id int) error
+	PurgeTrash(ctx context.Context, retention time.Duration) (entity.PurgeResult, error)
+	ReserveIdempotencyKey(ctx context.Context, uid int, key, requestHash string, ttl, lockTimeout time.Duration) (*entity.IdempotentResponse, error)
+	CompleteIdempotencyKey(ctx context.Context, uid int, key string, response entity.IdempotentResponse) error
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+	GetSourceJobControl(ctx context.Context, source string) (entity.SourceJobControl, error)
+	SetSourceJobPaused(ctx context.Context, source string, paused bool) error
+	SetSourceBreaker(ctx context.Context, source string, failures int, openUntil *time.Time) error
+}
+
+// Run runs the suite against the storage returned by open, which is called once per test.
+func Run(t *testing.T, open func(t *testing.T) Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Storage)
+	}{
+		{"Users", testUsers},
+		{"Categories", testCategories},
+		{"Goods", testGoods},
+		{"Versions", testVersions},
+		{"DeleteCategory", testDeleteCategory},
+		{"DeleteGood", testDeleteGood},
+		{"PurgeTrash", testPurgeTrash},
+		{"Attributes", testAttributes},
+		{"Idempotency", testIdempotency},
+		{"Leases", testLeases},
+		{"SourceBreaker", testSourceBreaker},
+		{"ConcurrentWrites", testConcurrentWrites},
+		{"CanceledContext", testCanceledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+var seq atomic.Int64
+
+// unique makes names that do not collide with earlier runs against the same database.
+func unique(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), seq.Add(1))
+}
+
+func testUsers(t *testing.T, s Storage) {
+	ctx := context.Background()
+	email := unique("user") + "@example.com"
+
+	uid, err := s.Register(ctx, email, []byte("hash"))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	if _, err := s.Register(ctx, email, []byte("other")); !errors.Is(err, signup.ErrEmailTaken) {
+		t.Errorf("Register with a taken email: got %v, want %v", err, signup.ErrEmailTaken)
+	}
+
+	hash, id, err := s.Authorizate(ctx, email)
+	if err != nil {
+		t.Fatalf("Authorizate: %v", err)
+	}
+	if id != uid || string(hash) != "hash" {
+		t.Errorf("Authorizate: got (%q, %d), want (%q, %d)", hash, id, "hash", uid)
+	}
+
+	if _, _, err := s.Authorizate(ctx, unique("nobody")+"@example.com"); !errors.Is(err, signin.ErrInvalidEmail) {
+		t.Errorf("Authorizate an unknown email: got %v, want %v", err, signin.ErrInvalidEmail)
+	}
+
+	if _, err := s.CreateUser(ctx, email, []byte("hash"), role.Admin); !errors.Is(err, signup.ErrEmailTaken) {
+		t.Errorf("CreateUser with a taken email: got %v, want %v", err, signup.ErrEmailTaken)
+	}
+
+	admin := unique("admin") + "@example.com"
+	if _, err := s.CreateUser(ctx, admin, []byte("hash"), role.Admin); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := s.SetPassword(ctx, email, []byte("new")); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if hash, _, err := s.Authorizate(ctx, email); err != nil || string(hash) != "new" {
+		t.Errorf("Authorizate after SetPassword: got (%q, %v), want %q", hash, err, "new")
+	}
+
+	if err := s.SetPassword(ctx, unique("nobody")+"@example.com", []byte("new")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetPassword of an unknown email: got %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func testCategories(t *testing.T, s Storage) {
+	ctx := context.Background()
+	name := unique("category")
+
+	id := mustCreateCategory(t, s, name)
+
+	c, ok := findCategory(t, s, id)
+	if !ok {
+		t.Fatalf("GetCategoryList: category %d not listed", id)
+	}
+	if c.CategoryName != name || c.Version != 1 {
+		t.Errorf("GetCategoryList: got (%q, version %d), want (%q, version 1)", c.CategoryName, c.Version, name)
+	}
+
+	renamed := unique("renamed")
+	if _, err := s.EditCategory(ctx, id, renamed, 1); err != nil {
+		t.Fatalf("EditCategory: %v", err)
+	}
+	if c, _ := findCategory(t, s, id); c.CategoryName != renamed || c.Version != 2 {
+		t.Errorf("EditCategory: got (%q, version %d), want (%q, version 2)", c.CategoryName, c.Version, renamed)
+	}
+
+	if _, err := s.EditCategory(ctx, id, unique("stale"), 1); err != storage.ErrVersionMismatch {
+		t.Errorf("EditCategory with a stale version: got %v, want %v", err, storage.ErrVersionMismatch)
+	}
+	if _, err := s.EditCategory(ctx, -1, unique("missing"), 0); err != storage.ErrNotFound {
+		t.Errorf("EditCategory of a missing category: got %v, want %v", err, storage.ErrNotFound)
+	}
+	if err := s.DeleteCategory(ctx, -1, 0); err != storage.ErrNotFound {
+		t.Errorf("DeleteCategory of a missing category: got %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func testGoods(t *testing.T, s Storage) {
+	ctx := context.Background()
+	categoryName := unique("category")
+	categoryId := mustCreateCategory(t, s, categoryName)
+
+	if _, _, err := s.AddGood(ctx, unique("good"), -1, nil, 0); err != storage.ErrNotFound {
+		t.Errorf("AddGood to a missing category: got %v, want %v", err, storage.ErrNotFound)
+	}
+
+	name := unique("good")
+	goodId, gotCategory, err := s.AddGood(ctx, name, categoryId, nil, 0)
+	if err != nil {
+		t.Fatalf("AddGood: %v", err)
+	}
+	if gotCategory != categoryName {
+		t.Errorf("AddGood: got category %q, want %q", gotCategory, categoryName)
+	}
+
+	g, err := s.GetGood(ctx, goodId)
+	if err != nil {
+		t.Fatalf("GetGood: %v", err)
+	}
+	if g.GoodName != name || g.Version != 1 || len(g.Categories) != 1 || g.Categories[0].CategoryId != categoryId {
+		t.Errorf("GetGood: got %+v", g)
+	}
+
+	list, err := s.GetGoodList(ctx, categoryId, nil, false)
+	if err != nil {
+		t.Fatalf("GetGoodList: %v", err)
+	}
+	if len(list) != 1 || list[0].GoodId != goodId {
+		t.Errorf("GetGoodList: got %+v, want good %d only", list, goodId)
+	}
+
+	otherName := unique("category")
+	otherId := mustCreateCategory(t, s, otherName)
+
+	_, categories, _, err := s.UpdateGood(ctx, goodId, otherId, "", 1, 0)
+	if err != nil {
+		t.Fatalf("UpdateGood: %v", err)
+	}
+	if len(categories) != 2 || categories[0] != categoryName || categories[1] != otherName {
+		t.Errorf("UpdateGood: got categories %q, want %q", categories, []string{categoryName, otherName})
+	}
+
+	if _, err := s.GetGood(ctx, -1); err != storage.ErrNotFound {
+		t.Errorf("GetGood of a missing good: got %v, want %v", err, storage.ErrNotFound)
+	}
+
+	history, err := s.GetGoodHistory(ctx, goodId)
+	if err != nil {
+		t.Fatalf("GetGoodHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Errorf("GetGoodHistory: got %d revisions, want 2", len(history))
+	}
+}
+
+func testVersions(t *testing.T, s Storage) {
+	ctx := context.Background()
+	goodId, _ := mustAddGood(t, s)
+
+	if _, _, _, err := s.UpdateGood(ctx, goodId, 0, unique("renamed"), 1, 0); err != nil {
+		t.Fatalf("UpdateGood: %v", err)
+	}
+	if _, _, _, err := s.UpdateGood(ctx, goodId, 0, unique("stale"), 1, 0); err != storage.ErrVersionMismatch {
+		t.Errorf("UpdateGood with a stale version: got %v, want %v", err, storage.ErrVersionMismatch)
+	}
+	if err := s.DeleteGood(ctx, goodId, 1, 0); err != storage.ErrVersionMismatch {
+		t.Errorf("DeleteGood with a stale version: got %v, want %v", err, storage.ErrVersionMismatch)
+	}
+
+	// Zero skips the check.
+	if err := s.DeleteGood(ctx, goodId, 0, 0); err != nil {
+		t.Errorf("DeleteGood without a version: %v", err)
+	}
+}
+
+func testDeleteCategory(t *testing.T, s Storage) {
+	ctx := context.Background()
+	goodId, categoryId := mustAddGood(t, s)
+
+	otherId := mustCreateCategory(t, s, unique("category"))
+	if _, _, _, err := s.UpdateGood(ctx, goodId, otherId, "", 0, 0); err != nil {
+		t.Fatalf("UpdateGood: %v", err)
+	}
+
+	if err := s.DeleteCategory(ctx, categoryId, 0); err != nil {
+		t.Fatalf("DeleteCategory: %v", err)
+	}
+
+	if _, ok := findCategory(t, s, categoryId); ok {
+		t.Errorf("GetCategoryList: deleted category %d still listed", categoryId)
+	}
+	if list, err := s.GetGoodList(ctx, categoryId, nil, false); err != nil || len(list) != 0 {
+		t.Errorf("GetGoodList of a deleted category: got (%+v, %v), want nothing", list, err)
+	}
+	if _, _, err := s.AddGood(ctx, unique("good"), categoryId, nil, 0); err != storage.ErrNotFound {
+		t.Errorf("AddGood to a deleted category: got %v, want %v", err, storage.ErrNotFound)
+	}
+
+	// The good stays, it only leaves the deleted category.
+	g, err := s.GetGood(ctx, goodId)
+	if err != nil {
+		t.Fatalf("GetGood: %v", err)
+	}
+	if len(g.Categories) != 1 || g.Categories[0].CategoryId != otherId {
+		t.Errorf("GetGood: got categories %+v, want only %d", g.Categories, otherId)
+	}
+
+	if err := s.RestoreCategory(ctx, categoryId); err != nil {
+		t.Fatalf("RestoreCategory: %v", err)
+	}
+	if list, err := s.GetGoodList(ctx, categoryId, nil, false); err != nil || len(list) != 1 || list[0].GoodId != goodId {
+		t.Errorf("GetGoodList of a restored category: got (%+v, %v), want good %d", list, err, goodId)
+	}
+	if err := s.RestoreCategory(ctx, categoryId); err != storage.ErrNotFound {
+		t.Errorf("RestoreCategory of a live category: got %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func testDeleteGood(t *testing.T, s Storage) {
+	ctx := context.Background()
+	goodId, categoryId := mustAddGood(t, s)
+
+	variants := mustGenerateVariants(t, s, goodId, categoryId)
+
+	if err := s.DeleteGood(ctx, goodId, 0, 0); err != nil {
+		t.Fatalf("DeleteGood: %v", err)
+	}
+
+	for _, id := range append([]int{goodId}, variantIds(variants)...) {
+		if _, err := s.GetGood(ctx, id); err != storage.ErrNotFound {
+			t.Errorf("GetGood %d after its good was deleted: got %v, want %v", id, err, storage.ErrNotFound)
+		}
+	}
+	if list, err := s.GetGoodList(ctx, categoryId, nil, false); err != nil || len(list) != 0 {
+		t.Errorf("GetGoodList after delete: got (%+v, %v), want nothing", list, err)
+	}
+	if err := s.DeleteGood(ctx, goodId, 0, 0); err != storage.ErrNotFound {
+		t.Errorf("DeleteGood of a deleted good: got %v, want %v", err, storage.ErrNotFound)
+	}
+
+	if err := s.RestoreGood(ctx, variants[0].GoodId, 0); err != storage.ErrParentDeleted {
+		t.Errorf("RestoreGood of a variant of a deleted good: got %v, want %v", err, storage.ErrParentDeleted)
+	}
+
+	if err := s.RestoreGood(ctx, goodId, 0); err != nil {
+		t.Fatalf("RestoreGood: %v", err)
+	}
+	restored, err := s.GetVariantList(ctx, goodId)
+	if err != nil {
+		t.Fatalf("GetVariantList: %v", err)
+	}
+	if len(restored) != len(variants) {
+		t.Errorf("GetVariantList after restore: got %d variants, want %d", len(restored), len(variants))
+	}
+}
+
+func testPurgeTrash(t *testing.T, s Storage) {
+	ctx := context.Background()
+	goodId, categoryId := mustAddGood(t, s)
+	variants := mustGenerateVariants(t, s, goodId, categoryId)
+
+	key := unique("image")
+	if _, err := s.AddGoodImage(ctx, entity.GoodImage{GoodId: goodId, Key: key, ContentType: "image/png", ThumbnailKeys: map[string]string{}}); err != nil {
+		t.Fatalf("AddGoodImage: %v", err)
+	}
+
+	if err := s.DeleteGood(ctx, goodId, 0, 0); err != nil {
+		t.Fatalf("DeleteGood: %v", err)
+	}
+	if err := s.DeleteCategory(ctx, categoryId, 0); err != nil {
+		t.Fatalf("DeleteCategory: %v", err)
+	}
+
+	// Let the deletions age past a zero retention.
+	time.Sleep(10 * time.Millisecond)
+
+	result, err := s.PurgeTrash(ctx, 0)
+	if err != nil {
+		t.Fatalf("PurgeTrash: %v", err)
+	}
+	if !contains(result.BlobKeys, key) {
+		t.Errorf("PurgeTrash: blob keys %q miss %q", result.BlobKeys, key)
+	}
+
+	for _, id := range append([]int{goodId}, variantIds(variants)...) {
+		if _, err := s.GetGoodHistory(ctx, id); err != storage.ErrNotFound {
+			t.Errorf("GetGoodHistory %d after purge: got %v, want %v", id, err, storage.ErrNotFound)
+		}
+		if err := s.RestoreGood(ctx, id, 0); err != storage.ErrNotFound {
+			t.Errorf("RestoreGood %d after purge: got %v, want %v", id, err, storage.ErrNotFound)
+		}
+	}
+	if images, err := s.GetGoodImages(ctx, goodId); err != nil || len(images) != 0 {
+		t.Errorf("GetGoodImages after purge: got (%+v, %v), want nothing", images, err)
+	}
+	if err := s.RestoreCategory(ctx, categoryId); err != storage.ErrNotFound {
+		t.Errorf("RestoreCategory after purge: got %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func testAttributes(t *testing.T, s Storage) {
+	ctx := context.Background()
+	categoryId := mustCreateCategory(t, s, unique("category"))
+
+	a := entity.CategoryAttribute{Name: "color", Type: attr.TypeEnum, EnumValues: []string{"red", "blue"}}
+
+	if _, err := s.CreateAttribute(ctx, -1, a); err != storage.ErrNotFound {
+		t.Errorf("CreateAttribute in a missing category: got %v, want %v", err, storage.ErrNotFound)
+	}
+
+	id, err := s.CreateAttribute(ctx, categoryId, a)
+	if err != nil {
+		t.Fatalf("CreateAttribute: %v", err)
+	}
+	if _, err := s.CreateAttribute(ctx, categoryId, a); err != storage.ErrAttributeExists {
+		t.Errorf("CreateAttribute twice: got %v, want %v", err, storage.ErrAttributeExists)
+	}
+
+	list, err := s.GetAttributeList(ctx, categoryId)
+	if err != nil {
+		t.Fatalf("GetAttributeList: %v", err)
+	}
+	if len(list) != 1 || list[0].AttributeId != id || list[0].Name != "color" {
+		t.Errorf("GetAttributeList: got %+v, want attribute %d", list, id)
+	}
+
+	// A good joins a category only with the values the category requires.
+	requiring := mustCreateCategory(t, s, unique("category"))
+	size := entity.CategoryAttribute{Name: "size", Type: attr.TypeString, Required: true}
+	if _, err := s.CreateAttribute(ctx, requiring, size); err != nil {
+		t.Fatalf("CreateAttribute: %v", err)
+	}
+
+	goodId, _ := mustAddGood(t, s)
+	if _, _, _, err := s.UpdateGood(ctx, goodId, requiring, "", 0, 0); !errors.Is(err, attr.ErrInvalidValue) {
+		t.Errorf("UpdateGood into a category with a required attribute: got %v, want %v", err, attr.ErrInvalidValue)
+	}
+	if _, categories, _, err := s.UpdateGood(ctx, goodId, categoryId, "", 0, 0); err != nil || len(categories) != 2 {
+		t.Errorf("UpdateGood into a category with optional attributes: got (%q, %v), want two categories", categories, err)
+	}
+
+	// So is a good created in one.
+	if _, _, err := s.AddGood(ctx, unique("good"), requiring, nil, 0); !errors.Is(err, attr.ErrInvalidValue) {
+		t.Errorf("AddGood without a required attribute: got %v, want %v", err, attr.ErrInvalidValue)
+	}
+	if _, _, err := s.AddGood(ctx, unique("good"), requiring, map[string]any{"size": 42.0}, 0); !errors.Is(err, attr.ErrInvalidValue) {
+		t.Errorf("AddGood with an invalid attribute: got %v, want %v", err, attr.ErrInvalidValue)
+	}
+	if _, _, err := s.AddGood(ctx, unique("good"), requiring, map[string]any{"size": "M"}, 0); err != nil {
+		t.Errorf("AddGood with the required attribute: %v", err)
+	}
+
+	// A category whose goods lack a value does not get an attribute requiring it.
+	material := entity.CategoryAttribute{Name: "material", Type: attr.TypeString, Required: true}
+	if _, err := s.CreateAttribute(ctx, categoryId, material); !errors.Is(err, attr.ErrInvalidValue) {
+		t.Errorf("CreateAttribute required by a category with goods: got %v, want %v", err, attr.ErrInvalidValue)
+	}
+	material.Required = false
+	if _, err := s.CreateAttribute(ctx, categoryId, material); err != nil {
+		t.Errorf("CreateAttribute optional in a category with goods: %v", err)
+	}
+	width := entity.CategoryAttribute{Name: "width", Type: attr.TypeNumber, Required: true}
+	if _, err := s.CreateAttribute(ctx, mustCreateCategory(t, s, unique("category")), width); err != nil {
+		t.Errorf("CreateAttribute required by an empty category: %v", err)
+	}
+}
+
+func testIdempotency(t *testing.T, s Storage) {
+	ctx := context.Background()
+	key := unique("key")
+
+	if r, err := s.ReserveIdempotencyKey(ctx, 1, key, "hash", time.Hour, time.Minute); err != nil || r != nil {
+		t.Fatalf("ReserveIdempotencyKey: got (%+v, %v), want a reservation", r, err)
+	}
+	if _, err := s.ReserveIdempotencyKey(ctx, 1, key, "hash", time.Hour, time.Minute); err != storage.ErrIdempotencyInProgress {
+		t.Errorf("ReserveIdempotencyKey while in progress: got %v, want %v", err, storage.ErrIdempotencyInProgress)
+	}
+
+	response := entity.IdempotentResponse{StatusCode: 201, Body: []byte("created")}
+	if err := s.CompleteIdempotencyKey(ctx, 1, key, response); err != nil {
+		t.Fatalf("CompleteIdempotencyKey: %v", err)
+	}
+
+	r, err := s.ReserveIdempotencyKey(ctx, 1, key, "hash", time.Hour, time.Minute)
+	if err != nil || r == nil || r.StatusCode != 201 || string(r.Body) != "created" {
+		t.Errorf("ReserveIdempotencyKey of a finished request: got (%+v, %v), want the stored response", r, err)
+	}
+	if _, err := s.ReserveIdempotencyKey(ctx, 1, key, "other", time.Hour, time.Minute); err != storage.ErrIdempotencyKeyReused {
+		t.Errorf("ReserveIdempotencyKey with another request: got %v, want %v", err, storage.ErrIdempotencyKeyReused)
+	}
+
+	// Keys belong to a user.
+	if r, err := s.ReserveIdempotencyKey(ctx, 2, key, "other", time.Hour, time.Minute); err != nil || r != nil {
+		t.Errorf("ReserveIdempotencyKey for another user: got (%+v, %v), want a reservation", r, err)
+	}
+}
+
+func testLeases(t *testing.T, s Storage) {
+	ctx := context.Background()
+	name := unique("lease")
+
+	if ok, err := s.AcquireLease(ctx, name, "a", time.Minute); err != nil || !ok {
+		t.Fatalf("AcquireLease: got (%t, %v), want true", ok, err)
+	}
+	if ok, err := s.AcquireLease(ctx, name, "b", time.Minute); err != nil || ok {
+		t.Errorf("AcquireLease held by another: got (%t, %v), want false", ok, err)
+	}
+	if ok, err := s.AcquireLease(ctx, name, "a", time.Minute); err != nil || !ok {
+		t.Errorf("AcquireLease renewal: got (%t, %v), want true", ok, err)
+	}
+
+	if err := s.ReleaseLease(ctx, name, "b"); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	if ok, _ := s.AcquireLease(ctx, name, "b", time.Minute); ok {
+		t.Errorf("AcquireLease after another holder's release: got true, want false")
+	}
+
+	if err := s.ReleaseLease(ctx, name, "a"); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	if ok, err := s.AcquireLease(ctx, name, "b", time.Minute); err != nil || !ok {
+		t.Errorf("AcquireLease after release: got (%t, %v), want true", ok, err)
+	}
+}
+
+func testSourceBreaker(t *testing.T, s Storage) {
+	ctx := context.Background()
+	source := unique("source")
+
+	if err := s.SetSourceJobPaused(ctx, source, true); err != nil {
+		t.Fatalf("SetSourceJobPaused: %v", err)
+	}
+
+	openUntil := time.Now().Add(time.Minute).UTC().Truncate(time.Millisecond)
+	if err := s.SetSourceBreaker(ctx, source, 3, &openUntil); err != nil {
+		t.Fatalf("SetSourceBreaker: %v", err)
+	}
+
+	c, err := s.GetSourceJobControl(ctx, source)
+	if err != nil {
+		t.Fatalf("GetSourceJobControl: %v", err)
+	}
+	if !c.Paused || c.Failures != 3 || c.OpenUntil == nil || !c.OpenUntil.Equal(openUntil) {
+		t.Errorf("open breaker: got paused %t, %d failures, open until %v, want true, 3, %v", c.Paused, c.Failures, c.OpenUntil, openUntil)
+	}
+
+	if err := s.SetSourceBreaker(ctx, source, 0, nil); err != nil {
+		t.Fatalf("SetSourceBreaker: %v", err)
+	}
+
+	c, err = s.GetSourceJobControl(ctx, source)
+	if err != nil {
+		t.Fatalf("GetSourceJobControl: %v", err)
+	}
+	if !c.Paused || c.Failures != 0 || c.OpenUntil != nil {
+		t.Errorf("closed breaker: got paused %t, %d failures, open until %v, want true, 0, none", c.Paused, c.Failures, c.OpenUntil)
+	}
+}
+
+func testConcurrentWrites(t *testing.T, s Storage) {
+	ctx := context.Background()
+	categoryId := mustCreateCategory(t, s, unique("category"))
+
+	const writers = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := s.AddGood(ctx, unique("good"), categoryId, nil, 0); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	// Registrations of one email race for it; exactly one wins.
+	email := unique("user") + "@example.com"
+	var registered atomic.Int32
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Register(ctx, email, []byte("hash"))
+			switch {
+			case err == nil:
+				registered.Add(1)
+			case !errors.Is(err, signup.ErrEmailTaken):
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent write: %v", err)
+	}
+
+	if n := registered.Load(); n != 1 {
+		t.Errorf("concurrent Register: %d succeeded, want 1", n)
+	}
+	if list, err := s.GetGoodList(ctx, categoryId, nil, false); err != nil || len(list) != writers {
+		t.Errorf("GetGoodList after concurrent AddGood: got %d goods (%v), want %d", len(list), err, writers)
+	}
+}
+
+func testCanceledContext(t *testing.T, s Storage) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.Create(ctx, unique("category"), 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Create with a canceled context: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func mustCreateCategory(t *testing.T, s Storage, name string) int {
+	t.Helper()
+
+	id, err := s.Create(context.Background(), name, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return id
+}
+
+// mustAddGood adds a good to a new category and returns both ids.
+func mustAddGood(t *testing.T, s Storage) (int, int) {
+	t.Helper()
+
+	categoryId := mustCreateCategory(t, s, unique("category"))
+	goodId, _, err := s.AddGood(context.Background(), unique("good"), categoryId, nil, 0)
+	if err != nil {
+		t.Fatalf("AddGood: %v", err)
+	}
+	return goodId, categoryId
+}
+
+// mustGenerateVariants gives the good two sizes; the axis is defined in the good's category first.
+func mustGenerateVariants(t *testing.T, s Storage, goodId, categoryId int) []entity.GoodVariant {
+	t.Helper()
+
+	size := entity.CategoryAttribute{Name: "size", Type: attr.TypeEnum, EnumValues: []string{"S", "M"}}
+	if _, err := s.CreateAttribute(context.Background(), categoryId, size); err != nil {
+		t.Fatalf("CreateAttribute: %v", err)
+	}
+
+	axes := []entity.VariantAxis{{Name: "size", Values: []string{"S", "M"}}}
+	variants, _, err := s.GenerateVariants(context.Background(), goodId, axes, unique("sku"), nil, 0, 0)
+	if err != nil {
+		t.Fatalf("GenerateVariants: %v", err)
+	}
+	return variants
+}
+
+func findCategory(t *testing.T, s Storage, id int) (entity.CategoryList, bool) {
+	t.Helper()
+
+	list, err := s.GetCategoryList(context.Background())
+	if err != nil {
+		t.Fatalf("GetCategoryList: %v", err)
+	}
+	for _, c := range list {
+		if c.CategoryId == id {
+			return c, true
+		}
+	}
+	return entity.CategoryList{}, false
+}
+
+func variantIds(variants []entity.GoodVariant) []int {
+	ids := make([]int, 0, len(variants))
+	for _, v := range variants {
+		ids = append(ids, v.GoodId)
+	}
+	return ids
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}